@@ -9,6 +9,17 @@ import (
 )
 
 // MaxBytes of an ABI object. Defaults to 32 MB.
+//
+// The maximum number of bytes passed to Marshal and Unmarshal is a budget that
+// is shared by everything that is marshaled or unmarshaled with it. Every
+// Marshal and Unmarshal consumes exactly SizeHint bytes of the budget, and
+// returns the remaining budget. The budget is checked before anything is
+// written, read, or allocated, and the remaining budget must always be
+// positive, so a value can only be marshaled or unmarshaled if its SizeHint is
+// less than the budget. Otherwise, surge.ErrMaxBytesExceeded is returned. The
+// only exception is a list of elements with an empty binary encoding, such as
+// empty records, which also consumes one byte for every element, so that the
+// length of every list is bounded by the budget.
 var MaxBytes = 32 * 1024 * 1024
 
 // A Type identifier is used to identify types over storage/network boundaries.
@@ -107,7 +118,7 @@ func (Type) SizeHint() int {
 // the specified maximum number of bytes. If it needs to allocate too many
 // bytes, and error may be returned instead.
 func (ty Type) Marshal(w io.Writer, m int) (int, error) {
-	return surge.Marshal(w, uint16(ty), m)
+	return marshalWithin(w, uint16(ty), ty.SizeHint(), m)
 }
 
 // Unmarshal the Type from binary. Unmarshaling will not allocate more than the
@@ -116,7 +127,7 @@ func (ty Type) Marshal(w io.Writer, m int) (int, error) {
 func (ty *Type) Unmarshal(r io.Reader, m int) (int, error) {
 	var ok bool
 	var i uint16
-	m, err := surge.Unmarshal(r, &i, m)
+	m, err := unmarshalWithin(r, &i, ty.SizeHint(), m)
 	if err != nil {
 		return m, err
 	}
@@ -188,9 +199,190 @@ func (ty Type) String() string {
 type Value interface {
 	surge.Marshaler
 	json.Marshaler
+
+	// Type returns the type identifier.
+	Type() Type
 }
 
-// SizeHint returns the number of bytes required to represent a value in binary.
+// SizeHint returns the number of bytes required to represent a value in
+// binary, together with its TypeDesc.
 func SizeHint(v Value) int {
-	return 2 + v.SizeHint()
+	return DescOf(v).SizeHint() + v.SizeHint()
+}
+
+// marshalWithin marshals a value of the given size using surge. The budget is
+// checked before anything is written, and the remaining budget is returned.
+func marshalWithin(w io.Writer, v interface{}, size, m int) (int, error) {
+	if m <= size {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	if _, err := surge.Marshal(w, v, m); err != nil {
+		return m, err
+	}
+	return m - size, nil
+}
+
+// unmarshalWithin unmarshals a value of the given size using surge. The budget
+// is checked before anything is read, and the remaining budget is returned.
+func unmarshalWithin(r io.Reader, v interface{}, size, m int) (int, error) {
+	if m <= size {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	if _, err := surge.Unmarshal(r, v, m); err != nil {
+		return m, err
+	}
+	return m - size, nil
+}
+
+// writeWithin writes fixed size data. The budget is checked before anything is
+// written, and the remaining budget is returned.
+func writeWithin(w io.Writer, data []byte, m int) (int, error) {
+	if m <= len(data) {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	if _, err := w.Write(data); err != nil {
+		return m, err
+	}
+	return m - len(data), nil
+}
+
+// readWithin reads fixed size data. The budget is checked before anything is
+// read, and the remaining budget is returned.
+func readWithin(r io.Reader, data []byte, m int) (int, error) {
+	if m <= len(data) {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	if _, err := io.ReadFull(r, data); err != nil {
+		return m, err
+	}
+	return m - len(data), nil
+}
+
+// isPrimitive returns true if the Type is a bytes or scalar type.
+func isPrimitive(ty Type) bool {
+	switch ty {
+	case TypeString, TypeBytes, TypeBytes32, TypeBytes65:
+		return true
+	case TypeBool, TypeU8, TypeU16, TypeU32, TypeU64, TypeU128, TypeU256:
+		return true
+	default:
+		return false
+	}
+}
+
+// newPrimitive returns a pointer to the zero value of a bytes or scalar Type,
+// which can be unmarshaled into. An error is returned if the Type is not a
+// bytes or scalar type.
+func newPrimitive(ty Type) (interface{}, error) {
+	switch ty {
+	case TypeString:
+		return new(String), nil
+	case TypeBytes:
+		return new(Bytes), nil
+	case TypeBytes32:
+		return new(Bytes32), nil
+	case TypeBytes65:
+		return new(Bytes65), nil
+	case TypeBool:
+		return new(Bool), nil
+	case TypeU8:
+		return new(U8), nil
+	case TypeU16:
+		return new(U16), nil
+	case TypeU32:
+		return new(U32), nil
+	case TypeU64:
+		return new(U64), nil
+	case TypeU128:
+		return new(U128), nil
+	case TypeU256:
+		return new(U256), nil
+	default:
+		return nil, fmt.Errorf("non-exhaustive pattern: Type(%v)", ty)
+	}
+}
+
+// pointee returns the Value that is pointed to by a pointer returned by
+// newPrimitive.
+func pointee(ptr interface{}) Value {
+	switch ptr := ptr.(type) {
+	case *String:
+		return *ptr
+	case *Bytes:
+		return *ptr
+	case *Bytes32:
+		return *ptr
+	case *Bytes65:
+		return *ptr
+	case *Bool:
+		return *ptr
+	case *U8:
+		return *ptr
+	case *U16:
+		return *ptr
+	case *U32:
+		return *ptr
+	case *U64:
+		return *ptr
+	case *U128:
+		return *ptr
+	case *U256:
+		return *ptr
+	default:
+		panic(fmt.Sprintf("non-exhaustive pattern: %T", ptr))
+	}
+}
+
+// unmarshalValue unmarshals a Value of the given Type from binary. An error is
+// returned if the Type is not a bytes or scalar type.
+func unmarshalValue(r io.Reader, ty Type, m int) (Value, int, error) {
+	var err error
+	switch ty {
+	case TypeString:
+		v := String("")
+		m, err = v.Unmarshal(r, m)
+		return v, m, err
+	case TypeBytes:
+		v := Bytes{}
+		m, err = v.Unmarshal(r, m)
+		return v, m, err
+	case TypeBytes32:
+		v := Bytes32{}
+		m, err = v.Unmarshal(r, m)
+		return v, m, err
+	case TypeBytes65:
+		v := Bytes65{}
+		m, err = v.Unmarshal(r, m)
+		return v, m, err
+	case TypeBool:
+		v := Bool{}
+		m, err = v.Unmarshal(r, m)
+		return v, m, err
+	case TypeU8:
+		v := U8{}
+		m, err = v.Unmarshal(r, m)
+		return v, m, err
+	case TypeU16:
+		v := U16{}
+		m, err = v.Unmarshal(r, m)
+		return v, m, err
+	case TypeU32:
+		v := U32{}
+		m, err = v.Unmarshal(r, m)
+		return v, m, err
+	case TypeU64:
+		v := U64{}
+		m, err = v.Unmarshal(r, m)
+		return v, m, err
+	case TypeU128:
+		v := U128{}
+		m, err = v.Unmarshal(r, m)
+		return v, m, err
+	case TypeU256:
+		v := U256{}
+		m, err = v.Unmarshal(r, m)
+		return v, m, err
+	default:
+		return nil, m, fmt.Errorf("non-exhaustive pattern: Type(%v)", ty)
+	}
 }
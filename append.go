@@ -0,0 +1,241 @@
+package abi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// AppendBinary appends the binary encoding of the string to dst, and returns
+// the extended slice. The encoding is the same as Marshal.
+func (str String) AppendBinary(dst []byte) ([]byte, error) {
+	if uint64(len(str)) > uint64(^uint32(0)) {
+		return dst, fmt.Errorf("overflow: string len=%v", len(str))
+	}
+	dst = appendUint32(dst, uint32(len(str)))
+	return append(dst, str...), nil
+}
+
+// DecodeFrom decodes the string from the start of src, and returns the rest of
+// src. The length of src bounds the number of bytes that are allocated, so no
+// maximum number of bytes is needed.
+func (str *String) DecodeFrom(src []byte) ([]byte, error) {
+	data, rest, err := decodeVariable(src)
+	if err != nil {
+		return src, err
+	}
+	*str = String(data)
+	return rest, nil
+}
+
+// AppendBinary appends the binary encoding of the bytes to dst, and returns the
+// extended slice. The encoding is the same as Marshal.
+func (b Bytes) AppendBinary(dst []byte) ([]byte, error) {
+	if uint64(len(b)) > uint64(^uint32(0)) {
+		return dst, fmt.Errorf("overflow: bytes len=%v", len(b))
+	}
+	dst = appendUint32(dst, uint32(len(b)))
+	return append(dst, b...), nil
+}
+
+// DecodeFrom decodes the bytes from the start of src, and returns the rest of
+// src. The bytes are copied, so src can be reused. The length of src bounds
+// the number of bytes that are allocated, so no maximum number of bytes is
+// needed.
+func (b *Bytes) DecodeFrom(src []byte) ([]byte, error) {
+	data, rest, err := decodeVariable(src)
+	if err != nil {
+		return src, err
+	}
+	*b = append(make(Bytes, 0, len(data)), data...)
+	return rest, nil
+}
+
+// AppendBinary appends the binary encoding of the Bytes32 to dst, and returns
+// the extended slice. The encoding is the same as Marshal.
+func (b32 Bytes32) AppendBinary(dst []byte) ([]byte, error) {
+	return append(dst, b32[:]...), nil
+}
+
+// DecodeFrom decodes the Bytes32 from the start of src, and returns the rest of
+// src.
+func (b32 *Bytes32) DecodeFrom(src []byte) ([]byte, error) {
+	if len(src) < 32 {
+		return src, io.ErrUnexpectedEOF
+	}
+	copy(b32[:], src)
+	return src[32:], nil
+}
+
+// AppendBinary appends the binary encoding of the Bytes65 to dst, and returns
+// the extended slice. The encoding is the same as Marshal.
+func (b65 Bytes65) AppendBinary(dst []byte) ([]byte, error) {
+	return append(dst, b65[:]...), nil
+}
+
+// DecodeFrom decodes the Bytes65 from the start of src, and returns the rest of
+// src.
+func (b65 *Bytes65) DecodeFrom(src []byte) ([]byte, error) {
+	if len(src) < 65 {
+		return src, io.ErrUnexpectedEOF
+	}
+	copy(b65[:], src)
+	return src[65:], nil
+}
+
+// AppendBinary appends the binary encoding of the Bool to dst, and returns the
+// extended slice. The encoding is the same as Marshal.
+func (b Bool) AppendBinary(dst []byte) ([]byte, error) {
+	if b.inner {
+		return append(dst, 1), nil
+	}
+	return append(dst, 0), nil
+}
+
+// DecodeFrom decodes the Bool from the start of src, and returns the rest of
+// src. Any non-zero byte is decoded as true, in the same way as Unmarshal.
+func (b *Bool) DecodeFrom(src []byte) ([]byte, error) {
+	if len(src) < 1 {
+		return src, io.ErrUnexpectedEOF
+	}
+	b.inner = src[0] != 0
+	return src[1:], nil
+}
+
+// AppendBinary appends the binary encoding of the U8 to dst, and returns the
+// extended slice. The encoding is the same as Marshal.
+func (u8 U8) AppendBinary(dst []byte) ([]byte, error) {
+	return append(dst, u8.inner), nil
+}
+
+// DecodeFrom decodes the U8 from the start of src, and returns the rest of src.
+func (u8 *U8) DecodeFrom(src []byte) ([]byte, error) {
+	if len(src) < 1 {
+		return src, io.ErrUnexpectedEOF
+	}
+	u8.inner = src[0]
+	return src[1:], nil
+}
+
+// AppendBinary appends the binary encoding of the U16 to dst, and returns the
+// extended slice. The encoding is the same as Marshal.
+func (u16 U16) AppendBinary(dst []byte) ([]byte, error) {
+	return append(dst, byte(u16.inner>>8), byte(u16.inner)), nil
+}
+
+// DecodeFrom decodes the U16 from the start of src, and returns the rest of
+// src.
+func (u16 *U16) DecodeFrom(src []byte) ([]byte, error) {
+	if len(src) < 2 {
+		return src, io.ErrUnexpectedEOF
+	}
+	u16.inner = binary.BigEndian.Uint16(src)
+	return src[2:], nil
+}
+
+// AppendBinary appends the binary encoding of the U32 to dst, and returns the
+// extended slice. The encoding is the same as Marshal.
+func (u32 U32) AppendBinary(dst []byte) ([]byte, error) {
+	return appendUint32(dst, u32.inner), nil
+}
+
+// DecodeFrom decodes the U32 from the start of src, and returns the rest of
+// src.
+func (u32 *U32) DecodeFrom(src []byte) ([]byte, error) {
+	if len(src) < 4 {
+		return src, io.ErrUnexpectedEOF
+	}
+	u32.inner = binary.BigEndian.Uint32(src)
+	return src[4:], nil
+}
+
+// AppendBinary appends the binary encoding of the U64 to dst, and returns the
+// extended slice. The encoding is the same as Marshal.
+func (u64 U64) AppendBinary(dst []byte) ([]byte, error) {
+	x := u64.inner
+	return append(dst, byte(x>>56), byte(x>>48), byte(x>>40), byte(x>>32), byte(x>>24), byte(x>>16), byte(x>>8), byte(x)), nil
+}
+
+// DecodeFrom decodes the U64 from the start of src, and returns the rest of
+// src.
+func (u64 *U64) DecodeFrom(src []byte) ([]byte, error) {
+	if len(src) < 8 {
+		return src, io.ErrUnexpectedEOF
+	}
+	u64.inner = binary.BigEndian.Uint64(src)
+	return src[8:], nil
+}
+
+// AppendBinary appends the binary encoding of the U128 to dst, and returns the
+// extended slice. The encoding is the same as Marshal. The integer is written
+// directly into dst, without an intermediate array.
+func (u128 U128) AppendBinary(dst []byte) ([]byte, error) {
+	return appendPadded(dst, u128.inner, 16)
+}
+
+// DecodeFrom decodes the U128 from the start of src, and returns the rest of
+// src.
+func (u128 *U128) DecodeFrom(src []byte) ([]byte, error) {
+	if len(src) < 16 {
+		return src, io.ErrUnexpectedEOF
+	}
+	if u128.inner == nil {
+		u128.inner = new(big.Int)
+	}
+	u128.inner.SetBytes(src[:16])
+	return src[16:], nil
+}
+
+// AppendBinary appends the binary encoding of the U256 to dst, and returns the
+// extended slice. The encoding is the same as Marshal. The integer is written
+// directly into dst, without an intermediate array.
+func (u256 U256) AppendBinary(dst []byte) ([]byte, error) {
+	return appendPadded(dst, u256.inner, 32)
+}
+
+// DecodeFrom decodes the U256 from the start of src, and returns the rest of
+// src.
+func (u256 *U256) DecodeFrom(src []byte) ([]byte, error) {
+	if len(src) < 32 {
+		return src, io.ErrUnexpectedEOF
+	}
+	if u256.inner == nil {
+		u256.inner = new(big.Int)
+	}
+	u256.inner.SetBytes(src[:32])
+	return src[32:], nil
+}
+
+// appendUint32 appends a uint32 to dst in big endian.
+func appendUint32(dst []byte, x uint32) []byte {
+	return append(dst, byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
+}
+
+// appendPadded appends a big integer to dst as a big endian integer padded to
+// the given number of bytes. A nil integer is treated as zero. An error is
+// returned if the integer does not fit.
+func appendPadded(dst []byte, bigint *big.Int, size int) ([]byte, error) {
+	if bigint != nil && bigint.BitLen() > 8*size {
+		return dst, fmt.Errorf("overflow: expected n<=%v, got n=%v", size, (bigint.BitLen()+7)/8)
+	}
+	n := len(dst)
+	dst = append(dst, make([]byte, size)...)
+	if bigint != nil {
+		readBits(bigint, dst[n:])
+	}
+	return dst, nil
+}
+
+// decodeVariable decodes a length prefixed byte slice from the start of src,
+// and returns the data and the rest of src. The data is a slice of src.
+func decodeVariable(src []byte) ([]byte, []byte, error) {
+	if len(src) < 4 {
+		return nil, src, io.ErrUnexpectedEOF
+	}
+	n := uint64(binary.BigEndian.Uint32(src))
+	if n > uint64(len(src)-4) {
+		return nil, src, io.ErrUnexpectedEOF
+	}
+	return src[4 : 4+n], src[4+n:], nil
+}
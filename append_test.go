@@ -0,0 +1,225 @@
+package abi_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Append", func() {
+	type appender interface {
+		abi.Value
+		AppendBinary(dst []byte) ([]byte, error)
+	}
+
+	Context("when appending", func() {
+		It("should produce the same bytes as marshaling", func() {
+			f := func(x uint64, y [32]byte, z []byte, s string, b bool, prefix []byte) bool {
+				vs := []appender{
+					abi.String(s),
+					abi.Bytes(z),
+					abi.Bytes32(y),
+					abi.Bytes65{y[0], y[1]},
+					abi.NewBool(b),
+					abi.NewU8(uint8(x)),
+					abi.NewU16(uint16(x)),
+					abi.NewU32(uint32(x)),
+					abi.NewU64(x),
+					abi.NewU128FromU64(abi.NewU64(x)),
+					abi.NewU256(y),
+				}
+				for _, v := range vs {
+					expected, err := surge.ToBinary(v)
+					Expect(err).ToNot(HaveOccurred())
+					actual, err := v.AppendBinary(append([]byte{}, prefix...))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(actual[:len(prefix)]).To(Equal(prefix))
+					Expect(actual[len(prefix):]).To(Equal(expected))
+				}
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should treat nil integers as zero", func() {
+			data, err := abi.U256{}.AppendBinary(nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(make([]byte, 32)))
+			data, err = abi.U128{}.AppendBinary(nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(make([]byte, 16)))
+		})
+	})
+
+	Context("when decoding", func() {
+		It("should return the same values as unmarshaling, and the rest", func() {
+			f := func(x uint64, y [32]byte, z []byte, s string, b bool, suffix []byte) bool {
+				str := abi.String(s)
+				bs := abi.Bytes(z)
+				b32 := abi.Bytes32(y)
+				b65 := abi.Bytes65{y[31]}
+				bl := abi.NewBool(b)
+				u8 := abi.NewU8(uint8(x))
+				u16 := abi.NewU16(uint16(x))
+				u32 := abi.NewU32(uint32(x))
+				u64 := abi.NewU64(x)
+				u128 := abi.NewU128FromU64(abi.NewU64(x))
+				u256 := abi.NewU256(y)
+
+				buf := new(bytes.Buffer)
+				_, err := surge.Marshal(buf, []interface{}{str, bs, b32, b65, bl, u8, u16, u32, u64, u128, u256}, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				src := append(buf.Bytes()[4:], suffix...)
+
+				var (
+					decodedStr  abi.String
+					decodedBs   abi.Bytes
+					decodedB32  abi.Bytes32
+					decodedB65  abi.Bytes65
+					decodedBl   abi.Bool
+					decodedU8   abi.U8
+					decodedU16  abi.U16
+					decodedU32  abi.U32
+					decodedU64  abi.U64
+					decodedU128 abi.U128
+					decodedU256 abi.U256
+				)
+				for _, v := range []interface {
+					DecodeFrom(src []byte) ([]byte, error)
+				}{&decodedStr, &decodedBs, &decodedB32, &decodedB65, &decodedBl, &decodedU8, &decodedU16, &decodedU32, &decodedU64, &decodedU128, &decodedU256} {
+					src, err = v.DecodeFrom(src)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(src).To(Equal(suffix))
+
+				Expect(decodedStr).To(Equal(str))
+				Expect([]byte(decodedBs)).To(Equal([]byte(bs)))
+				Expect(decodedB32).To(Equal(b32))
+				Expect(decodedB65).To(Equal(b65))
+				Expect(decodedBl).To(Equal(bl))
+				Expect(decodedU8).To(Equal(u8))
+				Expect(decodedU16).To(Equal(u16))
+				Expect(decodedU32).To(Equal(u32))
+				Expect(decodedU64).To(Equal(u64))
+				Expect(decodedU128.Equal(u128)).To(BeTrue())
+				Expect(decodedU256.Equal(u256)).To(BeTrue())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should return an error when the data is too short", func() {
+			data, err := abi.String("hello").AppendBinary(nil)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < len(data); i++ {
+				str := abi.String("")
+				rest, err := str.DecodeFrom(data[:i])
+				Expect(err).To(Equal(io.ErrUnexpectedEOF))
+				Expect(rest).To(Equal(data[:i]))
+			}
+
+			u256 := abi.U256{}
+			_, err = u256.DecodeFrom(make([]byte, 31))
+			Expect(err).To(Equal(io.ErrUnexpectedEOF))
+		})
+
+		It("should not alias the source", func() {
+			data, err := abi.Bytes{1, 2, 3}.AppendBinary(nil)
+			Expect(err).ToNot(HaveOccurred())
+			b := abi.Bytes{}
+			_, err = b.DecodeFrom(data)
+			Expect(err).ToNot(HaveOccurred())
+			data[4] = 42
+			Expect(b).To(Equal(abi.Bytes{1, 2, 3}))
+		})
+	})
+})
+
+func benchmarkValues() []abi.Value {
+	b32 := [32]byte{}
+	for i := range b32 {
+		b32[i] = byte(i)
+	}
+	return []abi.Value{
+		abi.NewU64(1 << 40),
+		abi.NewU128FromU64(abi.NewU64(1 << 40)),
+		abi.NewU256(b32),
+		abi.Bytes32(b32),
+		abi.Bytes65{},
+		abi.Bytes(b32[:]),
+		abi.String("hello, world"),
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	vs := benchmarkValues()
+	buf := bytes.NewBuffer(make([]byte, 0, 1024))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		for _, v := range vs {
+			if _, err := v.Marshal(buf, abi.MaxBytes); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkAppendBinary(b *testing.B) {
+	vs := benchmarkValues()
+	type appender interface {
+		AppendBinary(dst []byte) ([]byte, error)
+	}
+	dst := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dst = dst[:0]
+		for _, v := range vs {
+			var err error
+			if dst, err = v.(appender).AppendBinary(dst); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkUnmarshalU256(b *testing.B) {
+	data, err := abi.NewU256([32]byte{1}).AppendBinary(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	u256 := abi.U256{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		if _, err := u256.Unmarshal(r, abi.MaxBytes); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeFromU256(b *testing.B) {
+	data, err := abi.NewU256([32]byte{1}).AppendBinary(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	u256 := abi.U256{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := u256.DecodeFrom(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package abi_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"runtime"
+	"testing"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// A countingReader counts the number of bytes that are read from it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+// Read implements the I/O reader interface.
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += n
+	return n, err
+}
+
+// A countingWriter counts the number of bytes that are written to it.
+type countingWriter struct {
+	n int
+}
+
+// Write implements the I/O writer interface.
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n += len(p)
+	return len(p), nil
+}
+
+var _ = Describe("Maximum number of bytes", func() {
+	types := []abi.Type{
+		abi.TypeString, abi.TypeBytes, abi.TypeBytes32, abi.TypeBytes65,
+		abi.TypeBool, abi.TypeU8, abi.TypeU16, abi.TypeU32, abi.TypeU64, abi.TypeU128, abi.TypeU256,
+	}
+
+	for _, ty := range types {
+		ty := ty
+
+		Context(ty.String(), func() {
+			Context("when marshaling", func() {
+				It("should consume the size of the value", func() {
+					f := func(seed int64, extra uint16) bool {
+						v := abi.RandomValue(rand.New(rand.NewSource(seed)), abi.NewTypeDesc(ty))
+						m := v.SizeHint() + 1 + int(extra)
+						cw := new(countingWriter)
+						rem, err := v.Marshal(cw, m)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(cw.n).To(Equal(v.SizeHint()))
+						Expect(rem).To(Equal(m - v.SizeHint()))
+						return true
+					}
+					Expect(quick.Check(f, nil)).To(Succeed())
+				})
+
+				It("should not write anything when the maximum number of bytes is exceeded", func() {
+					f := func(seed int64) bool {
+						v := abi.RandomValue(rand.New(rand.NewSource(seed)), abi.NewTypeDesc(ty))
+						cw := new(countingWriter)
+						rem, err := v.Marshal(cw, v.SizeHint())
+						Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+						Expect(cw.n).To(Equal(0))
+						Expect(rem).To(Equal(v.SizeHint()))
+						return true
+					}
+					Expect(quick.Check(f, nil)).To(Succeed())
+				})
+			})
+
+			Context("when unmarshaling", func() {
+				It("should consume the size of the value", func() {
+					f := func(seed int64, extra uint16) bool {
+						v := abi.RandomValue(rand.New(rand.NewSource(seed)), abi.NewTypeDesc(ty))
+						data, err := surge.ToBinary(v)
+						Expect(err).ToNot(HaveOccurred())
+
+						m := v.SizeHint() + 1 + int(extra)
+						cr := &countingReader{r: bytes.NewReader(data)}
+						rem, err := newVectorValue(ty).Unmarshal(cr, m)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(cr.n).To(Equal(v.SizeHint()))
+						Expect(rem).To(Equal(m - v.SizeHint()))
+						return true
+					}
+					Expect(quick.Check(f, nil)).To(Succeed())
+				})
+
+				It("should only read the length prefix when the maximum number of bytes is exceeded", func() {
+					f := func(seed int64) bool {
+						v := abi.RandomValue(rand.New(rand.NewSource(seed)), abi.NewTypeDesc(ty))
+						data, err := surge.ToBinary(v)
+						Expect(err).ToNot(HaveOccurred())
+
+						cr := &countingReader{r: bytes.NewReader(data)}
+						_, err = newVectorValue(ty).Unmarshal(cr, v.SizeHint())
+						Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+						if ty == abi.TypeString || ty == abi.TypeBytes {
+							Expect(cr.n).To(BeNumerically("<=", 4))
+						} else {
+							Expect(cr.n).To(Equal(0))
+						}
+						return true
+					}
+					Expect(quick.Check(f, nil)).To(Succeed())
+				})
+
+				It("should not allocate when the maximum number of bytes is exceeded", func() {
+					v := abi.RandomValue(rand.New(rand.NewSource(GinkgoRandomSeed())), abi.NewTypeDesc(ty))
+					data, err := surge.ToBinary(v)
+					Expect(err).ToNot(HaveOccurred())
+					if ty == abi.TypeString || ty == abi.TypeBytes {
+						// Claim a length that would be far too large to
+						// allocate.
+						data = []byte{0xff, 0xff, 0xff, 0xff}
+					}
+
+					r := bytes.NewReader(data)
+					ptr := newVectorValue(ty)
+					unmarshal := func() {
+						r.Reset(data)
+						if _, err := ptr.Unmarshal(r, v.SizeHint()); err != surge.ErrMaxBytesExceeded {
+							panic(err)
+						}
+					}
+					if ty == abi.TypeString || ty == abi.TypeBytes {
+						// The length prefix is read into small buffers, but
+						// the data itself must never be allocated.
+						before := new(runtime.MemStats)
+						runtime.ReadMemStats(before)
+						for i := 0; i < 100; i++ {
+							unmarshal()
+						}
+						after := new(runtime.MemStats)
+						runtime.ReadMemStats(after)
+						Expect(after.TotalAlloc - before.TotalAlloc).To(BeNumerically("<", 100*64))
+					} else {
+						Expect(testing.AllocsPerRun(100, unmarshal)).To(Equal(0.0))
+					}
+				})
+			})
+		})
+	}
+
+	Context("when marshaling and unmarshaling many values with a shared maximum number of bytes", func() {
+		It("should consume the sum of their sizes", func() {
+			f := func(seed int64) bool {
+				r := rand.New(rand.NewSource(seed))
+				vs := make([]abi.Value, r.Intn(10))
+				size := 0
+				for i := range vs {
+					vs[i] = abi.RandomValue(r, abi.NewTypeDesc(types[r.Intn(len(types))]))
+					size += vs[i].SizeHint()
+				}
+
+				buf := new(bytes.Buffer)
+				m := size + 1
+				for _, v := range vs {
+					var err error
+					m, err = v.Marshal(buf, m)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(m).To(Equal(1))
+				Expect(buf.Len()).To(Equal(size))
+
+				m = size + 1
+				for _, v := range vs {
+					var err error
+					m, err = newVectorValue(v.Type()).Unmarshal(buf, m)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(m).To(Equal(1))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
+})
@@ -27,14 +27,18 @@ func (str String) SizeHint() int {
 // than the specified maximum number of bytes. If it needs to allocate too many
 // bytes, and error may be returned instead.
 func (str String) Marshal(w io.Writer, m int) (int, error) {
-	return surge.Marshal(w, string(str), m)
+	return marshalWithin(w, string(str), str.SizeHint(), m)
 }
 
 // Unmarshal the string from binary. Unmarshaling will not allocate more than
 // the specified maximum number of bytes. If it needs to allocate too many
 // bytes, and error is returned instead.
 func (str *String) Unmarshal(r io.Reader, m int) (int, error) {
-	return surge.Unmarshal(r, (*string)(str), m)
+	// The length prefix is consumed here, and surge consumes the length.
+	if m <= 4 {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	return surge.Unmarshal(r, (*string)(str), m-4)
 }
 
 // MarshalJSON implements the JSON marshaler interface.
@@ -47,6 +51,12 @@ func (str *String) UnmarshalJSON(data []byte) error {
 	return json.Unmarshal(data, (*string)(str))
 }
 
+// String returns the string without quotes or escaping. Use FormatText for a
+// representation that can be parsed.
+func (str String) String() string {
+	return string(str)
+}
+
 type Bytes []byte
 
 func (b Bytes) Type() Type {
@@ -58,11 +68,15 @@ func (b Bytes) SizeHint() int {
 }
 
 func (b Bytes) Marshal(w io.Writer, m int) (int, error) {
-	return surge.Marshal(w, []byte(b), m)
+	return marshalWithin(w, []byte(b), b.SizeHint(), m)
 }
 
 func (b *Bytes) Unmarshal(r io.Reader, m int) (int, error) {
-	return surge.Unmarshal(r, (*[]byte)(b), m)
+	// The length prefix is consumed here, and surge consumes the length.
+	if m <= 4 {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	return surge.Unmarshal(r, (*[]byte)(b), m-4)
 }
 
 func (b Bytes) MarshalJSON() ([]byte, error) {
@@ -89,7 +103,7 @@ func (b Bytes) String() string {
 type Bytes32 [32]byte
 
 func (b32 Bytes32) Type() Type {
-	return TypeBytes
+	return TypeBytes32
 }
 
 func (b32 Bytes32) SizeHint() int {
@@ -97,13 +111,11 @@ func (b32 Bytes32) SizeHint() int {
 }
 
 func (b32 Bytes32) Marshal(w io.Writer, m int) (int, error) {
-	n, err := w.Write(b32[:])
-	return m - n, err
+	return writeWithin(w, b32[:], m)
 }
 
 func (b32 *Bytes32) Unmarshal(r io.Reader, m int) (int, error) {
-	_, err := io.ReadFull(r, (*b32)[:])
-	return m, err
+	return readWithin(r, (*b32)[:], m)
 }
 
 func (b32 Bytes32) MarshalJSON() ([]byte, error) {
@@ -133,7 +145,7 @@ func (b32 Bytes32) String() string {
 type Bytes65 [65]byte
 
 func (b65 Bytes65) Type() Type {
-	return TypeBytes
+	return TypeBytes65
 }
 
 func (b65 Bytes65) SizeHint() int {
@@ -141,13 +153,11 @@ func (b65 Bytes65) SizeHint() int {
 }
 
 func (b65 Bytes65) Marshal(w io.Writer, m int) (int, error) {
-	n, err := w.Write(b65[:])
-	return m - n, err
+	return writeWithin(w, b65[:], m)
 }
 
 func (b65 *Bytes65) Unmarshal(r io.Reader, m int) (int, error) {
-	_, err := io.ReadFull(r, (*b65)[:])
-	return m, err
+	return readWithin(r, (*b65)[:], m)
 }
 
 func (b65 Bytes65) MarshalJSON() ([]byte, error) {
@@ -0,0 +1,318 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// MarshalCanonicalJSON marshals a Value to canonical JSON, as defined by the
+// JSON Canonicalization Scheme (RFC 8785). Object keys are sorted by their
+// UTF-16 code units, insignificant whitespace is removed, strings use the
+// minimal escaping, and numbers use the ECMAScript number format. The output is
+// deterministic, so it can be hashed and signed by clients that cannot produce
+// the binary format.
+//
+// JSON strings must be valid Unicode, and the standard JSON encoding replaces
+// invalid UTF-8 with the replacement character, which would give different
+// values the same canonical JSON. So, an error is returned if a String, or the
+// name of a record field, is not valid UTF-8.
+func MarshalCanonicalJSON(v Value) ([]byte, error) {
+	if err := Walk(v, utf8Visitor{}); err != nil {
+		return nil, err
+	}
+	data, err := v.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return CanonicalizeJSON(data)
+}
+
+// CanonicalizeJSON converts JSON into canonical JSON, as defined by the JSON
+// Canonicalization Scheme (RFC 8785). An error is returned if the JSON is
+// malformed, contains duplicate object keys, contains numbers that cannot be
+// represented as IEEE 754 doubles, or contains strings that are not valid
+// Unicode (invalid UTF-8, or escaped surrogates that are not paired).
+func CanonicalizeJSON(data []byte) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("malformed: json is not valid utf-8")
+	}
+	if err := checkJSONSurrogates(data); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	buf := new(bytes.Buffer)
+	if err := canonicalizeJSONValue(dec, buf); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("malformed: unexpected data after json value")
+	}
+	return buf.Bytes(), nil
+}
+
+// canonicalizeJSONValue reads the next JSON value from the decoder and writes
+// its canonical form to the buffer.
+func canonicalizeJSONValue(dec *json.Decoder, buf *bytes.Buffer) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			return canonicalizeJSONObject(dec, buf)
+		case '[':
+			return canonicalizeJSONArray(dec, buf)
+		}
+		return fmt.Errorf("malformed: unexpected %v", tok)
+	case string:
+		writeCanonicalJSONString(buf, tok)
+	case json.Number:
+		f, err := strconv.ParseFloat(string(tok), 64)
+		if err != nil {
+			return err
+		}
+		str, err := formatCanonicalJSONNumber(f)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(str)
+	case bool:
+		buf.WriteString(strconv.FormatBool(tok))
+	case nil:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+// canonicalizeJSONObject writes the members of an object, after its opening
+// delimiter has been read, with the keys in sorted order.
+func canonicalizeJSONObject(dec *json.Decoder, buf *bytes.Buffer) error {
+	type member struct {
+		key   string
+		value []byte
+	}
+	members := []member{}
+	seen := map[string]struct{}{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("malformed: duplicate json key %q", key)
+		}
+		seen[key] = struct{}{}
+		value := new(bytes.Buffer)
+		if err := canonicalizeJSONValue(dec, value); err != nil {
+			return err
+		}
+		members = append(members, member{key: key, value: value.Bytes()})
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return lessUTF16(members[i].key, members[j].key)
+	})
+	buf.WriteByte('{')
+	for i, member := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeCanonicalJSONString(buf, member.key)
+		buf.WriteByte(':')
+		buf.Write(member.value)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// canonicalizeJSONArray writes the elements of an array, after its opening
+// delimiter has been read.
+func canonicalizeJSONArray(dec *json.Decoder, buf *bytes.Buffer) error {
+	buf.WriteByte('[')
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := canonicalizeJSONValue(dec, buf); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// writeCanonicalJSONString writes a string using the minimal escaping required
+// by RFC 8785: quotation marks, reverse solidi, and control characters are
+// escaped, and everything else is written as UTF-8.
+func writeCanonicalJSONString(buf *bytes.Buffer, str string) {
+	buf.WriteByte('"')
+	for _, r := range str {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// formatCanonicalJSONNumber formats a number using the ECMAScript
+// Number.prototype.toString algorithm, as required by RFC 8785.
+func formatCanonicalJSONNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("malformed: json number %v", f)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+
+	sign := ""
+	if f < 0 {
+		sign, f = "-", -f
+	}
+
+	// Find the shortest decimal digits that round-trip, and the position of
+	// the decimal point relative to those digits.
+	str := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp := str[:strings.IndexByte(str, 'e')], str[strings.IndexByte(str, 'e')+1:]
+	digits := strings.Replace(mantissa, ".", "", 1)
+	e, err := strconv.Atoi(exp)
+	if err != nil {
+		return "", err
+	}
+	k, n := len(digits), e+1
+
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k), nil
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:], nil
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits, nil
+	}
+	expSign := "+"
+	if n-1 < 0 {
+		expSign = "-"
+	}
+	expAbs := n - 1
+	if expAbs < 0 {
+		expAbs = -expAbs
+	}
+	if k == 1 {
+		return fmt.Sprintf("%v%ve%v%v", sign, digits, expSign, expAbs), nil
+	}
+	return fmt.Sprintf("%v%v.%ve%v%v", sign, digits[:1], digits[1:], expSign, expAbs), nil
+}
+
+// lessUTF16 compares two strings by their UTF-16 code units.
+func lessUTF16(a, b string) bool {
+	x, y := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if x[i] != y[i] {
+			return x[i] < y[i]
+		}
+	}
+	return len(x) < len(y)
+}
+
+// checkJSONSurrogates returns an error if a JSON string has an escaped UTF-16
+// surrogate that is not part of a pair. The JSON decoder replaces these with
+// the replacement character, so they must be rejected before decoding.
+func checkJSONSurrogates(data []byte) error {
+	inString := false
+	for i := 0; i < len(data); i++ {
+		switch {
+		case data[i] == '"':
+			inString = !inString
+		case inString && data[i] == '\\':
+			i++
+			if i >= len(data) || data[i] != 'u' {
+				continue
+			}
+			r, ok := parseJSONEscape(data[i-1:])
+			if !ok || !utf16.IsSurrogate(r) {
+				i += 4
+				continue
+			}
+			low, ok := parseJSONEscape(data[i+5:])
+			if r >= 0xdc00 || !ok || low < 0xdc00 || low > 0xdfff {
+				return fmt.Errorf("malformed: json string has an unpaired surrogate at offset %v", i-1)
+			}
+			i += 10
+		}
+	}
+	return nil
+}
+
+// parseJSONEscape parses the \uXXXX escape at the start of the data. Returns
+// false if there is no such escape.
+func parseJSONEscape(data []byte) (rune, bool) {
+	if len(data) < 6 || data[0] != '\\' || data[1] != 'u' {
+		return 0, false
+	}
+	x, err := strconv.ParseUint(string(data[2:6]), 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return rune(x), true
+}
+
+// A utf8Visitor returns an error for every String, and every name of a record
+// field, that is not valid UTF-8.
+type utf8Visitor struct {
+	BaseVisitor
+}
+
+// VisitString checks that the String is valid UTF-8.
+func (utf8Visitor) VisitString(path Path, v String) error {
+	if !utf8.ValidString(string(v)) {
+		return fmt.Errorf("malformed: expected %v to be valid utf-8", path)
+	}
+	return nil
+}
+
+// EnterRecord checks that the names of the fields of the record are valid
+// UTF-8.
+func (utf8Visitor) EnterRecord(path Path, v Record) error {
+	for _, field := range v.Fields {
+		if !utf8.ValidString(field.Name) {
+			return fmt.Errorf("malformed: expected %v to have a valid utf-8 field name, got %q", path, field.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package abi_test
+
+import (
+	"testing/quick"
+
+	"github.com/renproject/abi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Canonical JSON", func() {
+	Context("when marshaling values", func() {
+		It("should produce the same bytes as the standard encoding", func() {
+			f := func(x uint64, y [32]byte) bool {
+				for _, v := range []abi.Value{abi.NewU64(x), abi.NewU256(y), abi.Bytes32(y)} {
+					expected, err := v.MarshalJSON()
+					Expect(err).ToNot(HaveOccurred())
+					data, err := abi.MarshalCanonicalJSON(v)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(data).To(Equal(expected))
+				}
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should use the minimal string escaping", func() {
+			data, err := abi.MarshalCanonicalJSON(abi.String("<€\"\\\n\u001f>"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("\"<€\\\"\\\\\\n\\u001f>\""))
+		})
+	})
+
+	Context("when marshaling strings that are not valid utf-8", func() {
+		It("should return an error", func() {
+			_, err := abi.MarshalCanonicalJSON(abi.String("\xff"))
+			Expect(err).To(MatchError("malformed: expected . to be valid utf-8"))
+
+			v := abi.MustParseText(`record{memo: maybe<str>(str("\xfe"))}`)
+			_, err = abi.MarshalCanonicalJSON(v)
+			Expect(err).To(MatchError("malformed: expected .memo to be valid utf-8"))
+
+			record, err := abi.NewRecord([]abi.RecordField{{Name: "\xff", Type: abi.TypeU8}}, abi.NewU8(1))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = abi.MarshalCanonicalJSON(record)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when canonicalizing json", func() {
+		It("should sort keys and remove whitespace", func() {
+			data, err := abi.CanonicalizeJSON([]byte(`{ "b": [1, true, null], "a": {"é": 1, "z": 2}, "\ufb33": 4, "😀": 3 }`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("{\"a\":{\"z\":2,\"é\":1},\"b\":[1,true,null],\"😀\":3,\"\ufb33\":4}"))
+		})
+
+		It("should format numbers like ecmascript", func() {
+			cases := map[string]string{
+				"0":                      "0",
+				"-0":                     "0",
+				"1.0":                    "1",
+				"100":                    "100",
+				"1e21":                   "1e+21",
+				"1e20":                   "100000000000000000000",
+				"0.000001":               "0.000001",
+				"0.0000001":              "1e-7",
+				"123.456":                "123.456",
+				"-1.5e-10":               "-1.5e-10",
+				"9007199254740993":       "9007199254740992",
+				"1.7976931348623157e308": "1.7976931348623157e+308",
+			}
+			for in, out := range cases {
+				data, err := abi.CanonicalizeJSON([]byte(in))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(data)).To(Equal(out))
+			}
+		})
+
+		It("should return an error for duplicate keys", func() {
+			_, err := abi.CanonicalizeJSON([]byte(`{"a":1,"a":2}`))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error for strings that are not valid unicode", func() {
+			for _, data := range []string{"\"\xff\"", `"\ud800"`, `"\udc00"`, `"\ud800A"`, `{"\ud83d": 1}`} {
+				_, err := abi.CanonicalizeJSON([]byte(data))
+				Expect(err).To(HaveOccurred(), data)
+			}
+			data, err := abi.CanonicalizeJSON([]byte(`"😀 \\ud800 A"`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal(`"😀 \\ud800 A"`))
+		})
+
+		It("should return an error for trailing data", func() {
+			_, err := abi.CanonicalizeJSON([]byte(`{} {}`))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
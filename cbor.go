@@ -0,0 +1,674 @@
+package abi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/renproject/surge"
+)
+
+// CBOR major types as defined in RFC 8949.
+const (
+	cborMajorUint   = 0
+	cborMajorBytes  = 2
+	cborMajorText   = 3
+	cborMajorArray  = 4
+	cborMajorMap    = 5
+	cborMajorTag    = 6
+	cborMajorSimple = 7
+
+	// cborTagBignum is the tag for unsigned bignums.
+	cborTagBignum = 2
+
+	cborFalse = cborMajorSimple<<5 | 20
+	cborTrue  = cborMajorSimple<<5 | 21
+)
+
+// A CBORMarshaler can be marshaled to CBOR.
+type CBORMarshaler interface {
+	// MarshalCBOR into an I/O writer. It accepts a maximum capacity of bytes
+	// that can be allocated, and returns the remaining capacity.
+	MarshalCBOR(w io.Writer, m int) (int, error)
+}
+
+// A CBORUnmarshaler can be unmarshaled from CBOR.
+type CBORUnmarshaler interface {
+	// UnmarshalCBOR from an I/O reader. It accepts a maximum capacity of bytes
+	// that can be allocated, and returns the remaining capacity. It must not
+	// allocate more bytes than the maximum capacity.
+	UnmarshalCBOR(r io.Reader, m int) (int, error)
+}
+
+// MarshalCBOR marshals the String to CBOR as a text string. An error is
+// returned if the String is not valid UTF-8.
+func (str String) MarshalCBOR(w io.Writer, m int) (int, error) {
+	if !utf8.ValidString(string(str)) {
+		return m, fmt.Errorf("malformed: String is not valid utf-8")
+	}
+	return cborWriteString(w, cborMajorText, []byte(str), m)
+}
+
+// UnmarshalCBOR unmarshals the String from a CBOR text string. Unmarshaling
+// will not allocate more than the specified maximum number of bytes.
+func (str *String) UnmarshalCBOR(r io.Reader, m int) (int, error) {
+	data, m, err := cborReadString(r, cborMajorText, m, m)
+	if err != nil {
+		return m, err
+	}
+	if !utf8.Valid(data) {
+		return m, fmt.Errorf("malformed: String is not valid utf-8")
+	}
+	*str = String(data)
+	return m, nil
+}
+
+// MarshalCBOR marshals the Bytes to CBOR as a byte string.
+func (b Bytes) MarshalCBOR(w io.Writer, m int) (int, error) {
+	return cborWriteString(w, cborMajorBytes, b, m)
+}
+
+// UnmarshalCBOR unmarshals the Bytes from a CBOR byte string. Unmarshaling
+// will not allocate more than the specified maximum number of bytes.
+func (b *Bytes) UnmarshalCBOR(r io.Reader, m int) (int, error) {
+	data, m, err := cborReadString(r, cborMajorBytes, m, m)
+	if err != nil {
+		return m, err
+	}
+	*b = data
+	return m, nil
+}
+
+// MarshalCBOR marshals the Bytes32 to CBOR as a 32 byte string.
+func (b32 Bytes32) MarshalCBOR(w io.Writer, m int) (int, error) {
+	return cborWriteString(w, cborMajorBytes, b32[:], m)
+}
+
+// UnmarshalCBOR unmarshals the Bytes32 from a CBOR byte string. An error is
+// returned if the byte string is not exactly 32 bytes long.
+func (b32 *Bytes32) UnmarshalCBOR(r io.Reader, m int) (int, error) {
+	data, m, err := cborReadString(r, cborMajorBytes, m, m)
+	if err != nil {
+		return m, err
+	}
+	if len(data) != 32 {
+		return m, fmt.Errorf("expected len=32, got len=%v", len(data))
+	}
+	copy((*b32)[:], data)
+	return m, nil
+}
+
+// MarshalCBOR marshals the Bytes65 to CBOR as a 65 byte string.
+func (b65 Bytes65) MarshalCBOR(w io.Writer, m int) (int, error) {
+	return cborWriteString(w, cborMajorBytes, b65[:], m)
+}
+
+// UnmarshalCBOR unmarshals the Bytes65 from a CBOR byte string. An error is
+// returned if the byte string is not exactly 65 bytes long.
+func (b65 *Bytes65) UnmarshalCBOR(r io.Reader, m int) (int, error) {
+	data, m, err := cborReadString(r, cborMajorBytes, m, m)
+	if err != nil {
+		return m, err
+	}
+	if len(data) != 65 {
+		return m, fmt.Errorf("expected len=65, got len=%v", len(data))
+	}
+	copy((*b65)[:], data)
+	return m, nil
+}
+
+// MarshalCBOR marshals the Bool to CBOR as a simple value.
+func (b Bool) MarshalCBOR(w io.Writer, m int) (int, error) {
+	bs := [1]byte{cborFalse}
+	if b.inner {
+		bs[0] = cborTrue
+	}
+	return writeWithin(w, bs[:], m)
+}
+
+// UnmarshalCBOR unmarshals the Bool from a CBOR simple value.
+func (b *Bool) UnmarshalCBOR(r io.Reader, m int) (int, error) {
+	bs := [1]byte{}
+	m, err := readWithin(r, bs[:], m)
+	if err != nil {
+		return m, err
+	}
+	switch bs[0] {
+	case cborFalse:
+		b.inner = false
+	case cborTrue:
+		b.inner = true
+	default:
+		return m, fmt.Errorf("non-exhaustive pattern: Bool(0x%x)", bs[0])
+	}
+	return m, nil
+}
+
+// MarshalCBOR marshals the U8 to CBOR as an unsigned integer.
+func (u8 U8) MarshalCBOR(w io.Writer, m int) (int, error) {
+	return cborWriteHead(w, cborMajorUint, uint64(u8.inner), m)
+}
+
+// UnmarshalCBOR unmarshals the U8 from a CBOR unsigned integer.
+func (u8 *U8) UnmarshalCBOR(r io.Reader, m int) (int, error) {
+	x, m, err := cborReadUint(r, uint64(MaxU8().inner), m)
+	if err != nil {
+		return m, err
+	}
+	u8.inner = uint8(x)
+	return m, nil
+}
+
+// MarshalCBOR marshals the U16 to CBOR as an unsigned integer.
+func (u16 U16) MarshalCBOR(w io.Writer, m int) (int, error) {
+	return cborWriteHead(w, cborMajorUint, uint64(u16.inner), m)
+}
+
+// UnmarshalCBOR unmarshals the U16 from a CBOR unsigned integer.
+func (u16 *U16) UnmarshalCBOR(r io.Reader, m int) (int, error) {
+	x, m, err := cborReadUint(r, uint64(MaxU16().inner), m)
+	if err != nil {
+		return m, err
+	}
+	u16.inner = uint16(x)
+	return m, nil
+}
+
+// MarshalCBOR marshals the U32 to CBOR as an unsigned integer.
+func (u32 U32) MarshalCBOR(w io.Writer, m int) (int, error) {
+	return cborWriteHead(w, cborMajorUint, uint64(u32.inner), m)
+}
+
+// UnmarshalCBOR unmarshals the U32 from a CBOR unsigned integer.
+func (u32 *U32) UnmarshalCBOR(r io.Reader, m int) (int, error) {
+	x, m, err := cborReadUint(r, uint64(MaxU32().inner), m)
+	if err != nil {
+		return m, err
+	}
+	u32.inner = uint32(x)
+	return m, nil
+}
+
+// MarshalCBOR marshals the U64 to CBOR as an unsigned integer.
+func (u64 U64) MarshalCBOR(w io.Writer, m int) (int, error) {
+	return cborWriteHead(w, cborMajorUint, u64.inner, m)
+}
+
+// UnmarshalCBOR unmarshals the U64 from a CBOR unsigned integer.
+func (u64 *U64) UnmarshalCBOR(r io.Reader, m int) (int, error) {
+	x, m, err := cborReadUint(r, MaxU64().inner, m)
+	if err != nil {
+		return m, err
+	}
+	u64.inner = x
+	return m, nil
+}
+
+// MarshalCBOR marshals the U128 to CBOR. Values that fit into 64 bits are
+// marshaled as unsigned integers, and larger values are marshaled as bignums.
+func (u128 U128) MarshalCBOR(w io.Writer, m int) (int, error) {
+	return cborWriteBigInt(w, u128.inner, m)
+}
+
+// UnmarshalCBOR unmarshals the U128 from a CBOR unsigned integer or bignum.
+func (u128 *U128) UnmarshalCBOR(r io.Reader, m int) (int, error) {
+	if u128.inner == nil {
+		u128.inner = new(big.Int)
+	}
+	return cborReadBigInt(r, u128.inner, 16, m)
+}
+
+// MarshalCBOR marshals the U256 to CBOR. Values that fit into 64 bits are
+// marshaled as unsigned integers, and larger values are marshaled as bignums.
+func (u256 U256) MarshalCBOR(w io.Writer, m int) (int, error) {
+	return cborWriteBigInt(w, u256.inner, m)
+}
+
+// UnmarshalCBOR unmarshals the U256 from a CBOR unsigned integer or bignum.
+func (u256 *U256) UnmarshalCBOR(r io.Reader, m int) (int, error) {
+	if u256.inner == nil {
+		u256.inner = new(big.Int)
+	}
+	return cborReadBigInt(r, u256.inner, 32, m)
+}
+
+// MarshalCBORList marshals a slice of values to CBOR as a definite length
+// array.
+func MarshalCBORList(w io.Writer, vs []CBORMarshaler, m int) (int, error) {
+	m, err := cborWriteHead(w, cborMajorArray, uint64(len(vs)), m)
+	if err != nil {
+		return m, err
+	}
+	for _, v := range vs {
+		if m, err = v.MarshalCBOR(w, m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// UnmarshalCBORList unmarshals a definite length CBOR array. The array header
+// is read, and then the function f is called once for each element. Every
+// element is at least one byte long, so arrays with more elements than the
+// maximum number of bytes are rejected before f is called.
+func UnmarshalCBORList(r io.Reader, m int, f func(r io.Reader, m int) (int, error)) (int, error) {
+	major, n, m, err := cborReadHead(r, m)
+	if err != nil {
+		return m, err
+	}
+	if major != cborMajorArray {
+		return m, fmt.Errorf("non-exhaustive pattern: expected cbor array, got cbor major type %v", major)
+	}
+	if n >= uint64(m) {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	for i := uint64(0); i < n; i++ {
+		if m, err = f(r, m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// MarshalCBOR marshals the List to CBOR as a definite length array of its
+// elements.
+func (list List) MarshalCBOR(w io.Writer, m int) (int, error) {
+	m, err := cborWriteHead(w, cborMajorArray, uint64(len(list.Elems)), m)
+	if err != nil {
+		return m, err
+	}
+	for _, elem := range list.Elems {
+		if m, err = cborWriteValue(w, elem, m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// MarshalCBOR marshals the Record to CBOR as a map from the names of its fields
+// to their values. As required for deterministic encoding, the entries of the
+// map are sorted by the bytewise order of their encoded keys, which is not
+// necessarily the order of the fields.
+func (record Record) MarshalCBOR(w io.Writer, m int) (int, error) {
+	if len(record.Values) != len(record.Fields) {
+		return m, fmt.Errorf("expected len=%v, got len=%v", len(record.Fields), len(record.Values))
+	}
+	m, err := cborWriteHead(w, cborMajorMap, uint64(len(record.Fields)), m)
+	if err != nil {
+		return m, err
+	}
+	for _, i := range cborFieldOrder(record.Fields) {
+		if m, err = String(record.Fields[i].Name).MarshalCBOR(w, m); err != nil {
+			return m, err
+		}
+		if m, err = cborWriteValue(w, record.Values[i], m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// MarshalCBOR marshals the Maybe to CBOR as an array that is empty if the value
+// is absent, and that contains only the value if it is present. Unlike null,
+// this distinguishes an absent value from a present value that is itself an
+// absent Maybe.
+func (maybe Maybe) MarshalCBOR(w io.Writer, m int) (int, error) {
+	if maybe.Value == nil {
+		return cborWriteHead(w, cborMajorArray, 0, m)
+	}
+	m, err := cborWriteHead(w, cborMajorArray, 1, m)
+	if err != nil {
+		return m, err
+	}
+	return cborWriteValue(w, maybe.Value, m)
+}
+
+// UnmarshalCBORValue unmarshals a value described by the TypeDesc from CBOR.
+// Lists, records and maybes are unmarshaled recursively, in the form written
+// by their MarshalCBOR methods. The bytes that are read are counted towards
+// the maximum number of bytes, and the value is checked against the
+// DefaultLimits before anything is allocated for it.
+func UnmarshalCBORValue(r io.Reader, desc TypeDesc, m int) (Value, int, error) {
+	limits := DefaultLimits()
+	limits.MaxBytes = m
+	return UnmarshalCBORValueWithLimits(r, desc, limits)
+}
+
+// UnmarshalCBORValueWithLimits is the same as UnmarshalCBORValue, but checks
+// the value against the given Limits. The maximum number of bytes is taken
+// from the Limits.
+func UnmarshalCBORValueWithLimits(r io.Reader, desc TypeDesc, limits Limits) (Value, int, error) {
+	m := limits.MaxBytes
+	if err := desc.validate(nil); err != nil {
+		return nil, m, err
+	}
+	return cborReadValue(r, desc, m, limits, 0)
+}
+
+// cborWriteValue writes a value to CBOR. An error is returned if the value
+// cannot be marshaled to CBOR.
+func cborWriteValue(w io.Writer, v Value, m int) (int, error) {
+	marshaler, ok := v.(CBORMarshaler)
+	if !ok {
+		return m, fmt.Errorf("non-exhaustive pattern: %T", v)
+	}
+	return marshaler.MarshalCBOR(w, m)
+}
+
+// cborReadValue reads a value described by a well-formed TypeDesc at the given
+// depth from CBOR, and checks it against the Limits.
+func cborReadValue(r io.Reader, desc TypeDesc, m int, limits Limits, depth int) (Value, int, error) {
+	switch desc.Type {
+	case TypeString:
+		data, m, err := cborReadString(r, cborMajorText, m, limits.MaxStringLen)
+		if err != nil {
+			return nil, m, err
+		}
+		if !utf8.Valid(data) {
+			return nil, m, fmt.Errorf("malformed: String is not valid utf-8")
+		}
+		return String(data), m, nil
+
+	case TypeBytes:
+		data, m, err := cborReadString(r, cborMajorBytes, m, limits.MaxStringLen)
+		if err != nil {
+			return nil, m, err
+		}
+		return Bytes(data), m, nil
+
+	case TypeList:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		n, m, err := cborReadArrayHead(r, m)
+		if err != nil {
+			return nil, m, err
+		}
+		// Every element is at least one byte long, so lists that cannot fit
+		// into the remaining budget are rejected before they are allocated.
+		if n >= uint64(m) {
+			return nil, m, surge.ErrMaxBytesExceeded
+		}
+		if err := limits.checkListLen(int(n)); err != nil {
+			return nil, m, err
+		}
+		elems := make([]Value, n)
+		for i := range elems {
+			if elems[i], m, err = cborReadValue(r, *desc.Elem, m, limits, depth+1); err != nil {
+				return nil, m, err
+			}
+		}
+		return List{Elem: *desc.Elem, Elems: elems}, m, nil
+
+	case TypeRecord:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		if err := limits.checkRecordFields(len(desc.Fields)); err != nil {
+			return nil, m, err
+		}
+		major, n, m, err := cborReadHead(r, m)
+		if err != nil {
+			return nil, m, err
+		}
+		if major != cborMajorMap {
+			return nil, m, fmt.Errorf("non-exhaustive pattern: expected cbor map, got cbor major type %v", major)
+		}
+		if n != uint64(len(desc.Fields)) {
+			return nil, m, fmt.Errorf("expected len=%v, got len=%v", len(desc.Fields), n)
+		}
+		fields := make([]RecordField, len(desc.Fields))
+		for i, field := range desc.Fields {
+			fields[i] = RecordField{Name: field.Name, Type: field.Desc.Type}
+		}
+		values := make([]Value, len(desc.Fields))
+		for _, i := range cborFieldOrder(fields) {
+			name := String("")
+			if m, err = name.UnmarshalCBOR(r, m); err != nil {
+				return nil, m, err
+			}
+			if string(name) != fields[i].Name {
+				return nil, m, fmt.Errorf("expected field %v, got field %v", fields[i].Name, name)
+			}
+			if values[i], m, err = cborReadValue(r, desc.Fields[i].Desc, m, limits, depth+1); err != nil {
+				return nil, m, err
+			}
+		}
+		return Record{Fields: fields, Values: values}, m, nil
+
+	case TypeMaybe:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		n, m, err := cborReadArrayHead(r, m)
+		if err != nil {
+			return nil, m, err
+		}
+		switch n {
+		case 0:
+			return Maybe{Elem: *desc.Elem}, m, nil
+		case 1:
+			v, m, err := cborReadValue(r, *desc.Elem, m, limits, depth+1)
+			if err != nil {
+				return nil, m, err
+			}
+			return Maybe{Elem: *desc.Elem, Value: v}, m, nil
+		default:
+			return nil, m, fmt.Errorf("non-exhaustive pattern: Maybe(%v)", n)
+		}
+
+	default:
+		ptr, err := newPrimitive(desc.Type)
+		if err != nil {
+			return nil, m, err
+		}
+		if m, err = ptr.(CBORUnmarshaler).UnmarshalCBOR(r, m); err != nil {
+			return nil, m, err
+		}
+		return pointee(ptr), m, nil
+	}
+}
+
+// cborReadArrayHead reads the head of a CBOR array, and returns the number of
+// elements.
+func cborReadArrayHead(r io.Reader, m int) (uint64, int, error) {
+	major, n, m, err := cborReadHead(r, m)
+	if err != nil {
+		return 0, m, err
+	}
+	if major != cborMajorArray {
+		return 0, m, fmt.Errorf("non-exhaustive pattern: expected cbor array, got cbor major type %v", major)
+	}
+	return n, m, nil
+}
+
+// cborFieldOrder returns the indices of the fields of a record, sorted by the
+// bytewise order of their names when encoded as CBOR text strings. Shorter
+// names have shorter heads, so this is the order of the length of the names,
+// and then the bytewise order of the names.
+func cborFieldOrder(fields []RecordField) []int {
+	order := make([]int, len(fields))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := fields[order[i]].Name, fields[order[j]].Name
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+	return order
+}
+
+// cborWriteHead writes the head of a CBOR data item using the shortest
+// possible encoding for the argument.
+func cborWriteHead(w io.Writer, major byte, arg uint64, m int) (int, error) {
+	bs := [9]byte{}
+	size := 1
+	switch {
+	case arg < 24:
+		bs[0] = major<<5 | byte(arg)
+	case arg <= 0xff:
+		bs[0] = major<<5 | 24
+		bs[1] = byte(arg)
+		size = 2
+	case arg <= 0xffff:
+		bs[0] = major<<5 | 25
+		binary.BigEndian.PutUint16(bs[1:], uint16(arg))
+		size = 3
+	case arg <= 0xffffffff:
+		bs[0] = major<<5 | 26
+		binary.BigEndian.PutUint32(bs[1:], uint32(arg))
+		size = 5
+	default:
+		bs[0] = major<<5 | 27
+		binary.BigEndian.PutUint64(bs[1:], arg)
+		size = 9
+	}
+	return writeWithin(w, bs[:size], m)
+}
+
+// cborWriteString writes a CBOR byte string or text string.
+func cborWriteString(w io.Writer, major byte, data []byte, m int) (int, error) {
+	m, err := cborWriteHead(w, major, uint64(len(data)), m)
+	if err != nil {
+		return m, err
+	}
+	return writeWithin(w, data, m)
+}
+
+// cborWriteBigInt writes a big integer as a CBOR unsigned integer if it fits
+// into 64 bits, and as a bignum otherwise. A nil integer is treated as zero.
+func cborWriteBigInt(w io.Writer, x *big.Int, m int) (int, error) {
+	if x == nil {
+		return cborWriteHead(w, cborMajorUint, 0, m)
+	}
+	if x.IsUint64() {
+		return cborWriteHead(w, cborMajorUint, x.Uint64(), m)
+	}
+	m, err := cborWriteHead(w, cborMajorTag, cborTagBignum, m)
+	if err != nil {
+		return m, err
+	}
+	return cborWriteString(w, cborMajorBytes, x.Bytes(), m)
+}
+
+// cborReadHead reads the head of a CBOR data item and returns its major type
+// and argument. The bytes of the head are counted towards the maximum number
+// of bytes. Indefinite lengths and arguments that are not encoded in their
+// shortest possible form are rejected.
+func cborReadHead(r io.Reader, m int) (byte, uint64, int, error) {
+	head := [1]byte{}
+	m, err := readWithin(r, head[:], m)
+	if err != nil {
+		return 0, 0, m, err
+	}
+	major := head[0] >> 5
+	info := head[0] & 0x1f
+
+	var size int
+	var min uint64
+	switch {
+	case info < 24:
+		return major, uint64(info), m, nil
+	case info == 24:
+		size, min = 1, 24
+	case info == 25:
+		size, min = 2, 0x100
+	case info == 26:
+		size, min = 4, 0x10000
+	case info == 27:
+		size, min = 8, 0x100000000
+	default:
+		return 0, 0, m, fmt.Errorf("non-canonical: cbor additional info %v", info)
+	}
+	bs := [8]byte{}
+	if m, err = readWithin(r, bs[8-size:], m); err != nil {
+		return 0, 0, m, err
+	}
+	arg := binary.BigEndian.Uint64(bs[:])
+	if arg < min {
+		return 0, 0, m, fmt.Errorf("non-canonical: cbor argument %v is not in its shortest form", arg)
+	}
+	return major, arg, m, nil
+}
+
+// cborReadString reads a CBOR string of the given major type that is at most
+// maxLen bytes long. Unmarshaling will not allocate more than the specified
+// maximum number of bytes.
+func cborReadString(r io.Reader, major byte, m int, maxLen int) ([]byte, int, error) {
+	actual, n, m, err := cborReadHead(r, m)
+	if err != nil {
+		return nil, m, err
+	}
+	if actual != major {
+		return nil, m, fmt.Errorf("non-exhaustive pattern: expected cbor major type %v, got %v", major, actual)
+	}
+	if n >= uint64(m) {
+		return nil, m, surge.ErrMaxBytesExceeded
+	}
+	if err := checkLimit("string len", maxLen, int(n)); err != nil {
+		return nil, m, err
+	}
+	data := make([]byte, n)
+	if m, err = readWithin(r, data, m); err != nil {
+		return nil, m, err
+	}
+	return data, m, nil
+}
+
+// cborReadUint reads a CBOR unsigned integer that is no greater than max.
+func cborReadUint(r io.Reader, max uint64, m int) (uint64, int, error) {
+	major, x, m, err := cborReadHead(r, m)
+	if err != nil {
+		return 0, m, err
+	}
+	if major != cborMajorUint {
+		return 0, m, fmt.Errorf("non-exhaustive pattern: expected cbor unsigned integer, got cbor major type %v", major)
+	}
+	if x > max {
+		return 0, m, fmt.Errorf("overflow: expected x<=%v, got x=%v", max, x)
+	}
+	return x, m, nil
+}
+
+// cborReadBigInt reads a CBOR unsigned integer or bignum that is at most n
+// bytes long into a big integer. Bignums that fit into 64 bits, or that have
+// leading zeros, are rejected.
+func cborReadBigInt(r io.Reader, x *big.Int, n int, m int) (int, error) {
+	major, arg, m, err := cborReadHead(r, m)
+	if err != nil {
+		return m, err
+	}
+	switch major {
+	case cborMajorUint:
+		x.SetUint64(arg)
+		return m, nil
+	case cborMajorTag:
+		if arg != cborTagBignum {
+			return m, fmt.Errorf("non-exhaustive pattern: cbor tag %v", arg)
+		}
+	default:
+		return m, fmt.Errorf("non-exhaustive pattern: expected cbor unsigned integer, got cbor major type %v", major)
+	}
+
+	data, m, err := cborReadString(r, cborMajorBytes, m, m)
+	if err != nil {
+		return m, err
+	}
+	if len(data) > n {
+		return m, fmt.Errorf("overflow: expected n<=%v, got n=%v", n, len(data))
+	}
+	if len(data) > 0 && data[0] == 0 {
+		return m, fmt.Errorf("non-canonical: cbor bignum has leading zeros")
+	}
+	if len(data) <= 8 {
+		return m, fmt.Errorf("non-canonical: cbor bignum fits into an unsigned integer")
+	}
+	x.SetBytes(data)
+	return m, nil
+}
@@ -0,0 +1,255 @@
+package abi_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CBOR", func() {
+	Context("when marshaling known values", func() {
+		It("should match the deterministic encoding", func() {
+			cases := []struct {
+				v        abi.CBORMarshaler
+				expected []byte
+			}{
+				{abi.NewU8(0), []byte{0x00}},
+				{abi.NewU8(23), []byte{0x17}},
+				{abi.NewU8(24), []byte{0x18, 0x18}},
+				{abi.NewU16(1000), []byte{0x19, 0x03, 0xe8}},
+				{abi.NewU64(1000000000000), []byte{0x1b, 0x00, 0x00, 0x00, 0xe8, 0xd4, 0xa5, 0x10, 0x00}},
+				{abi.NewU256FromU64(abi.NewU64(1000)), []byte{0x19, 0x03, 0xe8}},
+				{abi.NewBool(false), []byte{0xf4}},
+				{abi.NewBool(true), []byte{0xf5}},
+				{abi.String("IETF"), []byte{0x64, 'I', 'E', 'T', 'F'}},
+				{abi.Bytes{1, 2, 3, 4}, []byte{0x44, 1, 2, 3, 4}},
+			}
+			for _, c := range cases {
+				buf := new(bytes.Buffer)
+				_, err := c.v.MarshalCBOR(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Bytes()).To(Equal(c.expected))
+			}
+		})
+
+		It("should use a bignum for integers larger than 64 bits", func() {
+			x := [16]byte{}
+			x[7] = 1
+			buf := new(bytes.Buffer)
+			_, err := abi.NewU128(x).MarshalCBOR(buf, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Bytes()).To(Equal([]byte{0xc2, 0x49, 1, 0, 0, 0, 0, 0, 0, 0, 0}))
+		})
+	})
+
+	Context("when marshaling and unmarshaling", func() {
+		It("should equal itself", func() {
+			f := func(x uint16, y [16]byte, z [32]byte, s string) bool {
+				u16 := abi.NewU16(x)
+				u128 := abi.NewU128(y)
+				u256 := abi.NewU256(z)
+				b32 := abi.Bytes32(z)
+				str := abi.String(s)
+
+				buf := new(bytes.Buffer)
+				for _, v := range []abi.CBORMarshaler{u16, u128, u256, b32, str} {
+					_, err := v.MarshalCBOR(buf, abi.MaxBytes)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				u16Out := abi.U16{}
+				u128Out := abi.U128{}
+				u256Out := abi.U256{}
+				b32Out := abi.Bytes32{}
+				strOut := abi.String("")
+				for _, v := range []abi.CBORUnmarshaler{&u16Out, &u128Out, &u256Out, &b32Out, &strOut} {
+					_, err := v.UnmarshalCBOR(buf, abi.MaxBytes)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				Expect(u16Out).To(Equal(u16))
+				Expect(u128Out.Equal(u128)).To(BeTrue())
+				Expect(u256Out.Equal(u256)).To(BeTrue())
+				Expect(b32Out).To(Equal(b32))
+				Expect(strOut).To(Equal(str))
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should equal itself when in a list", func() {
+			f := func(xs [][]byte) bool {
+				vs := make([]abi.CBORMarshaler, len(xs))
+				for i := range xs {
+					vs[i] = abi.Bytes(xs[i])
+				}
+				buf := new(bytes.Buffer)
+				_, err := abi.MarshalCBORList(buf, vs, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+
+				ys := []abi.Bytes{}
+				_, err = abi.UnmarshalCBORList(buf, abi.MaxBytes, func(r io.Reader, m int) (int, error) {
+					y := abi.Bytes{}
+					m, err := y.UnmarshalCBOR(r, m)
+					ys = append(ys, y)
+					return m, err
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ys).To(HaveLen(len(xs)))
+				for i := range xs {
+					Expect(bytes.Equal(ys[i], xs[i])).To(BeTrue())
+				}
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when unmarshaling non-deterministic encodings", func() {
+		It("should return an error", func() {
+			cases := [][]byte{
+				{0x18, 0x05},                            // Integer not in its shortest form
+				{0x19, 0x00, 0xff},                      // Integer not in its shortest form
+				{0x1f},                                  // Indefinite length
+				{0xc2, 0x41, 0x01},                      // Bignum that fits into 64 bits
+				{0xc2, 0x49, 0, 1, 0, 0, 0, 0, 0, 0, 0}, // Bignum with leading zeros
+				{0xc3, 0x49, 1, 0, 0, 0, 0, 0, 0, 0, 0}, // Negative bignum
+				{0x40},                                  // Byte string
+			}
+			for _, c := range cases {
+				u256 := abi.U256{}
+				_, err := u256.UnmarshalCBOR(bytes.NewReader(c), abi.MaxBytes)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+
+		It("should return an error for invalid utf-8", func() {
+			str := abi.String("")
+			_, err := str.UnmarshalCBOR(bytes.NewReader([]byte{0x61, 0xff}), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when marshaling composite values", func() {
+		It("should match the deterministic encoding", func() {
+			cases := []struct {
+				text     string
+				expected []byte
+			}{
+				{`list<u8>[u8(1), u8(2)]`, []byte{0x82, 0x01, 0x02}},
+				{`list<u8>[]`, []byte{0x80}},
+				{`record{aa: u8(2), b: u8(1)}`, []byte{0xa2, 0x61, 'b', 0x01, 0x62, 'a', 'a', 0x02}},
+				{`maybe<u8>(none)`, []byte{0x80}},
+				{`maybe<u8>(u8(1))`, []byte{0x81, 0x01}},
+				{`maybe<maybe<u8>>(maybe<u8>(none))`, []byte{0x81, 0x80}},
+			}
+			for _, c := range cases {
+				v := abi.MustParseText(c.text)
+				buf := new(bytes.Buffer)
+				_, err := v.(abi.CBORMarshaler).MarshalCBOR(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Bytes()).To(Equal(c.expected), c.text)
+
+				w, _, err := abi.UnmarshalCBORValue(bytes.NewReader(c.expected), abi.DescOf(v), abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(abi.Equal(v, w)).To(BeTrue(), c.text)
+			}
+		})
+
+		It("should equal itself", func() {
+			f := func(desc abi.TypeDesc, seed int64) bool {
+				v := abi.RandomValue(rand.New(rand.NewSource(seed)), desc)
+				buf := new(bytes.Buffer)
+				_, err := v.(abi.CBORMarshaler).MarshalCBOR(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+
+				w, m, err := abi.UnmarshalCBORValue(buf, desc, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(abi.Equal(v, w)).To(BeTrue())
+				Expect(buf.Len()).To(Equal(0))
+				Expect(m).To(BeNumerically("<", abi.MaxBytes))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should return an error for records that do not match", func() {
+			desc, err := abi.ParseTypeDesc("record{aa:u8,b:u8}")
+			Expect(err).ToNot(HaveOccurred())
+			cases := [][]byte{
+				{0xa2, 0x62, 'a', 'a', 0x02, 0x61, 'b', 0x01}, // Fields not in deterministic order
+				{0xa2, 0x61, 'c', 0x01, 0x62, 'a', 'a', 0x02}, // Unknown field
+				{0xa1, 0x61, 'b', 0x01},                       // Missing field
+				{0x82, 0x01, 0x02},                            // Array instead of map
+			}
+			for _, c := range cases {
+				_, _, err := abi.UnmarshalCBORValue(bytes.NewReader(c), desc, abi.MaxBytes)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+
+		It("should return an error for maybes with more than one value", func() {
+			_, _, err := abi.UnmarshalCBORValue(bytes.NewReader([]byte{0x82, 0x01, 0x02}), abi.NewMaybeDesc(abi.NewTypeDesc(abi.TypeU8)), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should check lists against the limits", func() {
+			data := []byte{0x9a, 0x00, 0x01, 0x00, 0x01}
+			_, _, err := abi.UnmarshalCBORValue(bytes.NewReader(data), abi.NewListDesc(abi.NewTypeDesc(abi.TypeU8)), 1<<20)
+			Expect(err).To(BeAssignableToTypeOf(abi.LimitError{}))
+
+			_, _, err = abi.UnmarshalCBORValue(bytes.NewReader(data), abi.NewListDesc(abi.NewTypeDesc(abi.TypeU8)), 1024)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+	})
+
+	Context("when marshaling and unmarshaling with a limited budget", func() {
+		It("should count every byte towards the budget", func() {
+			for _, v := range []abi.Value{
+				abi.NewBool(true),
+				abi.NewU8(1),
+				abi.NewU16(1000),
+				abi.String("IETF"),
+				abi.MustParseText(`record{a: bool(true), b: list<u8>[u8(1), u8(200)], c: maybe<str>(str("x"))}`),
+			} {
+				buf := new(bytes.Buffer)
+				_, err := v.(abi.CBORMarshaler).MarshalCBOR(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				n := buf.Len()
+
+				m, err := v.(abi.CBORMarshaler).MarshalCBOR(new(bytes.Buffer), n+1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m).To(Equal(1))
+				_, err = v.(abi.CBORMarshaler).MarshalCBOR(new(bytes.Buffer), n)
+				Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+				_, m, err = abi.UnmarshalCBORValue(bytes.NewReader(buf.Bytes()), abi.DescOf(v), n+1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m).To(Equal(1))
+				_, _, err = abi.UnmarshalCBORValue(bytes.NewReader(buf.Bytes()), abi.DescOf(v), n)
+				Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			}
+		})
+	})
+
+	Context("when unmarshaling strings that are too long", func() {
+		It("should not allocate and should return an error", func() {
+			data := []byte{0x5a, 0x7f, 0xff, 0xff, 0xff}
+			b := abi.Bytes{}
+			_, err := b.UnmarshalCBOR(bytes.NewReader(data), 1024)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			Expect(b).To(BeEmpty())
+		})
+	})
+})
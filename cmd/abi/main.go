@@ -0,0 +1,170 @@
+// Command abi inspects binary encoded abi values.
+//
+// Usage:
+//
+//	abi query [-type T | -list T | -record name:T,... | -desc DESC] [-binary] QUERY
+//
+// The query subcommand reads the binary encoding of a value from stdin, as hex
+// by default, and prints every value selected by the query, one per line, as
+// its path, its type, and its JSON encoding separated by tabs. For example:
+//
+//	$ abi query -list u64 '[1]' <<< 00000002000000000000000a0000000000000014
+//	[1]	u64	"20"
+//
+// The shape of the value is given by exactly one of -type, -list, -record, or
+// -desc. The -list and -record flags only describe lists and records of bytes
+// and scalar values. The -desc flag takes a full type description, so values
+// can be nested:
+//
+//	$ abi query -desc 'record{outputs:list<record{amount:u256}>}' '.outputs[*].amount' < tx.hex
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/renproject/abi"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes a subcommand and returns the exit code: 0 on success, 1 if the
+// subcommand fails, and 2 if it is used incorrectly.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "usage: abi query [flags] QUERY")
+		return 2
+	}
+	switch args[0] {
+	case "query":
+		return runQuery(args[1:], stdin, stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "abi: unknown subcommand %q\n", args[0])
+		return 2
+	}
+}
+
+// runQuery executes the query subcommand.
+func runQuery(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	ty := flags.String("type", "", "type of the value")
+	list := flags.String("list", "", "element type of the list")
+	record := flags.String("record", "", "fields of the record, as name:type,...")
+	desc := flags.String("desc", "", "type description of the value, such as record{to:b32,amounts:list<u256>}")
+	binary := flags.Bool("binary", false, "read raw binary instead of hex")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: abi query [-type T | -list T | -record name:T,... | -desc DESC] [-binary] QUERY")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	sel, err := abi.ParseSelector(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "abi: %v\n", err)
+		return 2
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(stdin, int64(2*abi.MaxBytes)))
+	if err != nil {
+		fmt.Fprintf(stderr, "abi: %v\n", err)
+		return 1
+	}
+	if !*binary {
+		text := strings.TrimPrefix(string(bytes.TrimSpace(data)), "0x")
+		if data, err = hex.DecodeString(text); err != nil {
+			fmt.Fprintf(stderr, "abi: %v\n", err)
+			return 1
+		}
+	}
+	view, err := newView(*ty, *list, *record, *desc, data)
+	if err != nil {
+		fmt.Fprintf(stderr, "abi: %v\n", err)
+		return 2
+	}
+	v, err := view.Value()
+	if err != nil {
+		fmt.Fprintf(stderr, "abi: %v\n", err)
+		return 1
+	}
+
+	results, err := sel.Select(v)
+	if err != nil {
+		fmt.Fprintf(stderr, "abi: %v\n", err)
+		return 1
+	}
+	for _, result := range results {
+		data, err := result.Value.MarshalJSON()
+		if err != nil {
+			fmt.Fprintf(stderr, "abi: %v: %v\n", result.Path, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "%v\t%v\t%s\n", result.Path, result.Value.Type(), data)
+	}
+	return 0
+}
+
+// newView returns a View over the data, with the shape given by exactly one of
+// the type, list, record, or desc flags.
+func newView(ty, list, record, desc string, data []byte) (abi.View, error) {
+	n := 0
+	for _, shape := range []string{ty, list, record, desc} {
+		if shape != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return abi.View{}, errors.New("expected exactly one of -type, -list, -record, or -desc")
+	}
+	switch {
+	case desc != "":
+		d, err := abi.ParseTypeDesc(desc)
+		if err != nil {
+			return abi.View{}, err
+		}
+		return abi.NewDescView(d, data), nil
+	case ty != "":
+		t, err := parseType(ty)
+		return abi.NewView(t, data), err
+	case list != "":
+		t, err := parseType(list)
+		return abi.NewListView(t, data), err
+	default:
+		fields := []abi.RecordField{}
+		for _, field := range strings.Split(record, ",") {
+			parts := strings.SplitN(field, ":", 2)
+			if len(parts) != 2 {
+				return abi.View{}, fmt.Errorf("malformed: expected name:type, got %q", field)
+			}
+			t, err := parseType(parts[1])
+			if err != nil {
+				return abi.View{}, err
+			}
+			fields = append(fields, abi.RecordField{Name: parts[0], Type: t})
+		}
+		return abi.NewRecordView(fields, data), nil
+	}
+}
+
+// parseType parses the name of a Type, such as "u256" or "b32".
+func parseType(str string) (abi.Type, error) {
+	ty, ok := abi.NewTypeFromString(str)
+	if !ok {
+		return abi.TypeNil, fmt.Errorf("non-exhaustive pattern: Type(%v)", str)
+	}
+	return ty, nil
+}
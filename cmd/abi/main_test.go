@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query subcommand", func() {
+	fields := []abi.RecordField{
+		{Name: "to", Type: abi.TypeBytes32},
+		{Name: "amount", Type: abi.TypeU256},
+		{Name: "memo", Type: abi.TypeString},
+	}
+	var data []byte
+
+	BeforeEach(func() {
+		record, err := abi.NewRecord(fields, abi.Bytes32{1}, abi.NewU256FromInt(big.NewInt(1000)), abi.String("memo"))
+		Expect(err).ToNot(HaveOccurred())
+		data, err = surge.ToBinary(record)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	query := func(stdin []byte, args ...string) (int, string, string) {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		code := run(append([]string{"query"}, args...), bytes.NewReader(stdin), stdout, stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	Context("when querying a record", func() {
+		It("should print the path, type, and JSON of every result", func() {
+			code, stdout, stderr := query([]byte("0x"+hex.EncodeToString(data)+"\n"), "-record", "to:b32,amount:u256,memo:str", "..[?type!=record]")
+			Expect(stderr).To(BeEmpty())
+			Expect(code).To(Equal(0))
+			lines := strings.Split(strings.TrimSpace(stdout), "\n")
+			Expect(lines).To(HaveLen(3))
+			Expect(lines[1]).To(Equal(".amount\tu256\t\"1000\""))
+			Expect(lines[2]).To(Equal(".memo\tstr\t\"memo\""))
+		})
+
+		It("should read binary", func() {
+			code, stdout, _ := query(data, "-binary", "-record", "to:b32,amount:u256,memo:str", ".memo")
+			Expect(code).To(Equal(0))
+			Expect(stdout).To(Equal(".memo\tstr\t\"memo\"\n"))
+		})
+	})
+
+	Context("when querying a list or a value", func() {
+		It("should print the results", func() {
+			list, err := surge.ToBinary([]uint64{10, 20})
+			Expect(err).ToNot(HaveOccurred())
+			code, stdout, _ := query([]byte(hex.EncodeToString(list)), "-list", "u64", "[1]")
+			Expect(code).To(Equal(0))
+			Expect(stdout).To(Equal("[1]\tu64\t\"20\"\n"))
+
+			code, stdout, _ = query([]byte("2a"), "-type", "u8", ".")
+			Expect(code).To(Equal(0))
+			Expect(stdout).To(Equal(".\tu8\t\"42\"\n"))
+		})
+	})
+
+	Context("when querying a value with a type description", func() {
+		It("should decode nested values", func() {
+			v := abi.MustParseText(`record{outputs: list<record{amount:u256}>[record{amount: u256(1)}, record{amount: u256(2)}]}`)
+			nested, err := surge.ToBinary(v)
+			Expect(err).ToNot(HaveOccurred())
+			code, stdout, stderr := query([]byte(hex.EncodeToString(nested)), "-desc", "record{outputs:list<record{amount:u256}>}", ".outputs[1].amount")
+			Expect(stderr).To(BeEmpty())
+			Expect(code).To(Equal(0))
+			Expect(stdout).To(Equal(".outputs[1].amount\tu256\t\"2\"\n"))
+		})
+	})
+
+	Context("when the query fails", func() {
+		It("should name the failing segment", func() {
+			code, _, stderr := query([]byte(hex.EncodeToString(data)), "-record", "to:b32,amount:u256,memo:str", ".amount.value")
+			Expect(code).To(Equal(1))
+			Expect(stderr).To(ContainSubstring(`".value"`))
+		})
+
+		It("should fail for malformed input", func() {
+			code, _, _ := query([]byte("xyz"), "-type", "u8", ".")
+			Expect(code).To(Equal(1))
+			code, _, _ = query([]byte(""), "-type", "u8", ".")
+			Expect(code).To(Equal(1))
+		})
+	})
+
+	Context("when used incorrectly", func() {
+		It("should return a usage error", func() {
+			for _, args := range [][]string{
+				{},
+				{"-type", "u8"},
+				{"-type", "u8", "-list", "u8", "."},
+				{"-type", "u7", "."},
+				{"-record", "to", "."},
+				{"-type", "u8", "outputs"},
+				{"-desc", "record{a:}", "."},
+				{"-desc", "u8", "-type", "u8", "."},
+			} {
+				code, _, stderr := query([]byte("2a"), args...)
+				Expect(code).To(Equal(2), strings.Join(args, " "))
+				Expect(stderr).ToNot(BeEmpty())
+			}
+			Expect(run(nil, nil, new(bytes.Buffer), new(bytes.Buffer))).To(Equal(2))
+			Expect(run([]string{"unknown"}, nil, new(bytes.Buffer), new(bytes.Buffer))).To(Equal(2))
+		})
+	})
+})
@@ -0,0 +1,293 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/renproject/surge"
+)
+
+// A List is a list of values that are all described by the same TypeDesc. The
+// binary encoding of a list is a uint32 length prefix followed by the binary
+// encoding of each element, which is the same encoding that is read by a
+// ListReader and a list View. Lists can be nested by using a TypeDesc of a
+// list, record or maybe as the element TypeDesc.
+//
+// The binary encoding does not describe the elements, so lists are
+// unmarshaled by UnmarshalValue using the TypeDesc of the list.
+type List struct {
+	// Elem describes every element of the List.
+	Elem  TypeDesc
+	Elems []Value
+}
+
+// NewList returns a List of the given elements. An error is returned if the
+// element TypeDesc is malformed, or if an element is not described by it.
+// Elements that are lists, records or maybes must be described by the whole
+// element TypeDesc, not only by its Type, so that nested lists have the same
+// element TypeDesc and nested records have the same fields.
+func NewList(elem TypeDesc, elems ...Value) (List, error) {
+	if err := elem.validate(nil); err != nil {
+		return List{}, err
+	}
+	for i, e := range elems {
+		if e == nil || !DescOf(e).Equal(elem) {
+			return List{}, fmt.Errorf("expected element %v to have type %v, got %v", i, elem, typeOf(e))
+		}
+	}
+	return List{Elem: elem, Elems: elems}, nil
+}
+
+// Type returns the type identifier.
+func (list List) Type() Type {
+	return TypeList
+}
+
+// SizeHint returns the number of bytes required to represent the List in
+// binary.
+func (list List) SizeHint() int {
+	size := 4
+	for _, elem := range list.Elems {
+		size += elem.SizeHint()
+	}
+	return size
+}
+
+// Marshal the List to binary. The List consumes its SizeHint from the maximum
+// number of bytes, which is checked before anything is written. Elements with
+// an empty binary encoding, such as empty records, also consume one byte each.
+func (list List) Marshal(w io.Writer, m int) (int, error) {
+	if uint64(len(list.Elems)) > uint64(^uint32(0)) {
+		return m, fmt.Errorf("overflow: list len=%v", len(list.Elems))
+	}
+	if m <= list.SizeHint() {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	m, err := list.Elem.chargeElems(len(list.Elems), m)
+	if err != nil {
+		return m, err
+	}
+	if m, err = marshalWithin(w, uint32(len(list.Elems)), 4, m); err != nil {
+		return m, err
+	}
+	for _, elem := range list.Elems {
+		if m, err = elem.Marshal(w, m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// MarshalJSON implements the JSON marshaler interface. Lists are marshaled as
+// JSON arrays.
+func (list List) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('[')
+	for i, elem := range list.Elems {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		data, err := elem.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// A RecordField is a named field of a record.
+type RecordField struct {
+	Name string `json:"name"`
+	Type Type   `json:"type"`
+}
+
+// A Record is a list of named fields. The binary encoding of a record is the
+// binary encoding of each of its fields, in order, without any prefix, which is
+// the same encoding that is read by a record View.
+//
+// The binary encoding does not describe the fields, so records are unmarshaled
+// by UnmarshalValue using the TypeDesc of the record.
+type Record struct {
+	Fields []RecordField
+	Values []Value
+}
+
+// NewRecord returns a Record with the given fields and values. An error is
+// returned if the number of values does not match the number of fields, if a
+// value is not of the Type of its field, or if two fields have the same name.
+func NewRecord(fields []RecordField, values ...Value) (Record, error) {
+	if len(values) != len(fields) {
+		return Record{}, fmt.Errorf("expected len=%v, got len=%v", len(fields), len(values))
+	}
+	seen := make(map[string]struct{}, len(fields))
+	for i, field := range fields {
+		if _, ok := seen[field.Name]; ok {
+			return Record{}, fmt.Errorf("malformed: duplicate field %v", field.Name)
+		}
+		seen[field.Name] = struct{}{}
+		if values[i] == nil || values[i].Type() != field.Type {
+			return Record{}, fmt.Errorf("expected field %v to have type %v, got %v", field.Name, field.Type, typeOf(values[i]))
+		}
+	}
+	return Record{Fields: fields, Values: values}, nil
+}
+
+// Get returns the value of the field with the given name. Returns false if
+// there is no such field.
+func (record Record) Get(name string) (Value, bool) {
+	for i, field := range record.Fields {
+		if field.Name == name {
+			return record.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// Type returns the type identifier.
+func (record Record) Type() Type {
+	return TypeRecord
+}
+
+// SizeHint returns the number of bytes required to represent the Record in
+// binary.
+func (record Record) SizeHint() int {
+	size := 0
+	for _, v := range record.Values {
+		size += v.SizeHint()
+	}
+	return size
+}
+
+// Marshal the Record to binary. The Record consumes its SizeHint from the
+// maximum number of bytes, which is checked before anything is written.
+func (record Record) Marshal(w io.Writer, m int) (int, error) {
+	if m <= record.SizeHint() {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	var err error
+	for _, v := range record.Values {
+		if m, err = v.Marshal(w, m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// MarshalJSON implements the JSON marshaler interface. Records are marshaled
+// as JSON objects, with the fields in order.
+func (record Record) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for i, field := range record.Fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(field.Name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		data, err := record.Values[i].MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// A Maybe is a value that may be absent. The binary encoding of a maybe is a
+// byte that is 1 if the value is present and 0 otherwise, followed by the
+// binary encoding of the value if it is present.
+//
+// The binary encoding does not describe the value, so maybes are unmarshaled
+// by UnmarshalValue using the TypeDesc of the maybe.
+type Maybe struct {
+	// Elem describes the value of the Maybe, even when it is absent.
+	Elem TypeDesc
+	// Value is the value of the Maybe, or nil if it is absent.
+	Value Value
+}
+
+// NewMaybe returns a Maybe of the given value, which can be nil. An error is
+// returned if the element TypeDesc is malformed, or if the value is not
+// described by it.
+func NewMaybe(elem TypeDesc, v Value) (Maybe, error) {
+	if err := elem.validate(nil); err != nil {
+		return Maybe{}, err
+	}
+	if v != nil && !DescOf(v).Equal(elem) {
+		return Maybe{}, fmt.Errorf("expected value to have type %v, got %v", elem, typeOf(v))
+	}
+	return Maybe{Elem: elem, Value: v}, nil
+}
+
+// NewSome returns a Maybe of a value that is present. The value must not be
+// nil.
+func NewSome(v Value) Maybe {
+	return Maybe{Elem: DescOf(v), Value: v}
+}
+
+// NewNone returns a Maybe of a value, described by the element TypeDesc, that
+// is absent.
+func NewNone(elem TypeDesc) Maybe {
+	return Maybe{Elem: elem}
+}
+
+// IsSome returns true if the value of the Maybe is present.
+func (maybe Maybe) IsSome() bool {
+	return maybe.Value != nil
+}
+
+// Type returns the type identifier.
+func (maybe Maybe) Type() Type {
+	return TypeMaybe
+}
+
+// SizeHint returns the number of bytes required to represent the Maybe in
+// binary.
+func (maybe Maybe) SizeHint() int {
+	if maybe.Value == nil {
+		return 1
+	}
+	return 1 + maybe.Value.SizeHint()
+}
+
+// Marshal the Maybe to binary. The Maybe consumes its SizeHint from the
+// maximum number of bytes, which is checked before anything is written.
+func (maybe Maybe) Marshal(w io.Writer, m int) (int, error) {
+	if m <= maybe.SizeHint() {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	if maybe.Value == nil {
+		return writeWithin(w, []byte{0}, m)
+	}
+	m, err := writeWithin(w, []byte{1}, m)
+	if err != nil {
+		return m, err
+	}
+	return maybe.Value.Marshal(w, m)
+}
+
+// MarshalJSON implements the JSON marshaler interface. A Maybe is marshaled as
+// its value, or as null if the value is absent.
+func (maybe Maybe) MarshalJSON() ([]byte, error) {
+	if maybe.Value == nil {
+		return []byte("null"), nil
+	}
+	return maybe.Value.MarshalJSON()
+}
+
+// typeOf returns a description of the TypeDesc of a value, for use in errors.
+func typeOf(v Value) string {
+	if v == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("type %v", DescOf(v))
+}
@@ -0,0 +1,250 @@
+package abi_test
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lists, records and maybes", func() {
+	fields := []abi.RecordField{
+		{Name: "to", Type: abi.TypeBytes32},
+		{Name: "amount", Type: abi.TypeU256},
+		{Name: "memo", Type: abi.TypeString},
+	}
+
+	Context("when creating a list", func() {
+		It("should reject elements of the wrong type", func() {
+			_, err := abi.NewList(abi.NewTypeDesc(abi.TypeU8), abi.NewU8(1), abi.NewU16(2))
+			Expect(err).To(HaveOccurred())
+			_, err = abi.NewList(abi.NewTypeDesc(abi.TypeU8), nil)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reject nested elements of different shapes", func() {
+			u8s, err := abi.NewList(abi.NewTypeDesc(abi.TypeU8), abi.NewU8(1))
+			Expect(err).ToNot(HaveOccurred())
+			strs, err := abi.NewList(abi.NewTypeDesc(abi.TypeString), abi.String("a"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = abi.NewList(abi.DescOf(u8s), u8s, strs)
+			Expect(err).To(MatchError("expected element 1 to have type list<u8>, got type list<str>"))
+
+			x, err := abi.NewRecord([]abi.RecordField{{Name: "x", Type: abi.TypeU8}}, abi.NewU8(1))
+			Expect(err).ToNot(HaveOccurred())
+			y, err := abi.NewRecord([]abi.RecordField{{Name: "y", Type: abi.TypeU8}}, abi.NewU8(1))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = abi.NewList(abi.DescOf(x), x, y)
+			Expect(err).To(HaveOccurred())
+
+			// Empty lists are described by their element TypeDesc.
+			_, err = abi.NewList(abi.DescOf(u8s), u8s, abi.List{Elem: abi.NewTypeDesc(abi.TypeString)})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reject malformed element TypeDescs", func() {
+			_, err := abi.NewList(abi.TypeDesc{Type: abi.TypeList})
+			Expect(err).To(MatchError(HavePrefix("malformed")))
+			_, err = abi.NewList(abi.NewTypeDesc(abi.TypeNil))
+			Expect(err).To(MatchError(HavePrefix("non-exhaustive pattern")))
+		})
+	})
+
+	Context("when creating a maybe", func() {
+		It("should describe absent values", func() {
+			some := abi.NewSome(abi.NewU8(1))
+			Expect(some.IsSome()).To(BeTrue())
+			Expect(abi.DescOf(some)).To(Equal(abi.NewMaybeDesc(abi.NewTypeDesc(abi.TypeU8))))
+			none := abi.NewNone(abi.NewTypeDesc(abi.TypeU8))
+			Expect(none.IsSome()).To(BeFalse())
+			Expect(abi.DescOf(none)).To(Equal(abi.DescOf(some)))
+		})
+
+		It("should reject values of the wrong type", func() {
+			_, err := abi.NewMaybe(abi.NewTypeDesc(abi.TypeU8), abi.NewU16(1))
+			Expect(err).To(HaveOccurred())
+			maybe, err := abi.NewMaybe(abi.NewTypeDesc(abi.TypeU8), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(maybe.IsSome()).To(BeFalse())
+		})
+	})
+
+	Context("when creating a record", func() {
+		It("should reject values that do not match the fields", func() {
+			_, err := abi.NewRecord(fields, abi.Bytes32{}, abi.NewU256FromInt(big.NewInt(1)))
+			Expect(err).To(HaveOccurred())
+			_, err = abi.NewRecord(fields, abi.Bytes32{}, abi.NewU64(1), abi.String(""))
+			Expect(err).To(HaveOccurred())
+			_, err = abi.NewRecord([]abi.RecordField{{Name: "a", Type: abi.TypeU8}, {Name: "a", Type: abi.TypeU8}}, abi.NewU8(1), abi.NewU8(2))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should get fields by name", func() {
+			record, err := abi.NewRecord(fields, abi.Bytes32{1}, abi.NewU256FromInt(big.NewInt(1)), abi.String("memo"))
+			Expect(err).ToNot(HaveOccurred())
+			memo, ok := record.Get("memo")
+			Expect(ok).To(BeTrue())
+			Expect(memo).To(Equal(abi.String("memo")))
+			_, ok = record.Get("missing")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("when marshaling", func() {
+		It("should produce the encoding that is read by views", func() {
+			record, err := abi.NewRecord(fields, abi.Bytes32{1}, abi.NewU256FromInt(big.NewInt(42)), abi.String("memo"))
+			Expect(err).ToNot(HaveOccurred())
+			data, err := surge.ToBinary(record)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(HaveLen(record.SizeHint()))
+
+			view := abi.NewRecordView(fields, data)
+			Expect(view.Field("to").Bytes32()).To(Equal(abi.Bytes32{1}))
+			Expect(view.Field("memo").String()).To(Equal(abi.String("memo")))
+			amount, err := view.Field("amount").U256()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(amount.Int()).To(Equal(big.NewInt(42)))
+		})
+
+		It("should produce the same encoding as a slice", func() {
+			list, err := abi.NewList(abi.NewTypeDesc(abi.TypeString), abi.String("a"), abi.String("bc"))
+			Expect(err).ToNot(HaveOccurred())
+			data, err := surge.ToBinary(list)
+			Expect(err).ToNot(HaveOccurred())
+			expected, err := surge.ToBinary([]string{"a", "bc"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(expected))
+			Expect(data).To(HaveLen(list.SizeHint()))
+		})
+
+		It("should marshal nested lists", func() {
+			inner, err := abi.NewList(abi.NewTypeDesc(abi.TypeU8), abi.NewU8(1), abi.NewU8(2))
+			Expect(err).ToNot(HaveOccurred())
+			outer, err := abi.NewList(abi.DescOf(inner), inner, abi.List{Elem: abi.NewTypeDesc(abi.TypeU8)})
+			Expect(err).ToNot(HaveOccurred())
+			data, err := surge.ToBinary(outer)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte{0, 0, 0, 2, 0, 0, 0, 2, 1, 2, 0, 0, 0, 0}))
+		})
+
+		It("should marshal records as their fields in order, and maybes with a present byte", func() {
+			record, err := abi.NewRecord(
+				[]abi.RecordField{{Name: "b", Type: abi.TypeMaybe}, {Name: "a", Type: abi.TypeMaybe}},
+				abi.NewSome(abi.NewU8(1)), abi.NewNone(abi.NewTypeDesc(abi.TypeU8)),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			data, err := surge.ToBinary(record)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte{1, 1, 0}))
+			Expect(data).To(HaveLen(record.SizeHint()))
+		})
+		It("should consume the size of the value from the maximum number of bytes", func() {
+			list, err := abi.NewList(abi.NewTypeDesc(abi.TypeU64), abi.NewU64(1), abi.NewU64(2))
+			Expect(err).ToNot(HaveOccurred())
+			buf := new(bytes.Buffer)
+			_, err = list.Marshal(buf, list.SizeHint())
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			Expect(buf.Len()).To(Equal(0))
+			Expect(list.Marshal(buf, list.SizeHint()+1)).To(Equal(1))
+
+			record, err := abi.NewRecord(fields, abi.Bytes32{}, abi.NewU256FromInt(big.NewInt(1)), abi.String(""))
+			Expect(err).ToNot(HaveOccurred())
+			buf.Reset()
+			_, err = record.Marshal(buf, record.SizeHint())
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			Expect(buf.Len()).To(Equal(0))
+			Expect(record.Marshal(buf, record.SizeHint()+1)).To(Equal(1))
+		})
+	})
+
+	Context("when unmarshaling", func() {
+		output := func(to byte, amount int64, tags ...abi.Value) abi.Value {
+			list, err := abi.NewList(abi.NewTypeDesc(abi.TypeString), tags...)
+			Expect(err).ToNot(HaveOccurred())
+			record, err := abi.NewRecord(
+				[]abi.RecordField{{Name: "to", Type: abi.TypeBytes32}, {Name: "amount", Type: abi.TypeU256}, {Name: "tags", Type: abi.TypeList}},
+				abi.Bytes32{to}, abi.NewU256FromInt(big.NewInt(amount)), list,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			return record
+		}
+		value := func() abi.Value {
+			outputs, err := abi.NewList(abi.DescOf(output(0, 0)), output(1, 10), output(2, 20, abi.String("a"), abi.String("b")))
+			Expect(err).ToNot(HaveOccurred())
+			record, err := abi.NewRecord(
+				[]abi.RecordField{{Name: "memo", Type: abi.TypeMaybe}, {Name: "refund", Type: abi.TypeMaybe}, {Name: "outputs", Type: abi.TypeList}},
+				abi.NewSome(abi.String("memo")), abi.NewNone(abi.NewTypeDesc(abi.TypeBytes32)), outputs,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			return record
+		}
+
+		It("should return the same value", func() {
+			v := value()
+			data, err := surge.ToBinary(v)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(HaveLen(v.SizeHint()))
+			w, m, err := abi.UnmarshalValue(bytes.NewReader(data), abi.DescOf(v), v.SizeHint()+1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m).To(Equal(1))
+			Expect(abi.DescOf(w)).To(Equal(abi.DescOf(v)))
+			Expect(surge.ToBinary(w)).To(Equal(data))
+		})
+
+		It("should consume the size of the value from the maximum number of bytes", func() {
+			v := value()
+			data, err := surge.ToBinary(v)
+			Expect(err).ToNot(HaveOccurred())
+			for m := 0; m <= v.SizeHint(); m++ {
+				_, _, err := abi.UnmarshalValue(bytes.NewReader(data), abi.DescOf(v), m)
+				Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			}
+		})
+
+		It("should reject lists that cannot fit into the maximum number of bytes before allocating them", func() {
+			data := []byte{0x00, 0x01, 0x00, 0x00}
+			_, _, err := abi.UnmarshalValue(bytes.NewReader(data), abi.NewListDesc(abi.NewTypeDesc(abi.TypeU256)), 1024)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+
+		It("should reject malformed maybes", func() {
+			_, _, err := abi.UnmarshalValue(bytes.NewReader([]byte{2, 1}), abi.NewMaybeDesc(abi.NewTypeDesc(abi.TypeU8)), 1024)
+			Expect(err).To(MatchError("non-exhaustive pattern: Maybe(2)"))
+		})
+
+		It("should reject malformed TypeDescs", func() {
+			_, _, err := abi.UnmarshalValue(bytes.NewReader(nil), abi.TypeDesc{Type: abi.TypeMaybe}, 1024)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when marshaling to JSON", func() {
+		It("should marshal lists as arrays and records as objects in field order", func() {
+			list, err := abi.NewList(abi.NewTypeDesc(abi.TypeU8), abi.NewU8(1), abi.NewU8(2))
+			Expect(err).ToNot(HaveOccurred())
+			record, err := abi.NewRecord(
+				[]abi.RecordField{{Name: "b", Type: abi.TypeBool}, {Name: "a", Type: abi.TypeList}},
+				abi.NewBool(true), list,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			data, err := record.MarshalJSON()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal(`{"b":true,"a":["1","2"]}`))
+
+			data, err = abi.List{Elem: abi.NewTypeDesc(abi.TypeU8)}.MarshalJSON()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal(`[]`))
+
+			data, err = abi.NewSome(abi.NewU8(1)).MarshalJSON()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal(`"1"`))
+			data, err = abi.NewNone(abi.NewTypeDesc(abi.TypeU8)).MarshalJSON()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal(`null`))
+		})
+	})
+})
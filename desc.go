@@ -0,0 +1,382 @@
+package abi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/renproject/surge"
+)
+
+// A TypeDesc describes the Type of a value, including the Types of the values
+// nested inside of it. The binary encoding of lists, records and maybes does
+// not describe the Types of their elements and fields, so a TypeDesc is needed
+// to decode them.
+type TypeDesc struct {
+	Type Type `json:"type"`
+	// Elem describes the elements of a list, or the value of a maybe. It is
+	// only used by TypeList and TypeMaybe.
+	Elem *TypeDesc `json:"elem,omitempty"`
+	// Fields describes the fields of a record, in order. It is only used by
+	// TypeRecord.
+	Fields []FieldDesc `json:"fields,omitempty"`
+}
+
+// A FieldDesc describes a named field of a record.
+type FieldDesc struct {
+	Name string   `json:"name"`
+	Desc TypeDesc `json:"desc"`
+}
+
+// NewTypeDesc returns a TypeDesc for a bytes or scalar Type.
+func NewTypeDesc(ty Type) TypeDesc {
+	return TypeDesc{Type: ty}
+}
+
+// NewListDesc returns a TypeDesc for a list whose elements are described by
+// elem.
+func NewListDesc(elem TypeDesc) TypeDesc {
+	return TypeDesc{Type: TypeList, Elem: &elem}
+}
+
+// NewMaybeDesc returns a TypeDesc for a maybe whose value is described by
+// elem.
+func NewMaybeDesc(elem TypeDesc) TypeDesc {
+	return TypeDesc{Type: TypeMaybe, Elem: &elem}
+}
+
+// NewRecordDesc returns a TypeDesc for a record with the given fields.
+func NewRecordDesc(fields ...FieldDesc) TypeDesc {
+	return TypeDesc{Type: TypeRecord, Fields: fields}
+}
+
+// ParseTypeDesc parses a TypeDesc in the form returned by its String method,
+// for example "record{to:b32,amount:u256}". Whitespace between tokens is
+// ignored. TypeDescs are nested no deeper than the MaxDepth of the
+// DefaultLimits.
+func ParseTypeDesc(str string) (TypeDesc, error) {
+	p := textParser{text: str, limits: DefaultLimits()}
+	desc, err := p.desc(0)
+	if err != nil {
+		return TypeDesc{}, err
+	}
+	if p.skip(); p.pos != len(p.text) {
+		return TypeDesc{}, p.errorf("malformed: unexpected %q", p.text[p.pos:p.pos+1])
+	}
+	return desc, nil
+}
+
+// DescOf returns the TypeDesc of a value. Lists and maybes carry the TypeDesc
+// of their elements, so the TypeDesc of every value is complete, even when
+// lists are empty and maybes have no value.
+func DescOf(v Value) TypeDesc {
+	switch v := v.(type) {
+	case nil:
+		return TypeDesc{}
+	case List:
+		return NewListDesc(v.Elem)
+	case Maybe:
+		return NewMaybeDesc(v.Elem)
+	case Record:
+		fields := make([]FieldDesc, 0, len(v.Fields))
+		for i, field := range v.Fields {
+			desc := TypeDesc{Type: field.Type}
+			if i < len(v.Values) {
+				desc = DescOf(v.Values[i])
+			}
+			fields = append(fields, FieldDesc{Name: field.Name, Desc: desc})
+		}
+		return NewRecordDesc(fields...)
+	default:
+		return NewTypeDesc(v.Type())
+	}
+}
+
+// Equal returns true if two TypeDescs describe the same Type, with the same
+// nested Types and field names.
+func (desc TypeDesc) Equal(other TypeDesc) bool {
+	if desc.Type != other.Type || len(desc.Fields) != len(other.Fields) {
+		return false
+	}
+	if (desc.Elem == nil) != (other.Elem == nil) {
+		return false
+	}
+	if desc.Elem != nil && !desc.Elem.Equal(*other.Elem) {
+		return false
+	}
+	for i, field := range desc.Fields {
+		if field.Name != other.Fields[i].Name || !field.Desc.Equal(other.Fields[i].Desc) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the TypeDesc in the form "list<u256>", "maybe<str>" or
+// "record{to:b32,amount:u256}". Field names that are not identifiers are
+// quoted.
+func (desc TypeDesc) String() string {
+	switch desc.Type {
+	case TypeList, TypeMaybe:
+		if desc.Elem == nil {
+			return desc.Type.String() + "<?>"
+		}
+		return desc.Type.String() + "<" + desc.Elem.String() + ">"
+	case TypeRecord:
+		b := new(strings.Builder)
+		b.WriteString("record{")
+		for i, field := range desc.Fields {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if isTextName(field.Name) {
+				b.WriteString(field.Name)
+			} else {
+				b.WriteString(strconv.Quote(field.Name))
+			}
+			b.WriteByte(':')
+			b.WriteString(field.Desc.String())
+		}
+		b.WriteByte('}')
+		return b.String()
+	default:
+		return desc.Type.String()
+	}
+}
+
+// SizeHint returns the number of bytes required to represent the TypeDesc in
+// binary.
+func (desc TypeDesc) SizeHint() int {
+	size := desc.Type.SizeHint()
+	switch desc.Type {
+	case TypeList, TypeMaybe:
+		if desc.Elem != nil {
+			size += desc.Elem.SizeHint()
+		}
+	case TypeRecord:
+		size += 4
+		for _, field := range desc.Fields {
+			size += String(field.Name).SizeHint() + field.Desc.SizeHint()
+		}
+	}
+	return size
+}
+
+// Marshal the TypeDesc to binary. The binary encoding of a TypeDesc is its
+// Type, followed by the TypeDesc of the elements of a list or the value of a
+// maybe, or by a uint32 number of fields and the name and TypeDesc of each
+// field of a record. The TypeDesc of a bytes or scalar value is only its Type.
+// An error is returned if the TypeDesc is malformed.
+func (desc TypeDesc) Marshal(w io.Writer, m int) (int, error) {
+	if err := desc.validate(nil); err != nil {
+		return m, err
+	}
+	if m <= desc.SizeHint() {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	return writeWithin(w, appendDesc(make([]byte, 0, desc.SizeHint()), desc), m)
+}
+
+// Unmarshal the TypeDesc from binary. The TypeDesc is checked against the
+// DefaultLimits.
+func (desc *TypeDesc) Unmarshal(r io.Reader, m int) (int, error) {
+	d, m, err := unmarshalDesc(r, m, DefaultLimits(), 0)
+	if err != nil {
+		return m, err
+	}
+	*desc = d
+	return m, nil
+}
+
+// clone returns a deep copy of the TypeDesc.
+func (desc TypeDesc) clone() TypeDesc {
+	clone := TypeDesc{Type: desc.Type}
+	if desc.Elem != nil {
+		elem := desc.Elem.clone()
+		clone.Elem = &elem
+	}
+	if desc.Fields != nil {
+		clone.Fields = make([]FieldDesc, len(desc.Fields))
+		for i, field := range desc.Fields {
+			clone.Fields[i] = FieldDesc{Name: field.Name, Desc: field.Desc.clone()}
+		}
+	}
+	return clone
+}
+
+// validate returns an error if the TypeDesc, at the given Path, is malformed:
+// if it has an unknown Type, if a list or maybe has no element TypeDesc, or if
+// a record has two fields with the same name.
+func (desc TypeDesc) validate(path Path) error {
+	switch desc.Type {
+	case TypeList, TypeMaybe:
+		if desc.Elem == nil {
+			return fmt.Errorf("malformed: %v has no element type", path)
+		}
+		if desc.Type == TypeList {
+			return desc.Elem.validate(path.append(IndexSegment(0)))
+		}
+		return desc.Elem.validate(path)
+	case TypeRecord:
+		seen := make(map[string]struct{}, len(desc.Fields))
+		for _, field := range desc.Fields {
+			fieldPath := path.append(FieldSegment(field.Name))
+			if _, ok := seen[field.Name]; ok {
+				return fmt.Errorf("malformed: duplicate field %v", fieldPath)
+			}
+			seen[field.Name] = struct{}{}
+			if err := field.Desc.validate(fieldPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if !isPrimitive(desc.Type) {
+			return fmt.Errorf("non-exhaustive pattern: %v has type %v", path, desc.Type)
+		}
+		return nil
+	}
+}
+
+// isTextName returns true if the field name can be written without quotes.
+func isTextName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// minSize returns the smallest size of the binary encoding of a value that is
+// described by the TypeDesc.
+func (desc TypeDesc) minSize() int {
+	if size, ok := fixedSize(desc.Type); ok {
+		return size
+	}
+	switch desc.Type {
+	case TypeMaybe:
+		return 1
+	case TypeRecord:
+		size := 0
+		for _, field := range desc.Fields {
+			size += field.Desc.minSize()
+		}
+		return size
+	default:
+		return 4
+	}
+}
+
+// elemSize returns the smallest number of bytes that is charged for an element
+// of a list that is described by the TypeDesc. It is the smallest size of the
+// binary encoding of the element, except that elements with an empty binary
+// encoding, such as empty records, are charged one byte. Otherwise, a list of
+// empty records could be arbitrarily long without consuming any bytes.
+func (desc TypeDesc) elemSize() int {
+	if size := desc.minSize(); size > 0 {
+		return size
+	}
+	return 1
+}
+
+// chargeElems charges n elements of a list, which are described by the
+// TypeDesc, against the maximum number of bytes before any of them are read or
+// written, and returns the remaining budget. Elements with an empty binary
+// encoding consume one byte each when they are charged. All other elements are
+// only checked against the budget, and consume their bytes when they are read
+// or written.
+func (desc TypeDesc) chargeElems(n int, m int) (int, error) {
+	if uint64(n)*uint64(desc.elemSize()) >= uint64(m) {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	if desc.minSize() == 0 {
+		return m - n, nil
+	}
+	return m, nil
+}
+
+// appendDesc appends the binary encoding of a TypeDesc to dst, and returns the
+// extended slice.
+func appendDesc(dst []byte, desc TypeDesc) []byte {
+	dst = append(dst, 0, 0)
+	binary.BigEndian.PutUint16(dst[len(dst)-2:], uint16(desc.Type))
+	switch desc.Type {
+	case TypeList, TypeMaybe:
+		if desc.Elem != nil {
+			dst = appendDesc(dst, *desc.Elem)
+		}
+	case TypeRecord:
+		dst = appendUint32(dst, uint32(len(desc.Fields)))
+		for _, field := range desc.Fields {
+			dst = appendUint32(dst, uint32(len(field.Name)))
+			dst = append(dst, field.Name...)
+			dst = appendDesc(dst, field.Desc)
+		}
+	}
+	return dst
+}
+
+// unmarshalDesc unmarshals a TypeDesc at the given depth from binary, and
+// checks it against the Limits. Nested TypeDescs count towards the maximum
+// depth in the same way as the values that they describe.
+func unmarshalDesc(r io.Reader, m int, limits Limits, depth int) (TypeDesc, int, error) {
+	ty := TypeNil
+	m, err := ty.Unmarshal(r, m)
+	if err != nil {
+		return TypeDesc{}, m, err
+	}
+	switch ty {
+	case TypeList, TypeMaybe:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return TypeDesc{}, m, err
+		}
+		elem, m, err := unmarshalDesc(r, m, limits, depth+1)
+		if err != nil {
+			return TypeDesc{}, m, err
+		}
+		return TypeDesc{Type: ty, Elem: &elem}, m, nil
+
+	case TypeRecord:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return TypeDesc{}, m, err
+		}
+		var n uint32
+		if m, err = unmarshalWithin(r, &n, 4, m); err != nil {
+			return TypeDesc{}, m, err
+		}
+		if err := limits.checkRecordFields(int(n)); err != nil {
+			return TypeDesc{}, m, err
+		}
+		// Every field has at least a name length prefix and a Type.
+		if uint64(n)*6 >= uint64(m) {
+			return TypeDesc{}, m, surge.ErrMaxBytesExceeded
+		}
+		fields := make([]FieldDesc, n)
+		seen := make(map[string]struct{}, n)
+		for i := range fields {
+			var name Value
+			if name, m, err = decodeValue(r, NewTypeDesc(TypeString), m, limits, depth+1); err != nil {
+				return TypeDesc{}, m, err
+			}
+			fields[i].Name = string(name.(String))
+			if _, ok := seen[fields[i].Name]; ok {
+				return TypeDesc{}, m, fmt.Errorf("malformed: duplicate field %v", fields[i].Name)
+			}
+			seen[fields[i].Name] = struct{}{}
+			if fields[i].Desc, m, err = unmarshalDesc(r, m, limits, depth+1); err != nil {
+				return TypeDesc{}, m, err
+			}
+		}
+		return NewRecordDesc(fields...), m, nil
+
+	default:
+		return NewTypeDesc(ty), m, nil
+	}
+}
@@ -0,0 +1,150 @@
+package abi_test
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Type descriptors", func() {
+	u8 := abi.NewTypeDesc(abi.TypeU8)
+	output := abi.NewRecordDesc(
+		abi.FieldDesc{Name: "to", Desc: abi.NewTypeDesc(abi.TypeBytes32)},
+		abi.FieldDesc{Name: "amount", Desc: abi.NewTypeDesc(abi.TypeU256)},
+	)
+	descs := map[string]abi.TypeDesc{
+		"u8":                         u8,
+		"list<u256>":                 abi.NewListDesc(abi.NewTypeDesc(abi.TypeU256)),
+		"maybe<str>":                 abi.NewMaybeDesc(abi.NewTypeDesc(abi.TypeString)),
+		"record{}":                   abi.NewRecordDesc(),
+		"record{to:b32,amount:u256}": output,
+		`record{memo:maybe<str>,outputs:list<record{to:b32,amount:u256}>,"two words":list<list<b>>}`: abi.NewRecordDesc(
+			abi.FieldDesc{Name: "memo", Desc: abi.NewMaybeDesc(abi.NewTypeDesc(abi.TypeString))},
+			abi.FieldDesc{Name: "outputs", Desc: abi.NewListDesc(output)},
+			abi.FieldDesc{Name: "two words", Desc: abi.NewListDesc(abi.NewListDesc(abi.NewTypeDesc(abi.TypeBytes)))},
+		),
+	}
+
+	Context("when formatting", func() {
+		It("should describe nested types and quote field names that are not identifiers", func() {
+			for str, desc := range descs {
+				Expect(desc.String()).To(Equal(str))
+			}
+		})
+	})
+
+	Context("when comparing", func() {
+		It("should compare nested types and field names", func() {
+			for _, desc := range descs {
+				Expect(desc.Equal(desc)).To(BeTrue())
+			}
+			Expect(abi.NewListDesc(u8).Equal(abi.NewMaybeDesc(u8))).To(BeFalse())
+			Expect(abi.NewListDesc(u8).Equal(abi.NewListDesc(abi.NewTypeDesc(abi.TypeU16)))).To(BeFalse())
+			Expect(abi.NewRecordDesc(abi.FieldDesc{Name: "x", Desc: u8}).Equal(abi.NewRecordDesc(abi.FieldDesc{Name: "y", Desc: u8}))).To(BeFalse())
+		})
+	})
+
+	Context("when parsing", func() {
+		It("should return the same TypeDesc as String", func() {
+			for str, desc := range descs {
+				parsed, err := abi.ParseTypeDesc(str)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(parsed.Equal(desc)).To(BeTrue())
+				Expect(parsed.String()).To(Equal(str))
+			}
+			desc, err := abi.ParseTypeDesc(" record{ to : b32 , amount : list< u256 > , } ")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desc).To(Equal(abi.NewRecordDesc(
+				abi.FieldDesc{Name: "to", Desc: abi.NewTypeDesc(abi.TypeBytes32)},
+				abi.FieldDesc{Name: "amount", Desc: abi.NewListDesc(abi.NewTypeDesc(abi.TypeU256))},
+			)))
+		})
+
+		It("should return errors with the offset", func() {
+			for str, msg := range map[string]string{
+				"":                  "offset 0",
+				"u7":                "Type(u7)",
+				"list":              `expected "<"`,
+				"list<u8":           `expected ">"`,
+				"record{a:u8,a:u8}": "duplicate field a at offset 12",
+				"record{a u8}":      `expected ":"`,
+				"u8 u8":             "unexpected",
+			} {
+				_, err := abi.ParseTypeDesc(str)
+				Expect(err).To(MatchError(ContainSubstring(msg)), str)
+			}
+		})
+	})
+
+	Context("when marshaling and unmarshaling", func() {
+		It("should return the same TypeDesc", func() {
+			for _, desc := range descs {
+				data, err := surge.ToBinary(desc)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(HaveLen(desc.SizeHint()))
+
+				decoded := abi.TypeDesc{}
+				m, err := decoded.Unmarshal(bytes.NewReader(data), desc.SizeHint()+1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m).To(Equal(1))
+				Expect(decoded.Equal(desc)).To(BeTrue())
+
+				_, err = decoded.Unmarshal(bytes.NewReader(data), desc.SizeHint())
+				Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			}
+		})
+
+		It("should encode bytes and scalar TypeDescs as their Type", func() {
+			data, err := surge.ToBinary(abi.NewTypeDesc(abi.TypeU256))
+			Expect(err).ToNot(HaveOccurred())
+			expected, err := surge.ToBinary(abi.TypeU256)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(expected))
+		})
+
+		It("should reject malformed TypeDescs", func() {
+			_, err := surge.ToBinary(abi.TypeDesc{Type: abi.TypeList})
+			Expect(err).To(HaveOccurred())
+			_, err = surge.ToBinary(abi.NewRecordDesc(abi.FieldDesc{Name: "a", Desc: abi.NewTypeDesc(abi.TypeU8)}, abi.FieldDesc{Name: "a", Desc: abi.NewTypeDesc(abi.TypeU8)}))
+			Expect(err).To(HaveOccurred())
+
+			decoded := abi.TypeDesc{}
+			// A record with two fields named "a".
+			data := []byte{0, 103, 0, 0, 0, 2, 0, 0, 0, 1, 'a', 0, 12, 0, 0, 0, 1, 'a', 0, 12}
+			_, err = decoded.Unmarshal(bytes.NewReader(data), 1024)
+			Expect(err).To(MatchError(ContainSubstring("duplicate field")))
+			// A record with too many fields to fit into the remaining bytes.
+			data = []byte{0, 103, 0, 0, 0, 255}
+			_, err = decoded.Unmarshal(bytes.NewReader(data), 1024)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+
+		It("should limit the depth", func() {
+			data := []byte{}
+			for i := 0; i < 64; i++ {
+				data = append(data, 0, 102)
+			}
+			data = append(data, 0, 12)
+			decoded := abi.TypeDesc{}
+			_, err := decoded.Unmarshal(bytes.NewReader(data), 1024)
+			Expect(err).To(BeAssignableToTypeOf(abi.LimitError{}))
+		})
+	})
+
+	Context("when marshaling to JSON", func() {
+		It("should return the same TypeDesc", func() {
+			for _, desc := range descs {
+				data, err := json.Marshal(desc)
+				Expect(err).ToNot(HaveOccurred())
+				decoded := abi.TypeDesc{}
+				Expect(json.Unmarshal(data, &decoded)).To(Succeed())
+				Expect(decoded.Equal(desc)).To(BeTrue())
+			}
+		})
+	})
+})
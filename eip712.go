@@ -0,0 +1,556 @@
+package abi
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// EIP712TypeOf returns the EIP-712 type used to represent values of the given
+// Type. Bytes65 has no fixed size equivalent, so it is represented as dynamic
+// bytes. Returns false if the Type cannot be represented.
+func EIP712TypeOf(ty Type) (string, bool) {
+	switch ty {
+	case TypeString:
+		return "string", true
+	case TypeBytes, TypeBytes65:
+		return "bytes", true
+	case TypeBytes32:
+		return "bytes32", true
+	case TypeBool:
+		return "bool", true
+	case TypeU8:
+		return "uint8", true
+	case TypeU16:
+		return "uint16", true
+	case TypeU32:
+		return "uint32", true
+	case TypeU64:
+		return "uint64", true
+	case TypeU128:
+		return "uint128", true
+	case TypeU256:
+		return "uint256", true
+	default:
+		return "", false
+	}
+}
+
+// An EIP712Field is a named member of an EIP-712 struct type. Fields of
+// TypeRecord are nested struct types, described by Struct, and their values
+// are Records. Fields of TypeBytes that are marked as Address are EIP-712
+// addresses, and their values are Bytes of length 20. Array fields are EIP-712
+// arrays of the Type, and their values are Lists.
+type EIP712Field struct {
+	Name    string      `json:"name"`
+	Type    Type        `json:"type"`
+	Struct  *EIP712Type `json:"struct,omitempty"`
+	Address bool        `json:"address,omitempty"`
+	Array   bool        `json:"array,omitempty"`
+}
+
+// An EIP712Type describes an EIP-712 struct type whose members are ABI types.
+// Values of the type are given as a slice of values, one for each field, in
+// the same order as the fields.
+type EIP712Type struct {
+	Name   string
+	Fields []EIP712Field
+}
+
+// EIP712Names names the parts of an EIP712Type that cannot be derived from a
+// TypeDesc alone.
+type EIP712Names struct {
+	// Structs maps the String of the TypeDesc of a nested record, for example
+	// "record{name:str,wallet:b}", to the name of its struct type, for example
+	// "Person". Nested records that are not in the map are named after their
+	// field, with its first letter in upper case.
+	Structs map[string]string
+	// Addresses is the set of members that are EIP-712 addresses, given as the
+	// name of their struct type and their field name, for example
+	// "Person.wallet". These members must be bytes, or lists of bytes.
+	Addresses map[string]bool
+}
+
+// NewEIP712Type derives an EIP712Type from the TypeDesc of a record. Lists
+// become arrays, and records become nested struct types that are named after
+// their field, with its first letter in upper case. Values of the type are the
+// Values of a Record that is described by the TypeDesc.
+//
+// An error is returned if the TypeDesc is not a record, if a field name is not
+// an identifier, if a field is a maybe, which EIP-712 cannot represent, or if
+// a list holds another list.
+func NewEIP712Type(name string, desc TypeDesc) (EIP712Type, error) {
+	return NewEIP712TypeWithNames(name, desc, EIP712Names{})
+}
+
+// NewEIP712TypeWithNames derives an EIP712Type from the TypeDesc of a record in
+// the same way as NewEIP712Type, but names nested struct types and addresses
+// using the given EIP712Names. This is needed to derive most standard types,
+// such as "Mail(Person from,Person[] to,string contents)". An error is also
+// returned if an address is not bytes.
+func NewEIP712TypeWithNames(name string, desc TypeDesc, names EIP712Names) (EIP712Type, error) {
+	if err := desc.validate(nil); err != nil {
+		return EIP712Type{}, err
+	}
+	return newEIP712Type(name, desc, nil, names)
+}
+
+// EncodeType returns the EIP-712 encoding of the type, for example
+// "Transfer(bytes32 to,uint256 amount)". The encodings of nested struct types
+// follow the encoding of the type, sorted by name, for example
+// "Mail(Person from,string contents)Person(string name,bytes32 wallet)". An
+// error is returned if two different struct types have the same name.
+func (ty EIP712Type) EncodeType() (string, error) {
+	structs := map[string]EIP712Type{}
+	if err := ty.collectStructs(structs); err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(structs))
+	for name := range structs {
+		if name != ty.Name {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	encodedTy, err := ty.encodeOwnType()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range names {
+		encodedDep, err := structs[name].encodeOwnType()
+		if err != nil {
+			return "", err
+		}
+		encodedTy += encodedDep
+	}
+	return encodedTy, nil
+}
+
+// TypeHash returns the Keccak-256 hash of the encoded type.
+func (ty EIP712Type) TypeHash() (Bytes32, error) {
+	encodedTy, err := ty.EncodeType()
+	if err != nil {
+		return Bytes32{}, err
+	}
+	return keccak256([]byte(encodedTy)), nil
+}
+
+// HashStruct returns the EIP-712 hashStruct of the values, which is the
+// Keccak-256 hash of the type hash followed by the encoded data of each value.
+// An error is returned if the values do not match the fields of the type.
+func (ty EIP712Type) HashStruct(values []Value) (Bytes32, error) {
+	typeHash, err := ty.TypeHash()
+	if err != nil {
+		return Bytes32{}, err
+	}
+	if len(values) != len(ty.Fields) {
+		return Bytes32{}, fmt.Errorf("expected len=%v, got len=%v", len(ty.Fields), len(values))
+	}
+	return ty.hashStruct(typeHash, values)
+}
+
+// hashStruct returns the EIP-712 hashStruct of the values, given the type hash.
+func (ty EIP712Type) hashStruct(typeHash Bytes32, values []Value) (Bytes32, error) {
+	if len(values) != len(ty.Fields) {
+		return Bytes32{}, fmt.Errorf("expected len=%v, got len=%v", len(ty.Fields), len(values))
+	}
+	data := make([]byte, 0, 32*(len(values)+1))
+	data = append(data, typeHash[:]...)
+	for i, v := range values {
+		word, err := ty.Fields[i].encodeData(v)
+		if err != nil {
+			return Bytes32{}, err
+		}
+		data = append(data, word[:]...)
+	}
+	return keccak256(data), nil
+}
+
+// An EIP712Domain is the domain of an EIP-712 message. The name, version and
+// chain ID are always part of the domain. The verifying contract and salt are
+// only part of the domain when they are not nil.
+type EIP712Domain struct {
+	Name              string
+	Version           string
+	ChainID           U256
+	VerifyingContract *[20]byte
+	Salt              *Bytes32
+}
+
+// Separator returns the EIP-712 domain separator, which is the hashStruct of
+// the domain.
+func (domain EIP712Domain) Separator() Bytes32 {
+	typeHash := keccak256([]byte(domain.encodeType()))
+	name := keccak256([]byte(domain.Name))
+	version := keccak256([]byte(domain.Version))
+	chainID := domain.ChainID.bytes32()
+
+	data := make([]byte, 0, 32*6)
+	data = append(data, typeHash[:]...)
+	data = append(data, name[:]...)
+	data = append(data, version[:]...)
+	data = append(data, chainID[:]...)
+	if domain.VerifyingContract != nil {
+		// Addresses are left-padded to 32 bytes.
+		data = append(data, make([]byte, 12)...)
+		data = append(data, domain.VerifyingContract[:]...)
+	}
+	if domain.Salt != nil {
+		data = append(data, domain.Salt[:]...)
+	}
+	return keccak256(data)
+}
+
+// EIP712Digest returns the digest that is signed for an EIP-712 message, which
+// is the Keccak-256 hash of "\x19\x01", the domain separator, and the
+// hashStruct of the message.
+func EIP712Digest(domain EIP712Domain, ty EIP712Type, values []Value) (Bytes32, error) {
+	hashStruct, err := ty.HashStruct(values)
+	if err != nil {
+		return Bytes32{}, err
+	}
+	separator := domain.Separator()
+	data := make([]byte, 0, 66)
+	data = append(data, 0x19, 0x01)
+	data = append(data, separator[:]...)
+	data = append(data, hashStruct[:]...)
+	return keccak256(data), nil
+}
+
+// EIP712TypedData returns the JSON payload that wallets expect for
+// eth_signTypedData_v4. Integers are encoded as decimal strings, and bytes are
+// encoded as 0x-prefixed hex strings.
+func EIP712TypedData(domain EIP712Domain, ty EIP712Type, values []Value) ([]byte, error) {
+	if _, err := ty.HashStruct(values); err != nil {
+		return nil, err
+	}
+
+	type member struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	domainMembers := []member{{"name", "string"}, {"version", "string"}, {"chainId", "uint256"}}
+	domainValues := map[string]interface{}{
+		"name":    domain.Name,
+		"version": domain.Version,
+		"chainId": NewU256(domain.ChainID.bytes32()).String(),
+	}
+	if domain.VerifyingContract != nil {
+		domainMembers = append(domainMembers, member{"verifyingContract", "address"})
+		domainValues["verifyingContract"] = "0x" + hex.EncodeToString(domain.VerifyingContract[:])
+	}
+	if domain.Salt != nil {
+		domainMembers = append(domainMembers, member{"salt", "bytes32"})
+		domainValues["salt"] = "0x" + hex.EncodeToString(domain.Salt[:])
+	}
+
+	structs := map[string]EIP712Type{}
+	if err := ty.collectStructs(structs); err != nil {
+		return nil, err
+	}
+	types := map[string][]member{"EIP712Domain": domainMembers}
+	for name, structTy := range structs {
+		members := make([]member, len(structTy.Fields))
+		for i, field := range structTy.Fields {
+			eip712Ty, _ := field.eip712Type()
+			members[i] = member{field.Name, eip712Ty}
+		}
+		types[name] = members
+	}
+
+	return json.Marshal(struct {
+		Types       map[string][]member    `json:"types"`
+		PrimaryType string                 `json:"primaryType"`
+		Domain      map[string]interface{} `json:"domain"`
+		Message     map[string]interface{} `json:"message"`
+	}{
+		Types:       types,
+		PrimaryType: ty.Name,
+		Domain:      domainValues,
+		Message:     ty.jsonMessage(values),
+	})
+}
+
+// newEIP712Type derives an EIP712Type from the TypeDesc of a well-formed record
+// at the given Path.
+func newEIP712Type(name string, desc TypeDesc, path Path, names EIP712Names) (EIP712Type, error) {
+	if desc.Type != TypeRecord {
+		return EIP712Type{}, fmt.Errorf("non-exhaustive pattern: %v has type %v", path, desc)
+	}
+	ty := EIP712Type{Name: name, Fields: make([]EIP712Field, len(desc.Fields))}
+	for i, field := range desc.Fields {
+		fieldPath := path.append(FieldSegment(field.Name))
+		if !isTextName(field.Name) {
+			return EIP712Type{}, fmt.Errorf("malformed: %v is not an eip-712 member name", fieldPath)
+		}
+		eip712Field := EIP712Field{Name: field.Name}
+		elem := field.Desc
+		if elem.Type == TypeList {
+			eip712Field.Array, elem = true, *elem.Elem
+		}
+		switch elem.Type {
+		case TypeList, TypeMaybe:
+			return EIP712Type{}, fmt.Errorf("non-exhaustive pattern: %v has type %v", fieldPath, field.Desc)
+		case TypeRecord:
+			nestedName, ok := names.Structs[elem.String()]
+			if !ok {
+				nestedName = strings.ToUpper(field.Name[:1]) + field.Name[1:]
+			}
+			nested, err := newEIP712Type(nestedName, elem, fieldPath, names)
+			if err != nil {
+				return EIP712Type{}, err
+			}
+			eip712Field.Struct = &nested
+		}
+		if names.Addresses[name+"."+field.Name] {
+			if elem.Type != TypeBytes {
+				return EIP712Type{}, fmt.Errorf("non-exhaustive pattern: %v has type %v, expected address", fieldPath, field.Desc)
+			}
+			eip712Field.Address = true
+		}
+		eip712Field.Type = elem.Type
+		ty.Fields[i] = eip712Field
+	}
+	return ty, nil
+}
+
+// collectStructs adds the type, and every struct type nested inside of it, to
+// the struct types by name. An error is returned if a different struct type
+// with the same name has already been added.
+func (ty EIP712Type) collectStructs(structs map[string]EIP712Type) error {
+	encodedTy, err := ty.encodeOwnType()
+	if err != nil {
+		return err
+	}
+	if other, ok := structs[ty.Name]; ok {
+		if encodedOther, _ := other.encodeOwnType(); encodedOther != encodedTy {
+			return fmt.Errorf("malformed: duplicate struct type %v", ty.Name)
+		}
+		return nil
+	}
+	structs[ty.Name] = ty
+	for _, field := range ty.Fields {
+		if field.Struct != nil {
+			if err := field.Struct.collectStructs(structs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// encodeOwnType returns the EIP-712 encoding of the type, without the
+// encodings of nested struct types.
+func (ty EIP712Type) encodeOwnType() (string, error) {
+	b := new(strings.Builder)
+	b.WriteString(ty.Name)
+	b.WriteByte('(')
+	for i, field := range ty.Fields {
+		eip712Ty, err := field.eip712Type()
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, "%v %v", eip712Ty, field.Name)
+	}
+	b.WriteByte(')')
+	return b.String(), nil
+}
+
+// jsonMessage returns the representation of the values in the JSON payload
+// expected by wallets. The values must already have been checked by
+// HashStruct.
+func (ty EIP712Type) jsonMessage(values []Value) map[string]interface{} {
+	message := make(map[string]interface{}, len(ty.Fields))
+	for i, field := range ty.Fields {
+		message[field.Name] = field.jsonValue(values[i])
+	}
+	return message
+}
+
+// eip712Type returns the EIP-712 type of the field, for example "uint256",
+// "Person" or "Person[]".
+func (field EIP712Field) eip712Type() (string, error) {
+	eip712Ty, ok := EIP712TypeOf(field.Type)
+	if field.Type == TypeRecord && field.Struct != nil {
+		eip712Ty, ok = field.Struct.Name, true
+	}
+	if field.Address {
+		eip712Ty, ok = "address", field.Type == TypeBytes
+	}
+	if !ok {
+		return "", fmt.Errorf("non-exhaustive pattern: field %v has type %v", field.Name, field.Type)
+	}
+	if field.Array {
+		eip712Ty += "[]"
+	}
+	return eip712Ty, nil
+}
+
+// encodeData returns the EIP-712 encoding of the value of the field as a 32
+// byte word. Arrays are encoded as the Keccak-256 hash of the concatenated
+// encodings of their elements, and structs are encoded as their hashStruct.
+func (field EIP712Field) encodeData(v Value) (Bytes32, error) {
+	if !field.Array {
+		return field.encodeElem(v)
+	}
+	list, ok := v.(List)
+	if !ok {
+		return Bytes32{}, fmt.Errorf("expected field %v to have type %v, got type %v", field.Name, TypeList, typeOf(v))
+	}
+	data := make([]byte, 0, 32*len(list.Elems))
+	for _, elem := range list.Elems {
+		word, err := field.encodeElem(elem)
+		if err != nil {
+			return Bytes32{}, err
+		}
+		data = append(data, word[:]...)
+	}
+	return keccak256(data), nil
+}
+
+// encodeElem returns the EIP-712 encoding of a value of the field, or of an
+// element of an array field, as a 32 byte word.
+func (field EIP712Field) encodeElem(v Value) (Bytes32, error) {
+	if field.Type == TypeRecord && field.Struct != nil {
+		record, ok := v.(Record)
+		if !ok {
+			return Bytes32{}, fmt.Errorf("expected field %v to have type %v, got type %v", field.Name, TypeRecord, typeOf(v))
+		}
+		for i, recordField := range record.Fields {
+			if i < len(field.Struct.Fields) && recordField.Name != field.Struct.Fields[i].Name {
+				return Bytes32{}, fmt.Errorf("expected field %v, got field %v", field.Struct.Fields[i].Name, recordField.Name)
+			}
+		}
+		return field.Struct.HashStruct(record.Values)
+	}
+	if v == nil || v.Type() != field.Type {
+		return Bytes32{}, fmt.Errorf("expected field %v to have type %v, got type %v", field.Name, field.Type, typeOf(v))
+	}
+	if field.Address {
+		address, ok := v.(Bytes)
+		if !ok || len(address) != 20 {
+			return Bytes32{}, fmt.Errorf("expected field %v to be an address, got len=%v", field.Name, len(address))
+		}
+		// Addresses are left-padded to 32 bytes.
+		word := Bytes32{}
+		copy(word[12:], address)
+		return word, nil
+	}
+	return eip712EncodeValue(v)
+}
+
+// jsonValue returns the representation of a value of the field in the JSON
+// payload expected by wallets. Arrays are JSON arrays, and structs are JSON
+// objects.
+func (field EIP712Field) jsonValue(v Value) interface{} {
+	if field.Array {
+		list := v.(List)
+		elems := make([]interface{}, len(list.Elems))
+		elemField := field
+		elemField.Array = false
+		for i, elem := range list.Elems {
+			elems[i] = elemField.jsonValue(elem)
+		}
+		return elems
+	}
+	if field.Struct != nil {
+		return field.Struct.jsonMessage(v.(Record).Values)
+	}
+	return eip712JSONValue(v)
+}
+
+// encodeType returns the encoded type of the domain.
+func (domain EIP712Domain) encodeType() string {
+	encodedTy := "EIP712Domain(string name,string version,uint256 chainId"
+	if domain.VerifyingContract != nil {
+		encodedTy += ",address verifyingContract"
+	}
+	if domain.Salt != nil {
+		encodedTy += ",bytes32 salt"
+	}
+	return encodedTy + ")"
+}
+
+// eip712EncodeValue returns the EIP-712 encoding of a value as a 32 byte word.
+// Dynamic types are encoded as their Keccak-256 hash, and atomic types are
+// left-padded (integers) or right-padded (fixed size bytes).
+func eip712EncodeValue(v Value) (Bytes32, error) {
+	word := Bytes32{}
+	switch v := v.(type) {
+	case String:
+		return keccak256([]byte(v)), nil
+	case Bytes:
+		return keccak256(v), nil
+	case Bytes65:
+		return keccak256(v[:]), nil
+	case Signature:
+		return keccak256(v.Bytes65[:]), nil
+	case Bytes32:
+		return v, nil
+	case Bool:
+		if v.inner {
+			word[31] = 1
+		}
+		return word, nil
+	case U8:
+		return NewU256FromU8(v).bytes32(), nil
+	case U16:
+		return NewU256FromU16(v).bytes32(), nil
+	case U32:
+		return NewU256FromU32(v).bytes32(), nil
+	case U64:
+		return NewU256FromU64(v).bytes32(), nil
+	case U128:
+		if v.inner == nil {
+			return word, nil
+		}
+		return NewU256FromU128(v).bytes32(), nil
+	case U256:
+		return v.bytes32(), nil
+	default:
+		return word, fmt.Errorf("non-exhaustive pattern: %T", v)
+	}
+}
+
+// eip712JSONValue returns the representation of a value in the JSON payload
+// expected by wallets.
+func eip712JSONValue(v Value) interface{} {
+	switch v := v.(type) {
+	case String:
+		return string(v)
+	case Bytes:
+		return "0x" + hex.EncodeToString(v)
+	case Bytes32:
+		return "0x" + hex.EncodeToString(v[:])
+	case Bytes65:
+		return "0x" + hex.EncodeToString(v[:])
+	case Signature:
+		return "0x" + hex.EncodeToString(v.Bytes65[:])
+	case Bool:
+		return v.inner
+	case U128:
+		word, _ := eip712EncodeValue(v)
+		return NewU256(word).String()
+	case U256:
+		return NewU256(v.bytes32()).String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// keccak256 returns the legacy Keccak-256 hash of data.
+func keccak256(data []byte) Bytes32 {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	digest := Bytes32{}
+	copy(digest[:], h.Sum(nil))
+	return digest
+}
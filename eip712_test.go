@@ -0,0 +1,262 @@
+package abi_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/renproject/abi"
+	"golang.org/x/crypto/sha3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EIP-712", func() {
+	keccak256 := func(data []byte) []byte {
+		h := sha3.NewLegacyKeccak256()
+		h.Write(data)
+		return h.Sum(nil)
+	}
+
+	transfer := abi.EIP712Type{
+		Name: "Transfer",
+		Fields: []abi.EIP712Field{
+			{Name: "to", Type: abi.TypeBytes32},
+			{Name: "amount", Type: abi.TypeU256},
+			{Name: "memo", Type: abi.TypeString},
+			{Name: "urgent", Type: abi.TypeBool},
+		},
+	}
+	values := []abi.Value{
+		abi.Bytes32{1, 2, 3},
+		abi.NewU256FromU64(abi.NewU64(1000)),
+		abi.String("hello"),
+		abi.NewBool(true),
+	}
+
+	contract := [20]byte{}
+	for i := range contract {
+		contract[i] = 0xcc
+	}
+	domain := abi.EIP712Domain{
+		Name:              "Ether Mail",
+		Version:           "1",
+		ChainID:           abi.NewU256FromU8(abi.NewU8(1)),
+		VerifyingContract: &contract,
+	}
+
+	Context("when encoding a type", func() {
+		It("should list the members with their solidity types", func() {
+			encodedTy, err := transfer.EncodeType()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encodedTy).To(Equal("Transfer(bytes32 to,uint256 amount,string memo,bool urgent)"))
+
+			typeHash, err := transfer.TypeHash()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(typeHash[:]).To(Equal(keccak256([]byte(encodedTy))))
+		})
+
+		It("should return an error for unsupported types", func() {
+			_, err := abi.EIP712Type{Name: "T", Fields: []abi.EIP712Field{{Name: "x", Type: abi.TypeList}}}.EncodeType()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when hashing a struct", func() {
+		It("should hash the type hash and the encoded values", func() {
+			typeHash, err := transfer.TypeHash()
+			Expect(err).ToNot(HaveOccurred())
+			data := append([]byte{}, typeHash[:]...)
+			to := values[0].(abi.Bytes32)
+			data = append(data, to[:]...)
+			amount := make([]byte, 32)
+			amount[30], amount[31] = 0x03, 0xe8
+			data = append(data, amount...)
+			data = append(data, keccak256([]byte("hello"))...)
+			urgent := make([]byte, 32)
+			urgent[31] = 1
+			data = append(data, urgent...)
+
+			hashStruct, err := transfer.HashStruct(values)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hashStruct[:]).To(Equal(keccak256(data)))
+		})
+
+		It("should encode signatures in the same way as their bytes", func() {
+			signed := abi.EIP712Type{Name: "Signed", Fields: []abi.EIP712Field{{Name: "sig", Type: abi.TypeBytes65}}}
+			b65 := abi.Bytes65{1, 2, 3}
+			expected, err := signed.HashStruct([]abi.Value{b65})
+			Expect(err).ToNot(HaveOccurred())
+			hashStruct, err := signed.HashStruct([]abi.Value{abi.Signature{Bytes65: b65}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hashStruct).To(Equal(expected))
+
+			data, err := abi.EIP712TypedData(domain, signed, []abi.Value{abi.Signature{Bytes65: b65}})
+			Expect(err).ToNot(HaveOccurred())
+			typedData := map[string]interface{}{}
+			Expect(json.Unmarshal(data, &typedData)).To(Succeed())
+			Expect(typedData["message"]).To(Equal(map[string]interface{}{"sig": "0x" + hex.EncodeToString(b65[:])}))
+		})
+
+		It("should return an error if the values do not match the fields", func() {
+			_, err := transfer.HashStruct(values[:3])
+			Expect(err).To(HaveOccurred())
+
+			_, err = transfer.HashStruct([]abi.Value{values[0], abi.NewU64(1000), values[2], values[3]})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when deriving a type from a type desc", func() {
+		// The example from the EIP-712 specification.
+		mailDesc, err := abi.ParseTypeDesc("record{from:record{name:str,wallet:b},to:record{name:str,wallet:b},contents:str}")
+		if err != nil {
+			panic(err)
+		}
+		mail := abi.MustParseText(`record{from: record{name: str("Cow"), wallet: b(0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826)}, ` +
+			`to: record{name: str("Bob"), wallet: b(0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb)}, ` +
+			`contents: str("Hello, Bob!")}`).(abi.Record)
+		names := abi.EIP712Names{
+			Structs:   map[string]string{"record{name:str,wallet:b}": "Person"},
+			Addresses: map[string]bool{"Person.wallet": true},
+		}
+
+		It("should encode nested struct types after the primary type", func() {
+			ty, err := abi.NewEIP712TypeWithNames("Mail", mailDesc, names)
+			Expect(err).ToNot(HaveOccurred())
+			encodedTy, err := ty.EncodeType()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encodedTy).To(Equal("Mail(Person from,Person to,string contents)Person(string name,address wallet)"))
+
+			listDesc, err := abi.ParseTypeDesc("record{from:record{name:str,wallet:b},to:list<record{name:str,wallet:b}>,contents:str}")
+			Expect(err).ToNot(HaveOccurred())
+			ty, err = abi.NewEIP712TypeWithNames("Mail", listDesc, names)
+			Expect(err).ToNot(HaveOccurred())
+			encodedTy, err = ty.EncodeType()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encodedTy).To(Equal("Mail(Person from,Person[] to,string contents)Person(string name,address wallet)"))
+		})
+
+		It("should name nested struct types after their field by default", func() {
+			ty, err := abi.NewEIP712Type("Mail", mailDesc)
+			Expect(err).ToNot(HaveOccurred())
+			encodedTy, err := ty.EncodeType()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encodedTy).To(Equal("Mail(From from,To to,string contents)From(string name,bytes wallet)To(string name,bytes wallet)"))
+		})
+
+		It("should match the digest of the specification", func() {
+			ty, err := abi.NewEIP712TypeWithNames("Mail", mailDesc, names)
+			Expect(err).ToNot(HaveOccurred())
+
+			typeHash, err := ty.TypeHash()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hex.EncodeToString(typeHash[:])).To(Equal("a0cedeb2dc280ba39b857546d74f5549c3a1d7bdc2dd96bf881f76108e23dac2"))
+			hashStruct, err := ty.HashStruct(mail.Values)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hex.EncodeToString(hashStruct[:])).To(Equal("c52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e"))
+			digest, err := abi.EIP712Digest(domain, ty, mail.Values)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hex.EncodeToString(digest[:])).To(Equal("be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2"))
+
+			_, err = ty.HashStruct([]abi.Value{mail.Values[2], mail.Values[1], mail.Values[0]})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error for addresses of the wrong length", func() {
+			ty, err := abi.NewEIP712TypeWithNames("Mail", mailDesc, names)
+			Expect(err).ToNot(HaveOccurred())
+			from := abi.MustParseText(`record{name: str("Cow"), wallet: b(0xcd2a)}`)
+			_, err = ty.HashStruct([]abi.Value{from, mail.Values[1], mail.Values[2]})
+			Expect(err).To(HaveOccurred())
+
+			_, err = abi.NewEIP712TypeWithNames("Mail", mailDesc, abi.EIP712Names{Addresses: map[string]bool{"Mail.contents": true}})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should produce nested json", func() {
+			ty, err := abi.NewEIP712TypeWithNames("Mail", mailDesc, names)
+			Expect(err).ToNot(HaveOccurred())
+			data, err := abi.EIP712TypedData(domain, ty, mail.Values)
+			Expect(err).ToNot(HaveOccurred())
+
+			typedData := map[string]interface{}{}
+			Expect(json.Unmarshal(data, &typedData)).To(Succeed())
+			types := typedData["types"].(map[string]interface{})
+			Expect(types).To(HaveKey("Mail"))
+			Expect(types["Person"]).To(Equal([]interface{}{
+				map[string]interface{}{"name": "name", "type": "string"},
+				map[string]interface{}{"name": "wallet", "type": "address"},
+			}))
+			Expect(typedData["message"].(map[string]interface{})["to"]).To(Equal(
+				map[string]interface{}{"name": "Bob", "wallet": "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"},
+			))
+		})
+
+		It("should return an error for types that cannot be represented", func() {
+			for _, text := range []string{
+				"u8",
+				"record{a:maybe<u8>}",
+				"record{a:list<list<u8>>}",
+				`record{"a b":u8}`,
+			} {
+				desc, err := abi.ParseTypeDesc(text)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = abi.NewEIP712Type("T", desc)
+				Expect(err).To(HaveOccurred(), text)
+			}
+
+			desc, err := abi.ParseTypeDesc("record{a:record{x:u8},b:list<record{a:record{y:u8}}>}")
+			Expect(err).ToNot(HaveOccurred())
+			ty, err := abi.NewEIP712Type("T", desc)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = ty.EncodeType()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when computing the domain separator", func() {
+		It("should match the reference implementation", func() {
+			separator := domain.Separator()
+			Expect(hex.EncodeToString(separator[:])).To(Equal("f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f"))
+		})
+	})
+
+	Context("when computing the digest", func() {
+		It("should hash the prefix, domain separator and struct hash", func() {
+			separator := domain.Separator()
+			hashStruct, err := transfer.HashStruct(values)
+			Expect(err).ToNot(HaveOccurred())
+
+			digest, err := abi.EIP712Digest(domain, transfer, values)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(digest[:]).To(Equal(keccak256(append(append([]byte{0x19, 0x01}, separator[:]...), hashStruct[:]...))))
+		})
+	})
+
+	Context("when producing typed data", func() {
+		It("should produce the json expected by wallets", func() {
+			data, err := abi.EIP712TypedData(domain, transfer, values)
+			Expect(err).ToNot(HaveOccurred())
+
+			typedData := map[string]interface{}{}
+			Expect(json.Unmarshal(data, &typedData)).To(Succeed())
+			Expect(typedData["primaryType"]).To(Equal("Transfer"))
+			Expect(typedData["domain"]).To(Equal(map[string]interface{}{
+				"name":              "Ether Mail",
+				"version":           "1",
+				"chainId":           "1",
+				"verifyingContract": "0xcccccccccccccccccccccccccccccccccccccccc",
+			}))
+			Expect(typedData["message"]).To(Equal(map[string]interface{}{
+				"to":     "0x0102030000000000000000000000000000000000000000000000000000000000",
+				"amount": "1000",
+				"memo":   "hello",
+				"urgent": true,
+			}))
+			types := typedData["types"].(map[string]interface{})
+			Expect(types["Transfer"]).To(HaveLen(4))
+			Expect(types["EIP712Domain"]).To(HaveLen(4))
+		})
+	})
+})
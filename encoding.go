@@ -0,0 +1,390 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/renproject/surge"
+)
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (str String) MarshalBinary() ([]byte, error) {
+	return marshalBinary(str)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (str *String) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(data, str)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (str String) MarshalText() ([]byte, error) {
+	return []byte(str), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (str *String) UnmarshalText(text []byte) error {
+	if len(text) > MaxBytes {
+		return surge.ErrMaxBytesExceeded
+	}
+	*str = String(text)
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (b Bytes) MarshalBinary() ([]byte, error) {
+	return marshalBinary(b)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (b *Bytes) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(data, b)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. Bytes are
+// marshaled as unpadded standard base64 (RFC 4648).
+func (b Bytes) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (b *Bytes) UnmarshalText(text []byte) error {
+	data, err := decodeBase64Text(text)
+	if err != nil {
+		return err
+	}
+	*b = data
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (b32 Bytes32) MarshalBinary() ([]byte, error) {
+	return marshalBinary(b32)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (b32 *Bytes32) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(data, b32)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. Bytes32 are
+// marshaled as unpadded standard base64 (RFC 4648).
+func (b32 Bytes32) MarshalText() ([]byte, error) {
+	return []byte(b32.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (b32 *Bytes32) UnmarshalText(text []byte) error {
+	data, err := decodeBase64Text(text)
+	if err != nil {
+		return err
+	}
+	if len(data) != 32 {
+		return fmt.Errorf("expected len=32, got len=%v", len(data))
+	}
+	copy(b32[:], data)
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (b65 Bytes65) MarshalBinary() ([]byte, error) {
+	return marshalBinary(b65)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (b65 *Bytes65) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(data, b65)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. Bytes65 are
+// marshaled as unpadded standard base64 (RFC 4648).
+func (b65 Bytes65) MarshalText() ([]byte, error) {
+	return []byte(b65.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (b65 *Bytes65) UnmarshalText(text []byte) error {
+	data, err := decodeBase64Text(text)
+	if err != nil {
+		return err
+	}
+	if len(data) != 65 {
+		return fmt.Errorf("expected len=65, got len=%v", len(data))
+	}
+	copy(b65[:], data)
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (b Bool) MarshalBinary() ([]byte, error) {
+	return marshalBinary(b)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (b *Bool) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(data, b)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. Bools are
+// marshaled as "true" or "false".
+func (b Bool) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (b *Bool) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "true":
+		b.inner = true
+	case "false":
+		b.inner = false
+	default:
+		return fmt.Errorf("malformed: Bool(%v)", string(text))
+	}
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (u8 U8) MarshalBinary() ([]byte, error) {
+	return marshalBinary(u8)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (u8 *U8) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(data, u8)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. U8s are
+// marshaled as base 10 integers, with no sign and no leading zeros.
+func (u8 U8) MarshalText() ([]byte, error) {
+	return []byte(u8.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (u8 *U8) UnmarshalText(text []byte) error {
+	x, err := strconv.ParseUint(string(text), 10, 8)
+	if err != nil {
+		return err
+	}
+	u8.inner = uint8(x)
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (u16 U16) MarshalBinary() ([]byte, error) {
+	return marshalBinary(u16)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (u16 *U16) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(data, u16)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. U16s are
+// marshaled as base 10 integers, with no sign and no leading zeros.
+func (u16 U16) MarshalText() ([]byte, error) {
+	return []byte(u16.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (u16 *U16) UnmarshalText(text []byte) error {
+	x, err := strconv.ParseUint(string(text), 10, 16)
+	if err != nil {
+		return err
+	}
+	u16.inner = uint16(x)
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (u32 U32) MarshalBinary() ([]byte, error) {
+	return marshalBinary(u32)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (u32 *U32) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(data, u32)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. U32s are
+// marshaled as base 10 integers, with no sign and no leading zeros.
+func (u32 U32) MarshalText() ([]byte, error) {
+	return []byte(u32.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (u32 *U32) UnmarshalText(text []byte) error {
+	x, err := strconv.ParseUint(string(text), 10, 32)
+	if err != nil {
+		return err
+	}
+	u32.inner = uint32(x)
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (u64 U64) MarshalBinary() ([]byte, error) {
+	return marshalBinary(u64)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (u64 *U64) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(data, u64)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. U64s are
+// marshaled as base 10 integers, with no sign and no leading zeros.
+func (u64 U64) MarshalText() ([]byte, error) {
+	return []byte(u64.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (u64 *U64) UnmarshalText(text []byte) error {
+	x, err := strconv.ParseUint(string(text), 10, 64)
+	if err != nil {
+		return err
+	}
+	u64.inner = x
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (u128 U128) MarshalBinary() ([]byte, error) {
+	return marshalBinary(u128)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (u128 *U128) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(data, u128)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. U128s are
+// marshaled as base 10 integers, with no sign and no leading zeros. A nil
+// integer is marshaled as "0".
+func (u128 U128) MarshalText() ([]byte, error) {
+	if u128.inner == nil {
+		return []byte("0"), nil
+	}
+	return []byte(u128.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (u128 *U128) UnmarshalText(text []byte) error {
+	x, err := parseBigIntText(text, MaxU128.inner, "U128")
+	if err != nil {
+		return err
+	}
+	u128.inner = x
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (u256 U256) MarshalBinary() ([]byte, error) {
+	return marshalBinary(u256)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (u256 *U256) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(data, u256)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. U256s are
+// marshaled as base 10 integers, with no sign and no leading zeros. A nil
+// integer is marshaled as "0".
+func (u256 U256) MarshalText() ([]byte, error) {
+	if u256.inner == nil {
+		return []byte("0"), nil
+	}
+	return []byte(u256.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (u256 *U256) UnmarshalText(text []byte) error {
+	x, err := parseBigIntText(text, MaxU256.inner, "U256")
+	if err != nil {
+		return err
+	}
+	u256.inner = x
+	return nil
+}
+
+// marshalBinary marshals a value to binary, using at most MaxBytes.
+func marshalBinary(v surge.Marshaler) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Grow(v.SizeHint())
+	if _, err := v.Marshal(buf, MaxBytes); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalBinary unmarshals a value from binary, using at most MaxBytes. An
+// error is returned if the value does not consume all of the data.
+func unmarshalBinary(data []byte, v surge.Unmarshaler) error {
+	r := bytes.NewReader(data)
+	if _, err := v.Unmarshal(r, MaxBytes); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("malformed: %v unexpected bytes", r.Len())
+	}
+	return nil
+}
+
+// decodeBase64Text decodes unpadded base64 text, using at most MaxBytes.
+func decodeBase64Text(text []byte) ([]byte, error) {
+	enc := base64.StdEncoding.WithPadding(base64.NoPadding)
+	if enc.DecodedLen(len(text)) > MaxBytes {
+		return nil, surge.ErrMaxBytesExceeded
+	}
+	data := make([]byte, enc.DecodedLen(len(text)))
+	n, err := enc.Decode(data, text)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// maxBigIntTextLen is the number of decimal digits in the largest U256. Text
+// that is longer than this is rejected before it is parsed.
+const maxBigIntTextLen = 78
+
+// maxErrorTextLen is the number of bytes of malformed text that are included
+// in an error.
+const maxErrorTextLen = 32
+
+// parseBigIntText parses a decimal integer in the range [0, max]. Signs are
+// rejected, including "+" and "-0", because they are never produced by
+// MarshalText. The name of the type is used in errors, along with the text,
+// which is truncated so that large inputs do not produce large errors.
+func parseBigIntText(text []byte, max *big.Int, name string) (*big.Int, error) {
+	if len(text) > maxBigIntTextLen {
+		return nil, fmt.Errorf("overflow: %v(%v) has more than %v digits", name, truncateText(text), maxBigIntTextLen)
+	}
+	if len(text) > 0 && text[0] == '+' {
+		return nil, fmt.Errorf("malformed: %v(%v)", name, truncateText(text))
+	}
+	if len(text) > 0 && text[0] == '-' {
+		return nil, fmt.Errorf("underflow: %v(%v)", name, truncateText(text))
+	}
+	x, ok := new(big.Int).SetString(string(text), 10)
+	if !ok {
+		return nil, fmt.Errorf("malformed: %v(%v)", name, truncateText(text))
+	}
+	if x.Cmp(max) > 0 {
+		return nil, fmt.Errorf("overflow: %v(%v)", name, truncateText(text))
+	}
+	return x, nil
+}
+
+// truncateText returns the text as a string for use in an error, truncated to
+// at most maxErrorTextLen bytes.
+func truncateText(text []byte) string {
+	if len(text) <= maxErrorTextLen {
+		return string(text)
+	}
+	return string(text[:maxErrorTextLen]) + "..."
+}
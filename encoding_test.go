@@ -0,0 +1,232 @@
+package abi_test
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encoding", func() {
+	type marshaler interface {
+		encoding.BinaryMarshaler
+		encoding.TextMarshaler
+	}
+	type unmarshaler interface {
+		encoding.BinaryUnmarshaler
+		encoding.TextUnmarshaler
+	}
+
+	Context("when marshaling and unmarshaling", func() {
+		It("should equal itself", func() {
+			f := func(x uint64, y [32]byte, z []byte, s string, b bool) bool {
+				cases := []struct {
+					v     marshaler
+					empty unmarshaler
+				}{
+					{abi.String(s), new(abi.String)},
+					{abi.Bytes(z), new(abi.Bytes)},
+					{abi.Bytes32(y), new(abi.Bytes32)},
+					{abi.Bytes65{y[0]}, new(abi.Bytes65)},
+					{abi.NewBool(b), new(abi.Bool)},
+					{abi.NewU8(uint8(x)), new(abi.U8)},
+					{abi.NewU16(uint16(x)), new(abi.U16)},
+					{abi.NewU32(uint32(x)), new(abi.U32)},
+					{abi.NewU64(x), new(abi.U64)},
+					{abi.NewU128FromU64(abi.NewU64(x)), new(abi.U128)},
+					{abi.NewU256(y), new(abi.U256)},
+				}
+				for _, c := range cases {
+					data, err := c.v.MarshalBinary()
+					Expect(err).ToNot(HaveOccurred())
+					expected, err := surge.ToBinary(c.v)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(data).To(Equal(expected))
+					Expect(c.empty.UnmarshalBinary(data)).To(Succeed())
+					Expect(c.empty).To(Equal(normalize(c.v)))
+
+					text, err := c.v.MarshalText()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(string(text)).To(Equal(fmt.Sprint(c.v)))
+					Expect(c.empty.UnmarshalText(text)).To(Succeed())
+					Expect(c.empty).To(Equal(normalize(c.v)))
+				}
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
+
+	Context("when unmarshaling malformed data", func() {
+		It("should return an error", func() {
+			u64 := abi.U64{}
+			Expect(u64.UnmarshalBinary(make([]byte, 7))).ToNot(Succeed())
+			Expect(u64.UnmarshalBinary(make([]byte, 9))).ToNot(Succeed())
+			Expect(u64.UnmarshalText([]byte("-1"))).ToNot(Succeed())
+			Expect(u64.UnmarshalText([]byte("18446744073709551616"))).ToNot(Succeed())
+
+			u8 := abi.U8{}
+			Expect(u8.UnmarshalText([]byte("256"))).ToNot(Succeed())
+
+			u128 := abi.U128{}
+			Expect(u128.UnmarshalText([]byte("340282366920938463463374607431768211456"))).ToNot(Succeed())
+			Expect(u128.UnmarshalText([]byte("-1"))).ToNot(Succeed())
+			Expect(u128.UnmarshalText([]byte("0x1"))).ToNot(Succeed())
+
+			b := abi.Bool{}
+			Expect(b.UnmarshalText([]byte("yes"))).ToNot(Succeed())
+
+			b32 := abi.Bytes32{}
+			Expect(b32.UnmarshalText([]byte("AAAA"))).ToNot(Succeed())
+
+			bs := abi.Bytes{}
+			Expect(bs.UnmarshalBinary([]byte{0xff, 0xff, 0xff, 0xff})).ToNot(Succeed())
+		})
+	})
+
+	Context("when unmarshaling text with too many digits", func() {
+		It("should return a short error", func() {
+			u256 := abi.U256{}
+			Expect(u256.UnmarshalText([]byte(abi.MaxU256.String()))).To(Succeed())
+			Expect(u256.Equal(abi.MaxU256)).To(BeTrue())
+
+			// Leading zeros still count towards the number of digits.
+			err := u256.UnmarshalText([]byte("0" + abi.MaxU256.String()))
+			Expect(err).To(HaveOccurred())
+
+			text := strings.Repeat("1", 1<<20)
+			err = u256.UnmarshalText([]byte(text))
+			Expect(err).To(HaveOccurred())
+			Expect(len(err.Error())).To(BeNumerically("<", 100))
+
+			u128 := abi.U128{}
+			err = u128.UnmarshalText([]byte(strings.Repeat("x", 1<<20)))
+			Expect(err).To(HaveOccurred())
+			Expect(len(err.Error())).To(BeNumerically("<", 100))
+		})
+	})
+
+	Context("when unmarshaling text with a sign", func() {
+		It("should return an error", func() {
+			for _, text := range []string{"+1", "+0", "-0", "-1"} {
+				Expect(new(abi.U8).UnmarshalText([]byte(text))).ToNot(Succeed(), text)
+				Expect(new(abi.U64).UnmarshalText([]byte(text))).ToNot(Succeed(), text)
+				Expect(new(abi.U128).UnmarshalText([]byte(text))).ToNot(Succeed(), text)
+				Expect(new(abi.U256).UnmarshalText([]byte(text))).ToNot(Succeed(), text)
+			}
+		})
+	})
+
+	Context("when marshaling zero values", func() {
+		It("should marshal a nil integer as zero", func() {
+			data, err := abi.U128{}.MarshalBinary()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(make([]byte, 16)))
+
+			data, err = abi.U256{}.MarshalBinary()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(make([]byte, 32)))
+
+			u256 := abi.U256{}
+			Expect(u256.UnmarshalBinary(data)).To(Succeed())
+			Expect(u256.Equal(abi.NewU256([32]byte{}))).To(BeTrue())
+		})
+	})
+
+	Context("when using the standard library", func() {
+		It("should be usable as json map keys", func() {
+			m := map[abi.U64]abi.Bytes32{abi.NewU64(42): {1}}
+			data, err := json.Marshal(m)
+			Expect(err).ToNot(HaveOccurred())
+			decoded := map[abi.U64]abi.Bytes32{}
+			Expect(json.Unmarshal(data, &decoded)).To(Succeed())
+			Expect(decoded).To(Equal(m))
+		})
+
+		It("should be usable with gob", func() {
+			type message struct {
+				Amount abi.U256
+				Nonce  abi.U64
+				Memo   abi.String
+			}
+			expected := message{abi.NewU256FromU64(abi.NewU64(1000)), abi.NewU64(1), "memo"}
+			buf := new(bytes.Buffer)
+			Expect(gob.NewEncoder(buf).Encode(expected)).To(Succeed())
+			actual := message{}
+			Expect(gob.NewDecoder(buf).Decode(&actual)).To(Succeed())
+			Expect(actual.Amount.Equal(expected.Amount)).To(BeTrue())
+			Expect(actual.Nonce).To(Equal(expected.Nonce))
+			Expect(actual.Memo).To(Equal(expected.Memo))
+		})
+
+		It("should be usable as flags", func() {
+			u32 := abi.U32{}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.Var(textValue{&u32}, "n", "")
+			Expect(fs.Parse([]string{"-n", "42"})).To(Succeed())
+			Expect(u32).To(Equal(abi.NewU32(42)))
+		})
+	})
+})
+
+// textValue adapts a text unmarshaler to the flag.Value interface, in the same
+// way as flag.TextVar (which is not available in older versions of Go).
+type textValue struct {
+	v interface {
+		encoding.TextMarshaler
+		encoding.TextUnmarshaler
+	}
+}
+
+func (v textValue) Set(str string) error {
+	return v.v.UnmarshalText([]byte(str))
+}
+
+func (v textValue) String() string {
+	if v.v == nil {
+		return ""
+	}
+	text, _ := v.v.MarshalText()
+	return string(text)
+}
+
+// normalize returns a pointer to a copy of a value, so that it can be compared
+// to unmarshaled values.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case abi.String:
+		return &v
+	case abi.Bytes:
+		v = append(abi.Bytes{}, v...)
+		return &v
+	case abi.Bytes32:
+		return &v
+	case abi.Bytes65:
+		return &v
+	case abi.Bool:
+		return &v
+	case abi.U8:
+		return &v
+	case abi.U16:
+		return &v
+	case abi.U32:
+		return &v
+	case abi.U64:
+		return &v
+	case abi.U128:
+		return &v
+	case abi.U256:
+		return &v
+	}
+	return v
+}
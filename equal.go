@@ -0,0 +1,195 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// Equal returns true if two values have the same Type and the same binary
+// encoding. Lists and maybes must also have the same element TypeDesc, and
+// records must also have the same fields. Unlike the Equal methods of each
+// type, it can compare any two values, including values of different types
+// (which are never equal). Two nil values are equal, and records that do not
+// have one value for each field are never equal.
+func Equal(a, b Value) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	// Fast paths for the scalar types, which do not need to be encoded.
+	switch a := a.(type) {
+	case Bool:
+		b, ok := b.(Bool)
+		return ok && a.Equal(b)
+	case U8:
+		b, ok := b.(U8)
+		return ok && a.Equal(b)
+	case U16:
+		b, ok := b.(U16)
+		return ok && a.Equal(b)
+	case U32:
+		b, ok := b.(U32)
+		return ok && a.Equal(b)
+	case U64:
+		b, ok := b.(U64)
+		return ok && a.Equal(b)
+	case U128:
+		b, ok := b.(U128)
+		return ok && a.Equal(b)
+	case U256:
+		b, ok := b.(U256)
+		return ok && a.Equal(b)
+	case List:
+		b, ok := b.(List)
+		if !ok || !a.Elem.Equal(b.Elem) || len(a.Elems) != len(b.Elems) {
+			return false
+		}
+		for i := range a.Elems {
+			if !Equal(a.Elems[i], b.Elems[i]) {
+				return false
+			}
+		}
+		return true
+	case Record:
+		b, ok := b.(Record)
+		if !ok || len(a.Fields) != len(b.Fields) || len(a.Values) != len(a.Fields) || len(b.Values) != len(b.Fields) {
+			return false
+		}
+		for i := range a.Fields {
+			if a.Fields[i] != b.Fields[i] || !Equal(a.Values[i], b.Values[i]) {
+				return false
+			}
+		}
+		return true
+	case Maybe:
+		b, ok := b.(Maybe)
+		return ok && a.Elem.Equal(b.Elem) && Equal(a.Value, b.Value)
+	}
+	aKey, aErr := appendKey(nil, a)
+	bKey, bErr := appendKey(nil, b)
+	return aErr == nil && bErr == nil && bytes.Equal(aKey, bKey)
+}
+
+// Clone returns a deep copy of a value. The copy does not share any memory with
+// the original, so modifying one never modifies the other. This matters for
+// Bytes, which are slices, and for U128 and U256, which share their underlying
+// integer when they are copied by value, and for lists, records and maybes,
+// which are cloned recursively. It panics if the value is not a bytes, scalar,
+// list, record or maybe value.
+func Clone(v Value) Value {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case String, Bytes32, Bytes65, Signature, Bool, U8, U16, U32, U64:
+		return v
+	case Bytes:
+		if v == nil {
+			return Bytes(nil)
+		}
+		return append(make(Bytes, 0, len(v)), v...)
+	case U128:
+		if v.inner == nil {
+			return U128{}
+		}
+		return U128{inner: new(big.Int).Set(v.inner)}
+	case U256:
+		if v.inner == nil {
+			return U256{}
+		}
+		return U256{inner: new(big.Int).Set(v.inner)}
+	case List:
+		clone := List{Elem: v.Elem.clone()}
+		if v.Elems != nil {
+			clone.Elems = make([]Value, len(v.Elems))
+			for i, elem := range v.Elems {
+				clone.Elems[i] = Clone(elem)
+			}
+		}
+		return clone
+	case Record:
+		clone := Record{}
+		if v.Fields != nil {
+			clone.Fields = append(make([]RecordField, 0, len(v.Fields)), v.Fields...)
+		}
+		if v.Values != nil {
+			clone.Values = make([]Value, len(v.Values))
+			for i, value := range v.Values {
+				clone.Values[i] = Clone(value)
+			}
+		}
+		return clone
+	case Maybe:
+		return Maybe{Elem: v.Elem.clone(), Value: Clone(v.Value)}
+	default:
+		panic(fmt.Sprintf("non-exhaustive pattern: %T", v))
+	}
+}
+
+// Key returns a canonical key for a value. The key of a bytes or scalar value is
+// its Type followed by its binary encoding. The key of a list or maybe also
+// includes the element TypeDesc, and the key of a record also includes the
+// field names, so that the key describes the whole value. Two values have the
+// same key if, and only if, they are Equal, so keys can be used to store
+// values in Go maps. Keys are not meant to be human readable. It panics if the
+// value cannot be encoded.
+func Key(v Value) string {
+	if v == nil {
+		return ""
+	}
+	key, err := appendKey(make([]byte, 0, SizeHint(v)), v)
+	if err != nil {
+		panic(fmt.Sprintf("non-exhaustive pattern: %v", err))
+	}
+	return string(key)
+}
+
+// appendKey appends the key of a value to dst, and returns the extended slice.
+func appendKey(dst []byte, v Value) ([]byte, error) {
+	dst = append(dst, 0, 0)
+	binary.BigEndian.PutUint16(dst[len(dst)-2:], uint16(v.Type()))
+	var err error
+	switch v := v.(type) {
+	case List:
+		dst = appendDesc(dst, v.Elem)
+		dst = appendUint32(dst, uint32(len(v.Elems)))
+		for _, elem := range v.Elems {
+			if dst, err = appendKey(dst, elem); err != nil {
+				return dst, err
+			}
+		}
+		return dst, nil
+	case Record:
+		if len(v.Values) != len(v.Fields) {
+			return dst, fmt.Errorf("expected len=%v, got len=%v", len(v.Fields), len(v.Values))
+		}
+		dst = appendUint32(dst, uint32(len(v.Fields)))
+		for i, field := range v.Fields {
+			dst = appendUint32(dst, uint32(len(field.Name)))
+			dst = append(dst, field.Name...)
+			if dst, err = appendKey(dst, v.Values[i]); err != nil {
+				return dst, err
+			}
+		}
+		return dst, nil
+	case Maybe:
+		dst = appendDesc(dst, v.Elem)
+		if v.Value == nil {
+			return append(dst, 0), nil
+		}
+		return appendKey(append(dst, 1), v.Value)
+	}
+	if v, ok := v.(interface {
+		AppendBinary(dst []byte) ([]byte, error)
+	}); ok {
+		return v.AppendBinary(dst)
+	}
+	buf := bytes.NewBuffer(dst)
+	if _, err := v.Marshal(buf, MaxBytes); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,152 @@
+package abi_test
+
+import (
+	"math/big"
+	"math/rand"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Equal, Clone and Key", func() {
+	Context("when comparing values", func() {
+		It("should be equal to a clone", func() {
+			f := func(ty abi.Type, seed int64) bool {
+				v := abi.RandomValue(rand.New(rand.NewSource(seed)), abi.NewTypeDesc(ty))
+				Expect(abi.Equal(v, v)).To(BeTrue())
+				Expect(abi.Equal(v, abi.Clone(v))).To(BeTrue())
+				Expect(abi.Key(v)).To(Equal(abi.Key(abi.Clone(v))))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should be equal if, and only if, the keys are equal", func() {
+			f := func(ty1, ty2 abi.Type, seed1, seed2 int64) bool {
+				// Use the same seed half of the time, so that equal values are
+				// common.
+				if seed1%2 == 0 {
+					seed2 = seed1
+				}
+				v1 := abi.RandomValue(rand.New(rand.NewSource(seed1)), abi.NewTypeDesc(ty1))
+				v2 := abi.RandomValue(rand.New(rand.NewSource(seed2)), abi.NewTypeDesc(ty2))
+				Expect(abi.Equal(v1, v2)).To(Equal(abi.Key(v1) == abi.Key(v2)))
+				Expect(abi.Equal(v1, v2)).To(Equal(abi.Equal(v2, v1)))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should not be equal if the types are different", func() {
+			Expect(abi.Equal(abi.NewU8(1), abi.NewU16(1))).To(BeFalse())
+			Expect(abi.Equal(abi.String(""), abi.Bytes{})).To(BeFalse())
+			Expect(abi.Equal(abi.NewU64(0), abi.NewBool(false))).To(BeFalse())
+			Expect(abi.Key(abi.NewU8(1))).ToNot(Equal(abi.Key(abi.NewU16(1))))
+			Expect(abi.Key(abi.String(""))).ToNot(Equal(abi.Key(abi.Bytes{})))
+		})
+
+		It("should compare values with the same encoding as equal", func() {
+			Expect(abi.Equal(abi.Bytes(nil), abi.Bytes{})).To(BeTrue())
+			Expect(abi.Equal(abi.U256{}, abi.NewU256FromInt(big.NewInt(0)))).To(BeTrue())
+			Expect(abi.Equal(abi.U128{}, abi.NewU128FromInt(big.NewInt(0)))).To(BeTrue())
+			Expect(abi.Equal(abi.Signature{}, abi.Bytes65{})).To(BeTrue())
+		})
+
+		It("should compare nil values", func() {
+			Expect(abi.Equal(nil, nil)).To(BeTrue())
+			Expect(abi.Equal(nil, abi.NewU8(0))).To(BeFalse())
+			Expect(abi.Equal(abi.NewU8(0), nil)).To(BeFalse())
+			Expect(abi.Clone(nil)).To(BeNil())
+		})
+
+		It("should compare lists, records and maybes by their TypeDescs", func() {
+			u8 := abi.NewTypeDesc(abi.TypeU8)
+			Expect(abi.Equal(abi.List{Elem: u8}, abi.List{Elem: u8})).To(BeTrue())
+			Expect(abi.Equal(abi.List{Elem: u8}, abi.List{Elem: abi.NewTypeDesc(abi.TypeU16)})).To(BeFalse())
+			Expect(abi.Key(abi.List{Elem: u8})).ToNot(Equal(abi.Key(abi.List{Elem: abi.NewTypeDesc(abi.TypeU16)})))
+			Expect(abi.Equal(abi.NewNone(u8), abi.NewSome(abi.NewU8(0)))).To(BeFalse())
+			Expect(abi.Equal(abi.NewNone(u8), abi.NewNone(abi.NewTypeDesc(abi.TypeBool)))).To(BeFalse())
+
+			x, err := abi.NewRecord([]abi.RecordField{{Name: "x", Type: abi.TypeU8}}, abi.NewU8(1))
+			Expect(err).ToNot(HaveOccurred())
+			y, err := abi.NewRecord([]abi.RecordField{{Name: "y", Type: abi.TypeU8}}, abi.NewU8(1))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.Equal(x, abi.Clone(x))).To(BeTrue())
+			Expect(abi.Equal(x, y)).To(BeFalse())
+			Expect(abi.Key(x)).ToNot(Equal(abi.Key(y)))
+		})
+
+		It("should not compare records with missing values as equal", func() {
+			fields := []abi.RecordField{{Name: "x", Type: abi.TypeU8}, {Name: "y", Type: abi.TypeU8}}
+			short := abi.Record{Fields: fields, Values: []abi.Value{abi.NewU8(1)}}
+			Expect(abi.Equal(short, short)).To(BeFalse())
+			Expect(abi.Equal(short, abi.Record{Fields: fields})).To(BeFalse())
+		})
+	})
+
+	Context("when cloning values", func() {
+		It("should not share bytes", func() {
+			b := abi.Bytes{1, 2, 3}
+			clone := abi.Clone(b).(abi.Bytes)
+			clone[0] = 0
+			Expect(b).To(Equal(abi.Bytes{1, 2, 3}))
+			Expect(abi.Clone(abi.Bytes(nil))).To(Equal(abi.Bytes(nil)))
+		})
+
+		It("should not share integers", func() {
+			u256 := abi.NewU256FromInt(big.NewInt(1))
+			copied := u256
+			copied.AddAssign(abi.NewU256FromInt(big.NewInt(1)))
+			Expect(u256.Int()).To(Equal(big.NewInt(2)))
+
+			clone := abi.Clone(u256).(abi.U256)
+			clone.AddAssign(abi.NewU256FromInt(big.NewInt(1)))
+			Expect(u256.Int()).To(Equal(big.NewInt(2)))
+			Expect(clone.Int()).To(Equal(big.NewInt(3)))
+
+			u128 := abi.NewU128FromInt(big.NewInt(1))
+			clone128 := abi.Clone(u128).(abi.U128)
+			clone128.AddAssign(abi.NewU128FromInt(big.NewInt(1)))
+			Expect(u128.Int()).To(Equal(big.NewInt(1)))
+			Expect(clone128.Int()).To(Equal(big.NewInt(2)))
+		})
+
+		It("should keep the type of signatures", func() {
+			sig := abi.Signature{}
+			sig.Bytes65[0] = 1
+			Expect(abi.Clone(sig)).To(Equal(sig))
+		})
+
+		It("should clone lists, records and maybes recursively", func() {
+			list, err := abi.NewList(abi.NewTypeDesc(abi.TypeBytes), abi.Bytes{1, 2, 3})
+			Expect(err).ToNot(HaveOccurred())
+			record, err := abi.NewRecord(
+				[]abi.RecordField{{Name: "list", Type: abi.TypeList}, {Name: "maybe", Type: abi.TypeMaybe}},
+				list, abi.NewSome(abi.Bytes{4, 5, 6}),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			clone := abi.Clone(record).(abi.Record)
+			clone.Values[0].(abi.List).Elems[0].(abi.Bytes)[0] = 0
+			clone.Values[1].(abi.Maybe).Value.(abi.Bytes)[0] = 0
+			clone.Fields[0].Name = "other"
+			Expect(list.Elems[0]).To(Equal(abi.Bytes{1, 2, 3}))
+			Expect(record.Values[1].(abi.Maybe).Value).To(Equal(abi.Bytes{4, 5, 6}))
+			Expect(record.Fields[0].Name).To(Equal("list"))
+		})
+	})
+
+	Context("when using keys in a map", func() {
+		It("should find equal values", func() {
+			f := func(ty abi.Type, seed int64) bool {
+				v := abi.RandomValue(rand.New(rand.NewSource(seed)), abi.NewTypeDesc(ty))
+				m := map[string]abi.Value{abi.Key(v): v}
+				Expect(m).To(HaveKey(abi.Key(abi.Clone(v))))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
+})
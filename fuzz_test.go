@@ -0,0 +1,156 @@
+//go:build go1.18
+// +build go1.18
+
+package abi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+)
+
+// fuzzMaxBytes caps the maximum number of bytes used when fuzzing, so that
+// inputs with large length prefixes do not slow down the fuzzer.
+const fuzzMaxBytes = 1 << 20
+
+// fuzzValue is implemented by pointers to every bytes and scalar type.
+type fuzzValue interface {
+	surge.Marshaler
+	surge.Unmarshaler
+	json.Marshaler
+	json.Unmarshaler
+}
+
+// fuzzBinary unmarshals data into a new value, using at most m bytes. It
+// checks that unmarshaling does not panic, that it never reports more bytes
+// remaining than it was given, and that successfully unmarshaled values stay
+// within the maximum number of bytes. Marshaling and unmarshaling a value must
+// both consume exactly its SizeHint. Successfully unmarshaled values are
+// marshaled and unmarshaled again, and must produce the same binary encoding.
+func fuzzBinary(t *testing.T, newValue func() fuzzValue, data []byte, m int) {
+	if m > fuzzMaxBytes {
+		m = fuzzMaxBytes
+	}
+
+	v := newValue()
+	rem, err := v.Unmarshal(bytes.NewReader(data), m)
+	if rem > m {
+		t.Fatalf("expected remaining<=%v, got remaining=%v", m, rem)
+	}
+	if err != nil {
+		return
+	}
+	if rem <= 0 {
+		t.Fatalf("expected error when remaining=%v", rem)
+	}
+	if v.SizeHint() > len(data) {
+		t.Fatalf("expected size<=%v, got size=%v", len(data), v.SizeHint())
+	}
+	if m-rem != v.SizeHint() {
+		t.Fatalf("expected unmarshaling to consume %v bytes, got %v bytes", v.SizeHint(), m-rem)
+	}
+	if rem, err = v.Marshal(ioutil.Discard, m); err != nil || m-rem != v.SizeHint() {
+		t.Fatalf("expected marshaling to consume %v bytes, got %v bytes: %v", v.SizeHint(), m-rem, err)
+	}
+
+	encoded, err := surge.ToBinary(v)
+	if err != nil {
+		t.Fatalf("marshaling: %v", err)
+	}
+	w := newValue()
+	if _, err := w.Unmarshal(bytes.NewReader(encoded), abi.MaxBytes); err != nil {
+		t.Fatalf("unmarshaling %x: %v", encoded, err)
+	}
+	reencoded, err := surge.ToBinary(w)
+	if err != nil {
+		t.Fatalf("marshaling: %v", err)
+	}
+	if !bytes.Equal(encoded, reencoded) {
+		t.Fatalf("expected %x, got %x", encoded, reencoded)
+	}
+}
+
+// fuzzJSON unmarshals data into a new value from JSON. It checks that
+// unmarshaling does not panic, and that successfully unmarshaled values can be
+// marshaled and unmarshaled again to produce the same JSON.
+func fuzzJSON(t *testing.T, newValue func() fuzzValue, data []byte) {
+	v := newValue()
+	if err := v.UnmarshalJSON(data); err != nil {
+		return
+	}
+	encoded, err := v.MarshalJSON()
+	if err != nil {
+		t.Fatalf("marshaling: %v", err)
+	}
+	w := newValue()
+	if err := w.UnmarshalJSON(encoded); err != nil {
+		t.Fatalf("unmarshaling %s: %v", encoded, err)
+	}
+	reencoded, err := w.MarshalJSON()
+	if err != nil {
+		t.Fatalf("marshaling: %v", err)
+	}
+	if !bytes.Equal(encoded, reencoded) {
+		t.Fatalf("expected %s, got %s", encoded, reencoded)
+	}
+}
+
+// fuzz runs the binary and JSON checks for a type.
+func fuzz(f *testing.F, newValue func() fuzzValue) {
+	f.Fuzz(func(t *testing.T, data []byte, m int) {
+		fuzzBinary(t, newValue, data, m)
+		fuzzJSON(t, newValue, data)
+	})
+}
+
+func FuzzString(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.String) })
+}
+
+func FuzzBytes(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.Bytes) })
+}
+
+func FuzzBytes32(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.Bytes32) })
+}
+
+func FuzzBytes65(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.Bytes65) })
+}
+
+func FuzzBool(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.Bool) })
+}
+
+func FuzzU8(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.U8) })
+}
+
+func FuzzU16(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.U16) })
+}
+
+func FuzzU32(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.U32) })
+}
+
+func FuzzU64(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.U64) })
+}
+
+func FuzzU128(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.U128) })
+}
+
+func FuzzU256(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.U256) })
+}
+
+func FuzzType(f *testing.F) {
+	fuzz(f, func() fuzzValue { return new(abi.Type) })
+}
@@ -0,0 +1,280 @@
+package abi
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"unicode/utf8"
+)
+
+// RandomValue returns a random Value described by the TypeDesc. Values are
+// biased towards boundaries: integers are often 0, 1, the maximum, one less
+// than the maximum, or a power of two (or one less than a power of two), bytes
+// are often empty or filled with zeros or ones, lists are often empty or have
+// one element, and maybes often have no value. Nested lists, records and
+// maybes are generated recursively. It panics if the TypeDesc is malformed.
+func RandomValue(r *rand.Rand, desc TypeDesc) Value {
+	if err := desc.validate(nil); err != nil {
+		panic(err)
+	}
+	return randomValue(r, desc)
+}
+
+// Generate implements the quick.Generator interface. Only the bytes and scalar
+// types are generated.
+func (Type) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(primitiveTypes[r.Intn(len(primitiveTypes))])
+}
+
+// Generate implements the quick.Generator interface. TypeDescs are nested at
+// most three levels deep, and records have at most four fields.
+func (TypeDesc) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(randomDesc(r, 3))
+}
+
+// Generate implements the quick.Generator interface. Strings are valid UTF-8,
+// and have at most size runes.
+func (String) Generate(r *rand.Rand, size int) reflect.Value {
+	n := randomLen(r, size)
+	buf := make([]byte, 0, n)
+	for i := 0; i < n; i++ {
+		var c rune
+		switch r.Intn(4) {
+		case 0:
+			// Control characters and characters that must be escaped in
+			// JSON.
+			c = []rune{0, '\t', '\n', '"', '\\', 0x7f}[r.Intn(6)]
+		case 1:
+			c = rune(r.Intn(utf8.MaxRune + 1))
+			if !utf8.ValidRune(c) {
+				c = utf8.RuneError
+			}
+		default:
+			c = rune(0x20 + r.Intn(0x5f))
+		}
+		buf = append(buf, string(c)...)
+	}
+	return reflect.ValueOf(String(buf))
+}
+
+// Generate implements the quick.Generator interface. Bytes have at most size
+// bytes.
+func (Bytes) Generate(r *rand.Rand, size int) reflect.Value {
+	b := make(Bytes, randomLen(r, size))
+	randomFill(r, b)
+	return reflect.ValueOf(b)
+}
+
+// Generate implements the quick.Generator interface.
+func (Bytes32) Generate(r *rand.Rand, size int) reflect.Value {
+	b32 := Bytes32{}
+	randomFill(r, b32[:])
+	return reflect.ValueOf(b32)
+}
+
+// Generate implements the quick.Generator interface.
+func (Bytes65) Generate(r *rand.Rand, size int) reflect.Value {
+	b65 := Bytes65{}
+	randomFill(r, b65[:])
+	return reflect.ValueOf(b65)
+}
+
+// Generate implements the quick.Generator interface.
+func (Bool) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(NewBool(r.Intn(2) == 1))
+}
+
+// Generate implements the quick.Generator interface.
+func (U8) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(NewU8(uint8(randomUint(r, 8))))
+}
+
+// Generate implements the quick.Generator interface.
+func (U16) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(NewU16(uint16(randomUint(r, 16))))
+}
+
+// Generate implements the quick.Generator interface.
+func (U32) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(NewU32(uint32(randomUint(r, 32))))
+}
+
+// Generate implements the quick.Generator interface.
+func (U64) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(NewU64(randomUint(r, 64)))
+}
+
+// Generate implements the quick.Generator interface.
+func (U128) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(U128{inner: randomBigInt(r, 128)})
+}
+
+// Generate implements the quick.Generator interface.
+func (U256) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(U256{inner: randomBigInt(r, 256)})
+}
+
+// primitiveTypes are the bytes and scalar types.
+var primitiveTypes = []Type{
+	TypeString, TypeBytes, TypeBytes32, TypeBytes65,
+	TypeBool, TypeU8, TypeU16, TypeU32, TypeU64, TypeU128, TypeU256,
+}
+
+// randomValue returns a random Value described by a valid TypeDesc.
+func randomValue(r *rand.Rand, desc TypeDesc) Value {
+	size := 32
+	switch desc.Type {
+	case TypeString:
+		return String("").Generate(r, size).Interface().(Value)
+	case TypeBytes:
+		return Bytes{}.Generate(r, size).Interface().(Value)
+	case TypeBytes32:
+		return Bytes32{}.Generate(r, size).Interface().(Value)
+	case TypeBytes65:
+		return Bytes65{}.Generate(r, size).Interface().(Value)
+	case TypeBool:
+		return Bool{}.Generate(r, size).Interface().(Value)
+	case TypeU8:
+		return U8{}.Generate(r, size).Interface().(Value)
+	case TypeU16:
+		return U16{}.Generate(r, size).Interface().(Value)
+	case TypeU32:
+		return U32{}.Generate(r, size).Interface().(Value)
+	case TypeU64:
+		return U64{}.Generate(r, size).Interface().(Value)
+	case TypeU128:
+		return U128{}.Generate(r, size).Interface().(Value)
+	case TypeU256:
+		return U256{}.Generate(r, size).Interface().(Value)
+	case TypeList:
+		elems := make([]Value, randomLen(r, 4))
+		for i := range elems {
+			elems[i] = randomValue(r, *desc.Elem)
+		}
+		return List{Elem: desc.Elem.clone(), Elems: elems}
+	case TypeRecord:
+		record := Record{
+			Fields: make([]RecordField, len(desc.Fields)),
+			Values: make([]Value, len(desc.Fields)),
+		}
+		for i, field := range desc.Fields {
+			record.Fields[i] = RecordField{Name: field.Name, Type: field.Desc.Type}
+			record.Values[i] = randomValue(r, field.Desc)
+		}
+		return record
+	case TypeMaybe:
+		maybe := Maybe{Elem: desc.Elem.clone()}
+		if r.Intn(4) != 0 {
+			maybe.Value = randomValue(r, *desc.Elem)
+		}
+		return maybe
+	default:
+		panic(fmt.Sprintf("non-exhaustive pattern: Type(%v)", desc.Type))
+	}
+}
+
+// randomDesc returns a random TypeDesc that is nested at most depth levels
+// deep. Records have at most four fields, named "f0", "f1", and so on.
+func randomDesc(r *rand.Rand, depth int) TypeDesc {
+	if depth <= 0 || r.Intn(2) == 0 {
+		return NewTypeDesc(primitiveTypes[r.Intn(len(primitiveTypes))])
+	}
+	switch r.Intn(3) {
+	case 0:
+		return NewListDesc(randomDesc(r, depth-1))
+	case 1:
+		return NewMaybeDesc(randomDesc(r, depth-1))
+	default:
+		fields := make([]FieldDesc, randomLen(r, 4))
+		for i := range fields {
+			fields[i] = FieldDesc{Name: fmt.Sprintf("f%v", i), Desc: randomDesc(r, depth-1)}
+		}
+		return NewRecordDesc(fields...)
+	}
+}
+
+// randomLen returns a random length in the range [0, size], biased towards
+// zero, one and size.
+func randomLen(r *rand.Rand, size int) int {
+	if size <= 0 {
+		return 0
+	}
+	switch r.Intn(8) {
+	case 0:
+		return 0
+	case 1:
+		return 1
+	case 2:
+		return size
+	default:
+		return r.Intn(size + 1)
+	}
+}
+
+// randomFill fills a byte slice with random bytes, biased towards all zeros
+// and all ones.
+func randomFill(r *rand.Rand, b []byte) {
+	switch r.Intn(8) {
+	case 0:
+		for i := range b {
+			b[i] = 0
+		}
+	case 1:
+		for i := range b {
+			b[i] = 0xff
+		}
+	default:
+		r.Read(b)
+	}
+}
+
+// randomUint returns a random unsigned integer with the given number of bits,
+// biased towards boundaries.
+func randomUint(r *rand.Rand, bits uint) uint64 {
+	max := ^uint64(0) >> (64 - bits)
+	k := uint(r.Intn(int(bits)))
+	switch r.Intn(8) {
+	case 0:
+		return 0
+	case 1:
+		return 1
+	case 2:
+		return max
+	case 3:
+		return max - 1
+	case 4:
+		return uint64(1) << k
+	case 5:
+		return uint64(1)<<k - 1
+	default:
+		return r.Uint64() & max
+	}
+}
+
+// randomBigInt returns a random unsigned integer with the given number of
+// bits, biased towards boundaries.
+func randomBigInt(r *rand.Rand, bits uint) *big.Int {
+	one := big.NewInt(1)
+	max := new(big.Int).Sub(new(big.Int).Lsh(one, bits), one)
+	k := uint(r.Intn(int(bits)))
+	switch r.Intn(8) {
+	case 0:
+		return new(big.Int)
+	case 1:
+		return big.NewInt(1)
+	case 2:
+		return max
+	case 3:
+		return max.Sub(max, one)
+	case 4:
+		return new(big.Int).Lsh(one, k)
+	case 5:
+		x := new(big.Int).Lsh(one, k)
+		return x.Sub(x, one)
+	default:
+		buf := make([]byte, bits/8)
+		r.Read(buf)
+		return new(big.Int).SetBytes(buf)
+	}
+}
@@ -0,0 +1,131 @@
+package abi_test
+
+import (
+	"bytes"
+	"math/big"
+	"math/rand"
+	"testing/quick"
+	"unicode/utf8"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Generators", func() {
+	Context("when generating values with testing/quick", func() {
+		It("should marshal and unmarshal", func() {
+			f := func(str abi.String, b abi.Bytes, b32 abi.Bytes32, b65 abi.Bytes65, bl abi.Bool, u8 abi.U8, u16 abi.U16, u32 abi.U32, u64 abi.U64, u128 abi.U128, u256 abi.U256) bool {
+				Expect(utf8.ValidString(string(str))).To(BeTrue())
+				for _, v := range []abi.Value{str, b, b32, b65, bl, u8, u16, u32, u64, u128, u256} {
+					buf := new(bytes.Buffer)
+					_, err := v.Marshal(buf, abi.MaxBytes)
+					Expect(err).ToNot(HaveOccurred())
+
+					decoded, err := abi.NewDecoder(bytes.NewReader(mustEncode(v))).Decode()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(decoded.Type()).To(Equal(v.Type()))
+				}
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should generate valid types", func() {
+			f := func(ty abi.Type) bool {
+				_, ok := abi.NewTypeFromUint16(uint16(ty))
+				Expect(ok).To(BeTrue())
+				Expect(abi.RandomValue(rand.New(rand.NewSource(0)), abi.NewTypeDesc(ty)).Type()).To(Equal(ty))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
+
+	Context("when generating random values", func() {
+		It("should be biased towards boundaries", func() {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			seen := map[string]bool{}
+			for i := 0; i < 1000; i++ {
+				u256 := abi.RandomValue(r, abi.NewTypeDesc(abi.TypeU256)).(abi.U256)
+				switch {
+				case u256.Equal(abi.NewU256([32]byte{})):
+					seen["zero"] = true
+				case u256.Equal(abi.MaxU256):
+					seen["max"] = true
+				case u256.Equal(abi.NewU256FromInt(new(big.Int).Sub(abi.MaxU256.Int(), big.NewInt(1)))):
+					seen["max-1"] = true
+				}
+
+				u8 := abi.RandomValue(r, abi.NewTypeDesc(abi.TypeU8)).(abi.U8)
+				if u8.Equal(abi.MaxU8()) {
+					seen["max u8"] = true
+				}
+
+				b := abi.RandomValue(r, abi.NewTypeDesc(abi.TypeBytes)).(abi.Bytes)
+				if len(b) == 0 {
+					seen["empty"] = true
+				}
+			}
+			Expect(seen).To(HaveLen(5))
+		})
+
+		It("should be deterministic for a given source", func() {
+			for _, ty := range []abi.Type{abi.TypeString, abi.TypeBytes, abi.TypeBytes32, abi.TypeBytes65, abi.TypeBool, abi.TypeU8, abi.TypeU16, abi.TypeU32, abi.TypeU64, abi.TypeU128, abi.TypeU256} {
+				x := abi.RandomValue(rand.New(rand.NewSource(42)), abi.NewTypeDesc(ty))
+				y := abi.RandomValue(rand.New(rand.NewSource(42)), abi.NewTypeDesc(ty))
+				Expect(x.Type()).To(Equal(ty))
+				Expect(mustEncode(x)).To(Equal(mustEncode(y)))
+			}
+		})
+
+		It("should panic for malformed type descriptions", func() {
+			Expect(func() { abi.RandomValue(rand.New(rand.NewSource(0)), abi.NewTypeDesc(abi.TypeList)) }).To(Panic())
+			Expect(func() { abi.RandomValue(rand.New(rand.NewSource(0)), abi.NewTypeDesc(abi.TypeNil)) }).To(Panic())
+		})
+	})
+
+	Context("when generating random composite values", func() {
+		It("should match the type description", func() {
+			f := func(desc abi.TypeDesc, seed int64) bool {
+				v := abi.RandomValue(rand.New(rand.NewSource(seed)), desc)
+				Expect(abi.DescOf(v).Equal(desc)).To(BeTrue(), desc.String())
+
+				data, err := surge.ToBinary(v)
+				Expect(err).ToNot(HaveOccurred())
+				w, _, err := abi.UnmarshalValue(bytes.NewReader(data), desc, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(abi.Equal(v, w)).To(BeTrue())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should generate nested lists, records and maybes", func() {
+			desc, err := abi.ParseTypeDesc("record{outputs:list<record{to:b32,amount:u256}>,memo:maybe<str>}")
+			Expect(err).ToNot(HaveOccurred())
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			seen := map[string]bool{}
+			for i := 0; i < 100; i++ {
+				v := abi.RandomValue(r, desc).(abi.Record)
+				Expect(abi.DescOf(v).Equal(desc)).To(BeTrue())
+				outputs := v.Values[0].(abi.List)
+				seen["outputs"] = seen["outputs"] || len(outputs.Elems) > 0
+				seen["no outputs"] = seen["no outputs"] || len(outputs.Elems) == 0
+				memo := v.Values[1].(abi.Maybe)
+				seen["memo"] = seen["memo"] || memo.IsSome()
+				seen["no memo"] = seen["no memo"] || !memo.IsSome()
+			}
+			Expect(seen).To(HaveLen(4))
+		})
+	})
+})
+
+// mustEncode encodes a value as a single frame.
+func mustEncode(v abi.Value) []byte {
+	buf := new(bytes.Buffer)
+	Expect(abi.NewEncoder(buf).Encode(v)).To(Succeed())
+	return buf.Bytes()
+}
@@ -13,4 +13,5 @@ require (
 	github.com/renproject/surge v1.1.1
 	github.com/steakknife/bloomfilter v0.0.0-20180922174646-6819c0d2a570 // indirect
 	github.com/steakknife/hamming v0.0.0-20180906055917-c99c65617cd3 // indirect
+	golang.org/x/crypto v0.0.0-20200115085410-6d4e4cb37c7d
 )
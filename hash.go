@@ -0,0 +1,64 @@
+package abi
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Hash a Value by streaming its canonical binary encoding into the hasher. The
+// hasher is reset before use, and must produce 32 byte digests.
+//
+// The canonical binary encoding is the TypeDesc of the Value, followed by the
+// binary encoding of the Value itself. The TypeDesc provides domain
+// separation: values of different types always hash different inputs, even
+// when their binary encodings are identical (for example, a U64 and a Bytes32
+// whose bytes happen to be equal, or two lists whose elements have different
+// types). For bytes and scalar values, the TypeDesc is only the type
+// identifier. Within a type, the binary encoding is unambiguous, because
+// variable length types are prefixed with their length.
+//
+// Unlike hash.Hash, which never fails, an error is returned instead of a
+// digest when the Value has no canonical binary encoding: if the Value is nil,
+// if it is bigger than MaxBytes, or if its TypeDesc is malformed (for example,
+// a List or Maybe without an element TypeDesc, or a Record with duplicate field
+// names or nil values). An error is also returned if the hasher does not
+// produce 32 byte digests. Values that are built with their constructors, and
+// that are no bigger than MaxBytes, can always be hashed by SHA256 and
+// Keccak256, so callers only need to handle the error when hashing values from
+// untrusted sources or with a custom hasher. Hashing never panics.
+func Hash(v Value, h hash.Hash) (Bytes32, error) {
+	if h.Size() != 32 {
+		return Bytes32{}, fmt.Errorf("expected hash size=32, got size=%v", h.Size())
+	}
+	if v == nil {
+		return Bytes32{}, fmt.Errorf("non-exhaustive pattern: %v", v)
+	}
+
+	h.Reset()
+	m, err := DescOf(v).Marshal(h, MaxBytes)
+	if err != nil {
+		return Bytes32{}, fmt.Errorf("marshaling type: %v", err)
+	}
+	if _, err := v.Marshal(h, m); err != nil {
+		return Bytes32{}, fmt.Errorf("marshaling value: %v", err)
+	}
+
+	digest := Bytes32{}
+	copy(digest[:], h.Sum(nil))
+	return digest, nil
+}
+
+// SHA256 hashes a Value using SHA2-256. See Hash for a description of the bytes
+// that are hashed.
+func SHA256(v Value) (Bytes32, error) {
+	return Hash(v, sha256.New())
+}
+
+// Keccak256 hashes a Value using the legacy Keccak-256 hash function used by
+// Ethereum. See Hash for a description of the bytes that are hashed.
+func Keccak256(v Value) (Bytes32, error) {
+	return Hash(v, sha3.NewLegacyKeccak256())
+}
@@ -0,0 +1,137 @@
+package abi_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+	"golang.org/x/crypto/sha3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hash", func() {
+	Context("when hashing values", func() {
+		It("should hash the type identifier followed by the binary encoding", func() {
+			f := func(x [32]byte) bool {
+				v := abi.NewU256(x)
+				data, err := surge.ToBinary(v)
+				Expect(err).ToNot(HaveOccurred())
+				preimage := append([]byte{0, byte(abi.TypeU256)}, data...)
+
+				expected := sha256.Sum256(preimage)
+				Expect(mustSHA256(v)).To(Equal(abi.Bytes32(expected)))
+
+				h := sha3.NewLegacyKeccak256()
+				h.Write(preimage)
+				digest, err := abi.Keccak256(v)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(digest[:]).To(Equal(h.Sum(nil)))
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should reset the hasher before use", func() {
+			h := sha256.New()
+			h.Write([]byte("garbage"))
+			digest, err := abi.Hash(abi.NewU8(1), h)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(digest).To(Equal(mustSHA256(abi.NewU8(1))))
+		})
+
+		It("should return an error if the hasher does not produce 32 byte digests", func() {
+			_, err := abi.Hash(abi.NewU8(1), sha256.New224())
+			Expect(err).To(MatchError("expected hash size=32, got size=28"))
+		})
+
+		It("should hash the zero value of a U128 or U256 as zero", func() {
+			Expect(mustSHA256(abi.U128{})).To(Equal(mustSHA256(abi.NewU128([16]byte{}))))
+			Expect(mustSHA256(abi.U256{})).To(Equal(mustSHA256(abi.NewU256([32]byte{}))))
+		})
+
+		It("should return an error if the value is too big", func() {
+			_, err := abi.SHA256(abi.Bytes(make([]byte, abi.MaxBytes)))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error if the value has no canonical encoding", func() {
+			_, err := abi.SHA256(nil)
+			Expect(err).To(HaveOccurred())
+			_, err = abi.SHA256(abi.List{})
+			Expect(err).To(HaveOccurred())
+			_, err = abi.SHA256(abi.Maybe{})
+			Expect(err).To(HaveOccurred())
+			_, err = abi.SHA256(abi.Record{Fields: []abi.RecordField{{Name: "a", Type: abi.TypeU8}, {Name: "a", Type: abi.TypeU8}}, Values: []abi.Value{abi.NewU8(1), abi.NewU8(2)}})
+			Expect(err).To(HaveOccurred())
+			_, err = abi.SHA256(abi.Record{Fields: []abi.RecordField{{Name: "a", Type: abi.TypeU8}}, Values: []abi.Value{nil}})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when hashing composite values", func() {
+		It("should hash the type description followed by the binary encoding", func() {
+			v := abi.MustParseText(`record{to: b32(0x` + strings.Repeat("01", 32) + `), amounts: list<u64>[u64(1), u64(2)]}`)
+			data, err := surge.ToBinary(abi.DescOf(v))
+			Expect(err).ToNot(HaveOccurred())
+			data = append(data, mustToBinary(v)...)
+
+			expected := sha256.Sum256(data)
+			Expect(mustSHA256(v)).To(Equal(abi.Bytes32(expected)))
+		})
+
+		It("should not collide when the element types differ", func() {
+			empty64 := abi.MustParseText(`list<u64>[]`)
+			empty32 := abi.MustParseText(`list<u32>[]`)
+			Expect(mustToBinary(empty64)).To(Equal(mustToBinary(empty32)))
+			Expect(mustSHA256(empty64)).ToNot(Equal(mustSHA256(empty32)))
+
+			none64 := abi.MustParseText(`maybe<u64>(none)`)
+			none32 := abi.MustParseText(`maybe<u32>(none)`)
+			Expect(mustSHA256(none64)).ToNot(Equal(mustSHA256(none32)))
+		})
+	})
+
+	Context("when hashing values of different types with the same encoding", func() {
+		It("should not collide", func() {
+			f := func(x uint64) bool {
+				u64 := abi.NewU64(x)
+				data, err := surge.ToBinary(u64)
+				Expect(err).ToNot(HaveOccurred())
+
+				// A Bytes32 whose first bytes are a length prefix could be
+				// confused with a Bytes, if not for the type identifier.
+				b32 := abi.Bytes32{}
+				copy(b32[:], []byte{0, 0, 0, 28})
+				b := abi.Bytes(b32[4:])
+				Expect(bytes.Equal(mustToBinary(b32), mustToBinary(b))).To(BeTrue())
+
+				Expect(mustSHA256(u64)).ToNot(Equal(mustSHA256(abi.Bytes(data))))
+				Expect(mustSHA256(u64)).ToNot(Equal(mustSHA256(abi.NewU8(uint8(x)))))
+				Expect(mustSHA256(b32)).ToNot(Equal(mustSHA256(b)))
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+})
+
+func mustToBinary(v abi.Value) []byte {
+	data, err := surge.ToBinary(v)
+	Expect(err).ToNot(HaveOccurred())
+	return data
+}
+
+func mustSHA256(v abi.Value) abi.Bytes32 {
+	digest, err := abi.SHA256(v)
+	Expect(err).ToNot(HaveOccurred())
+	return digest
+}
@@ -0,0 +1,221 @@
+package abi
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/renproject/surge"
+)
+
+// Limits restrict what is accepted when decoding values from untrusted input.
+// The maximum number of bytes alone bounds the size of the input, but not how
+// it is shaped: a small input can still describe very long lists of tiny
+// values, or very deeply nested values. Decoders that accept Limits check them
+// before anything is allocated, and return a LimitError when a limit is
+// exceeded. Every limit applies to every nested value, and not only to the
+// outermost one.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of a value. Bytes and scalar
+	// values have a depth of zero, and lists, records and maybes have a depth
+	// of one more than their deepest element. TypeDescs that are decoded or
+	// parsed have the same depth as the values that they describe.
+	MaxDepth int
+	// MaxListLen is the maximum number of elements in a list.
+	MaxListLen int
+	// MaxRecordFields is the maximum number of fields in a record.
+	MaxRecordFields int
+	// MaxStringLen is the maximum length of a String or Bytes value, not
+	// including its length prefix.
+	MaxStringLen int
+	// MaxBytes is the maximum number of bytes that are read when decoding a
+	// value, including its length prefixes. Decoders that accept Limits start
+	// their budget from MaxBytes, and decoders that accept a maximum number of
+	// bytes use it instead of MaxBytes.
+	MaxBytes int
+}
+
+// DefaultLimits returns the Limits that are used when decoding, unless other
+// Limits are given. They are suitable for decoding untrusted input.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxDepth:        32,
+		MaxListLen:      1 << 16,
+		MaxRecordFields: 1 << 8,
+		MaxStringLen:    1 << 20,
+		MaxBytes:        MaxBytes,
+	}
+}
+
+// A LimitError is returned when decoding exceeds one of the Limits.
+type LimitError struct {
+	// Limit is the name of the limit that was exceeded, for example
+	// "list len".
+	Limit string
+	Max   int
+	Got   int
+}
+
+// Error implements the error interface.
+func (err LimitError) Error() string {
+	return fmt.Sprintf("overflow: expected %v<=%v, got %v=%v", err.Limit, err.Max, err.Limit, err.Got)
+}
+
+// checkDepth returns an error if the depth exceeds the maximum depth.
+func (limits Limits) checkDepth(depth int) error {
+	return checkLimit("depth", limits.MaxDepth, depth)
+}
+
+// checkListLen returns an error if the length of a list exceeds the maximum
+// list length.
+func (limits Limits) checkListLen(n int) error {
+	return checkLimit("list len", limits.MaxListLen, n)
+}
+
+// checkRecordFields returns an error if the number of fields in a record
+// exceeds the maximum number of record fields.
+func (limits Limits) checkRecordFields(n int) error {
+	return checkLimit("record fields", limits.MaxRecordFields, n)
+}
+
+// checkStringLen returns an error if the length of a String or Bytes value
+// exceeds the maximum string length.
+func (limits Limits) checkStringLen(n int) error {
+	return checkLimit("string len", limits.MaxStringLen, n)
+}
+
+// checkBytes returns an error if the size of a binary encoding exceeds the
+// maximum number of bytes.
+func (limits Limits) checkBytes(n int) error {
+	return checkLimit("bytes", limits.MaxBytes, n)
+}
+
+// checkLimit returns a LimitError if the value exceeds the maximum.
+func checkLimit(limit string, max, got int) error {
+	if got > max {
+		return LimitError{Limit: limit, Max: max, Got: got}
+	}
+	return nil
+}
+
+// UnmarshalValue unmarshals a value described by the TypeDesc from binary.
+// Lists, records and maybes are unmarshaled recursively, and their elements
+// and fields are described by the TypeDesc. The value consumes its SizeHint
+// from the maximum number of bytes, and the remaining budget is returned, in
+// the same way as by the Marshal method of the value. The value is also
+// checked against the DefaultLimits.
+func UnmarshalValue(r io.Reader, desc TypeDesc, m int) (Value, int, error) {
+	limits := DefaultLimits()
+	limits.MaxBytes = m
+	return UnmarshalValueWithLimits(r, desc, limits)
+}
+
+// UnmarshalValueWithLimits is the same as UnmarshalValue, but checks the value
+// against the given Limits. The maximum number of bytes is taken from the
+// Limits. The depth of the value, the length of every list, the number of
+// fields of every record, and the length of every String and Bytes value are
+// checked before anything is allocated for them. The TypeDesc is trusted, so
+// only the values that are read are checked: an empty list is accepted even
+// if its elements would exceed the Limits.
+func UnmarshalValueWithLimits(r io.Reader, desc TypeDesc, limits Limits) (Value, int, error) {
+	m := limits.MaxBytes
+	if err := desc.validate(nil); err != nil {
+		return nil, m, err
+	}
+	return decodeValue(r, desc, m, limits, 0)
+}
+
+// decodeValue unmarshals a value described by a well-formed TypeDesc at the
+// given depth from binary, and checks it against the Limits. Lengths are
+// checked against the Limits, and against the remaining budget, before
+// anything is allocated.
+func decodeValue(r io.Reader, desc TypeDesc, m int, limits Limits, depth int) (Value, int, error) {
+	var err error
+	switch desc.Type {
+	case TypeString, TypeBytes:
+		// The length prefix is consumed here, and the length is consumed
+		// when the data is allocated.
+		var n uint32
+		if m, err = unmarshalWithin(r, &n, 4, m); err != nil {
+			return nil, m, err
+		}
+		if err := limits.checkStringLen(int(n)); err != nil {
+			return nil, m, err
+		}
+		if uint64(n) >= uint64(m) {
+			return nil, m, surge.ErrMaxBytesExceeded
+		}
+		data := make([]byte, n)
+		if m, err = readWithin(r, data, m); err != nil {
+			return nil, m, err
+		}
+		if desc.Type == TypeString {
+			return String(data), m, nil
+		}
+		return Bytes(data), m, nil
+
+	case TypeList:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		var n uint32
+		if m, err = unmarshalWithin(r, &n, 4, m); err != nil {
+			return nil, m, err
+		}
+		if err := limits.checkListLen(int(n)); err != nil {
+			return nil, m, err
+		}
+		// Lists that cannot fit into the remaining budget are rejected before
+		// the elements are allocated.
+		if m, err = desc.Elem.chargeElems(int(n), m); err != nil {
+			return nil, m, err
+		}
+		elems := make([]Value, n)
+		for i := range elems {
+			if elems[i], m, err = decodeValue(r, *desc.Elem, m, limits, depth+1); err != nil {
+				return nil, m, err
+			}
+		}
+		return List{Elem: *desc.Elem, Elems: elems}, m, nil
+
+	case TypeRecord:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		if err := limits.checkRecordFields(len(desc.Fields)); err != nil {
+			return nil, m, err
+		}
+		fields := make([]RecordField, len(desc.Fields))
+		values := make([]Value, len(desc.Fields))
+		for i, field := range desc.Fields {
+			fields[i] = RecordField{Name: field.Name, Type: field.Desc.Type}
+			if values[i], m, err = decodeValue(r, field.Desc, m, limits, depth+1); err != nil {
+				return nil, m, err
+			}
+		}
+		return Record{Fields: fields, Values: values}, m, nil
+
+	case TypeMaybe:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		some := [1]byte{}
+		if m, err = readWithin(r, some[:], m); err != nil {
+			return nil, m, err
+		}
+		switch some[0] {
+		case 0:
+			return Maybe{Elem: *desc.Elem}, m, nil
+		case 1:
+			v, m, err := decodeValue(r, *desc.Elem, m, limits, depth+1)
+			if err != nil {
+				return nil, m, err
+			}
+			return Maybe{Elem: *desc.Elem, Value: v}, m, nil
+		default:
+			return nil, m, fmt.Errorf("non-exhaustive pattern: Maybe(%v)", some[0])
+		}
+
+	default:
+		return unmarshalValue(r, desc.Type, m)
+	}
+}
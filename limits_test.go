@@ -0,0 +1,345 @@
+package abi_test
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limits", func() {
+	limits := func() abi.Limits {
+		return abi.Limits{
+			MaxDepth:        1,
+			MaxListLen:      2,
+			MaxRecordFields: 2,
+			MaxStringLen:    4,
+			MaxBytes:        64,
+		}
+	}
+
+	Context("when a limit is exceeded", func() {
+		It("should return a clear error", func() {
+			err := abi.LimitError{Limit: "list len", Max: 2, Got: 3}
+			Expect(err.Error()).To(Equal("overflow: expected list len<=2, got list len=3"))
+		})
+	})
+
+	Context("when using the default limits", func() {
+		It("should use the maximum number of bytes", func() {
+			Expect(abi.DefaultLimits().MaxBytes).To(Equal(abi.MaxBytes))
+		})
+
+		It("should reject long lists of small elements", func() {
+			n := abi.DefaultLimits().MaxListLen + 1
+			data, err := surge.ToBinary(make([]uint8, n))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = abi.NewListReaderWithLimits(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeU8), abi.DefaultLimits())
+			Expect(err).To(Equal(abi.LimitError{Limit: "list len", Max: n - 1, Got: n}))
+			_, err = abi.NewListView(abi.TypeU8, data).Len()
+			Expect(err).To(Equal(abi.LimitError{Limit: "list len", Max: n - 1, Got: n}))
+		})
+	})
+
+	Context("when reading a list", func() {
+		It("should accept lists within the limits", func() {
+			data, err := surge.ToBinary([]string{"abcd", ""})
+			Expect(err).ToNot(HaveOccurred())
+
+			lr, err := abi.NewListReaderWithLimits(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeString), limits())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lr.Next()).To(Equal(abi.String("abcd")))
+			Expect(lr.Next()).To(Equal(abi.String("")))
+			_, err = lr.Next()
+			Expect(err).To(Equal(io.EOF))
+		})
+
+		It("should reject lists that are too long", func() {
+			data, err := surge.ToBinary([]uint8{1, 2, 3})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = abi.NewListReaderWithLimits(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeU8), limits())
+			Expect(err).To(Equal(abi.LimitError{Limit: "list len", Max: 2, Got: 3}))
+		})
+
+		It("should reject elements that are too long before allocating them", func() {
+			// The element claims to be much longer than the data.
+			data := []byte{0, 0, 0, 1, 0, 0, 0, 5, 'h', 'e'}
+
+			lr, err := abi.NewListReaderWithLimits(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeBytes), limits())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = lr.Next()
+			Expect(err).To(Equal(abi.LimitError{Limit: "string len", Max: 4, Got: 5}))
+		})
+
+		It("should reject lists that are too deep", func() {
+			data, err := surge.ToBinary([]uint8{})
+			Expect(err).ToNot(HaveOccurred())
+
+			lim := limits()
+			lim.MaxDepth = 0
+			_, err = abi.NewListReaderWithLimits(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeU8), lim)
+			Expect(err).To(Equal(abi.LimitError{Limit: "depth", Max: 0, Got: 1}))
+		})
+
+		It("should reject lists that exceed the maximum number of bytes", func() {
+			data, err := surge.ToBinary([]string{"abcd", "abcd"})
+			Expect(err).ToNot(HaveOccurred())
+
+			lim := limits()
+			lim.MaxBytes = 14
+			lr, err := abi.NewListReaderWithLimits(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeString), lim)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lr.Next()).To(Equal(abi.String("abcd")))
+			_, err = lr.Next()
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+	})
+
+	Context("when unmarshaling a value", func() {
+		unmarshal := func(text string, lim abi.Limits) error {
+			v := abi.MustParseText(text)
+			data, err := surge.ToBinary(v)
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = abi.UnmarshalValueWithLimits(bytes.NewReader(data), abi.DescOf(v), lim)
+			return err
+		}
+
+		It("should accept values within the limits", func() {
+			lim := limits()
+			lim.MaxDepth = 3
+			Expect(unmarshal(`list<record{a:maybe<str>,b:u8}>[record{a: maybe<str>(str("abcd")), b: u8(1)}]`, lim)).To(Succeed())
+		})
+
+		It("should reject values that are too deep", func() {
+			lim := limits()
+			lim.MaxDepth = 2
+			Expect(unmarshal(`list<list<u8>>[]`, lim)).To(Succeed())
+			Expect(unmarshal(`list<list<list<u8>>>[]`, lim)).To(Succeed())
+			Expect(unmarshal(`list<list<list<u8>>>[list<list<u8>>[]]`, lim)).To(Succeed())
+			Expect(unmarshal(`list<list<list<u8>>>[list<list<u8>>[list<u8>[]]]`, lim)).To(Equal(abi.LimitError{Limit: "depth", Max: 2, Got: 3}))
+			Expect(unmarshal(`record{a: record{b: maybe<u8>(none)}}`, lim)).To(Equal(abi.LimitError{Limit: "depth", Max: 2, Got: 3}))
+		})
+
+		It("should reject nested lists that are too long", func() {
+			lim := limits()
+			lim.MaxDepth = 2
+			Expect(unmarshal(`list<list<u8>>[list<u8>[u8(1), u8(2)]]`, lim)).To(Succeed())
+			Expect(unmarshal(`list<list<u8>>[list<u8>[u8(1), u8(2), u8(3)]]`, lim)).To(Equal(abi.LimitError{Limit: "list len", Max: 2, Got: 3}))
+		})
+
+		It("should reject nested records with too many fields", func() {
+			lim := limits()
+			lim.MaxDepth = 2
+			Expect(unmarshal(`list<record{a:u8,b:u8}>[record{a: u8(1), b: u8(2)}]`, lim)).To(Succeed())
+			Expect(unmarshal(`list<record{a:u8,b:u8,c:u8}>[record{a: u8(1), b: u8(2), c: u8(3)}]`, lim)).To(Equal(abi.LimitError{Limit: "record fields", Max: 2, Got: 3}))
+		})
+
+		It("should reject nested strings that are too long", func() {
+			lim := limits()
+			lim.MaxDepth = 2
+			Expect(unmarshal(`record{a: maybe<str>(str("abcde"))}`, lim)).To(Equal(abi.LimitError{Limit: "string len", Max: 4, Got: 5}))
+		})
+
+		It("should take the maximum number of bytes from the limits", func() {
+			v := abi.MustParseText(`record{a: str("abcd"), b: list<u8>[u8(1), u8(2)]}`).(abi.Record)
+			decoders := []struct {
+				marshal   func(w io.Writer, m int) (int, error)
+				unmarshal func(r io.Reader, lim abi.Limits) (int, error)
+			}{
+				{v.Marshal, func(r io.Reader, lim abi.Limits) (int, error) {
+					_, m, err := abi.UnmarshalValueWithLimits(r, abi.DescOf(v), lim)
+					return m, err
+				}},
+				{v.MarshalCBOR, func(r io.Reader, lim abi.Limits) (int, error) {
+					_, m, err := abi.UnmarshalCBORValueWithLimits(r, abi.DescOf(v), lim)
+					return m, err
+				}},
+				{v.MarshalMsgpack, func(r io.Reader, lim abi.Limits) (int, error) {
+					_, m, err := abi.UnmarshalMsgpackValueWithLimits(r, abi.DescOf(v), lim)
+					return m, err
+				}},
+				{v.MarshalRLP, func(r io.Reader, lim abi.Limits) (int, error) {
+					_, m, err := abi.UnmarshalRLPValueWithLimits(r, abi.DescOf(v), lim)
+					return m, err
+				}},
+				{func(w io.Writer, m int) (int, error) { return abi.MarshalProtoMessage(w, v, m) }, func(r io.Reader, lim abi.Limits) (int, error) {
+					_, m, err := abi.UnmarshalProtoMessageWithLimits(r, abi.DescOf(v), lim)
+					return m, err
+				}},
+			}
+			for _, decoder := range decoders {
+				buf := new(bytes.Buffer)
+				_, err := decoder.marshal(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+
+				lim := limits()
+				lim.MaxDepth = 2
+				lim.MaxBytes = buf.Len() + 1
+				m, err := decoder.unmarshal(bytes.NewReader(buf.Bytes()), lim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m).To(Equal(1))
+
+				lim.MaxBytes = buf.Len()
+				_, err = decoder.unmarshal(bytes.NewReader(buf.Bytes()), lim)
+				Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			}
+		})
+
+		It("should not consume the budget for strings that are too long", func() {
+			data := []byte{0, 0, 0, 10}
+			_, m, err := abi.UnmarshalValue(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeString), 8)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			Expect(m).To(Equal(4))
+		})
+
+		It("should reject nested lengths before allocating them", func() {
+			// A list of lists, whose first element claims to have 2^31
+			// elements.
+			data := []byte{0, 0, 0, 1, 0x80, 0, 0, 0}
+			desc := abi.NewListDesc(abi.NewListDesc(abi.NewTypeDesc(abi.TypeU8)))
+			lim := abi.DefaultLimits()
+			_, _, err := abi.UnmarshalValueWithLimits(bytes.NewReader(data), desc, lim)
+			Expect(err).To(Equal(abi.LimitError{Limit: "list len", Max: lim.MaxListLen, Got: 1 << 31}))
+			lim.MaxListLen = 1 << 31
+			_, _, err = abi.UnmarshalValueWithLimits(bytes.NewReader(data), desc, lim)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+	})
+
+	Context("when decoding lists of empty records", func() {
+		// A list of 2000 lists, each of which claims to have 65536 empty
+		// records. The payload is only 8004 bytes long.
+		nested := func() []byte {
+			data := []byte{0, 0, 0x07, 0xd0}
+			for i := 0; i < 2000; i++ {
+				data = append(data, 0, 1, 0, 0)
+			}
+			return data
+		}
+		desc := abi.NewListDesc(abi.NewListDesc(abi.NewRecordDesc()))
+
+		It("should charge one byte for every element", func() {
+			v := abi.MustParseText(`list<record{}>[record{}, record{}, record{}]`)
+			data, err := surge.ToBinary(v)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(HaveLen(4))
+			_, m, err := abi.UnmarshalValue(bytes.NewReader(data), abi.DescOf(v), 8)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m).To(Equal(1))
+			_, _, err = abi.UnmarshalValue(bytes.NewReader(data), abi.DescOf(v), 7)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+			m, err = v.Marshal(new(bytes.Buffer), 8)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m).To(Equal(1))
+			_, err = v.Marshal(new(bytes.Buffer), 7)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+
+		It("should reject nested lists that cannot fit into the maximum number of bytes", func() {
+			_, _, err := abi.UnmarshalValue(bytes.NewReader(nested()), desc, 1<<20)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+			lr, err := abi.NewListReader(bytes.NewReader(nested()), *desc.Elem, 1<<20)
+			Expect(err).ToNot(HaveOccurred())
+			for err == nil {
+				_, err = lr.Next()
+			}
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+
+		It("should charge views of nested lists against the maximum number of bytes", func() {
+			lim := abi.DefaultLimits()
+			lim.MaxBytes = 1 << 20
+			_, err := abi.NewDescView(desc, nested()).WithLimits(lim).Value()
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+			// The budget of a view is shared in the same way as by
+			// UnmarshalValue.
+			data := []byte{0, 0, 0, 3}
+			lim.MaxBytes = 8
+			Expect(abi.NewDescView(*desc.Elem, data).WithLimits(lim).Len()).To(Equal(3))
+			lim.MaxBytes = 7
+			_, err = abi.NewDescView(*desc.Elem, data).WithLimits(lim).Len()
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+
+		It("should reject lists that cannot fit into the maximum number of bytes of a list writer", func() {
+			_, err := abi.NewListWriter(new(bytes.Buffer), abi.NewRecordDesc(), 65536, 1<<16)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			lw, err := abi.NewListWriter(new(bytes.Buffer), abi.NewRecordDesc(), 3, 8)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lw.MaxBytes()).To(Equal(1))
+		})
+	})
+
+	Context("when viewing a value", func() {
+		It("should reject lists that are too long", func() {
+			data, err := surge.ToBinary([]uint8{1, 2, 3})
+			Expect(err).ToNot(HaveOccurred())
+
+			view := abi.NewListView(abi.TypeU8, data).WithLimits(limits())
+			_, err = view.Len()
+			Expect(err).To(Equal(abi.LimitError{Limit: "list len", Max: 2, Got: 3}))
+			_, err = view.Index(0).U8()
+			Expect(err).To(Equal(abi.LimitError{Limit: "list len", Max: 2, Got: 3}))
+		})
+
+		It("should reject records with too many fields", func() {
+			fields := []abi.RecordField{
+				{Name: "a", Type: abi.TypeU8},
+				{Name: "b", Type: abi.TypeU8},
+				{Name: "c", Type: abi.TypeU8},
+			}
+			view := abi.NewRecordView(fields, []byte{1, 2, 3}).WithLimits(limits())
+			_, err := view.Field("a").U8()
+			Expect(err).To(Equal(abi.LimitError{Limit: "record fields", Max: 2, Got: 3}))
+		})
+
+		It("should reject strings that are too long", func() {
+			data, err := surge.ToBinary([]string{"abcd", "abcde"})
+			Expect(err).ToNot(HaveOccurred())
+
+			view := abi.NewListView(abi.TypeString, data).WithLimits(limits())
+			Expect(view.Index(0).String()).To(Equal(abi.String("abcd")))
+			_, err = view.Index(1).String()
+			Expect(err).To(Equal(abi.LimitError{Limit: "string len", Max: 4, Got: 5}))
+		})
+
+		It("should reject data that exceeds the maximum number of bytes", func() {
+			view := abi.NewView(abi.TypeBytes, make([]byte, 65)).WithLimits(limits())
+			_, err := view.Bytes()
+			Expect(err).To(Equal(abi.LimitError{Limit: "bytes", Max: 64, Got: 65}))
+		})
+
+		It("should reject lists and records that are too deep", func() {
+			lim := limits()
+			lim.MaxDepth = 0
+			_, err := abi.NewListView(abi.TypeU8, []byte{0, 0, 0, 0}).WithLimits(lim).Len()
+			Expect(err).To(Equal(abi.LimitError{Limit: "depth", Max: 0, Got: 1}))
+			_, err = abi.NewRecordView(nil, nil).WithLimits(lim).Field("a").U8()
+			Expect(err).To(Equal(abi.LimitError{Limit: "depth", Max: 0, Got: 1}))
+		})
+	})
+
+	Context("when decoding a stream", func() {
+		It("should reject values that exceed the limits", func() {
+			buf := new(bytes.Buffer)
+			enc := abi.NewEncoder(buf)
+			Expect(enc.Encode(abi.String("abcd"))).To(Succeed())
+			Expect(enc.Encode(abi.String("abcde"))).To(Succeed())
+
+			dec := abi.NewDecoder(buf)
+			dec.SetLimits(limits())
+			Expect(dec.Decode()).To(Equal(abi.String("abcd")))
+			_, err := dec.Decode()
+			Expect(err).To(Equal(abi.LimitError{Limit: "string len", Max: 4, Got: 5}))
+		})
+	})
+})
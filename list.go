@@ -0,0 +1,225 @@
+package abi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/renproject/surge"
+)
+
+// A ListReader reads the elements of a binary encoded list one at a time,
+// without buffering the whole list in memory. The binary encoding of a list is
+// a uint32 length prefix followed by the binary encoding of each element, in
+// the same way that slices are encoded. All elements of the list are described
+// by the same TypeDesc, so lists of records, lists and maybes can be read.
+//
+// The maximum number of bytes is shared by the whole list, and is consumed in
+// the same way as by UnmarshalValue: the length prefix consumes four bytes,
+// and each element consumes the bytes of its binary encoding, so reading the
+// whole list consumes the SizeHint of the List. Elements with an empty binary
+// encoding also consume one byte each, before any of them are read. A list can
+// be read by a ListReader if, and only if, it can be unmarshaled by
+// UnmarshalValue with the same maximum number of bytes and Limits.
+type ListReader struct {
+	r      io.Reader
+	desc   TypeDesc
+	m      int
+	limits Limits
+	len    int
+	i      int
+}
+
+// NewListReader reads the length prefix of a list from the reader, and returns
+// a ListReader that can be used to read the elements of the list. Elements
+// are expected to be described by the given TypeDesc. An error is returned if
+// the TypeDesc is malformed, if the length prefix cannot be read, or if the
+// maximum number of bytes is exceeded. The length of the list, and of any
+// lists nested in its elements, is only limited by the maximum number of
+// bytes, and the elements are checked against the other DefaultLimits.
+func NewListReader(r io.Reader, desc TypeDesc, m int) (*ListReader, error) {
+	limits := DefaultLimits()
+	limits.MaxBytes = m
+	limits.MaxListLen = m
+	return NewListReaderWithLimits(r, desc, limits)
+}
+
+// NewListReaderWithLimits is the same as NewListReader, but checks the list
+// against the given Limits. The maximum number of bytes is taken from the
+// Limits. A LimitError is returned if the length of the list exceeds the
+// maximum list length, and by Next if an element exceeds the maximum string
+// length, and by Next if an element exceeds any of the other Limits.
+func NewListReaderWithLimits(r io.Reader, desc TypeDesc, limits Limits) (*ListReader, error) {
+	m := limits.MaxBytes
+	if m <= 0 {
+		return nil, surge.ErrMaxBytesExceeded
+	}
+	if err := desc.validate(Path{IndexSegment(0)}); err != nil {
+		return nil, err
+	}
+	if err := limits.checkDepth(1); err != nil {
+		return nil, err
+	}
+
+	var n uint32
+	m, err := unmarshalWithin(r, &n, 4, m)
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.checkListLen(int(n)); err != nil {
+		return nil, err
+	}
+	// Lists that cannot fit into the remaining budget are rejected before any
+	// elements are read.
+	if m, err = desc.chargeElems(int(n), m); err != nil {
+		return nil, err
+	}
+	return &ListReader{r: r, desc: desc, m: m, limits: limits, len: int(n)}, nil
+}
+
+// Type returns the type identifier of the elements of the list.
+func (lr *ListReader) Type() Type {
+	return lr.desc.Type
+}
+
+// Desc returns the TypeDesc of the elements of the list.
+func (lr *ListReader) Desc() TypeDesc {
+	return lr.desc
+}
+
+// Len returns the number of elements in the list.
+func (lr *ListReader) Len() int {
+	return lr.len
+}
+
+// Remaining returns the number of elements that have not been read.
+func (lr *ListReader) Remaining() int {
+	return lr.len - lr.i
+}
+
+// MaxBytes returns the maximum number of bytes that remain for reading the
+// rest of the list.
+func (lr *ListReader) MaxBytes() int {
+	return lr.m
+}
+
+// Next reads the next element of the list. It returns io.EOF when all elements
+// have been read. If the underlying reader ends before all elements have been
+// read, io.ErrUnexpectedEOF is returned. After an error, the ListReader must not
+// be used again.
+func (lr *ListReader) Next() (Value, error) {
+	if lr.i >= lr.len {
+		return nil, io.EOF
+	}
+	if lr.m <= 0 {
+		return nil, surge.ErrMaxBytesExceeded
+	}
+
+	v, m, err := decodeValue(lr.r, lr.desc, lr.m, lr.limits, 1)
+	lr.m = m
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	lr.i++
+	return v, nil
+}
+
+// A ListWriter writes the elements of a list one at a time, producing the same
+// binary encoding that is read by a ListReader. The length of the list must be
+// known before any elements are written.
+//
+// The maximum number of bytes is consumed in the same way as by List.Marshal:
+// the length prefix consumes four bytes, and each element consumes the bytes
+// that it writes, so writing the whole list consumes the SizeHint of the List.
+// Elements with an empty binary encoding also consume one byte each, before any
+// of them are written. A list can be written by a ListWriter if, and only if,
+// it can be marshaled by List.Marshal with the same maximum number of bytes.
+type ListWriter struct {
+	w    io.Writer
+	desc TypeDesc
+	m    int
+	len  int
+	i    int
+}
+
+// NewListWriter writes the length prefix of a list to the writer, and returns
+// a ListWriter that can be used to write the elements of the list. Elements
+// must be described by the given TypeDesc. An error is returned if the
+// TypeDesc is malformed, or if the maximum number of bytes is exceeded.
+func NewListWriter(w io.Writer, desc TypeDesc, n int, m int) (*ListWriter, error) {
+	if err := desc.validate(Path{IndexSegment(0)}); err != nil {
+		return nil, err
+	}
+	if n < 0 || uint64(n) > uint64(^uint32(0)) {
+		return nil, fmt.Errorf("overflow: list len=%v", n)
+	}
+	prefix := [4]byte{}
+	binary.BigEndian.PutUint32(prefix[:], uint32(n))
+	m, err := writeWithin(w, prefix[:], m)
+	if err != nil {
+		return nil, err
+	}
+	// Lists that cannot fit into the remaining budget are rejected before any
+	// elements are written.
+	if m, err = desc.chargeElems(n, m); err != nil {
+		return nil, err
+	}
+	return &ListWriter{w: w, desc: desc, m: m, len: n}, nil
+}
+
+// Type returns the type identifier of the elements of the list.
+func (lw *ListWriter) Type() Type {
+	return lw.desc.Type
+}
+
+// Desc returns the TypeDesc of the elements of the list.
+func (lw *ListWriter) Desc() TypeDesc {
+	return lw.desc
+}
+
+// Len returns the number of elements in the list.
+func (lw *ListWriter) Len() int {
+	return lw.len
+}
+
+// Remaining returns the number of elements that have not been written.
+func (lw *ListWriter) Remaining() int {
+	return lw.len - lw.i
+}
+
+// MaxBytes returns the maximum number of bytes that remain for writing the
+// rest of the list.
+func (lw *ListWriter) MaxBytes() int {
+	return lw.m
+}
+
+// Write the next element of the list. An error is returned if the element is
+// not described by the expected TypeDesc, if all elements have already been
+// written, or if the maximum number of bytes is exceeded.
+func (lw *ListWriter) Write(v Value) error {
+	if lw.i >= lw.len {
+		return fmt.Errorf("expected len=%v, got len=%v", lw.len, lw.i+1)
+	}
+	if desc := DescOf(v); !desc.Equal(lw.desc) {
+		return fmt.Errorf("expected type=%v, got type=%v", lw.desc, desc)
+	}
+	if lw.m <= 0 {
+		return surge.ErrMaxBytesExceeded
+	}
+	m, err := v.Marshal(lw.w, lw.m)
+	lw.m = m
+	if err != nil {
+		return err
+	}
+	lw.i++
+	return nil
+}
+
+// Close checks that every element of the list has been written. It does not
+// close the underlying writer.
+func (lw *ListWriter) Close() error {
+	if lw.i != lw.len {
+		return fmt.Errorf("expected len=%v, got len=%v", lw.len, lw.i)
+	}
+	return nil
+}
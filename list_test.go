@@ -0,0 +1,264 @@
+package abi_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lists", func() {
+	Context("when reading a list", func() {
+		It("should return the same elements as unmarshaling a slice", func() {
+			f := func(xs []uint64, strs []string) bool {
+				u64s := make([]abi.U64, len(xs))
+				for i, x := range xs {
+					u64s[i] = abi.NewU64(x)
+				}
+				data, err := surge.ToBinary(u64s)
+				Expect(err).ToNot(HaveOccurred())
+
+				lr, err := abi.NewListReader(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeU64), abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(lr.Len()).To(Equal(len(xs)))
+				for i := range xs {
+					Expect(lr.Remaining()).To(Equal(len(xs) - i))
+					v, err := lr.Next()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(v).To(Equal(u64s[i]))
+				}
+				_, err = lr.Next()
+				Expect(err).To(Equal(io.EOF))
+
+				data, err = surge.ToBinary(strs)
+				Expect(err).ToNot(HaveOccurred())
+				lr, err = abi.NewListReader(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeString), abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				for i := range strs {
+					v, err := lr.Next()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(v).To(Equal(abi.String(strs[i])))
+				}
+				_, err = lr.Next()
+				Expect(err).To(Equal(io.EOF))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should consume the same number of bytes as UnmarshalValue", func() {
+			f := func(strs []string, m uint16) bool {
+				list := stringList(strs)
+				data, err := surge.ToBinary(list)
+				Expect(err).ToNot(HaveOccurred())
+
+				_, expectedM, expectedErr := abi.UnmarshalValue(bytes.NewReader(data), abi.DescOf(list), int(m))
+
+				lr, err := abi.NewListReader(bytes.NewReader(data), list.Elem, int(m))
+				for err == nil {
+					_, err = lr.Next()
+				}
+				if expectedErr != nil {
+					Expect(err).To(Equal(expectedErr))
+					return true
+				}
+				Expect(err).To(Equal(io.EOF))
+				Expect(lr.MaxBytes()).To(Equal(expectedM))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should return an error when the list is truncated", func() {
+			data, err := surge.ToBinary([]abi.U64{abi.NewU64(1), abi.NewU64(2)})
+			Expect(err).ToNot(HaveOccurred())
+
+			lr, err := abi.NewListReader(bytes.NewReader(data[:len(data)-1]), abi.NewTypeDesc(abi.TypeU64), abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = lr.Next()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = lr.Next()
+			Expect(err).To(Equal(io.ErrUnexpectedEOF))
+		})
+
+		It("should return an error when the length exceeds the maximum number of bytes", func() {
+			data := []byte{0x00, 0x00, 0x04, 0x00}
+			_, err := abi.NewListReader(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeU8), 1024)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+			// The maximum list length is the maximum number of bytes.
+			data = []byte{0x00, 0x00, 0xff, 0xff}
+			_, err = abi.NewListReader(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeU8), 1024)
+			Expect(err).To(Equal(abi.LimitError{Limit: "list len", Max: 1024, Got: 0xffff}))
+		})
+
+		It("should only limit the length by the maximum number of bytes", func() {
+			n := 1<<16 + 1
+			data := make([]byte, 4+n)
+			binary.BigEndian.PutUint32(data, uint32(n))
+			lr, err := abi.NewListReader(bytes.NewReader(data), abi.NewTypeDesc(abi.TypeU8), len(data)+1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lr.Len()).To(Equal(n))
+			for i := 0; i < n; i++ {
+				_, err := lr.Next()
+				Expect(err).ToNot(HaveOccurred())
+			}
+			_, err = lr.Next()
+			Expect(err).To(Equal(io.EOF))
+		})
+
+		It("should return an error for malformed element types", func() {
+			_, err := abi.NewListReader(bytes.NewReader([]byte{0, 0, 0, 0}), abi.NewTypeDesc(abi.TypeList), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+			_, err = abi.NewListWriter(new(bytes.Buffer), abi.NewTypeDesc(abi.TypeList), 0, abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should read records with nested lists and maybes", func() {
+			list := abi.MustParseText(`list<record{to:b32,amounts:list<u256>,memo:maybe<str>}>[` +
+				`record{to: b32(0x` + strings.Repeat("01", 32) + `), amounts: list<u256>[u256(1), u256(2)], memo: maybe<str>(str("hi"))}, ` +
+				`record{to: b32(0x` + strings.Repeat("02", 32) + `), amounts: list<u256>[], memo: maybe<str>(none)}]`).(abi.List)
+			data, err := surge.ToBinary(list)
+			Expect(err).ToNot(HaveOccurred())
+
+			lr, err := abi.NewListReader(bytes.NewReader(data), list.Elem, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lr.Desc().Equal(list.Elem)).To(BeTrue())
+			for _, elem := range list.Elems {
+				v, err := lr.Next()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(abi.Equal(v, elem)).To(BeTrue())
+			}
+			_, err = lr.Next()
+			Expect(err).To(Equal(io.EOF))
+		})
+	})
+
+	Context("when writing a list", func() {
+		It("should produce the same bytes as marshaling a slice", func() {
+			f := func(xs [][32]byte) bool {
+				b32s := make([]abi.Bytes32, len(xs))
+				for i, x := range xs {
+					b32s[i] = abi.Bytes32(x)
+				}
+				expected, err := surge.ToBinary(b32s)
+				Expect(err).ToNot(HaveOccurred())
+
+				buf := new(bytes.Buffer)
+				lw, err := abi.NewListWriter(buf, abi.NewTypeDesc(abi.TypeBytes32), len(xs), abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				for _, b32 := range b32s {
+					Expect(lw.Write(b32)).To(Succeed())
+				}
+				Expect(lw.Remaining()).To(Equal(0))
+				Expect(lw.Close()).To(Succeed())
+				Expect(buf.Bytes()).To(Equal(expected))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should round trip through a list reader", func() {
+			buf := new(bytes.Buffer)
+			lw, err := abi.NewListWriter(buf, abi.NewTypeDesc(abi.TypeBytes), 2, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lw.Write(abi.Bytes{1, 2, 3})).To(Succeed())
+			Expect(lw.Write(abi.Bytes{})).To(Succeed())
+			Expect(lw.Close()).To(Succeed())
+
+			lr, err := abi.NewListReader(buf, abi.NewTypeDesc(abi.TypeBytes), abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			v, err := lr.Next()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v).To(Equal(abi.Bytes{1, 2, 3}))
+			v, err = lr.Next()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v).To(Equal(abi.Bytes{}))
+		})
+
+		It("should return an error when elements are missing or extra", func() {
+			lw, err := abi.NewListWriter(new(bytes.Buffer), abi.NewTypeDesc(abi.TypeBool), 1, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lw.Close()).ToNot(Succeed())
+			Expect(lw.Write(abi.NewBool(true))).To(Succeed())
+			Expect(lw.Write(abi.NewBool(true))).ToNot(Succeed())
+			Expect(lw.Close()).To(Succeed())
+		})
+
+		It("should return an error when an element has the wrong type", func() {
+			lw, err := abi.NewListWriter(new(bytes.Buffer), abi.NewTypeDesc(abi.TypeBool), 1, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lw.Write(abi.NewU8(1))).ToNot(Succeed())
+
+			desc, err := abi.ParseTypeDesc("record{a:u8}")
+			Expect(err).ToNot(HaveOccurred())
+			lw, err = abi.NewListWriter(new(bytes.Buffer), desc, 1, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lw.Write(abi.MustParseText("record{b: u8(1)}"))).ToNot(Succeed())
+			Expect(lw.Write(abi.MustParseText("record{a: u8(1)}"))).To(Succeed())
+		})
+
+		It("should return an error when the maximum number of bytes is exceeded", func() {
+			// The length prefix consumes four bytes, and each string consumes
+			// its SizeHint.
+			lw, err := abi.NewListWriter(new(bytes.Buffer), abi.NewTypeDesc(abi.TypeString), 2, 4+16+1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lw.Write(abi.String("hello, world"))).To(Succeed())
+			Expect(lw.MaxBytes()).To(Equal(1))
+			Expect(lw.Write(abi.String("hello, world"))).To(Equal(surge.ErrMaxBytesExceeded))
+
+			_, err = abi.NewListWriter(new(bytes.Buffer), abi.NewTypeDesc(abi.TypeString), 2, 4)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+
+		It("should consume the same number of bytes as a list reader and List.Marshal", func() {
+			f := func(strs []string, m uint16) bool {
+				list := stringList(strs)
+				expectedM, expectedErr := list.Marshal(new(bytes.Buffer), int(m))
+
+				buf := new(bytes.Buffer)
+				lw, writeErr := abi.NewListWriter(buf, list.Elem, len(strs), int(m))
+				for i := 0; writeErr == nil && i < len(strs); i++ {
+					writeErr = lw.Write(list.Elems[i])
+				}
+
+				data, err := surge.ToBinary(list)
+				Expect(err).ToNot(HaveOccurred())
+				lr, readErr := abi.NewListReader(bytes.NewReader(data), list.Elem, int(m))
+				for i := 0; readErr == nil && i < len(strs); i++ {
+					_, readErr = lr.Next()
+				}
+
+				if expectedErr != nil {
+					Expect(writeErr).To(Equal(expectedErr))
+					Expect(readErr).To(Equal(expectedErr))
+				} else {
+					Expect(writeErr).ToNot(HaveOccurred())
+					Expect(readErr).ToNot(HaveOccurred())
+					Expect(buf.Bytes()).To(Equal(data))
+					Expect(lw.MaxBytes()).To(Equal(expectedM))
+					Expect(lr.MaxBytes()).To(Equal(expectedM))
+					Expect(expectedM).To(Equal(int(m) - list.SizeHint()))
+				}
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
+})
+
+// stringList returns a List of Strings.
+func stringList(strs []string) abi.List {
+	elems := make([]abi.Value, len(strs))
+	for i, str := range strs {
+		elems[i] = abi.String(str)
+	}
+	return abi.List{Elem: abi.NewTypeDesc(abi.TypeString), Elems: elems}
+}
@@ -0,0 +1,413 @@
+package abi
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// HashTreeRoot returns the Merkle root of a Value, using an SSZ-style scheme
+// built on SHA2-256. Values are split into 32 byte chunks, which are the
+// leaves of a binary Merkle tree that is padded with zero chunks up to the
+// next power of two.
+//
+//   - Bool and U8 to U256 are little endian, and padded to one chunk.
+//   - Bytes32 is one chunk.
+//   - Bytes65 and Signature are packed into three chunks.
+//   - Bytes and String are packed into chunks, and the length is mixed into
+//     the root (as in SSZ lists).
+//   - List is the HashTreeRootList of its elements.
+//   - Record is the HashTreeRootRecord of its fields.
+//   - Maybe mixes a selector into the root of its value (as in SSZ unions):
+//     zero, mixed into the zero chunk, when there is no value, and one, mixed
+//     into the root of the value, when there is a value.
+//
+// An error is returned if the Value, or any value nested in it, is nil or is
+// not one of these types.
+func HashTreeRoot(v Value) (Bytes32, error) {
+	chunk := Bytes32{}
+	switch v := v.(type) {
+	case Bool:
+		if v.inner {
+			chunk[0] = 1
+		}
+		return chunk, nil
+	case U8:
+		chunk[0] = v.inner
+		return chunk, nil
+	case U16:
+		binary.LittleEndian.PutUint16(chunk[:], v.inner)
+		return chunk, nil
+	case U32:
+		binary.LittleEndian.PutUint32(chunk[:], v.inner)
+		return chunk, nil
+	case U64:
+		binary.LittleEndian.PutUint64(chunk[:], v.inner)
+		return chunk, nil
+	case U128:
+		if v.inner != nil {
+			b16 := paddedTo16(v.inner)
+			for i := range b16 {
+				chunk[i] = b16[15-i]
+			}
+		}
+		return chunk, nil
+	case U256:
+		if v.inner != nil {
+			b32 := paddedTo32(v.inner)
+			for i := range b32 {
+				chunk[i] = b32[31-i]
+			}
+		}
+		return chunk, nil
+	case Bytes32:
+		return v, nil
+	case Bytes65:
+		return merkleize(pack(v[:])), nil
+	case Signature:
+		return merkleize(pack(v.Bytes65[:])), nil
+	case Bytes:
+		return mixInLength(merkleize(pack(v)), len(v)), nil
+	case String:
+		return mixInLength(merkleize(pack([]byte(v))), len(v)), nil
+	case List:
+		return HashTreeRootList(v.Elems)
+	case Record:
+		return HashTreeRootRecord(v.Values)
+	case Maybe:
+		if v.Value == nil {
+			return mixInLength(Bytes32{}, 0), nil
+		}
+		root, err := HashTreeRoot(v.Value)
+		if err != nil {
+			return Bytes32{}, err
+		}
+		return mixInLength(root, 1), nil
+	default:
+		return Bytes32{}, fmt.Errorf("non-exhaustive pattern: %T", v)
+	}
+}
+
+// HashTreeRootList returns the Merkle root of a list of values. The roots of
+// the values are the leaves of the tree, and the length of the list is mixed
+// into the root. An error is returned if the root of any value cannot be
+// computed.
+func HashTreeRootList(vs []Value) (Bytes32, error) {
+	chunks, err := hashTreeRoots(vs)
+	if err != nil {
+		return Bytes32{}, err
+	}
+	return mixInLength(merkleize(chunks), len(vs)), nil
+}
+
+// HashTreeRootRecord returns the Merkle root of a record, given the values of
+// its fields in order. The roots of the fields are the leaves of the tree. The
+// number of fields is fixed by the type of the record, so it is not mixed into
+// the root. An error is returned if the root of any field cannot be computed.
+func HashTreeRootRecord(fields []Value) (Bytes32, error) {
+	chunks, err := hashTreeRoots(fields)
+	if err != nil {
+		return Bytes32{}, err
+	}
+	return merkleize(chunks), nil
+}
+
+// A MerkleProof proves that a leaf is part of a Merkle tree. The position of
+// the leaf is identified by its generalized index: the root has index 1, and
+// the children of the node at index i have indices 2i and 2i+1. The branch
+// contains the sibling of every node on the path from the leaf to the root.
+type MerkleProof struct {
+	Index  uint64    `json:"index"`
+	Leaf   Bytes32   `json:"leaf"`
+	Branch []Bytes32 `json:"branch"`
+}
+
+// Root computes the Merkle root implied by the proof. An error is returned if
+// the length of the branch does not match the depth of the index.
+func (proof MerkleProof) Root() (Bytes32, error) {
+	if proof.Index == 0 {
+		return Bytes32{}, fmt.Errorf("non-exhaustive pattern: generalized index 0")
+	}
+	if depth := bits.Len64(proof.Index) - 1; len(proof.Branch) != depth {
+		return Bytes32{}, fmt.Errorf("expected branch len=%v, got len=%v", depth, len(proof.Branch))
+	}
+	node := proof.Leaf
+	index := proof.Index
+	for _, sibling := range proof.Branch {
+		if index&1 == 1 {
+			node = hashPair(sibling, node)
+		} else {
+			node = hashPair(node, sibling)
+		}
+		index >>= 1
+	}
+	return node, nil
+}
+
+// Verify that the proof is valid for the given Merkle root.
+func (proof MerkleProof) Verify(root Bytes32) bool {
+	actual, err := proof.Root()
+	return err == nil && actual == root
+}
+
+// ProveList returns a proof that the element at index i is part of the list.
+// The leaf of the proof is the HashTreeRoot of the element.
+func ProveList(vs []Value, i int) (MerkleProof, error) {
+	if i < 0 || i >= len(vs) {
+		return MerkleProof{}, fmt.Errorf("expected index<%v, got index=%v", len(vs), i)
+	}
+	chunks, err := hashTreeRoots(vs)
+	if err != nil {
+		return MerkleProof{}, err
+	}
+	branch := merkleBranch(chunks, i)
+	branch = append(branch, lengthChunk(len(vs)))
+	return MerkleProof{
+		Index:  ListGeneralizedIndex(len(vs), i),
+		Leaf:   chunks[i],
+		Branch: branch,
+	}, nil
+}
+
+// VerifyList verifies that the proof is for the element at index i of a list
+// with the given length and Merkle root. The last node in the branch must be
+// the length of the list.
+func VerifyList(root Bytes32, length, i int, proof MerkleProof) bool {
+	if i < 0 || i >= length || len(proof.Branch) == 0 {
+		return false
+	}
+	if proof.Branch[len(proof.Branch)-1] != lengthChunk(length) {
+		return false
+	}
+	return proof.Index == ListGeneralizedIndex(length, i) && proof.Verify(root)
+}
+
+// ProveRecord returns a proof that the field at index i is part of the record.
+// The leaf of the proof is the HashTreeRoot of the field.
+func ProveRecord(fields []Value, i int) (MerkleProof, error) {
+	if i < 0 || i >= len(fields) {
+		return MerkleProof{}, fmt.Errorf("expected index<%v, got index=%v", len(fields), i)
+	}
+	chunks, err := hashTreeRoots(fields)
+	if err != nil {
+		return MerkleProof{}, err
+	}
+	return MerkleProof{
+		Index:  RecordGeneralizedIndex(len(fields), i),
+		Leaf:   chunks[i],
+		Branch: merkleBranch(chunks, i),
+	}, nil
+}
+
+// VerifyRecord verifies that the proof is for the field at index i of a record
+// with the given number of fields and Merkle root.
+func VerifyRecord(root Bytes32, numFields, i int, proof MerkleProof) bool {
+	if i < 0 || i >= numFields {
+		return false
+	}
+	return proof.Index == RecordGeneralizedIndex(numFields, i) && proof.Verify(root)
+}
+
+// Prove returns a proof that the value at the given Path is part of a Value.
+// The leaf of the proof is the HashTreeRoot of the value at the Path, and the
+// proof verifies against the HashTreeRoot of the Value. Paths can pass through
+// nested lists and records, and through maybes that have a value (the value of
+// a maybe has the same Path as the maybe). An error is returned if there is no
+// value at the Path.
+func Prove(v Value, path Path) (MerkleProof, error) {
+	proof := MerkleProof{Index: 1}
+	for i := 0; i <= len(path); i++ {
+		// The value of a maybe is the left child of the root of the maybe, and
+		// the selector is the right child.
+		for {
+			maybe, ok := v.(Maybe)
+			if !ok || maybe.Value == nil {
+				break
+			}
+			proof = proof.extend(MerkleProof{Index: 2, Branch: []Bytes32{lengthChunk(1)}})
+			v = maybe.Value
+		}
+		if i == len(path) {
+			break
+		}
+
+		var child MerkleProof
+		var err error
+		seg := path[i]
+		switch parent := v.(type) {
+		case List:
+			if !seg.IsIndex() {
+				return MerkleProof{}, fmt.Errorf("expected %v to be a record, got %v", path[:i], typeOf(v))
+			}
+			if child, err = ProveList(parent.Elems, seg.Index); err != nil {
+				return MerkleProof{}, fmt.Errorf("proving %v: %v", path[:i+1], err)
+			}
+			v = parent.Elems[seg.Index]
+		case Record:
+			if seg.IsIndex() {
+				return MerkleProof{}, fmt.Errorf("expected %v to be a list, got %v", path[:i], typeOf(v))
+			}
+			j := -1
+			for k, field := range parent.Fields {
+				if field.Name == seg.Field {
+					j = k
+				}
+			}
+			if j < 0 {
+				return MerkleProof{}, fmt.Errorf("proving %v: no such field", path[:i+1])
+			}
+			if child, err = ProveRecord(parent.Values, j); err != nil {
+				return MerkleProof{}, fmt.Errorf("proving %v: %v", path[:i+1], err)
+			}
+			v = parent.Values[j]
+		default:
+			return MerkleProof{}, fmt.Errorf("proving %v: %v has no children", path[:i+1], typeOf(v))
+		}
+		proof = proof.extend(child)
+	}
+	leaf, err := HashTreeRoot(v)
+	if err != nil {
+		return MerkleProof{}, err
+	}
+	proof.Leaf = leaf
+	return proof, nil
+}
+
+// ListGeneralizedIndex returns the generalized index of the element at index i
+// of a list with the given length. The Merkle tree of the elements is the left
+// child of the root, and the length is the right child.
+func ListGeneralizedIndex(length, i int) uint64 {
+	return RecordGeneralizedIndex(length, i) + uint64(1)<<merkleDepth(length)
+}
+
+// RecordGeneralizedIndex returns the generalized index of the field at index i
+// of a record with the given number of fields.
+func RecordGeneralizedIndex(numFields, i int) uint64 {
+	return uint64(1)<<merkleDepth(numFields) + uint64(i)
+}
+
+// extend returns a proof for the leaf of a child proof, where the root of the
+// child proof is the leaf of the proof. The generalized indices are
+// concatenated, and the branch of the child proof comes first, because
+// branches are ordered from the leaf to the root.
+func (proof MerkleProof) extend(child MerkleProof) MerkleProof {
+	depth := uint(bits.Len64(child.Index) - 1)
+	branch := make([]Bytes32, 0, len(child.Branch)+len(proof.Branch))
+	branch = append(branch, child.Branch...)
+	branch = append(branch, proof.Branch...)
+	return MerkleProof{
+		Index:  proof.Index<<depth | (child.Index - uint64(1)<<depth),
+		Branch: branch,
+	}
+}
+
+// hashTreeRoots returns the HashTreeRoot of each value.
+func hashTreeRoots(vs []Value) ([]Bytes32, error) {
+	chunks := make([]Bytes32, len(vs))
+	for i, v := range vs {
+		var err error
+		if chunks[i], err = HashTreeRoot(v); err != nil {
+			return nil, err
+		}
+	}
+	return chunks, nil
+}
+
+// pack bytes into 32 byte chunks. The last chunk is padded with zeros.
+func pack(data []byte) []Bytes32 {
+	chunks := make([]Bytes32, (len(data)+31)/32)
+	for i := range chunks {
+		copy(chunks[i][:], data[32*i:])
+	}
+	return chunks
+}
+
+// merkleDepth returns the depth of a Merkle tree with n leaves, after padding
+// to the next power of two.
+func merkleDepth(n int) uint {
+	depth := uint(0)
+	for 1<<depth < n {
+		depth++
+	}
+	return depth
+}
+
+// merkleize returns the root of the Merkle tree with the given leaves, after
+// padding with zero chunks to the next power of two. The root of an empty tree
+// is the zero chunk.
+func merkleize(chunks []Bytes32) Bytes32 {
+	if len(chunks) == 0 {
+		return Bytes32{}
+	}
+	layer := chunks
+	for d := uint(0); d < merkleDepth(len(chunks)); d++ {
+		layer = merkleLayer(layer, d)
+	}
+	return layer[0]
+}
+
+// merkleBranch returns the siblings on the path from the leaf at index i to the
+// root of the Merkle tree with the given leaves.
+func merkleBranch(chunks []Bytes32, i int) []Bytes32 {
+	depth := merkleDepth(len(chunks))
+	branch := make([]Bytes32, 0, depth)
+	layer := chunks
+	for d := uint(0); d < depth; d++ {
+		if sibling := i ^ 1; sibling < len(layer) {
+			branch = append(branch, layer[sibling])
+		} else {
+			branch = append(branch, zeroHash(d))
+		}
+		layer = merkleLayer(layer, d)
+		i /= 2
+	}
+	return branch
+}
+
+// merkleLayer returns the parents of a layer of nodes at the given height. If
+// the layer has an odd number of nodes, the last node is paired with the root
+// of an all-zero tree of the same height.
+func merkleLayer(layer []Bytes32, height uint) []Bytes32 {
+	next := make([]Bytes32, (len(layer)+1)/2)
+	for i := range next {
+		if 2*i+1 < len(layer) {
+			next[i] = hashPair(layer[2*i], layer[2*i+1])
+		} else {
+			next[i] = hashPair(layer[2*i], zeroHash(height))
+		}
+	}
+	return next
+}
+
+// mixInLength returns the hash of a Merkle root and a length.
+func mixInLength(root Bytes32, length int) Bytes32 {
+	return hashPair(root, lengthChunk(length))
+}
+
+// lengthChunk returns a length as a little endian chunk.
+func lengthChunk(length int) Bytes32 {
+	chunk := Bytes32{}
+	binary.LittleEndian.PutUint64(chunk[:], uint64(length))
+	return chunk
+}
+
+// zeroHash returns the root of a Merkle tree of the given depth where every
+// leaf is the zero chunk.
+func zeroHash(depth uint) Bytes32 {
+	node := Bytes32{}
+	for d := uint(0); d < depth; d++ {
+		node = hashPair(node, node)
+	}
+	return node
+}
+
+// hashPair returns the SHA2-256 hash of two concatenated nodes.
+func hashPair(left, right Bytes32) Bytes32 {
+	h := sha256.New()
+	h.Write(left[:])
+	h.Write(right[:])
+	node := Bytes32{}
+	copy(node[:], h.Sum(nil))
+	return node
+}
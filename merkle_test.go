@@ -0,0 +1,221 @@
+package abi_test
+
+import (
+	"crypto/sha256"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Merkle", func() {
+	hashPair := func(left, right abi.Bytes32) abi.Bytes32 {
+		return abi.Bytes32(sha256.Sum256(append(left[:], right[:]...)))
+	}
+	hashTreeRoot := func(v abi.Value) abi.Bytes32 {
+		root, err := abi.HashTreeRoot(v)
+		Expect(err).ToNot(HaveOccurred())
+		return root
+	}
+	hashTreeRootList := func(vs []abi.Value) abi.Bytes32 {
+		root, err := abi.HashTreeRootList(vs)
+		Expect(err).ToNot(HaveOccurred())
+		return root
+	}
+	hashTreeRootRecord := func(fields []abi.Value) abi.Bytes32 {
+		root, err := abi.HashTreeRootRecord(fields)
+		Expect(err).ToNot(HaveOccurred())
+		return root
+	}
+
+	Context("when computing the root of a scalar", func() {
+		It("should be the little endian chunk", func() {
+			root := hashTreeRoot(abi.NewU64(0x0102))
+			Expect(root[:3]).To(Equal([]byte{0x02, 0x01, 0x00}))
+
+			root = hashTreeRoot(abi.NewU256FromU64(abi.NewU64(0x0102)))
+			Expect(root[:3]).To(Equal([]byte{0x02, 0x01, 0x00}))
+
+			root = hashTreeRoot(abi.NewBool(true))
+			Expect(root[:2]).To(Equal([]byte{0x01, 0x00}))
+		})
+	})
+
+	Context("when computing the root of bytes", func() {
+		It("should merkleize the chunks", func() {
+			b65 := abi.Bytes65{}
+			b65[0], b65[32], b65[64] = 1, 2, 3
+			c0, c1, c2 := abi.Bytes32{1}, abi.Bytes32{2}, abi.Bytes32{3}
+			expected := hashPair(hashPair(c0, c1), hashPair(c2, abi.Bytes32{}))
+			Expect(hashTreeRoot(b65)).To(Equal(expected))
+			Expect(hashTreeRoot(abi.Signature{Bytes65: b65})).To(Equal(expected))
+		})
+
+		It("should mix in the length", func() {
+			length := abi.Bytes32{3}
+			expected := hashPair(abi.Bytes32{'a', 'b', 'c'}, length)
+			Expect(hashTreeRoot(abi.String("abc"))).To(Equal(expected))
+			Expect(hashTreeRoot(abi.Bytes("abc"))).To(Equal(expected))
+			Expect(hashTreeRoot(abi.Bytes("abc\x00"))).ToNot(Equal(expected))
+		})
+	})
+
+	Context("when proving elements of a list", func() {
+		It("should verify against the root", func() {
+			f := func(xs []uint64, i uint) bool {
+				if len(xs) == 0 {
+					return true
+				}
+				vs := make([]abi.Value, len(xs))
+				for j := range xs {
+					vs[j] = abi.NewU64(xs[j])
+				}
+				root := hashTreeRootList(vs)
+				index := int(i % uint(len(xs)))
+
+				proof, err := abi.ProveList(vs, index)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(proof.Leaf).To(Equal(hashTreeRoot(vs[index])))
+				Expect(abi.VerifyList(root, len(vs), index, proof)).To(BeTrue())
+
+				// Proofs for the wrong index, length, or leaf must fail.
+				Expect(abi.VerifyList(root, len(vs)+1, index, proof)).To(BeFalse())
+				Expect(abi.VerifyList(root, len(vs), index+1, proof)).To(BeFalse())
+				proof.Leaf[0]++
+				Expect(abi.VerifyList(root, len(vs), index, proof)).To(BeFalse())
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when proving fields of a record", func() {
+		It("should verify against the root", func() {
+			f := func(x [32]byte, y string, z bool) bool {
+				fields := []abi.Value{abi.NewU256(x), abi.String(y), abi.NewBool(z)}
+				root := hashTreeRootRecord(fields)
+				for i := range fields {
+					proof, err := abi.ProveRecord(fields, i)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(abi.VerifyRecord(root, len(fields), i, proof)).To(BeTrue())
+					Expect(abi.VerifyList(root, len(fields), i, proof)).To(BeFalse())
+				}
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should return an error for out of range fields", func() {
+			_, err := abi.ProveRecord([]abi.Value{abi.NewU8(1)}, 1)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when computing the root of a composite value", func() {
+		It("should be the root of its elements or fields", func() {
+			list := abi.MustParseText(`list<u64>[u64(1), u64(2)]`).(abi.List)
+			Expect(hashTreeRoot(list)).To(Equal(hashTreeRootList(list.Elems)))
+
+			record := abi.MustParseText(`record{to: str("a"), amounts: list<u64>[u64(1)]}`).(abi.Record)
+			Expect(hashTreeRoot(record)).To(Equal(hashTreeRootRecord(record.Values)))
+		})
+
+		It("should mix a selector into the root of a maybe", func() {
+			none := abi.MustParseText(`maybe<u64>(none)`)
+			Expect(hashTreeRoot(none)).To(Equal(hashPair(abi.Bytes32{}, abi.Bytes32{})))
+
+			some := abi.MustParseText(`maybe<u64>(u64(0))`)
+			Expect(hashTreeRoot(some)).To(Equal(hashPair(abi.Bytes32{}, abi.Bytes32{1})))
+		})
+	})
+
+	Context("when computing the root of a value that is not supported", func() {
+		It("should return an error", func() {
+			_, err := abi.HashTreeRoot(nil)
+			Expect(err).To(HaveOccurred())
+			_, err = abi.HashTreeRootList([]abi.Value{abi.NewU8(1), nil})
+			Expect(err).To(HaveOccurred())
+			_, err = abi.HashTreeRootRecord([]abi.Value{nil})
+			Expect(err).To(HaveOccurred())
+			_, err = abi.ProveList([]abi.Value{nil}, 0)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when proving values at a path", func() {
+		It("should verify every nested value against the root", func() {
+			v := abi.MustParseText(`record{
+				outputs: list<record{to: str, amount: u256}>[
+					record{to: str("a"), amount: u256(1)},
+					record{to: str("b"), amount: u256(2)},
+					record{to: str("c"), amount: u256(3)},
+				],
+				memo: maybe<record{note: str}>(record{note: str("hello")}),
+				nonce: u64(7),
+			}`)
+			root := hashTreeRoot(v)
+
+			results, err := abi.Query(v, "..")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(results)).To(BeNumerically(">", 10))
+			for _, result := range results {
+				proof, err := abi.Prove(v, result.Path)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(proof.Verify(root)).To(BeTrue(), result.Path.String())
+
+				// The proof is for the value inside of any maybes at the path.
+				leaf := result.Value
+				for maybe, ok := leaf.(abi.Maybe); ok; maybe, ok = leaf.(abi.Maybe) {
+					leaf = maybe.Value
+				}
+				Expect(proof.Leaf).To(Equal(hashTreeRoot(leaf)), result.Path.String())
+			}
+		})
+
+		It("should match the proofs of a list and a record", func() {
+			v := abi.MustParseText(`record{a: u8(1), b: list<u8>[u8(2), u8(3)]}`).(abi.Record)
+			list := v.Values[1].(abi.List)
+
+			proof, err := abi.Prove(v, abi.Path{abi.FieldSegment("b"), abi.IndexSegment(1)})
+			Expect(err).ToNot(HaveOccurred())
+			fieldProof, err := abi.ProveRecord(v.Values, 1)
+			Expect(err).ToNot(HaveOccurred())
+			elemProof, err := abi.ProveList(list.Elems, 1)
+			Expect(err).ToNot(HaveOccurred())
+
+			// The field is at index 0b11, and the element is at index 0b101 of the
+			// field, so the element is at index 0b1101.
+			Expect(proof.Index).To(Equal(uint64(0xd)))
+			Expect(proof.Branch).To(Equal(append(elemProof.Branch, fieldProof.Branch...)))
+			Expect(proof.Leaf).To(Equal(elemProof.Leaf))
+		})
+
+		It("should return an error if there is no value at the path", func() {
+			v := abi.MustParseText(`record{a: u8(1), b: list<u8>[u8(2)], c: maybe<record{d: u8}>(none)}`)
+			for _, path := range []abi.Path{
+				{abi.FieldSegment("z")},
+				{abi.IndexSegment(0)},
+				{abi.FieldSegment("a"), abi.FieldSegment("z")},
+				{abi.FieldSegment("b"), abi.IndexSegment(1)},
+				{abi.FieldSegment("b"), abi.FieldSegment("z")},
+				{abi.FieldSegment("c"), abi.FieldSegment("d")},
+			} {
+				_, err := abi.Prove(v, path)
+				Expect(err).To(HaveOccurred(), path.String())
+			}
+		})
+	})
+
+	Context("when computing the root of a proof with the wrong branch length", func() {
+		It("should return an error", func() {
+			_, err := abi.MerkleProof{Index: 4, Branch: []abi.Bytes32{{}}}.Root()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
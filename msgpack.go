@@ -0,0 +1,760 @@
+package abi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"unicode/utf8"
+
+	"github.com/renproject/surge"
+)
+
+// MessagePack formats as defined in the MessagePack specification.
+const (
+	msgpackFixMap   = 0x80
+	msgpackFixArray = 0x90
+	msgpackFixStr   = 0xa0
+	msgpackFalse    = 0xc2
+	msgpackTrue     = 0xc3
+	msgpackBin8     = 0xc4
+	msgpackBin16    = 0xc5
+	msgpackBin32    = 0xc6
+	msgpackExt8     = 0xc7
+	msgpackExt16    = 0xc8
+	msgpackExt32    = 0xc9
+	msgpackUint8    = 0xcc
+	msgpackUint16   = 0xcd
+	msgpackUint32   = 0xce
+	msgpackUint64   = 0xcf
+	msgpackFixExt16 = 0xd8
+	msgpackStr8     = 0xd9
+	msgpackStr16    = 0xda
+	msgpackStr32    = 0xdb
+	msgpackArray16  = 0xdc
+	msgpackArray32  = 0xdd
+	msgpackMap16    = 0xde
+	msgpackMap32    = 0xdf
+)
+
+// A MsgpackMarshaler can be marshaled to MessagePack.
+type MsgpackMarshaler interface {
+	// MarshalMsgpack into an I/O writer. It accepts a maximum capacity of
+	// bytes that can be allocated, and returns the remaining capacity.
+	MarshalMsgpack(w io.Writer, m int) (int, error)
+}
+
+// A MsgpackUnmarshaler can be unmarshaled from MessagePack.
+type MsgpackUnmarshaler interface {
+	// UnmarshalMsgpack from an I/O reader. It accepts a maximum capacity of
+	// bytes that can be allocated, and returns the remaining capacity. It must
+	// not allocate more bytes than the maximum capacity.
+	UnmarshalMsgpack(r io.Reader, m int) (int, error)
+}
+
+// MarshalMsgpack marshals the String to MessagePack as a str. An error is
+// returned if the String is not valid UTF-8.
+func (str String) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	if !utf8.ValidString(string(str)) {
+		return m, fmt.Errorf("malformed: String is not valid utf-8")
+	}
+	m, err := msgpackWriteStrHeader(w, len(str), m)
+	if err != nil {
+		return m, err
+	}
+	return writeWithin(w, []byte(str), m)
+}
+
+// UnmarshalMsgpack unmarshals the String from a MessagePack str. Unmarshaling
+// will not allocate more than the specified maximum number of bytes.
+func (str *String) UnmarshalMsgpack(r io.Reader, m int) (int, error) {
+	data, m, err := msgpackReadStr(r, m, m)
+	if err != nil {
+		return m, err
+	}
+	*str = String(data)
+	return m, nil
+}
+
+// MarshalMsgpack marshals the Bytes to MessagePack as a bin.
+func (b Bytes) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	m, err := msgpackWriteBinHeader(w, len(b), m)
+	if err != nil {
+		return m, err
+	}
+	return writeWithin(w, b, m)
+}
+
+// UnmarshalMsgpack unmarshals the Bytes from a MessagePack bin. Unmarshaling
+// will not allocate more than the specified maximum number of bytes.
+func (b *Bytes) UnmarshalMsgpack(r io.Reader, m int) (int, error) {
+	data, m, err := msgpackReadBin(r, m, m)
+	if err != nil {
+		return m, err
+	}
+	*b = data
+	return m, nil
+}
+
+// MarshalMsgpack marshals the Bytes32 to MessagePack as an ext with the
+// TypeBytes32 type identifier.
+func (b32 Bytes32) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	return msgpackWriteExt(w, TypeBytes32, b32[:], m)
+}
+
+// UnmarshalMsgpack unmarshals the Bytes32 from a MessagePack ext with the
+// TypeBytes32 type identifier.
+func (b32 *Bytes32) UnmarshalMsgpack(r io.Reader, m int) (int, error) {
+	return msgpackReadExt(r, TypeBytes32, (*b32)[:], m)
+}
+
+// MarshalMsgpack marshals the Bytes65 to MessagePack as an ext with the
+// TypeBytes65 type identifier.
+func (b65 Bytes65) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	return msgpackWriteExt(w, TypeBytes65, b65[:], m)
+}
+
+// UnmarshalMsgpack unmarshals the Bytes65 from a MessagePack ext with the
+// TypeBytes65 type identifier.
+func (b65 *Bytes65) UnmarshalMsgpack(r io.Reader, m int) (int, error) {
+	return msgpackReadExt(r, TypeBytes65, (*b65)[:], m)
+}
+
+// MarshalMsgpack marshals the Bool to MessagePack.
+func (b Bool) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	bs := [1]byte{msgpackFalse}
+	if b.inner {
+		bs[0] = msgpackTrue
+	}
+	return writeWithin(w, bs[:], m)
+}
+
+// UnmarshalMsgpack unmarshals the Bool from MessagePack.
+func (b *Bool) UnmarshalMsgpack(r io.Reader, m int) (int, error) {
+	prefix, m, err := msgpackReadPrefix(r, m)
+	if err != nil {
+		return m, err
+	}
+	switch prefix {
+	case msgpackFalse:
+		b.inner = false
+	case msgpackTrue:
+		b.inner = true
+	default:
+		return m, fmt.Errorf("non-exhaustive pattern: Bool(0x%x)", prefix)
+	}
+	return m, nil
+}
+
+// MarshalMsgpack marshals the U8 to MessagePack as an unsigned integer.
+func (u8 U8) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	return msgpackWriteInt(w, uint64(u8.inner), m)
+}
+
+// UnmarshalMsgpack unmarshals the U8 from a MessagePack integer.
+func (u8 *U8) UnmarshalMsgpack(r io.Reader, m int) (int, error) {
+	x, m, err := msgpackReadInt(r, uint64(MaxU8().inner), m)
+	if err != nil {
+		return m, err
+	}
+	u8.inner = uint8(x)
+	return m, nil
+}
+
+// MarshalMsgpack marshals the U16 to MessagePack as an unsigned integer.
+func (u16 U16) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	return msgpackWriteInt(w, uint64(u16.inner), m)
+}
+
+// UnmarshalMsgpack unmarshals the U16 from a MessagePack integer.
+func (u16 *U16) UnmarshalMsgpack(r io.Reader, m int) (int, error) {
+	x, m, err := msgpackReadInt(r, uint64(MaxU16().inner), m)
+	if err != nil {
+		return m, err
+	}
+	u16.inner = uint16(x)
+	return m, nil
+}
+
+// MarshalMsgpack marshals the U32 to MessagePack as an unsigned integer.
+func (u32 U32) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	return msgpackWriteInt(w, uint64(u32.inner), m)
+}
+
+// UnmarshalMsgpack unmarshals the U32 from a MessagePack integer.
+func (u32 *U32) UnmarshalMsgpack(r io.Reader, m int) (int, error) {
+	x, m, err := msgpackReadInt(r, uint64(MaxU32().inner), m)
+	if err != nil {
+		return m, err
+	}
+	u32.inner = uint32(x)
+	return m, nil
+}
+
+// MarshalMsgpack marshals the U64 to MessagePack as an unsigned integer.
+func (u64 U64) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	return msgpackWriteInt(w, u64.inner, m)
+}
+
+// UnmarshalMsgpack unmarshals the U64 from a MessagePack integer.
+func (u64 *U64) UnmarshalMsgpack(r io.Reader, m int) (int, error) {
+	x, m, err := msgpackReadInt(r, MaxU64().inner, m)
+	if err != nil {
+		return m, err
+	}
+	u64.inner = x
+	return m, nil
+}
+
+// MarshalMsgpack marshals the U128 to MessagePack as an ext with the TypeU128
+// type identifier. The data is the 16 byte big endian representation.
+func (u128 U128) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	var b16 [16]byte
+	if u128.inner != nil {
+		b16 = paddedTo16(u128.inner)
+	}
+	return msgpackWriteExt(w, TypeU128, b16[:], m)
+}
+
+// UnmarshalMsgpack unmarshals the U128 from a MessagePack ext with the
+// TypeU128 type identifier.
+func (u128 *U128) UnmarshalMsgpack(r io.Reader, m int) (int, error) {
+	b16 := [16]byte{}
+	m, err := msgpackReadExt(r, TypeU128, b16[:], m)
+	if err != nil {
+		return m, err
+	}
+	if u128.inner == nil {
+		u128.inner = new(big.Int)
+	}
+	u128.inner.SetBytes(b16[:])
+	return m, nil
+}
+
+// MarshalMsgpack marshals the U256 to MessagePack as an ext with the TypeU256
+// type identifier. The data is the 32 byte big endian representation.
+func (u256 U256) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	var b32 [32]byte
+	if u256.inner != nil {
+		b32 = paddedTo32(u256.inner)
+	}
+	return msgpackWriteExt(w, TypeU256, b32[:], m)
+}
+
+// UnmarshalMsgpack unmarshals the U256 from a MessagePack ext with the
+// TypeU256 type identifier.
+func (u256 *U256) UnmarshalMsgpack(r io.Reader, m int) (int, error) {
+	b32 := [32]byte{}
+	m, err := msgpackReadExt(r, TypeU256, b32[:], m)
+	if err != nil {
+		return m, err
+	}
+	if u256.inner == nil {
+		u256.inner = new(big.Int)
+	}
+	u256.inner.SetBytes(b32[:])
+	return m, nil
+}
+
+// MarshalMsgpackList marshals a slice of values to MessagePack as an array.
+func MarshalMsgpackList(w io.Writer, vs []MsgpackMarshaler, m int) (int, error) {
+	m, err := msgpackWriteContainerHeader(w, msgpackFixArray, msgpackArray16, len(vs), m)
+	if err != nil {
+		return m, err
+	}
+	for _, v := range vs {
+		if m, err = v.MarshalMsgpack(w, m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// UnmarshalMsgpackList unmarshals a MessagePack array. The array header is
+// read, and then the function f is called once for each element. Every element
+// is at least one byte long, so arrays with more elements than the maximum
+// number of bytes are rejected before f is called.
+func UnmarshalMsgpackList(r io.Reader, m int, f func(r io.Reader, m int) (int, error)) (int, error) {
+	n, m, err := msgpackReadContainerHeader(r, msgpackFixArray, msgpackArray16, m)
+	if err != nil {
+		return m, err
+	}
+	if n >= uint64(m) {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	for i := uint64(0); i < n; i++ {
+		if m, err = f(r, m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// MarshalMsgpack marshals the List to MessagePack as an array of its elements.
+func (list List) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	m, err := msgpackWriteContainerHeader(w, msgpackFixArray, msgpackArray16, len(list.Elems), m)
+	if err != nil {
+		return m, err
+	}
+	for _, elem := range list.Elems {
+		if m, err = msgpackWriteValue(w, elem, m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// MarshalMsgpack marshals the Record to MessagePack as a map from the names of
+// its fields to their values, in the order of the fields.
+func (record Record) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	if len(record.Values) != len(record.Fields) {
+		return m, fmt.Errorf("expected len=%v, got len=%v", len(record.Fields), len(record.Values))
+	}
+	m, err := msgpackWriteContainerHeader(w, msgpackFixMap, msgpackMap16, len(record.Fields), m)
+	if err != nil {
+		return m, err
+	}
+	for i, field := range record.Fields {
+		if m, err = String(field.Name).MarshalMsgpack(w, m); err != nil {
+			return m, err
+		}
+		if m, err = msgpackWriteValue(w, record.Values[i], m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// MarshalMsgpack marshals the Maybe to MessagePack as an array that is empty if
+// the value is absent, and that contains only the value if it is present.
+// Unlike nil, this distinguishes an absent value from a present value that is
+// itself an absent Maybe.
+func (maybe Maybe) MarshalMsgpack(w io.Writer, m int) (int, error) {
+	if maybe.Value == nil {
+		return msgpackWriteContainerHeader(w, msgpackFixArray, msgpackArray16, 0, m)
+	}
+	m, err := msgpackWriteContainerHeader(w, msgpackFixArray, msgpackArray16, 1, m)
+	if err != nil {
+		return m, err
+	}
+	return msgpackWriteValue(w, maybe.Value, m)
+}
+
+// UnmarshalMsgpackValue unmarshals a value described by the TypeDesc from
+// MessagePack. Lists, records and maybes are unmarshaled recursively, in the
+// form written by their MarshalMsgpack methods. The bytes that are read are
+// counted towards the maximum number of bytes, and the value is checked
+// against the DefaultLimits before anything is allocated for it.
+func UnmarshalMsgpackValue(r io.Reader, desc TypeDesc, m int) (Value, int, error) {
+	limits := DefaultLimits()
+	limits.MaxBytes = m
+	return UnmarshalMsgpackValueWithLimits(r, desc, limits)
+}
+
+// UnmarshalMsgpackValueWithLimits is the same as UnmarshalMsgpackValue, but
+// checks the value against the given Limits. The maximum number of bytes is
+// taken from the Limits.
+func UnmarshalMsgpackValueWithLimits(r io.Reader, desc TypeDesc, limits Limits) (Value, int, error) {
+	m := limits.MaxBytes
+	if err := desc.validate(nil); err != nil {
+		return nil, m, err
+	}
+	return msgpackReadValue(r, desc, m, limits, 0)
+}
+
+// msgpackWriteValue writes a value to MessagePack. An error is returned if the
+// value cannot be marshaled to MessagePack.
+func msgpackWriteValue(w io.Writer, v Value, m int) (int, error) {
+	marshaler, ok := v.(MsgpackMarshaler)
+	if !ok {
+		return m, fmt.Errorf("non-exhaustive pattern: %T", v)
+	}
+	return marshaler.MarshalMsgpack(w, m)
+}
+
+// msgpackReadValue reads a value described by a well-formed TypeDesc at the
+// given depth from MessagePack, and checks it against the Limits.
+func msgpackReadValue(r io.Reader, desc TypeDesc, m int, limits Limits, depth int) (Value, int, error) {
+	switch desc.Type {
+	case TypeString:
+		data, m, err := msgpackReadStr(r, m, limits.MaxStringLen)
+		if err != nil {
+			return nil, m, err
+		}
+		return String(data), m, nil
+
+	case TypeBytes:
+		data, m, err := msgpackReadBin(r, m, limits.MaxStringLen)
+		if err != nil {
+			return nil, m, err
+		}
+		return Bytes(data), m, nil
+
+	case TypeList:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		n, m, err := msgpackReadContainerHeader(r, msgpackFixArray, msgpackArray16, m)
+		if err != nil {
+			return nil, m, err
+		}
+		// Every element is at least one byte long, so lists that cannot fit
+		// into the remaining budget are rejected before they are allocated.
+		if n >= uint64(m) {
+			return nil, m, surge.ErrMaxBytesExceeded
+		}
+		if err := limits.checkListLen(int(n)); err != nil {
+			return nil, m, err
+		}
+		elems := make([]Value, n)
+		for i := range elems {
+			if elems[i], m, err = msgpackReadValue(r, *desc.Elem, m, limits, depth+1); err != nil {
+				return nil, m, err
+			}
+		}
+		return List{Elem: *desc.Elem, Elems: elems}, m, nil
+
+	case TypeRecord:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		if err := limits.checkRecordFields(len(desc.Fields)); err != nil {
+			return nil, m, err
+		}
+		n, m, err := msgpackReadContainerHeader(r, msgpackFixMap, msgpackMap16, m)
+		if err != nil {
+			return nil, m, err
+		}
+		if n != uint64(len(desc.Fields)) {
+			return nil, m, fmt.Errorf("expected len=%v, got len=%v", len(desc.Fields), n)
+		}
+		fields := make([]RecordField, len(desc.Fields))
+		values := make([]Value, len(desc.Fields))
+		for i, field := range desc.Fields {
+			fields[i] = RecordField{Name: field.Name, Type: field.Desc.Type}
+			name := String("")
+			if m, err = name.UnmarshalMsgpack(r, m); err != nil {
+				return nil, m, err
+			}
+			if string(name) != field.Name {
+				return nil, m, fmt.Errorf("expected field %v, got field %v", field.Name, name)
+			}
+			if values[i], m, err = msgpackReadValue(r, field.Desc, m, limits, depth+1); err != nil {
+				return nil, m, err
+			}
+		}
+		return Record{Fields: fields, Values: values}, m, nil
+
+	case TypeMaybe:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		n, m, err := msgpackReadContainerHeader(r, msgpackFixArray, msgpackArray16, m)
+		if err != nil {
+			return nil, m, err
+		}
+		switch n {
+		case 0:
+			return Maybe{Elem: *desc.Elem}, m, nil
+		case 1:
+			v, m, err := msgpackReadValue(r, *desc.Elem, m, limits, depth+1)
+			if err != nil {
+				return nil, m, err
+			}
+			return Maybe{Elem: *desc.Elem, Value: v}, m, nil
+		default:
+			return nil, m, fmt.Errorf("non-exhaustive pattern: Maybe(%v)", n)
+		}
+
+	default:
+		ptr, err := newPrimitive(desc.Type)
+		if err != nil {
+			return nil, m, err
+		}
+		if m, err = ptr.(MsgpackUnmarshaler).UnmarshalMsgpack(r, m); err != nil {
+			return nil, m, err
+		}
+		return pointee(ptr), m, nil
+	}
+}
+
+// msgpackWriteContainerHeader writes the header of an array or map with n
+// entries using the smallest format. The fix format and the 16-bit format are
+// given, and the 32-bit format always follows the 16-bit format.
+func msgpackWriteContainerHeader(w io.Writer, fix, format16 byte, n int, m int) (int, error) {
+	switch {
+	case n <= 0x0f:
+		return writeWithin(w, []byte{fix | byte(n)}, m)
+	case n <= 0xffff:
+		bs := [3]byte{format16}
+		binary.BigEndian.PutUint16(bs[1:], uint16(n))
+		return writeWithin(w, bs[:], m)
+	case uint64(n) <= 0xffffffff:
+		bs := [5]byte{format16 + 1}
+		binary.BigEndian.PutUint32(bs[1:], uint32(n))
+		return writeWithin(w, bs[:], m)
+	default:
+		return m, fmt.Errorf("overflow: expected len<=%v, got len=%v", uint32(0xffffffff), n)
+	}
+}
+
+// msgpackWriteInt writes an unsigned integer using the smallest format.
+func msgpackWriteInt(w io.Writer, x uint64, m int) (int, error) {
+	bs := [9]byte{}
+	switch {
+	case x <= 0x7f:
+		bs[0] = byte(x)
+		return writeWithin(w, bs[:1], m)
+	case x <= 0xff:
+		bs[0], bs[1] = msgpackUint8, byte(x)
+		return writeWithin(w, bs[:2], m)
+	case x <= 0xffff:
+		bs[0] = msgpackUint16
+		binary.BigEndian.PutUint16(bs[1:], uint16(x))
+		return writeWithin(w, bs[:3], m)
+	case x <= 0xffffffff:
+		bs[0] = msgpackUint32
+		binary.BigEndian.PutUint32(bs[1:], uint32(x))
+		return writeWithin(w, bs[:5], m)
+	default:
+		bs[0] = msgpackUint64
+		binary.BigEndian.PutUint64(bs[1:], x)
+		return writeWithin(w, bs[:9], m)
+	}
+}
+
+// msgpackWriteStrHeader writes the header of a str using the smallest format.
+func msgpackWriteStrHeader(w io.Writer, size int, m int) (int, error) {
+	bs := [5]byte{}
+	switch {
+	case size <= 0x1f:
+		bs[0] = msgpackFixStr | byte(size)
+		return writeWithin(w, bs[:1], m)
+	case size <= 0xff:
+		bs[0], bs[1] = msgpackStr8, byte(size)
+		return writeWithin(w, bs[:2], m)
+	case size <= 0xffff:
+		bs[0] = msgpackStr16
+		binary.BigEndian.PutUint16(bs[1:], uint16(size))
+		return writeWithin(w, bs[:3], m)
+	case uint64(size) <= 0xffffffff:
+		bs[0] = msgpackStr32
+		binary.BigEndian.PutUint32(bs[1:], uint32(size))
+		return writeWithin(w, bs[:5], m)
+	default:
+		return m, fmt.Errorf("overflow: expected len<=%v, got len=%v", uint32(0xffffffff), size)
+	}
+}
+
+// msgpackWriteBinHeader writes the header of a bin using the smallest format.
+func msgpackWriteBinHeader(w io.Writer, size int, m int) (int, error) {
+	bs := [5]byte{}
+	switch {
+	case size <= 0xff:
+		bs[0], bs[1] = msgpackBin8, byte(size)
+		return writeWithin(w, bs[:2], m)
+	case size <= 0xffff:
+		bs[0] = msgpackBin16
+		binary.BigEndian.PutUint16(bs[1:], uint16(size))
+		return writeWithin(w, bs[:3], m)
+	case uint64(size) <= 0xffffffff:
+		bs[0] = msgpackBin32
+		binary.BigEndian.PutUint32(bs[1:], uint32(size))
+		return writeWithin(w, bs[:5], m)
+	default:
+		return m, fmt.Errorf("overflow: expected len<=%v, got len=%v", uint32(0xffffffff), size)
+	}
+}
+
+// msgpackWriteExt writes an ext whose extension type is the given type
+// identifier. All of the fixed size types that are written as an ext have
+// identifiers that fit into the signed 8-bit extension type.
+func msgpackWriteExt(w io.Writer, ty Type, data []byte, m int) (int, error) {
+	var err error
+	if len(data) == 16 {
+		m, err = writeWithin(w, []byte{msgpackFixExt16, byte(ty)}, m)
+	} else {
+		m, err = writeWithin(w, []byte{msgpackExt8, byte(len(data)), byte(ty)}, m)
+	}
+	if err != nil {
+		return m, err
+	}
+	return writeWithin(w, data, m)
+}
+
+// msgpackReadPrefix reads the first byte of a MessagePack object, and counts
+// it towards the maximum number of bytes.
+func msgpackReadPrefix(r io.Reader, m int) (byte, int, error) {
+	bs := [1]byte{}
+	m, err := readWithin(r, bs[:], m)
+	if err != nil {
+		return 0, m, err
+	}
+	return bs[0], m, nil
+}
+
+// msgpackReadUint reads an n byte big endian unsigned integer, and counts it
+// towards the maximum number of bytes.
+func msgpackReadUint(r io.Reader, n int, m int) (uint64, int, error) {
+	bs := [8]byte{}
+	m, err := readWithin(r, bs[8-n:], m)
+	if err != nil {
+		return 0, m, err
+	}
+	return binary.BigEndian.Uint64(bs[:]), m, nil
+}
+
+// msgpackReadContainerHeader reads the header of an array or map, and returns
+// the number of entries. The fix format and the 16-bit format are given, and
+// the 32-bit format always follows the 16-bit format.
+func msgpackReadContainerHeader(r io.Reader, fix, format16 byte, m int) (uint64, int, error) {
+	prefix, m, err := msgpackReadPrefix(r, m)
+	if err != nil {
+		return 0, m, err
+	}
+	switch {
+	case prefix&0xf0 == fix:
+		return uint64(prefix & 0x0f), m, nil
+	case prefix == format16:
+		return msgpackReadUint(r, 2, m)
+	case prefix == format16+1:
+		return msgpackReadUint(r, 4, m)
+	default:
+		if fix == msgpackFixMap {
+			return 0, m, fmt.Errorf("non-exhaustive pattern: expected msgpack map, got 0x%x", prefix)
+		}
+		return 0, m, fmt.Errorf("non-exhaustive pattern: expected msgpack array, got 0x%x", prefix)
+	}
+}
+
+// msgpackReadStr reads a str that is at most maxLen bytes long. Unmarshaling
+// will not allocate more than the specified maximum number of bytes.
+func msgpackReadStr(r io.Reader, m int, maxLen int) ([]byte, int, error) {
+	prefix, m, err := msgpackReadPrefix(r, m)
+	if err != nil {
+		return nil, m, err
+	}
+	var size uint64
+	switch {
+	case prefix&0xe0 == msgpackFixStr:
+		size = uint64(prefix & 0x1f)
+	case prefix == msgpackStr8:
+		size, m, err = msgpackReadUint(r, 1, m)
+	case prefix == msgpackStr16:
+		size, m, err = msgpackReadUint(r, 2, m)
+	case prefix == msgpackStr32:
+		size, m, err = msgpackReadUint(r, 4, m)
+	default:
+		return nil, m, fmt.Errorf("non-exhaustive pattern: String(0x%x)", prefix)
+	}
+	if err != nil {
+		return nil, m, err
+	}
+	return msgpackReadData(r, size, m, maxLen)
+}
+
+// msgpackReadBin reads a bin that is at most maxLen bytes long. Unmarshaling
+// will not allocate more than the specified maximum number of bytes.
+func msgpackReadBin(r io.Reader, m int, maxLen int) ([]byte, int, error) {
+	prefix, m, err := msgpackReadPrefix(r, m)
+	if err != nil {
+		return nil, m, err
+	}
+	var size uint64
+	switch prefix {
+	case msgpackBin8:
+		size, m, err = msgpackReadUint(r, 1, m)
+	case msgpackBin16:
+		size, m, err = msgpackReadUint(r, 2, m)
+	case msgpackBin32:
+		size, m, err = msgpackReadUint(r, 4, m)
+	default:
+		return nil, m, fmt.Errorf("non-exhaustive pattern: Bytes(0x%x)", prefix)
+	}
+	if err != nil {
+		return nil, m, err
+	}
+	return msgpackReadData(r, size, m, maxLen)
+}
+
+// msgpackReadData reads the payload of a str or bin that is at most maxLen
+// bytes long. Unmarshaling will not allocate more than the specified maximum
+// number of bytes.
+func msgpackReadData(r io.Reader, size uint64, m int, maxLen int) ([]byte, int, error) {
+	if size >= uint64(m) {
+		return nil, m, surge.ErrMaxBytesExceeded
+	}
+	if err := checkLimit("string len", maxLen, int(size)); err != nil {
+		return nil, m, err
+	}
+	data := make([]byte, size)
+	m, err := readWithin(r, data, m)
+	if err != nil {
+		return nil, m, err
+	}
+	return data, m, nil
+}
+
+// msgpackReadInt reads an integer that is no greater than max. Any of the
+// unsigned integer formats are accepted, as well as signed integer formats
+// that hold non-negative values.
+func msgpackReadInt(r io.Reader, max uint64, m int) (uint64, int, error) {
+	prefix, m, err := msgpackReadPrefix(r, m)
+	if err != nil {
+		return 0, m, err
+	}
+	var x uint64
+	switch {
+	case prefix <= 0x7f:
+		x = uint64(prefix)
+	case prefix >= msgpackUint8 && prefix <= msgpackUint64:
+		x, m, err = msgpackReadUint(r, 1<<(prefix-msgpackUint8), m)
+	case prefix >= 0xd0 && prefix <= 0xd3:
+		x, m, err = msgpackReadUint(r, 1<<(prefix-0xd0), m)
+		if err == nil && x>>(8<<(prefix-0xd0)-1) != 0 {
+			return 0, m, fmt.Errorf("underflow: msgpack integer is negative")
+		}
+	default:
+		return 0, m, fmt.Errorf("non-exhaustive pattern: expected msgpack integer, got 0x%x", prefix)
+	}
+	if err != nil {
+		return 0, m, err
+	}
+	if x > max {
+		return 0, m, fmt.Errorf("overflow: expected x<=%v, got x=%v", max, x)
+	}
+	return x, m, nil
+}
+
+// msgpackReadExt reads an ext with the given type identifier into data. The
+// ext must hold exactly len(data) bytes. The header, the extension type and
+// the payload are all counted towards the maximum number of bytes.
+func msgpackReadExt(r io.Reader, ty Type, data []byte, m int) (int, error) {
+	prefix, m, err := msgpackReadPrefix(r, m)
+	if err != nil {
+		return m, err
+	}
+	var size uint64
+	switch {
+	case prefix >= 0xd4 && prefix <= msgpackFixExt16:
+		size = 1 << (prefix - 0xd4)
+	case prefix >= msgpackExt8 && prefix <= msgpackExt32:
+		size, m, err = msgpackReadUint(r, 1<<(prefix-msgpackExt8), m)
+	default:
+		return m, fmt.Errorf("non-exhaustive pattern: expected msgpack ext, got 0x%x", prefix)
+	}
+	if err != nil {
+		return m, err
+	}
+	extType, m, err := msgpackReadPrefix(r, m)
+	if err != nil {
+		return m, err
+	}
+	if Type(extType) != ty {
+		return m, fmt.Errorf("non-exhaustive pattern: expected ext type %v, got ext type %v", ty, extType)
+	}
+	if size != uint64(len(data)) {
+		return m, fmt.Errorf("expected len=%v, got len=%v", len(data), size)
+	}
+	return readWithin(r, data, m)
+}
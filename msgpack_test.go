@@ -0,0 +1,271 @@
+package abi_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MessagePack", func() {
+	Context("when marshaling known values", func() {
+		It("should use the smallest format", func() {
+			cases := []struct {
+				v        abi.MsgpackMarshaler
+				expected []byte
+			}{
+				{abi.NewU8(0x7f), []byte{0x7f}},
+				{abi.NewU8(0x80), []byte{0xcc, 0x80}},
+				{abi.NewU64(0x100), []byte{0xcd, 0x01, 0x00}},
+				{abi.NewBool(false), []byte{0xc2}},
+				{abi.NewBool(true), []byte{0xc3}},
+				{abi.String("abc"), []byte{0xa3, 'a', 'b', 'c'}},
+				{abi.Bytes{1, 2}, []byte{0xc4, 0x02, 1, 2}},
+			}
+			for _, c := range cases {
+				buf := new(bytes.Buffer)
+				_, err := c.v.MarshalMsgpack(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Bytes()).To(Equal(c.expected))
+			}
+		})
+
+		It("should tag large integers and byte arrays with their type", func() {
+			buf := new(bytes.Buffer)
+			_, err := abi.NewU128FromU8(abi.NewU8(1)).MarshalMsgpack(buf, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Bytes()[:2]).To(Equal([]byte{0xd8, byte(abi.TypeU128)}))
+			Expect(buf.Len()).To(Equal(18))
+
+			buf.Reset()
+			_, err = abi.Bytes65{}.MarshalMsgpack(buf, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Bytes()[:3]).To(Equal([]byte{0xc7, 65, byte(abi.TypeBytes65)}))
+			Expect(buf.Len()).To(Equal(68))
+		})
+	})
+
+	Context("when marshaling and unmarshaling", func() {
+		It("should equal itself", func() {
+			f := func(x uint32, y [16]byte, z [32]byte, s string, bs []byte) bool {
+				u32 := abi.NewU32(x)
+				u128 := abi.NewU128(y)
+				u256 := abi.NewU256(z)
+				b32 := abi.Bytes32(z)
+				str := abi.String(s)
+				b := abi.Bytes(bs)
+
+				buf := new(bytes.Buffer)
+				for _, v := range []abi.MsgpackMarshaler{u32, u128, u256, b32, str, b} {
+					_, err := v.MarshalMsgpack(buf, abi.MaxBytes)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				u32Out := abi.U32{}
+				u128Out := abi.U128{}
+				u256Out := abi.U256{}
+				b32Out := abi.Bytes32{}
+				strOut := abi.String("")
+				bOut := abi.Bytes{}
+				for _, v := range []abi.MsgpackUnmarshaler{&u32Out, &u128Out, &u256Out, &b32Out, &strOut, &bOut} {
+					_, err := v.UnmarshalMsgpack(buf, abi.MaxBytes)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				Expect(u32Out).To(Equal(u32))
+				Expect(u128Out.Equal(u128)).To(BeTrue())
+				Expect(u256Out.Equal(u256)).To(BeTrue())
+				Expect(b32Out).To(Equal(b32))
+				Expect(strOut).To(Equal(str))
+				Expect(bytes.Equal(bOut, b)).To(BeTrue())
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should equal itself when in a list", func() {
+			f := func(xs []uint64) bool {
+				vs := make([]abi.MsgpackMarshaler, len(xs))
+				for i := range xs {
+					vs[i] = abi.NewU64(xs[i])
+				}
+				buf := new(bytes.Buffer)
+				_, err := abi.MarshalMsgpackList(buf, vs, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+
+				ys := []abi.U64{}
+				_, err = abi.UnmarshalMsgpackList(buf, abi.MaxBytes, func(r io.Reader, m int) (int, error) {
+					y := abi.U64{}
+					m, err := y.UnmarshalMsgpack(r, m)
+					ys = append(ys, y)
+					return m, err
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ys).To(HaveLen(len(xs)))
+				for i := range xs {
+					Expect(ys[i].Uint64()).To(Equal(xs[i]))
+				}
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when unmarshaling invalid encodings", func() {
+		It("should return an error", func() {
+			u8 := abi.U8{}
+			_, err := u8.UnmarshalMsgpack(bytes.NewReader([]byte{0xcd, 0x01, 0x00}), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+
+			_, err = u8.UnmarshalMsgpack(bytes.NewReader([]byte{0xd0, 0xff}), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+
+			u128 := abi.U128{}
+			data := append([]byte{0xd8, byte(abi.TypeBytes32)}, make([]byte, 16)...)
+			_, err = u128.UnmarshalMsgpack(bytes.NewReader(data), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+
+			b32 := abi.Bytes32{}
+			data = append([]byte{0xc7, 31, byte(abi.TypeBytes32)}, make([]byte, 31)...)
+			_, err = b32.UnmarshalMsgpack(bytes.NewReader(data), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should accept non-negative signed integers", func() {
+			u16 := abi.U16{}
+			_, err := u16.UnmarshalMsgpack(bytes.NewReader([]byte{0xd1, 0x01, 0x00}), abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(u16.Uint16()).To(Equal(uint16(0x100)))
+		})
+	})
+
+	Context("when marshaling invalid strings", func() {
+		It("should return an error for invalid utf-8", func() {
+			_, err := abi.String("\xff").MarshalMsgpack(new(bytes.Buffer), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when marshaling composite values", func() {
+		It("should match the expected encoding", func() {
+			cases := []struct {
+				text     string
+				expected []byte
+			}{
+				{`list<u8>[u8(1), u8(2)]`, []byte{0x92, 0x01, 0x02}},
+				{`list<u8>[]`, []byte{0x90}},
+				{`record{b: u8(1), aa: u8(2)}`, []byte{0x82, 0xa1, 'b', 0x01, 0xa2, 'a', 'a', 0x02}},
+				{`maybe<u8>(none)`, []byte{0x90}},
+				{`maybe<u8>(u8(1))`, []byte{0x91, 0x01}},
+				{`maybe<maybe<u8>>(maybe<u8>(none))`, []byte{0x91, 0x90}},
+			}
+			for _, c := range cases {
+				v := abi.MustParseText(c.text)
+				buf := new(bytes.Buffer)
+				_, err := v.(abi.MsgpackMarshaler).MarshalMsgpack(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Bytes()).To(Equal(c.expected), c.text)
+
+				w, _, err := abi.UnmarshalMsgpackValue(bytes.NewReader(c.expected), abi.DescOf(v), abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(abi.Equal(v, w)).To(BeTrue(), c.text)
+			}
+		})
+
+		It("should equal itself", func() {
+			f := func(desc abi.TypeDesc, seed int64) bool {
+				v := abi.RandomValue(rand.New(rand.NewSource(seed)), desc)
+				buf := new(bytes.Buffer)
+				_, err := v.(abi.MsgpackMarshaler).MarshalMsgpack(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+
+				w, _, err := abi.UnmarshalMsgpackValue(buf, desc, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(abi.Equal(v, w)).To(BeTrue())
+				Expect(buf.Len()).To(Equal(0))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should return an error for records that do not match", func() {
+			desc, err := abi.ParseTypeDesc("record{b:u8,aa:u8}")
+			Expect(err).ToNot(HaveOccurred())
+			cases := [][]byte{
+				{0x82, 0xa2, 'a', 'a', 0x02, 0xa1, 'b', 0x01}, // Fields out of order
+				{0x82, 0xa1, 'c', 0x01, 0xa2, 'a', 'a', 0x02}, // Unknown field
+				{0x81, 0xa1, 'b', 0x01},                       // Missing field
+				{0x92, 0x01, 0x02},                            // Array instead of map
+			}
+			for _, c := range cases {
+				_, _, err := abi.UnmarshalMsgpackValue(bytes.NewReader(c), desc, abi.MaxBytes)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+
+		It("should return an error for maybes with more than one value", func() {
+			_, _, err := abi.UnmarshalMsgpackValue(bytes.NewReader([]byte{0x92, 0x01, 0x02}), abi.NewMaybeDesc(abi.NewTypeDesc(abi.TypeU8)), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should check lists against the limits", func() {
+			data := []byte{0xdd, 0x00, 0x01, 0x00, 0x01}
+			_, _, err := abi.UnmarshalMsgpackValue(bytes.NewReader(data), abi.NewListDesc(abi.NewTypeDesc(abi.TypeU8)), 1<<20)
+			Expect(err).To(BeAssignableToTypeOf(abi.LimitError{}))
+
+			_, _, err = abi.UnmarshalMsgpackValue(bytes.NewReader(data), abi.NewListDesc(abi.NewTypeDesc(abi.TypeU8)), 1024)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+	})
+
+	Context("when marshaling and unmarshaling with a limited budget", func() {
+		It("should count every byte towards the budget", func() {
+			for _, v := range []abi.Value{
+				abi.NewBool(true),
+				abi.NewU8(1),
+				abi.NewU16(1000),
+				abi.String("abc"),
+				abi.Bytes32{1},
+				abi.NewU128([16]byte{1}),
+				abi.MustParseText(`record{a: bool(true), b: list<u8>[u8(1), u8(200)], c: maybe<str>(str("x"))}`),
+			} {
+				buf := new(bytes.Buffer)
+				_, err := v.(abi.MsgpackMarshaler).MarshalMsgpack(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				n := buf.Len()
+
+				m, err := v.(abi.MsgpackMarshaler).MarshalMsgpack(new(bytes.Buffer), n+1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m).To(Equal(1))
+				_, err = v.(abi.MsgpackMarshaler).MarshalMsgpack(new(bytes.Buffer), n)
+				Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+				_, m, err = abi.UnmarshalMsgpackValue(bytes.NewReader(buf.Bytes()), abi.DescOf(v), n+1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m).To(Equal(1))
+				_, _, err = abi.UnmarshalMsgpackValue(bytes.NewReader(buf.Bytes()), abi.DescOf(v), n)
+				Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			}
+		})
+	})
+
+	Context("when unmarshaling bytes that are too long", func() {
+		It("should not allocate and should return an error", func() {
+			data := []byte{0xc6, 0x7f, 0xff, 0xff, 0xff}
+			b := abi.Bytes{}
+			_, err := b.UnmarshalMsgpack(bytes.NewReader(data), 1024)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			Expect(b).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,304 @@
+package abi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// ToNative converts a value into a native Go value:
+//
+//	String                  string
+//	Bytes, Bytes32, Bytes65 []byte
+//	Bool                    bool
+//	U8, U16, U32, U64       uint8, uint16, uint32, uint64
+//	U128, U256              *big.Int
+//	List                    []interface{}
+//	Record                  map[string]interface{}
+//	Maybe                   nil, or the native value of its value
+//
+// Native values never share memory with the value. A maybe whose value is an
+// absent maybe is also converted into nil, so nested maybes cannot always be
+// told apart by their native values. It panics if the value is not a bytes,
+// scalar, list, record or maybe value.
+func ToNative(v Value) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case String:
+		return string(v)
+	case Bytes:
+		return append([]byte{}, v...)
+	case Bytes32:
+		return append([]byte{}, v[:]...)
+	case Bytes65:
+		return append([]byte{}, v[:]...)
+	case Signature:
+		return append([]byte{}, v.Bytes65[:]...)
+	case Bool:
+		return v.inner
+	case U8:
+		return v.inner
+	case U16:
+		return v.inner
+	case U32:
+		return v.inner
+	case U64:
+		return v.inner
+	case U128:
+		if v.inner == nil {
+			return new(big.Int)
+		}
+		return v.Int()
+	case U256:
+		if v.inner == nil {
+			return new(big.Int)
+		}
+		return v.Int()
+	case List:
+		elems := make([]interface{}, len(v.Elems))
+		for i, elem := range v.Elems {
+			elems[i] = ToNative(elem)
+		}
+		return elems
+	case Record:
+		fields := make(map[string]interface{}, len(v.Fields))
+		for i, field := range v.Fields {
+			if i < len(v.Values) {
+				fields[field.Name] = ToNative(v.Values[i])
+			}
+		}
+		return fields
+	case Maybe:
+		return ToNative(v.Value)
+	default:
+		panic(fmt.Sprintf("non-exhaustive pattern: %T", v))
+	}
+}
+
+// FromNative converts a native Go value into a value described by the
+// TypeDesc. It accepts the native values returned by ToNative, and also:
+//
+//   - any string or bool kind for String and Bool,
+//   - any []byte or [N]byte kind for Bytes, Bytes32 and Bytes65 (Bytes32 and
+//     Bytes65 must have exactly 32 and 65 bytes),
+//   - any integer kind, integral float64s, json.Numbers, and *big.Ints for U8
+//     to U256,
+//   - any slice or array kind for lists,
+//   - any map kind with string keys for records (every field must be present,
+//     and there must be no other keys), and
+//   - nil for a maybe whose value is absent, and any other native value for a
+//     maybe whose value is present.
+//
+// Converting the native value of a value back with its TypeDesc returns an
+// equal value, except for maybes whose value is an absent maybe, which are
+// converted into absent maybes.
+//
+// Integers are range checked, and an underflow or overflow error is returned
+// if they cannot be represented by the Type. Errors name the Path of the value
+// that failed to convert. An error is also returned if the TypeDesc is
+// malformed.
+func FromNative(x interface{}, desc TypeDesc) (Value, error) {
+	if err := desc.validate(nil); err != nil {
+		return nil, err
+	}
+	return fromNative(nil, x, desc)
+}
+
+// fromNative converts a native Go value at the given Path, into a value
+// described by a well-formed TypeDesc.
+func fromNative(path Path, x interface{}, desc TypeDesc) (Value, error) {
+	rv := reflect.ValueOf(x)
+	switch desc.Type {
+	case TypeString:
+		if rv.Kind() != reflect.String {
+			return nil, expectedNative(path, desc, x)
+		}
+		return String(rv.String()), nil
+
+	case TypeBytes:
+		data, ok := nativeBytes(rv)
+		if !ok {
+			return nil, expectedNative(path, desc, x)
+		}
+		return Bytes(data), nil
+
+	case TypeBytes32:
+		data, ok := nativeBytes(rv)
+		if !ok {
+			return nil, expectedNative(path, desc, x)
+		}
+		if len(data) != 32 {
+			return nil, fmt.Errorf("expected %v to have len=32, got len=%v", path, len(data))
+		}
+		b32 := Bytes32{}
+		copy(b32[:], data)
+		return b32, nil
+
+	case TypeBytes65:
+		data, ok := nativeBytes(rv)
+		if !ok {
+			return nil, expectedNative(path, desc, x)
+		}
+		if len(data) != 65 {
+			return nil, fmt.Errorf("expected %v to have len=65, got len=%v", path, len(data))
+		}
+		b65 := Bytes65{}
+		copy(b65[:], data)
+		return b65, nil
+
+	case TypeBool:
+		if rv.Kind() != reflect.Bool {
+			return nil, expectedNative(path, desc, x)
+		}
+		return NewBool(rv.Bool()), nil
+
+	case TypeU8, TypeU16, TypeU32, TypeU64, TypeU128, TypeU256:
+		i, ok := nativeInt(x)
+		if !ok {
+			return nil, expectedNative(path, desc, x)
+		}
+		return newScalarFromInt(path, desc.Type, i)
+
+	case TypeList:
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil, expectedNative(path, desc, x)
+		}
+		elems := make([]Value, rv.Len())
+		for i := range elems {
+			elem, err := fromNative(path.append(IndexSegment(i)), rv.Index(i).Interface(), *desc.Elem)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return List{Elem: *desc.Elem, Elems: elems}, nil
+
+	case TypeRecord:
+		if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+			return nil, expectedNative(path, desc, x)
+		}
+		if rv.Len() != len(desc.Fields) {
+			return nil, fmt.Errorf("expected %v to have len=%v, got len=%v", path, len(desc.Fields), rv.Len())
+		}
+		fields := make([]RecordField, len(desc.Fields))
+		values := make([]Value, len(desc.Fields))
+		for i, field := range desc.Fields {
+			fieldPath := path.append(FieldSegment(field.Name))
+			fieldValue := rv.MapIndex(reflect.ValueOf(field.Name).Convert(rv.Type().Key()))
+			if !fieldValue.IsValid() {
+				return nil, fmt.Errorf("non-exhaustive pattern: %v is missing", fieldPath)
+			}
+			value, err := fromNative(fieldPath, fieldValue.Interface(), field.Desc)
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = RecordField{Name: field.Name, Type: field.Desc.Type}
+			values[i] = value
+		}
+		return NewRecord(fields, values...)
+
+	case TypeMaybe:
+		if x == nil {
+			return Maybe{Elem: *desc.Elem}, nil
+		}
+		value, err := fromNative(path, x, *desc.Elem)
+		if err != nil {
+			return nil, err
+		}
+		return Maybe{Elem: *desc.Elem, Value: value}, nil
+
+	default:
+		return nil, fmt.Errorf("non-exhaustive pattern: %v has type %v", path, desc.Type)
+	}
+}
+
+// expectedNative returns an error for a native Go value that cannot be
+// converted into a value described by the TypeDesc.
+func expectedNative(path Path, desc TypeDesc, x interface{}) error {
+	return fmt.Errorf("expected %v to have type %v, got %T", path, desc, x)
+}
+
+// nativeBytes returns a copy of a native byte slice or array. Returns false if
+// the value is not a byte slice or array.
+func nativeBytes(rv reflect.Value) ([]byte, bool) {
+	if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Type().Elem().Kind() != reflect.Uint8 {
+		return nil, false
+	}
+	data := make([]byte, rv.Len())
+	reflect.Copy(reflect.ValueOf(data), rv)
+	return data, true
+}
+
+// nativeInt converts a native integer into a big integer. Returns false if the
+// value is not an integer.
+func nativeInt(x interface{}) (*big.Int, bool) {
+	switch x := x.(type) {
+	case *big.Int:
+		if x == nil {
+			return nil, false
+		}
+		return new(big.Int).Set(x), true
+	case json.Number:
+		return new(big.Int).SetString(string(x), 10)
+	}
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Int).SetUint64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) || f != math.Trunc(f) {
+			return nil, false
+		}
+		i, _ := big.NewFloat(f).Int(nil)
+		return i, true
+	default:
+		return nil, false
+	}
+}
+
+// newScalarFromInt returns a scalar value of the given Type. An error is
+// returned if the integer is negative, or does not fit into the Type.
+func newScalarFromInt(path Path, ty Type, i *big.Int) (Value, error) {
+	if i.Sign() < 0 {
+		return nil, fmt.Errorf("underflow: expected %v>=0, got %v", path, i)
+	}
+	bits := 0
+	switch ty {
+	case TypeU8:
+		bits = 8
+	case TypeU16:
+		bits = 16
+	case TypeU32:
+		bits = 32
+	case TypeU64:
+		bits = 64
+	case TypeU128:
+		bits = 128
+	case TypeU256:
+		bits = 256
+	}
+	if i.BitLen() > bits {
+		max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bits)), big.NewInt(1))
+		return nil, fmt.Errorf("overflow: expected %v<=%v, got %v", path, max, i)
+	}
+	switch ty {
+	case TypeU8:
+		return NewU8(uint8(i.Uint64())), nil
+	case TypeU16:
+		return NewU16(uint16(i.Uint64())), nil
+	case TypeU32:
+		return NewU32(uint32(i.Uint64())), nil
+	case TypeU64:
+		return NewU64(i.Uint64()), nil
+	case TypeU128:
+		return U128{inner: i}, nil
+	default:
+		return U256{inner: i}, nil
+	}
+}
@@ -0,0 +1,226 @@
+package abi_test
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"math/rand"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Native values", func() {
+	primitives := []abi.Type{
+		abi.TypeString, abi.TypeBytes, abi.TypeBytes32, abi.TypeBytes65,
+		abi.TypeBool, abi.TypeU8, abi.TypeU16, abi.TypeU32, abi.TypeU64, abi.TypeU128, abi.TypeU256,
+	}
+
+	Context("when converting bytes and scalar values", func() {
+		It("should return the same value", func() {
+			f := func(seed int64) bool {
+				r := rand.New(rand.NewSource(seed))
+				for _, ty := range primitives {
+					v := abi.RandomValue(r, abi.NewTypeDesc(ty))
+					w, err := abi.FromNative(abi.ToNative(v), abi.NewTypeDesc(ty))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(abi.Equal(v, w)).To(BeTrue())
+				}
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should return natural Go values", func() {
+			Expect(abi.ToNative(abi.String("str"))).To(Equal("str"))
+			Expect(abi.ToNative(abi.Bytes32{1})).To(Equal(append([]byte{1}, make([]byte, 31)...)))
+			Expect(abi.ToNative(abi.NewBool(true))).To(Equal(true))
+			Expect(abi.ToNative(abi.NewU8(1))).To(Equal(uint8(1)))
+			Expect(abi.ToNative(abi.NewU64(1))).To(Equal(uint64(1)))
+			Expect(abi.ToNative(abi.NewU256FromInt(big.NewInt(1)))).To(Equal(big.NewInt(1)))
+		})
+
+		It("should not share memory", func() {
+			b := abi.Bytes{1, 2, 3}
+			native := abi.ToNative(b).([]byte)
+			native[0] = 0
+			Expect(b).To(Equal(abi.Bytes{1, 2, 3}))
+
+			u256 := abi.NewU256FromInt(big.NewInt(1))
+			abi.ToNative(u256).(*big.Int).SetInt64(2)
+			Expect(u256.Int()).To(Equal(big.NewInt(1)))
+
+			data := [32]byte{1}
+			b32, err := abi.FromNative(data[:], abi.NewTypeDesc(abi.TypeBytes32))
+			Expect(err).ToNot(HaveOccurred())
+			data[0] = 0
+			Expect(b32).To(Equal(abi.Bytes32{1}))
+		})
+	})
+
+	Context("when converting integers", func() {
+		It("should accept every integer kind", func() {
+			for _, x := range []interface{}{
+				int(42), int8(42), int16(42), int32(42), int64(42),
+				uint(42), uint8(42), uint16(42), uint32(42), uint64(42),
+				float64(42), json.Number("42"), big.NewInt(42),
+			} {
+				v, err := abi.FromNative(x, abi.NewTypeDesc(abi.TypeU8))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(v).To(Equal(abi.NewU8(42)))
+			}
+		})
+
+		It("should reject values that are not integers", func() {
+			for _, x := range []interface{}{"42", 4.2, math.NaN(), math.Inf(1), json.Number("4.2"), (*big.Int)(nil), nil, true} {
+				_, err := abi.FromNative(x, abi.NewTypeDesc(abi.TypeU64))
+				Expect(err).To(HaveOccurred())
+			}
+		})
+
+		It("should check ranges instead of panicking", func() {
+			for ty, max := range map[abi.Type]*big.Int{
+				abi.TypeU8:   big.NewInt(math.MaxUint8),
+				abi.TypeU16:  big.NewInt(math.MaxUint16),
+				abi.TypeU32:  big.NewInt(math.MaxUint32),
+				abi.TypeU64:  new(big.Int).SetUint64(math.MaxUint64),
+				abi.TypeU128: abi.MaxU128.Int(),
+				abi.TypeU256: abi.MaxU256.Int(),
+			} {
+				v, err := abi.FromNative(max, abi.NewTypeDesc(ty))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(v.Type()).To(Equal(ty))
+				Expect(nativeInt(abi.ToNative(v))).To(Equal(max))
+
+				_, err = abi.FromNative(new(big.Int).Add(max, big.NewInt(1)), abi.NewTypeDesc(ty))
+				Expect(err).To(MatchError(HavePrefix("overflow")))
+				_, err = abi.FromNative(-1, abi.NewTypeDesc(ty))
+				Expect(err).To(MatchError(HavePrefix("underflow")))
+			}
+		})
+	})
+
+	Context("when converting lists and records", func() {
+		desc := abi.NewRecordDesc(
+			abi.FieldDesc{Name: "memo", Desc: abi.NewTypeDesc(abi.TypeString)},
+			abi.FieldDesc{Name: "outputs", Desc: abi.NewListDesc(abi.NewRecordDesc(
+				abi.FieldDesc{Name: "to", Desc: abi.NewTypeDesc(abi.TypeBytes32)},
+				abi.FieldDesc{Name: "amount", Desc: abi.NewTypeDesc(abi.TypeU256)},
+			))},
+		)
+		native := func() map[string]interface{} {
+			return map[string]interface{}{
+				"memo": "memo",
+				"outputs": []interface{}{
+					map[string]interface{}{"to": make([]byte, 32), "amount": 10},
+					map[string]interface{}{"to": [32]byte{1}, "amount": big.NewInt(20)},
+				},
+			}
+		}
+
+		It("should return the same value", func() {
+			v, err := abi.FromNative(native(), desc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.DescOf(v)).To(Equal(desc))
+			Expect(desc.String()).To(Equal("record{memo:str,outputs:list<record{to:b32,amount:u256}>}"))
+
+			amount, err := abi.Query(v, ".outputs[1].amount")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(amount[0].Value).To(Equal(abi.NewU256FromInt(big.NewInt(20))))
+
+			w, err := abi.FromNative(abi.ToNative(v), desc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.Equal(v, w)).To(BeTrue())
+		})
+
+		It("should accept typed slices and maps", func() {
+			v, err := abi.FromNative([]uint16{1, 2}, abi.NewListDesc(abi.NewTypeDesc(abi.TypeU16)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.ToNative(v)).To(Equal([]interface{}{uint16(1), uint16(2)}))
+
+			v, err = abi.FromNative(map[string]bool{"ok": true}, abi.NewRecordDesc(abi.FieldDesc{Name: "ok", Desc: abi.NewTypeDesc(abi.TypeBool)}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.ToNative(v)).To(Equal(map[string]interface{}{"ok": true}))
+		})
+
+		It("should convert maybes", func() {
+			desc := abi.NewRecordDesc(abi.FieldDesc{Name: "memo", Desc: abi.NewMaybeDesc(abi.NewTypeDesc(abi.TypeString))})
+			v, err := abi.FromNative(map[string]interface{}{"memo": nil}, desc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.DescOf(v)).To(Equal(desc))
+			memo, _ := v.(abi.Record).Get("memo")
+			Expect(memo.(abi.Maybe).IsSome()).To(BeFalse())
+			Expect(abi.ToNative(v)).To(Equal(map[string]interface{}{"memo": nil}))
+
+			v, err = abi.FromNative(map[string]interface{}{"memo": "memo"}, desc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.ToNative(v)).To(Equal(map[string]interface{}{"memo": "memo"}))
+		})
+
+		It("should not tell nested absent maybes apart", func() {
+			u32 := abi.NewTypeDesc(abi.TypeU32)
+			desc := abi.NewMaybeDesc(abi.NewMaybeDesc(u32))
+			none := abi.NewNone(abi.NewMaybeDesc(u32))
+			some := abi.NewSome(abi.NewNone(u32))
+			Expect(abi.ToNative(some)).To(BeNil())
+			Expect(abi.ToNative(none)).To(BeNil())
+
+			v, err := abi.FromNative(abi.ToNative(some), desc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.Equal(v, none)).To(BeTrue())
+			Expect(abi.Equal(v, some)).To(BeFalse())
+		})
+
+		It("should return errors that name the path", func() {
+			x := native()
+			x["outputs"].([]interface{})[1].(map[string]interface{})["amount"] = -1
+			_, err := abi.FromNative(x, desc)
+			Expect(err).To(MatchError("underflow: expected .outputs[1].amount>=0, got -1"))
+
+			x = native()
+			x["outputs"].([]interface{})[0].(map[string]interface{})["to"] = make([]byte, 31)
+			_, err = abi.FromNative(x, desc)
+			Expect(err).To(MatchError(ContainSubstring(".outputs[0].to")))
+
+			x = native()
+			delete(x["outputs"].([]interface{})[0].(map[string]interface{}), "to")
+			_, err = abi.FromNative(x, desc)
+			Expect(err).To(MatchError(ContainSubstring(".outputs[0]")))
+
+			x = native()
+			x["extra"] = 1
+			delete(x, "memo")
+			_, err = abi.FromNative(x, desc)
+			Expect(err).To(MatchError(ContainSubstring(".memo")))
+
+			_, err = abi.FromNative("memo", desc)
+			Expect(err).To(MatchError(ContainSubstring("record{")))
+
+			_, err = abi.FromNative([]interface{}{}, abi.TypeDesc{Type: abi.TypeList})
+			Expect(err).To(HaveOccurred())
+			_, err = abi.FromNative(nil, abi.NewTypeDesc(abi.TypeMaybe))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+// nativeInt converts an unsigned native integer into a big integer.
+func nativeInt(x interface{}) *big.Int {
+	switch x := x.(type) {
+	case uint8:
+		return new(big.Int).SetUint64(uint64(x))
+	case uint16:
+		return new(big.Int).SetUint64(uint64(x))
+	case uint32:
+		return new(big.Int).SetUint64(uint64(x))
+	case uint64:
+		return new(big.Int).SetUint64(x)
+	case *big.Int:
+		return x
+	default:
+		panic("non-exhaustive pattern")
+	}
+}
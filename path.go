@@ -0,0 +1,66 @@
+package abi
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A PathSegment identifies a child of a list or record: either the element at
+// an index of a list, or the field with a name of a record.
+type PathSegment struct {
+	// Field is the name of a record field. It is only used when Index is
+	// negative.
+	Field string
+	// Index is the index of a list element, or -1 for a record field.
+	Index int
+}
+
+// FieldSegment returns a PathSegment for the field of a record with the given
+// name.
+func FieldSegment(name string) PathSegment {
+	return PathSegment{Field: name, Index: -1}
+}
+
+// IndexSegment returns a PathSegment for the element of a list at the given
+// index.
+func IndexSegment(i int) PathSegment {
+	return PathSegment{Index: i}
+}
+
+// IsIndex returns true if the PathSegment is a list index, and false if it is
+// a record field.
+func (seg PathSegment) IsIndex() bool {
+	return seg.Index >= 0
+}
+
+// String returns the PathSegment as ".field" or "[index]".
+func (seg PathSegment) String() string {
+	if seg.IsIndex() {
+		return "[" + strconv.Itoa(seg.Index) + "]"
+	}
+	return "." + seg.Field
+}
+
+// A Path identifies a value nested inside of another value, as a sequence of
+// PathSegments from the outermost value. The empty Path identifies the
+// outermost value itself.
+type Path []PathSegment
+
+// String returns the Path in the form ".outputs[2].amount". The empty Path is
+// returned as ".".
+func (path Path) String() string {
+	if len(path) == 0 {
+		return "."
+	}
+	b := new(strings.Builder)
+	for _, seg := range path {
+		b.WriteString(seg.String())
+	}
+	return b.String()
+}
+
+// append returns a new Path with the segment appended. The Path is never
+// modified, so Paths that are kept by callers are never changed.
+func (path Path) append(seg PathSegment) Path {
+	return append(path[:len(path):len(path)], seg)
+}
@@ -0,0 +1,863 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/renproject/surge"
+)
+
+// A ProtoWireType identifies how a protobuf field is encoded on the wire.
+type ProtoWireType uint8
+
+// Protobuf wire types. The ABI types only use two of them: integers and bools
+// are encoded as varints, and everything else, including nested messages, is
+// length-delimited. Fields with the fixed wire types can still be skipped when
+// they are unknown.
+const (
+	ProtoWireVarint  = ProtoWireType(0)
+	ProtoWireFixed64 = ProtoWireType(1)
+	ProtoWireBytes   = ProtoWireType(2)
+	ProtoWireFixed32 = ProtoWireType(5)
+)
+
+// ProtoWireTypeOf returns the protobuf wire type used to encode values of the
+// given Type. Returns false if the Type cannot be encoded as a protobuf field.
+func ProtoWireTypeOf(ty Type) (ProtoWireType, bool) {
+	switch ty {
+	case TypeBool, TypeU8, TypeU16, TypeU32, TypeU64:
+		return ProtoWireVarint, true
+	case TypeString, TypeBytes, TypeBytes32, TypeBytes65, TypeU128, TypeU256:
+		return ProtoWireBytes, true
+	default:
+		return 0, false
+	}
+}
+
+// ProtoTypeOf returns the protobuf scalar type used to represent values of the
+// given Type. U128 and U256 values are represented as bytes holding their
+// fixed-width big endian representation. Returns false if the Type cannot be
+// represented as a protobuf scalar type.
+func ProtoTypeOf(ty Type) (string, bool) {
+	switch ty {
+	case TypeString:
+		return "string", true
+	case TypeBytes, TypeBytes32, TypeBytes65, TypeU128, TypeU256:
+		return "bytes", true
+	case TypeBool:
+		return "bool", true
+	case TypeU8, TypeU16, TypeU32:
+		return "uint32", true
+	case TypeU64:
+		return "uint64", true
+	default:
+		return "", false
+	}
+}
+
+// A ProtoField describes one field of a protobuf message. Repeated fields
+// correspond to lists of the Type, and optional fields correspond to maybes of
+// the Type. Fields of TypeRecord are nested messages, described by Message.
+type ProtoField struct {
+	Name     string
+	Number   uint32
+	Type     Type
+	Message  *ProtoMessage
+	Repeated bool
+	Optional bool
+}
+
+// A ProtoMessage describes a protobuf message with ABI typed fields.
+type ProtoMessage struct {
+	Name   string
+	Fields []ProtoField
+}
+
+// NewProtoMessage derives a ProtoMessage from the TypeDesc of a record. The
+// fields of the record are numbered from 1, in order. Lists become repeated
+// fields, maybes become optional fields, and records become nested messages
+// that are named after their field, with its first letter in upper case. This
+// is the message that is marshaled by MarshalProtoMessage.
+//
+// An error is returned if the TypeDesc is not a record, if a field name is not
+// a protobuf identifier, or if a list or maybe holds another list or maybe,
+// which protobuf cannot represent without a wrapper message.
+func NewProtoMessage(name string, desc TypeDesc) (ProtoMessage, error) {
+	if err := desc.validate(nil); err != nil {
+		return ProtoMessage{}, err
+	}
+	return newProtoMessage(name, desc, nil)
+}
+
+// Proto returns the proto3 definition of the message, with the definitions of
+// nested messages inside of it. An error is returned if a field has a Type
+// that cannot be represented, or if a field is both repeated and optional.
+// Repeated varint fields are explicitly unpacked, because each element is
+// marshaled as its own field.
+func (msg ProtoMessage) Proto() (string, error) {
+	b := new(strings.Builder)
+	if err := msg.writeProto(b, ""); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeProto writes the proto3 definition of the message, with every line
+// prefixed by the indent.
+func (msg ProtoMessage) writeProto(b *strings.Builder, indent string) error {
+	fmt.Fprintf(b, "%vmessage %v {\n", indent, msg.Name)
+	for _, field := range msg.Fields {
+		if field.Type == TypeRecord && field.Message != nil {
+			if err := field.Message.writeProto(b, indent+"  "); err != nil {
+				return err
+			}
+		}
+	}
+	for _, field := range msg.Fields {
+		protoTy, ok := ProtoTypeOf(field.Type)
+		if field.Type == TypeRecord && field.Message != nil {
+			protoTy, ok = field.Message.Name, true
+		}
+		if !ok {
+			return fmt.Errorf("non-exhaustive pattern: field %v has type %v", field.Name, field.Type)
+		}
+		if field.Repeated && field.Optional {
+			return fmt.Errorf("field %v cannot be both repeated and optional", field.Name)
+		}
+		b.WriteString(indent + "  ")
+		if field.Repeated {
+			b.WriteString("repeated ")
+		}
+		if field.Optional {
+			b.WriteString("optional ")
+		}
+		fmt.Fprintf(b, "%v %v = %v", protoTy, field.Name, field.Number)
+		if wireTy, ok := ProtoWireTypeOf(field.Type); ok && field.Repeated && wireTy == ProtoWireVarint {
+			b.WriteString(" [packed = false]")
+		}
+		fmt.Fprintf(b, "; // %v\n", field.Type)
+	}
+	fmt.Fprintf(b, "%v}\n", indent)
+	return nil
+}
+
+// newProtoMessage derives a ProtoMessage from the TypeDesc of a well-formed
+// record at the given Path.
+func newProtoMessage(name string, desc TypeDesc, path Path) (ProtoMessage, error) {
+	if desc.Type != TypeRecord {
+		return ProtoMessage{}, fmt.Errorf("non-exhaustive pattern: %v has type %v", path, desc)
+	}
+	msg := ProtoMessage{Name: name, Fields: make([]ProtoField, len(desc.Fields))}
+	messages := map[string]struct{}{}
+	for i, field := range desc.Fields {
+		fieldPath := path.append(FieldSegment(field.Name))
+		if !isTextName(field.Name) {
+			return ProtoMessage{}, fmt.Errorf("malformed: %v is not a protobuf field name", fieldPath)
+		}
+		protoField := ProtoField{Name: field.Name, Number: uint32(i + 1)}
+		elem := field.Desc
+		switch elem.Type {
+		case TypeList:
+			protoField.Repeated, elem = true, *elem.Elem
+		case TypeMaybe:
+			protoField.Optional, elem = true, *elem.Elem
+		}
+		if elem.Type == TypeList || elem.Type == TypeMaybe {
+			return ProtoMessage{}, fmt.Errorf("non-exhaustive pattern: %v has type %v", fieldPath, field.Desc)
+		}
+		protoField.Type = elem.Type
+		if elem.Type == TypeRecord {
+			nested, err := newProtoMessage(strings.ToUpper(field.Name[:1])+field.Name[1:], elem, fieldPath)
+			if err != nil {
+				return ProtoMessage{}, err
+			}
+			if _, ok := messages[nested.Name]; ok {
+				return ProtoMessage{}, fmt.Errorf("malformed: duplicate message %v", nested.Name)
+			}
+			messages[nested.Name] = struct{}{}
+			protoField.Message = &nested
+		}
+		msg.Fields[i] = protoField
+	}
+	return msg, nil
+}
+
+// A ProtoMarshaler can be marshaled to a protobuf field.
+type ProtoMarshaler interface {
+	// MarshalProto the tag and value of a field into an I/O writer. It accepts
+	// a maximum capacity of bytes that can be allocated, and returns the
+	// remaining capacity.
+	MarshalProto(w io.Writer, field uint32, m int) (int, error)
+}
+
+// A ProtoUnmarshaler can be unmarshaled from a protobuf field.
+type ProtoUnmarshaler interface {
+	// UnmarshalProto the value of a field from an I/O reader. The tag must
+	// have already been read using UnmarshalProtoTag. It accepts a maximum
+	// capacity of bytes that can be allocated, and returns the remaining
+	// capacity. It must not allocate more bytes than the maximum capacity.
+	UnmarshalProto(r io.Reader, m int) (int, error)
+}
+
+// MarshalProto marshals the String as a protobuf string field. An error is
+// returned if the String is not valid UTF-8, which protobuf requires of
+// strings.
+func (str String) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	if !utf8.ValidString(string(str)) {
+		return m, fmt.Errorf("malformed: String is not valid utf-8")
+	}
+	return protoWriteBytesField(w, field, []byte(str), m)
+}
+
+// UnmarshalProto unmarshals the String from the value of a protobuf string
+// field. An error is returned if the value is not valid UTF-8.
+func (str *String) UnmarshalProto(r io.Reader, m int) (int, error) {
+	data, m, err := protoReadString(r, m, m)
+	if err != nil {
+		return m, err
+	}
+	*str = String(data)
+	return m, nil
+}
+
+// MarshalProto marshals the Bytes as a protobuf bytes field.
+func (b Bytes) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	return protoWriteBytesField(w, field, b, m)
+}
+
+// UnmarshalProto unmarshals the Bytes from the value of a protobuf bytes field.
+func (b *Bytes) UnmarshalProto(r io.Reader, m int) (int, error) {
+	data, m, err := protoReadBytes(r, m, m)
+	if err != nil {
+		return m, err
+	}
+	*b = data
+	return m, nil
+}
+
+// MarshalProto marshals the Bytes32 as a protobuf bytes field.
+func (b32 Bytes32) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	return protoWriteBytesField(w, field, b32[:], m)
+}
+
+// UnmarshalProto unmarshals the Bytes32 from the value of a protobuf bytes
+// field. An error is returned if the value is not exactly 32 bytes long.
+func (b32 *Bytes32) UnmarshalProto(r io.Reader, m int) (int, error) {
+	return protoReadFixedBytes(r, (*b32)[:], m)
+}
+
+// MarshalProto marshals the Bytes65 as a protobuf bytes field.
+func (b65 Bytes65) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	return protoWriteBytesField(w, field, b65[:], m)
+}
+
+// UnmarshalProto unmarshals the Bytes65 from the value of a protobuf bytes
+// field. An error is returned if the value is not exactly 65 bytes long.
+func (b65 *Bytes65) UnmarshalProto(r io.Reader, m int) (int, error) {
+	return protoReadFixedBytes(r, (*b65)[:], m)
+}
+
+// MarshalProto marshals the Bool as a protobuf bool field.
+func (b Bool) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	if b.inner {
+		return protoWriteVarintField(w, field, 1, m)
+	}
+	return protoWriteVarintField(w, field, 0, m)
+}
+
+// UnmarshalProto unmarshals the Bool from the value of a protobuf bool field.
+func (b *Bool) UnmarshalProto(r io.Reader, m int) (int, error) {
+	x, m, err := protoReadVarint(r, m)
+	if err != nil {
+		return m, err
+	}
+	b.inner = x != 0
+	return m, nil
+}
+
+// MarshalProto marshals the U8 as a protobuf uint32 field.
+func (u8 U8) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	return protoWriteVarintField(w, field, uint64(u8.inner), m)
+}
+
+// UnmarshalProto unmarshals the U8 from the value of a protobuf uint32 field.
+// An error is returned if the value does not fit into 8 bits.
+func (u8 *U8) UnmarshalProto(r io.Reader, m int) (int, error) {
+	x, m, err := protoReadUint(r, uint64(MaxU8().inner), m)
+	if err != nil {
+		return m, err
+	}
+	u8.inner = uint8(x)
+	return m, nil
+}
+
+// MarshalProto marshals the U16 as a protobuf uint32 field.
+func (u16 U16) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	return protoWriteVarintField(w, field, uint64(u16.inner), m)
+}
+
+// UnmarshalProto unmarshals the U16 from the value of a protobuf uint32 field.
+// An error is returned if the value does not fit into 16 bits.
+func (u16 *U16) UnmarshalProto(r io.Reader, m int) (int, error) {
+	x, m, err := protoReadUint(r, uint64(MaxU16().inner), m)
+	if err != nil {
+		return m, err
+	}
+	u16.inner = uint16(x)
+	return m, nil
+}
+
+// MarshalProto marshals the U32 as a protobuf uint32 field.
+func (u32 U32) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	return protoWriteVarintField(w, field, uint64(u32.inner), m)
+}
+
+// UnmarshalProto unmarshals the U32 from the value of a protobuf uint32 field.
+func (u32 *U32) UnmarshalProto(r io.Reader, m int) (int, error) {
+	x, m, err := protoReadUint(r, uint64(MaxU32().inner), m)
+	if err != nil {
+		return m, err
+	}
+	u32.inner = uint32(x)
+	return m, nil
+}
+
+// MarshalProto marshals the U64 as a protobuf uint64 field.
+func (u64 U64) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	return protoWriteVarintField(w, field, u64.inner, m)
+}
+
+// UnmarshalProto unmarshals the U64 from the value of a protobuf uint64 field.
+func (u64 *U64) UnmarshalProto(r io.Reader, m int) (int, error) {
+	x, m, err := protoReadVarint(r, m)
+	if err != nil {
+		return m, err
+	}
+	u64.inner = x
+	return m, nil
+}
+
+// MarshalProto marshals the U128 as a protobuf bytes field holding its 16 byte
+// big endian representation.
+func (u128 U128) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	var b16 [16]byte
+	if u128.inner != nil {
+		b16 = paddedTo16(u128.inner)
+	}
+	return protoWriteBytesField(w, field, b16[:], m)
+}
+
+// UnmarshalProto unmarshals the U128 from the value of a protobuf bytes field.
+// An error is returned if the value is not exactly 16 bytes long.
+func (u128 *U128) UnmarshalProto(r io.Reader, m int) (int, error) {
+	b16 := [16]byte{}
+	m, err := protoReadFixedBytes(r, b16[:], m)
+	if err != nil {
+		return m, err
+	}
+	if u128.inner == nil {
+		u128.inner = new(big.Int)
+	}
+	u128.inner.SetBytes(b16[:])
+	return m, nil
+}
+
+// MarshalProto marshals the U256 as a protobuf bytes field holding its 32 byte
+// big endian representation.
+func (u256 U256) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	var b32 [32]byte
+	if u256.inner != nil {
+		b32 = paddedTo32(u256.inner)
+	}
+	return protoWriteBytesField(w, field, b32[:], m)
+}
+
+// UnmarshalProto unmarshals the U256 from the value of a protobuf bytes field.
+// An error is returned if the value is not exactly 32 bytes long.
+func (u256 *U256) UnmarshalProto(r io.Reader, m int) (int, error) {
+	b32 := [32]byte{}
+	m, err := protoReadFixedBytes(r, b32[:], m)
+	if err != nil {
+		return m, err
+	}
+	if u256.inner == nil {
+		u256.inner = new(big.Int)
+	}
+	u256.inner.SetBytes(b32[:])
+	return m, nil
+}
+
+// MarshalProtoTag marshals the tag of a protobuf field.
+func MarshalProtoTag(w io.Writer, field uint32, wireTy ProtoWireType, m int) (int, error) {
+	if field == 0 || field >= 1<<29 {
+		return m, fmt.Errorf("non-exhaustive pattern: field number %v", field)
+	}
+	return protoWriteVarint(w, uint64(field)<<3|uint64(wireTy), m)
+}
+
+// UnmarshalProtoTag unmarshals the tag of a protobuf field, and returns the
+// field number and wire type. Callers should use the field number to select
+// the ProtoUnmarshaler for the value, and check that its wire type is expected
+// using ProtoWireTypeOf.
+func UnmarshalProtoTag(r io.Reader, m int) (uint32, ProtoWireType, int, error) {
+	tag, m, err := protoReadVarint(r, m)
+	if err != nil {
+		return 0, 0, m, err
+	}
+	field := tag >> 3
+	if field == 0 || field >= 1<<29 {
+		return 0, 0, m, fmt.Errorf("non-exhaustive pattern: field number %v", field)
+	}
+	return uint32(field), ProtoWireType(tag & 0x7), m, nil
+}
+
+// MarshalProto marshals the Record as a protobuf field holding a nested
+// message. See MarshalProtoMessage for how the fields of the Record are
+// marshaled. The nested message is marshaled into an intermediate buffer so
+// that its length can be written, and its bytes are only counted once towards
+// the maximum number of bytes.
+func (record Record) MarshalProto(w io.Writer, field uint32, m int) (int, error) {
+	buf := new(bytes.Buffer)
+	m, err := MarshalProtoMessage(buf, record, m)
+	if err != nil {
+		return m, err
+	}
+	// The message has already been charged while it was buffered, so only
+	// the tag and the length are charged when it is written.
+	if m, err = MarshalProtoTag(w, field, ProtoWireBytes, m); err != nil {
+		return m, err
+	}
+	if m, err = protoWriteVarint(w, uint64(buf.Len()), m); err != nil {
+		return m, err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// MarshalProtoMessage marshals the fields of a Record as a protobuf message, as
+// described by NewProtoMessage. The value of each field is marshaled with the
+// number of the field: every element of a list is marshaled as its own field,
+// the value of a maybe is only marshaled when it is present, and a record is
+// marshaled as a nested message. Fields are always marshaled, even when they
+// have their default value. An error is returned if a list or maybe holds
+// another list or maybe.
+func MarshalProtoMessage(w io.Writer, record Record, m int) (int, error) {
+	if len(record.Values) != len(record.Fields) {
+		return m, fmt.Errorf("expected len=%v, got len=%v", len(record.Fields), len(record.Values))
+	}
+	var err error
+	for i, v := range record.Values {
+		field := uint32(i + 1)
+		switch v := v.(type) {
+		case List:
+			for _, elem := range v.Elems {
+				if m, err = protoWriteField(w, field, elem, m); err != nil {
+					return m, err
+				}
+			}
+		case Maybe:
+			if v.Value != nil {
+				if m, err = protoWriteField(w, field, v.Value, m); err != nil {
+					return m, err
+				}
+			}
+		default:
+			if m, err = protoWriteField(w, field, v, m); err != nil {
+				return m, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// UnmarshalProtoMessage unmarshals a protobuf message into a Record described
+// by the TypeDesc, as described by NewProtoMessage. Protobuf messages are not
+// delimited, so the message is read until the end of the reader.
+//
+// Unknown fields are skipped. Absent fields have their default value: zero,
+// an empty list, an absent maybe, or a record whose fields all have their
+// default value. As in protobuf, the last value of a field that is not
+// repeated is used, and repeated varint fields can be packed or unpacked. The
+// bytes that are read are counted towards the maximum number of bytes, and the
+// message is checked against the DefaultLimits.
+func UnmarshalProtoMessage(r io.Reader, desc TypeDesc, m int) (Record, int, error) {
+	limits := DefaultLimits()
+	limits.MaxBytes = m
+	return UnmarshalProtoMessageWithLimits(r, desc, limits)
+}
+
+// UnmarshalProtoMessageWithLimits is the same as UnmarshalProtoMessage, but
+// checks the message against the given Limits. The maximum number of bytes is
+// taken from the Limits.
+func UnmarshalProtoMessageWithLimits(r io.Reader, desc TypeDesc, limits Limits) (Record, int, error) {
+	m := limits.MaxBytes
+	if _, err := NewProtoMessage("Message", desc); err != nil {
+		return Record{}, m, err
+	}
+	return protoReadMessage(r, desc, m, limits, 0)
+}
+
+// protoWriteField writes the tag and value of a field that is not repeated.
+func protoWriteField(w io.Writer, field uint32, v Value, m int) (int, error) {
+	marshaler, ok := v.(ProtoMarshaler)
+	if !ok {
+		return m, fmt.Errorf("non-exhaustive pattern: field %v has type %v", field, typeOf(v))
+	}
+	return marshaler.MarshalProto(w, field, m)
+}
+
+// protoReadMessage reads the fields of a message, described by the TypeDesc of
+// a well-formed record at the given depth, until the end of the reader.
+func protoReadMessage(r io.Reader, desc TypeDesc, m int, limits Limits, depth int) (Record, int, error) {
+	if err := limits.checkDepth(depth + 1); err != nil {
+		return Record{}, m, err
+	}
+	if err := limits.checkRecordFields(len(desc.Fields)); err != nil {
+		return Record{}, m, err
+	}
+
+	values := make([]Value, len(desc.Fields))
+	for {
+		field, wireTy, ok, m2, err := protoReadTagOrEOF(r, m)
+		if m = m2; err != nil {
+			return Record{}, m, err
+		}
+		if !ok {
+			break
+		}
+		if field > uint32(len(desc.Fields)) {
+			if m, err = protoSkipField(r, wireTy, m); err != nil {
+				return Record{}, m, err
+			}
+			continue
+		}
+
+		i := field - 1
+		fieldDesc := desc.Fields[i].Desc
+		switch fieldDesc.Type {
+		case TypeList:
+			if err := limits.checkDepth(depth + 2); err != nil {
+				return Record{}, m, err
+			}
+			list, _ := values[i].(List)
+			list.Elem = *fieldDesc.Elem
+			if list.Elems, m, err = protoReadRepeated(r, list.Elems, *fieldDesc.Elem, wireTy, m, limits, depth+2); err != nil {
+				return Record{}, m, err
+			}
+			values[i] = list
+		case TypeMaybe:
+			if err := limits.checkDepth(depth + 2); err != nil {
+				return Record{}, m, err
+			}
+			maybe := Maybe{Elem: *fieldDesc.Elem}
+			if maybe.Value, m, err = protoReadValue(r, *fieldDesc.Elem, wireTy, m, limits, depth+2); err != nil {
+				return Record{}, m, err
+			}
+			values[i] = maybe
+		default:
+			if values[i], m, err = protoReadValue(r, fieldDesc, wireTy, m, limits, depth+1); err != nil {
+				return Record{}, m, err
+			}
+		}
+	}
+
+	fields := make([]RecordField, len(desc.Fields))
+	for i, field := range desc.Fields {
+		fields[i] = RecordField{Name: field.Name, Type: field.Desc.Type}
+		if values[i] == nil {
+			values[i] = protoDefault(field.Desc)
+		}
+	}
+	return Record{Fields: fields, Values: values}, m, nil
+}
+
+// protoReadRepeated reads the value of a repeated field, and appends it to the
+// elements that have already been read. Repeated varint fields can be packed,
+// in which case every element in the packed value is appended.
+func protoReadRepeated(r io.Reader, elems []Value, desc TypeDesc, wireTy ProtoWireType, m int, limits Limits, depth int) ([]Value, int, error) {
+	if elemWireTy, ok := ProtoWireTypeOf(desc.Type); !ok || elemWireTy != ProtoWireVarint || wireTy != ProtoWireBytes {
+		v, m, err := protoReadValue(r, desc, wireTy, m, limits, depth)
+		if err != nil {
+			return elems, m, err
+		}
+		if err := limits.checkListLen(len(elems) + 1); err != nil {
+			return elems, m, err
+		}
+		return append(elems, v), m, nil
+	}
+
+	size, m, err := protoReadVarint(r, m)
+	if err != nil {
+		return elems, m, err
+	}
+	if size >= uint64(m) {
+		return elems, m, surge.ErrMaxBytesExceeded
+	}
+	lr := &io.LimitedReader{R: r, N: int64(size)}
+	for lr.N > 0 {
+		var v Value
+		if v, m, err = protoReadValue(lr, desc, ProtoWireVarint, m, limits, depth); err != nil {
+			return elems, m, err
+		}
+		if err := limits.checkListLen(len(elems) + 1); err != nil {
+			return elems, m, err
+		}
+		elems = append(elems, v)
+	}
+	return elems, m, nil
+}
+
+// protoReadValue reads the value of a field, described by a well-formed
+// TypeDesc of a record or of a bytes or scalar type, at the given depth. An
+// error is returned if the wire type is not the one that is expected.
+func protoReadValue(r io.Reader, desc TypeDesc, wireTy ProtoWireType, m int, limits Limits, depth int) (Value, int, error) {
+	expectedWireTy, ok := ProtoWireTypeOf(desc.Type)
+	if desc.Type == TypeRecord {
+		expectedWireTy, ok = ProtoWireBytes, true
+	}
+	if !ok {
+		return nil, m, fmt.Errorf("non-exhaustive pattern: Type(%v)", desc.Type)
+	}
+	if wireTy != expectedWireTy {
+		return nil, m, fmt.Errorf("expected wire type %v, got wire type %v", expectedWireTy, wireTy)
+	}
+
+	switch desc.Type {
+	case TypeRecord:
+		size, m, err := protoReadVarint(r, m)
+		if err != nil {
+			return nil, m, err
+		}
+		if size >= uint64(m) {
+			return nil, m, surge.ErrMaxBytesExceeded
+		}
+		lr := &io.LimitedReader{R: r, N: int64(size)}
+		record, m, err := protoReadMessage(lr, desc, m, limits, depth)
+		if err != nil {
+			return nil, m, err
+		}
+		if lr.N != 0 {
+			return nil, m, io.ErrUnexpectedEOF
+		}
+		return record, m, nil
+
+	case TypeString:
+		data, m, err := protoReadString(r, m, limits.MaxStringLen)
+		if err != nil {
+			return nil, m, err
+		}
+		return String(data), m, nil
+
+	case TypeBytes:
+		data, m, err := protoReadBytes(r, m, limits.MaxStringLen)
+		if err != nil {
+			return nil, m, err
+		}
+		return Bytes(data), m, nil
+
+	default:
+		ptr, err := newPrimitive(desc.Type)
+		if err != nil {
+			return nil, m, err
+		}
+		if m, err = ptr.(ProtoUnmarshaler).UnmarshalProto(r, m); err != nil {
+			return nil, m, err
+		}
+		return pointee(ptr), m, nil
+	}
+}
+
+// protoDefault returns the default value of a field that is absent from a
+// message.
+func protoDefault(desc TypeDesc) Value {
+	switch desc.Type {
+	case TypeList:
+		return List{Elem: *desc.Elem, Elems: []Value{}}
+	case TypeMaybe:
+		return Maybe{Elem: *desc.Elem}
+	case TypeRecord:
+		record := Record{
+			Fields: make([]RecordField, len(desc.Fields)),
+			Values: make([]Value, len(desc.Fields)),
+		}
+		for i, field := range desc.Fields {
+			record.Fields[i] = RecordField{Name: field.Name, Type: field.Desc.Type}
+			record.Values[i] = protoDefault(field.Desc)
+		}
+		return record
+	case TypeU128:
+		return NewU128([16]byte{})
+	case TypeU256:
+		return NewU256([32]byte{})
+	default:
+		ptr, err := newPrimitive(desc.Type)
+		if err != nil {
+			panic(err)
+		}
+		return pointee(ptr)
+	}
+}
+
+// protoSkipField reads and discards the value of an unknown field. The bytes
+// that are skipped are counted towards the maximum number of bytes, but are
+// never allocated.
+func protoSkipField(r io.Reader, wireTy ProtoWireType, m int) (int, error) {
+	var size uint64
+	var err error
+	switch wireTy {
+	case ProtoWireVarint:
+		_, m, err = protoReadVarint(r, m)
+		return m, err
+	case ProtoWireFixed64:
+		size = 8
+	case ProtoWireFixed32:
+		size = 4
+	case ProtoWireBytes:
+		if size, m, err = protoReadVarint(r, m); err != nil {
+			return m, err
+		}
+	default:
+		return m, fmt.Errorf("non-exhaustive pattern: wire type %v", wireTy)
+	}
+	if size >= uint64(m) {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	n, err := io.CopyN(ioutil.Discard, r, int64(size))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return m - int(n), err
+}
+
+// protoReadTagOrEOF reads the tag of the next field of a message. Returns false
+// if the reader has ended before the tag, which is the end of the message.
+func protoReadTagOrEOF(r io.Reader, m int) (uint32, ProtoWireType, bool, int, error) {
+	first := [1]byte{}
+	if _, err := io.ReadFull(r, first[:]); err != nil {
+		if err == io.EOF {
+			return 0, 0, false, m, nil
+		}
+		return 0, 0, false, m, err
+	}
+	if m <= 1 {
+		return 0, 0, false, m, surge.ErrMaxBytesExceeded
+	}
+	field, wireTy, m, err := UnmarshalProtoTag(io.MultiReader(bytes.NewReader(first[:]), r), m)
+	return field, wireTy, err == nil, m, err
+}
+
+// protoWriteVarint writes a base 128 varint.
+func protoWriteVarint(w io.Writer, x uint64, m int) (int, error) {
+	bs := [binary.MaxVarintLen64]byte{}
+	return writeWithin(w, bs[:binary.PutUvarint(bs[:], x)], m)
+}
+
+// protoWriteVarintField writes the tag and value of a varint field.
+func protoWriteVarintField(w io.Writer, field uint32, x uint64, m int) (int, error) {
+	m, err := MarshalProtoTag(w, field, ProtoWireVarint, m)
+	if err != nil {
+		return m, err
+	}
+	return protoWriteVarint(w, x, m)
+}
+
+// protoWriteBytesField writes the tag and value of a length-delimited field.
+func protoWriteBytesField(w io.Writer, field uint32, data []byte, m int) (int, error) {
+	m, err := MarshalProtoTag(w, field, ProtoWireBytes, m)
+	if err != nil {
+		return m, err
+	}
+	if m, err = protoWriteVarint(w, uint64(len(data)), m); err != nil {
+		return m, err
+	}
+	return writeWithin(w, data, m)
+}
+
+// protoReadVarint reads a base 128 varint, and counts every byte towards the
+// maximum number of bytes. Varints that are longer than ten bytes, or that
+// overflow 64 bits, are rejected.
+func protoReadVarint(r io.Reader, m int) (uint64, int, error) {
+	x := uint64(0)
+	bs := [1]byte{}
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		var err error
+		if m, err = readWithin(r, bs[:], m); err != nil {
+			return 0, m, err
+		}
+		if i == binary.MaxVarintLen64-1 && bs[0] > 1 {
+			break
+		}
+		x |= uint64(bs[0]&0x7f) << (7 * uint(i))
+		if bs[0] < 0x80 {
+			return x, m, nil
+		}
+	}
+	return 0, m, fmt.Errorf("overflow: varint is longer than 64 bits")
+}
+
+// protoReadUint reads a varint that is no greater than max.
+func protoReadUint(r io.Reader, max uint64, m int) (uint64, int, error) {
+	x, m, err := protoReadVarint(r, m)
+	if err != nil {
+		return 0, m, err
+	}
+	if x > max {
+		return 0, m, fmt.Errorf("overflow: expected x<=%v, got x=%v", max, x)
+	}
+	return x, m, nil
+}
+
+// protoReadBytes reads the value of a length-delimited field that is at most
+// maxLen bytes long. Unmarshaling will not allocate more than the specified
+// maximum number of bytes.
+func protoReadBytes(r io.Reader, m int, maxLen int) ([]byte, int, error) {
+	size, m, err := protoReadVarint(r, m)
+	if err != nil {
+		return nil, m, err
+	}
+	if size >= uint64(m) {
+		return nil, m, surge.ErrMaxBytesExceeded
+	}
+	if err := checkLimit("string len", maxLen, int(size)); err != nil {
+		return nil, m, err
+	}
+	data := make([]byte, size)
+	if m, err = readWithin(r, data, m); err != nil {
+		return nil, m, err
+	}
+	return data, m, nil
+}
+
+// protoReadString reads the value of a string field that is at most maxLen
+// bytes long. An error is returned if the value is not valid UTF-8.
+func protoReadString(r io.Reader, m int, maxLen int) ([]byte, int, error) {
+	data, m, err := protoReadBytes(r, m, maxLen)
+	if err != nil {
+		return nil, m, err
+	}
+	if !utf8.Valid(data) {
+		return nil, m, fmt.Errorf("malformed: String is not valid utf-8")
+	}
+	return data, m, nil
+}
+
+// protoReadFixedBytes reads the value of a length-delimited field into data.
+// The value must be exactly len(data) bytes long.
+func protoReadFixedBytes(r io.Reader, data []byte, m int) (int, error) {
+	size, m, err := protoReadVarint(r, m)
+	if err != nil {
+		return m, err
+	}
+	if size != uint64(len(data)) {
+		return m, fmt.Errorf("expected len=%v, got len=%v", len(data), size)
+	}
+	return readWithin(r, data, m)
+}
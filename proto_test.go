@@ -0,0 +1,251 @@
+package abi_test
+
+import (
+	"bytes"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Protobuf", func() {
+	Context("when generating a proto definition", func() {
+		It("should map each type to a protobuf type", func() {
+			msg := abi.ProtoMessage{
+				Name: "Transfer",
+				Fields: []abi.ProtoField{
+					{Name: "to", Number: 1, Type: abi.TypeBytes32},
+					{Name: "amount", Number: 2, Type: abi.TypeU256},
+					{Name: "nonces", Number: 3, Type: abi.TypeU64, Repeated: true},
+					{Name: "memo", Number: 4, Type: abi.TypeString, Optional: true},
+				},
+			}
+			proto, err := msg.Proto()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(proto).To(Equal(`message Transfer {
+  bytes to = 1; // b32
+  bytes amount = 2; // u256
+  repeated uint64 nonces = 3 [packed = false]; // u64
+  optional string memo = 4; // str
+}
+`))
+		})
+
+		It("should return an error for unsupported fields", func() {
+			_, err := abi.ProtoMessage{Name: "M", Fields: []abi.ProtoField{{Name: "x", Number: 1, Type: abi.TypeRecord}}}.Proto()
+			Expect(err).To(HaveOccurred())
+
+			_, err = abi.ProtoMessage{Name: "M", Fields: []abi.ProtoField{{Name: "x", Number: 1, Type: abi.TypeU8, Repeated: true, Optional: true}}}.Proto()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when marshaling known values", func() {
+		It("should match the protobuf encoding", func() {
+			buf := new(bytes.Buffer)
+			_, err := abi.NewU32(150).MarshalProto(buf, 1, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = abi.String("testing").MarshalProto(buf, 2, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Bytes()).To(Equal([]byte{0x08, 0x96, 0x01, 0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}))
+		})
+	})
+
+	Context("when marshaling and unmarshaling", func() {
+		It("should equal itself", func() {
+			f := func(x uint64, y [32]byte, b bool) bool {
+				u64 := abi.NewU64(x)
+				u256 := abi.NewU256(y)
+				bl := abi.NewBool(b)
+
+				buf := new(bytes.Buffer)
+				for i, v := range []abi.ProtoMarshaler{u64, u256, bl} {
+					_, err := v.MarshalProto(buf, uint32(i+1), abi.MaxBytes)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				u64Out := abi.U64{}
+				u256Out := abi.U256{}
+				blOut := abi.Bool{}
+				for i, v := range []abi.ProtoUnmarshaler{&u64Out, &u256Out, &blOut} {
+					field, wireTy, m, err := abi.UnmarshalProtoTag(buf, abi.MaxBytes)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(field).To(Equal(uint32(i + 1)))
+					expectedWireTy, ok := abi.ProtoWireTypeOf(v.(interface{ Type() abi.Type }).Type())
+					Expect(ok).To(BeTrue())
+					Expect(wireTy).To(Equal(expectedWireTy))
+					_, err = v.UnmarshalProto(buf, m)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				Expect(u64Out).To(Equal(u64))
+				Expect(u256Out.Equal(u256)).To(BeTrue())
+				Expect(blOut).To(Equal(bl))
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when unmarshaling invalid values", func() {
+		It("should return an error", func() {
+			u8 := abi.U8{}
+			_, err := u8.UnmarshalProto(bytes.NewReader([]byte{0x80, 0x02}), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+
+			u64 := abi.U64{}
+			_, err = u64.UnmarshalProto(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+
+			b32 := abi.Bytes32{}
+			_, err = b32.UnmarshalProto(bytes.NewReader(append([]byte{31}, make([]byte, 31)...)), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+
+			b := abi.Bytes{}
+			_, err = b.UnmarshalProto(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x07}), 1024)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+	})
+
+	Context("when deriving a message from a type desc", func() {
+		It("should nest record fields as messages", func() {
+			desc, err := abi.ParseTypeDesc("record{to:b32,outputs:list<record{amount:u256}>,memo:maybe<str>}")
+			Expect(err).ToNot(HaveOccurred())
+			msg, err := abi.NewProtoMessage("Tx", desc)
+			Expect(err).ToNot(HaveOccurred())
+			proto, err := msg.Proto()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(proto).To(Equal(`message Tx {
+  message Outputs {
+    bytes amount = 1; // u256
+  }
+  bytes to = 1; // b32
+  repeated Outputs outputs = 2; // record
+  optional string memo = 3; // str
+}
+`))
+		})
+
+		It("should return an error for types that cannot be represented", func() {
+			for _, text := range []string{
+				"u8",
+				"record{a:list<list<u8>>}",
+				"record{a:maybe<list<u8>>}",
+				`record{"a b":u8}`,
+				"record{a:record{x:u8},A:record{y:u8}}",
+			} {
+				desc, err := abi.ParseTypeDesc(text)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = abi.NewProtoMessage("Message", desc)
+				Expect(err).To(HaveOccurred(), text)
+			}
+		})
+	})
+
+	Context("when marshaling and unmarshaling messages", func() {
+		It("should equal itself", func() {
+			for _, text := range []string{
+				`record{a: u8(1), b: list<u64>[u64(2), u64(3)], c: maybe<str>(str("x")), d: record{e: u256(4), f: list<record{g:bool}>[record{g: bool(false)}]}}`,
+				`record{a: u8(0), b: list<u64>[], c: maybe<str>(none), d: record{e: u256(0), f: list<record{g:bool}>[]}}`,
+			} {
+				record := abi.MustParseText(text).(abi.Record)
+				buf := new(bytes.Buffer)
+				m, err := abi.MarshalProtoMessage(buf, record, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m).To(Equal(abi.MaxBytes - buf.Len()))
+
+				out, m, err := abi.UnmarshalProtoMessage(bytes.NewReader(buf.Bytes()), abi.DescOf(record), abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m).To(Equal(abi.MaxBytes - buf.Len()))
+				Expect(abi.Equal(out, record)).To(BeTrue(), text)
+			}
+		})
+
+		It("should skip unknown fields", func() {
+			desc, err := abi.ParseTypeDesc("record{a:u8}")
+			Expect(err).ToNot(HaveOccurred())
+			data := []byte{
+				0x10, 0x96, 0x01, // field 2, varint
+				0x19, 1, 2, 3, 4, 5, 6, 7, 8, // field 3, fixed64
+				0x22, 2, 'h', 'i', // field 4, bytes
+				0x2d, 1, 2, 3, 4, // field 5, fixed32
+				0x08, 0x07, // field 1, varint
+			}
+			out, _, err := abi.UnmarshalProtoMessage(bytes.NewReader(data), desc, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.Equal(out, abi.MustParseText("record{a: u8(7)}"))).To(BeTrue())
+
+			_, _, err = abi.UnmarshalProtoMessage(bytes.NewReader([]byte{0x13}), desc, abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should accept packed repeated varints", func() {
+			desc, err := abi.ParseTypeDesc("record{a:list<u16>}")
+			Expect(err).ToNot(HaveOccurred())
+			out, _, err := abi.UnmarshalProtoMessage(bytes.NewReader([]byte{0x0a, 3, 1, 0x80, 0x01, 0x08, 3}), desc, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.Equal(out, abi.MustParseText("record{a: list<u16>[u16(1), u16(128), u16(3)]}"))).To(BeTrue())
+		})
+
+		It("should use defaults for absent fields and the last value of singular fields", func() {
+			desc, err := abi.ParseTypeDesc("record{a:u128,b:record{c:str},d:u8}")
+			Expect(err).ToNot(HaveOccurred())
+			out, _, err := abi.UnmarshalProtoMessage(bytes.NewReader([]byte{0x18, 1, 0x18, 2}), desc, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.Equal(out, abi.MustParseText(`record{a: u128(0), b: record{c: str("")}, d: u8(2)}`))).To(BeTrue())
+		})
+
+		It("should return an error for mismatched wire types", func() {
+			desc, err := abi.ParseTypeDesc("record{a:u8}")
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = abi.UnmarshalProtoMessage(bytes.NewReader([]byte{0x0a, 0}), desc, abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error when the budget is exceeded", func() {
+			record := abi.MustParseText(`record{a: list<str>[str("hello"), str("world")], b: record{c: u64(300)}}`).(abi.Record)
+			buf := new(bytes.Buffer)
+			_, err := abi.MarshalProtoMessage(buf, record, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			n := buf.Len()
+
+			m, err := abi.MarshalProtoMessage(new(bytes.Buffer), record, n+1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m).To(Equal(1))
+			_, err = abi.MarshalProtoMessage(new(bytes.Buffer), record, n)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+			_, m, err = abi.UnmarshalProtoMessage(bytes.NewReader(buf.Bytes()), abi.DescOf(record), n+1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m).To(Equal(1))
+			_, _, err = abi.UnmarshalProtoMessage(bytes.NewReader(buf.Bytes()), abi.DescOf(record), n)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+			desc, err := abi.ParseTypeDesc("record{a:u8}")
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = abi.UnmarshalProtoMessage(bytes.NewReader([]byte{0x12, 0xff, 0xff, 0xff, 0xff, 0x07}), desc, 1024)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+	})
+
+	Context("when marshaling strings that are not valid utf-8", func() {
+		It("should return an error", func() {
+			_, err := abi.String("\xff").MarshalProto(new(bytes.Buffer), 1, abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+
+			str := abi.String("")
+			_, err = str.UnmarshalProto(bytes.NewReader([]byte{1, 0xff}), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+
+			desc, err := abi.ParseTypeDesc("record{a:str}")
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = abi.UnmarshalProtoMessage(bytes.NewReader([]byte{0x0a, 1, 0xff}), desc, abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,326 @@
+package abi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A QueryResult is a value selected by a query, and the Path at which it was
+// found.
+type QueryResult struct {
+	Path  Path
+	Value Value
+}
+
+// A QueryError is returned when a query cannot be parsed, or when a segment of
+// the query cannot be applied to a value. It names the failing segment, and its
+// offset in the query.
+type QueryError struct {
+	Segment string
+	Offset  int
+	Err     error
+}
+
+// Error implements the error interface.
+func (err QueryError) Error() string {
+	return fmt.Sprintf("segment %q at offset %v: %v", err.Segment, err.Offset, err.Err)
+}
+
+// Unwrap returns the underlying error.
+func (err QueryError) Unwrap() error {
+	return err.Err
+}
+
+// querySegmentKind identifies the kind of a query segment.
+type querySegmentKind uint8
+
+const (
+	queryField querySegmentKind = iota
+	queryIndex
+	queryWildcard
+	queryRecursive
+	queryFilter
+)
+
+// A querySegment is one step of a Selector.
+type querySegment struct {
+	kind   querySegmentKind
+	field  string
+	index  int
+	ty     Type
+	negate bool
+
+	raw    string
+	offset int
+}
+
+// A Selector is a parsed query. Queries are written in a small jq-style
+// language, and select values nested inside of another value:
+//
+//	.                 the value itself
+//	.amount           the field "amount" of a record
+//	[2]               the element at index 2 of a list
+//	[*] or .*         every element of a list, or every field of a record
+//	..                the value itself, and every value nested inside of it
+//	[?type==b32]      the selected values of type b32 (or != for other types)
+//
+// Segments are applied in order to every selected value, so
+// ".inputs[*].hash" selects the hash of every input, and "..[?type==b32]"
+// selects every b32 value. A field name can directly follow "..", so
+// "..amount" selects the field "amount" of every record.
+//
+// Until a wildcard, recursive, or filter segment has been applied, a field that
+// does not exist, an index that is out of range, or a value that is not a
+// record or list is an error. After one has been applied, such values are
+// skipped, because the query is expected to match only some of them.
+type Selector struct {
+	query    string
+	segments []querySegment
+}
+
+// Query parses the query and applies it to a value. See Selector for the query
+// language. The results are returned in depth-first order.
+func Query(v Value, query string) ([]QueryResult, error) {
+	sel, err := ParseSelector(query)
+	if err != nil {
+		return nil, err
+	}
+	return sel.Select(v)
+}
+
+// ParseSelector parses a query. See Selector for the query language. A
+// QueryError is returned if the query is malformed.
+func ParseSelector(query string) (Selector, error) {
+	if query == "" {
+		return Selector{}, QueryError{Segment: query, Err: fmt.Errorf("malformed: empty query")}
+	}
+	if query == "." {
+		return Selector{query: query}, nil
+	}
+	segments := []querySegment{}
+	for i := 0; i < len(query); {
+		seg, n, err := parseQuerySegment(query[i:])
+		if err != nil {
+			return Selector{}, QueryError{Segment: query[i : i+n], Offset: i, Err: err}
+		}
+		seg.raw = query[i : i+n]
+		seg.offset = i
+		segments = append(segments, seg)
+		i += n
+
+		// The ".." segment can be followed directly by a field name, in which
+		// case the "." of the field is implied.
+		if seg.kind == queryRecursive && i < len(query) && isQueryNameStart(query[i]) {
+			n = queryNameLen(query[i:])
+			segments = append(segments, querySegment{kind: queryField, field: query[i : i+n], raw: query[i : i+n], offset: i})
+			i += n
+		}
+	}
+	return Selector{query: query, segments: segments}, nil
+}
+
+// parseQuerySegment parses the segment at the start of the query. It returns
+// the segment and its length. If an error is returned, the length covers the
+// malformed part of the segment.
+func parseQuerySegment(query string) (querySegment, int, error) {
+	switch query[0] {
+	case '.':
+		if len(query) == 1 {
+			return querySegment{}, 1, fmt.Errorf("malformed: expected field name")
+		}
+		if query[1] == '.' {
+			return querySegment{kind: queryRecursive}, 2, nil
+		}
+		if query[1] == '*' {
+			return querySegment{kind: queryWildcard}, 2, nil
+		}
+		if !isQueryNameStart(query[1]) {
+			return querySegment{}, 2, fmt.Errorf("malformed: expected field name, got %q", query[1])
+		}
+		n := 1 + queryNameLen(query[1:])
+		return querySegment{kind: queryField, field: query[1:n]}, n, nil
+
+	case '[':
+		end := strings.IndexByte(query, ']')
+		if end < 0 {
+			return querySegment{}, len(query), fmt.Errorf("malformed: expected ']'")
+		}
+		inner := query[1:end]
+		n := end + 1
+		switch {
+		case inner == "*":
+			return querySegment{kind: queryWildcard}, n, nil
+		case strings.HasPrefix(inner, "?"):
+			seg, err := parseQueryFilter(inner[1:])
+			return seg, n, err
+		default:
+			index, err := strconv.ParseUint(inner, 10, 31)
+			if err != nil {
+				return querySegment{}, n, fmt.Errorf("malformed: expected index, got %q", inner)
+			}
+			return querySegment{kind: queryIndex, index: int(index)}, n, nil
+		}
+
+	default:
+		return querySegment{}, 1, fmt.Errorf("malformed: expected '.' or '[', got %q", query[0])
+	}
+}
+
+// parseQueryFilter parses the predicate of a filter segment, without the
+// surrounding "[?" and "]".
+func parseQueryFilter(predicate string) (querySegment, error) {
+	seg := querySegment{kind: queryFilter}
+	var operands []string
+	if operands = strings.SplitN(predicate, "!=", 2); len(operands) == 2 {
+		seg.negate = true
+	} else if operands = strings.SplitN(predicate, "==", 2); len(operands) != 2 {
+		return seg, fmt.Errorf("malformed: expected type==T or type!=T, got %q", predicate)
+	}
+	if key := strings.TrimSpace(operands[0]); key != "type" {
+		return seg, fmt.Errorf("non-exhaustive pattern: filter on %q", key)
+	}
+	ty, ok := NewTypeFromString(strings.TrimSpace(operands[1]))
+	if !ok {
+		return seg, fmt.Errorf("non-exhaustive pattern: Type(%v)", strings.TrimSpace(operands[1]))
+	}
+	seg.ty = ty
+	return seg, nil
+}
+
+// isQueryNameStart returns true if the character can start a field name.
+func isQueryNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// queryNameLen returns the length of the field name at the start of the query.
+func queryNameLen(query string) int {
+	n := 0
+	for n < len(query) && (isQueryNameStart(query[n]) || (query[n] >= '0' && query[n] <= '9')) {
+		n++
+	}
+	return n
+}
+
+// String returns the query from which the Selector was parsed.
+func (sel Selector) String() string {
+	return sel.query
+}
+
+// Select applies the Selector to a value, and returns the selected values in
+// depth-first order. A QueryError is returned if a segment cannot be applied.
+func (sel Selector) Select(v Value) ([]QueryResult, error) {
+	results := []QueryResult{{Path: nil, Value: v}}
+	strict := true
+	for _, seg := range sel.segments {
+		next := []QueryResult{}
+		for _, result := range results {
+			var err error
+			if next, err = seg.apply(next, result, strict); err != nil {
+				return nil, QueryError{Segment: seg.raw, Offset: seg.offset, Err: err}
+			}
+		}
+		results = next
+		if seg.kind != queryField && seg.kind != queryIndex {
+			strict = false
+		}
+	}
+	return results, nil
+}
+
+// apply appends the values selected by the segment from the result to dst. If
+// strict is true, values that cannot be selected from are an error. Otherwise,
+// they are skipped.
+func (seg querySegment) apply(dst []QueryResult, result QueryResult, strict bool) ([]QueryResult, error) {
+	path, v := result.Path, result.Value
+	switch seg.kind {
+	case queryField:
+		record, ok := v.(Record)
+		if !ok {
+			if strict {
+				return dst, fmt.Errorf("expected %v to have type %v, got %v", path, TypeRecord, typeOf(v))
+			}
+			return dst, nil
+		}
+		for i, field := range record.Fields {
+			if field.Name == seg.field && i < len(record.Values) {
+				return append(dst, QueryResult{Path: path.append(FieldSegment(field.Name)), Value: record.Values[i]}), nil
+			}
+		}
+		if strict {
+			return dst, fmt.Errorf("non-exhaustive pattern: %v has no field %v", path, seg.field)
+		}
+		return dst, nil
+
+	case queryIndex:
+		list, ok := v.(List)
+		if !ok {
+			if strict {
+				return dst, fmt.Errorf("expected %v to have type %v, got %v", path, TypeList, typeOf(v))
+			}
+			return dst, nil
+		}
+		if seg.index >= len(list.Elems) {
+			if strict {
+				return dst, fmt.Errorf("expected index<%v, got index=%v", len(list.Elems), seg.index)
+			}
+			return dst, nil
+		}
+		return append(dst, QueryResult{Path: path.append(IndexSegment(seg.index)), Value: list.Elems[seg.index]}), nil
+
+	case queryWildcard:
+		switch v := v.(type) {
+		case List:
+			for i, elem := range v.Elems {
+				dst = append(dst, QueryResult{Path: path.append(IndexSegment(i)), Value: elem})
+			}
+		case Record:
+			for i, field := range v.Fields {
+				if i < len(v.Values) {
+					dst = append(dst, QueryResult{Path: path.append(FieldSegment(field.Name)), Value: v.Values[i]})
+				}
+			}
+		default:
+			if strict {
+				return dst, fmt.Errorf("expected %v to have type %v or %v, got %v", path, TypeList, TypeRecord, typeOf(v))
+			}
+		}
+		return dst, nil
+
+	case queryRecursive:
+		return appendDescendants(dst, path, v), nil
+
+	case queryFilter:
+		if v != nil && (v.Type() == seg.ty) != seg.negate {
+			dst = append(dst, result)
+		}
+		return dst, nil
+
+	default:
+		return dst, fmt.Errorf("non-exhaustive pattern: segment %v", seg.raw)
+	}
+}
+
+// appendDescendants appends a value, and every value nested inside of it, to
+// dst in depth-first order. The value of a maybe has the same Path as the
+// maybe.
+func appendDescendants(dst []QueryResult, path Path, v Value) []QueryResult {
+	dst = append(dst, QueryResult{Path: path, Value: v})
+	switch v := v.(type) {
+	case List:
+		for i, elem := range v.Elems {
+			dst = appendDescendants(dst, path.append(IndexSegment(i)), elem)
+		}
+	case Record:
+		for i, field := range v.Fields {
+			if i < len(v.Values) {
+				dst = appendDescendants(dst, path.append(FieldSegment(field.Name)), v.Values[i])
+			}
+		}
+	case Maybe:
+		if v.Value != nil {
+			dst = appendDescendants(dst, path, v.Value)
+		}
+	}
+	return dst
+}
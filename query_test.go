@@ -0,0 +1,210 @@
+package abi_test
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/renproject/abi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Queries", func() {
+	inputFields := []abi.RecordField{
+		{Name: "hash", Type: abi.TypeBytes32},
+		{Name: "index", Type: abi.TypeU32},
+	}
+	outputFields := []abi.RecordField{
+		{Name: "to", Type: abi.TypeBytes32},
+		{Name: "amount", Type: abi.TypeU256},
+	}
+	record := func(fields []abi.RecordField, values ...abi.Value) abi.Value {
+		r, err := abi.NewRecord(fields, values...)
+		if err != nil {
+			panic(err)
+		}
+		return r
+	}
+	list := func(desc abi.TypeDesc, elems ...abi.Value) abi.Value {
+		l, err := abi.NewList(desc, elems...)
+		if err != nil {
+			panic(err)
+		}
+		return l
+	}
+	tx := record(
+		[]abi.RecordField{
+			{Name: "memo", Type: abi.TypeString},
+			{Name: "inputs", Type: abi.TypeList},
+			{Name: "outputs", Type: abi.TypeList},
+		},
+		abi.String("memo"),
+		list(abi.DescOf(record(inputFields, abi.Bytes32{}, abi.NewU32(0))),
+			record(inputFields, abi.Bytes32{1}, abi.NewU32(0)),
+			record(inputFields, abi.Bytes32{2}, abi.NewU32(1)),
+		),
+		list(abi.DescOf(record(outputFields, abi.Bytes32{}, abi.NewU256FromInt(big.NewInt(0)))),
+			record(outputFields, abi.Bytes32{3}, abi.NewU256FromInt(big.NewInt(10))),
+			record(outputFields, abi.Bytes32{4}, abi.NewU256FromInt(big.NewInt(20))),
+			record(outputFields, abi.Bytes32{5}, abi.NewU256FromInt(big.NewInt(30))),
+		),
+	)
+
+	paths := func(results []abi.QueryResult) []string {
+		strs := make([]string, len(results))
+		for i, result := range results {
+			strs[i] = result.Path.String()
+		}
+		return strs
+	}
+
+	Context("when selecting fields and indices", func() {
+		It("should return the value at the path", func() {
+			results, err := abi.Query(tx, ".outputs[2].amount")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Path.String()).To(Equal(".outputs[2].amount"))
+			Expect(results[0].Value).To(Equal(abi.NewU256FromInt(big.NewInt(30))))
+		})
+
+		It("should return the value itself for the root", func() {
+			results, err := abi.Query(tx, ".")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Path).To(BeEmpty())
+			Expect(abi.Equal(results[0].Value, tx)).To(BeTrue())
+
+			results, err = abi.Query(abi.NewU8(1), ".")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results[0].Value).To(Equal(abi.NewU8(1)))
+		})
+
+		It("should select from a list at the root", func() {
+			results, err := abi.Query(list(abi.NewTypeDesc(abi.TypeU8), abi.NewU8(1), abi.NewU8(2)), "[1]")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Value).To(Equal(abi.NewU8(2)))
+		})
+	})
+
+	Context("when selecting with wildcards", func() {
+		It("should return every element of a list", func() {
+			results, err := abi.Query(tx, ".inputs[*].hash")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths(results)).To(Equal([]string{".inputs[0].hash", ".inputs[1].hash"}))
+			Expect(results[0].Value).To(Equal(abi.Bytes32{1}))
+			Expect(results[1].Value).To(Equal(abi.Bytes32{2}))
+		})
+
+		It("should return every field of a record", func() {
+			results, err := abi.Query(tx, ".outputs[0].*")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths(results)).To(Equal([]string{".outputs[0].to", ".outputs[0].amount"}))
+		})
+	})
+
+	Context("when selecting recursively", func() {
+		It("should return every value of a type in depth-first order", func() {
+			results, err := abi.Query(tx, "..[?type==b32]")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths(results)).To(Equal([]string{
+				".inputs[0].hash",
+				".inputs[1].hash",
+				".outputs[0].to",
+				".outputs[1].to",
+				".outputs[2].to",
+			}))
+			for _, result := range results {
+				Expect(result.Value.Type()).To(Equal(abi.TypeBytes32))
+			}
+		})
+
+		It("should return every value not of a type", func() {
+			results, err := abi.Query(tx, ".outputs[0]..[?type!=b32]")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths(results)).To(Equal([]string{".outputs[0]", ".outputs[0].amount"}))
+		})
+
+		It("should return every field with a name", func() {
+			results, err := abi.Query(tx, "..amount")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths(results)).To(Equal([]string{".outputs[0].amount", ".outputs[1].amount", ".outputs[2].amount"}))
+		})
+
+		It("should return the values of maybes with the path of the maybe", func() {
+			v := list(abi.NewMaybeDesc(abi.NewTypeDesc(abi.TypeU8)), abi.NewSome(abi.NewU8(1)), abi.NewNone(abi.NewTypeDesc(abi.TypeU8)))
+			results, err := abi.Query(v, "..[?type==u8]")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths(results)).To(Equal([]string{"[0]"}))
+			Expect(results[0].Value).To(Equal(abi.NewU8(1)))
+		})
+
+		It("should skip values that cannot be selected from", func() {
+			results, err := abi.Query(tx, ".inputs[*].amount")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results).To(BeEmpty())
+			results, err = abi.Query(tx, "..[5]")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results).To(BeEmpty())
+		})
+	})
+
+	Context("when a segment cannot be applied", func() {
+		It("should return an error that names the segment", func() {
+			for query, segment := range map[string]string{
+				".outputs[3].amount": "[3]",
+				".outputs[2].value":  ".value",
+				".memo.length":       ".length",
+				".memo[0]":           "[0]",
+				".memo[*]":           "[*]",
+			} {
+				_, err := abi.Query(tx, query)
+				Expect(err).To(HaveOccurred())
+				queryErr := abi.QueryError{}
+				Expect(errors.As(err, &queryErr)).To(BeTrue())
+				Expect(queryErr.Segment).To(Equal(segment))
+				Expect(err.Error()).To(ContainSubstring(segment))
+			}
+		})
+	})
+
+	Context("when a query is malformed", func() {
+		It("should return an error that names the segment", func() {
+			for query, offset := range map[string]int{
+				"":               0,
+				"outputs":        0,
+				".outputs[":      8,
+				".outputs[x]":    8,
+				".outputs[-1]":   8,
+				".outputs.":      8,
+				".outputs.1":     8,
+				"..[?type==u7]":  2,
+				"..[?name==b32]": 2,
+				"..[?type]":      2,
+			} {
+				_, err := abi.ParseSelector(query)
+				Expect(err).To(HaveOccurred(), query)
+				queryErr := abi.QueryError{}
+				Expect(errors.As(err, &queryErr)).To(BeTrue())
+				Expect(queryErr.Offset).To(Equal(offset), query)
+			}
+		})
+	})
+
+	Context("when reusing a selector", func() {
+		It("should select from every value", func() {
+			sel, err := abi.ParseSelector("[*].amount")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sel.String()).To(Equal("[*].amount"))
+			for _, outputs := range []abi.Value{
+				list(*abi.DescOf(tx.(abi.Record).Values[2]).Elem),
+				list(*abi.DescOf(tx.(abi.Record).Values[2]).Elem, record(outputFields, abi.Bytes32{}, abi.NewU256FromInt(big.NewInt(1)))),
+			} {
+				results, err := sel.Select(outputs)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(results).To(HaveLen(len(outputs.(abi.List).Elems)))
+			}
+		})
+	})
+})
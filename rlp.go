@@ -0,0 +1,614 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/renproject/surge"
+)
+
+// RLP prefixes as defined in the Ethereum Yellow Paper (Appendix B).
+const (
+	rlpStringOffset = 0x80
+	rlpListOffset   = 0xc0
+
+	// rlpShortMaxLen is the maximum payload length that can be encoded using
+	// the short form of a string/list header.
+	rlpShortMaxLen = 55
+)
+
+// An RLPMarshaler can be marshaled to RLP.
+type RLPMarshaler interface {
+	// MarshalRLP into an I/O writer. It accepts a maximum capacity of bytes
+	// that can be allocated, and returns the remaining capacity.
+	MarshalRLP(w io.Writer, m int) (int, error)
+}
+
+// An RLPUnmarshaler can be unmarshaled from RLP.
+type RLPUnmarshaler interface {
+	// UnmarshalRLP from an I/O reader. It accepts a maximum capacity of bytes
+	// that can be allocated, and returns the remaining capacity. It must not
+	// allocate more bytes than the maximum capacity.
+	UnmarshalRLP(r io.Reader, m int) (int, error)
+}
+
+// MarshalRLP marshals the String to RLP as a byte string.
+func (str String) MarshalRLP(w io.Writer, m int) (int, error) {
+	return rlpWriteString(w, []byte(str), m)
+}
+
+// UnmarshalRLP unmarshals the String from an RLP byte string. Unmarshaling
+// will not allocate more than the specified maximum number of bytes.
+func (str *String) UnmarshalRLP(r io.Reader, m int) (int, error) {
+	data, m, err := rlpReadString(r, m, m)
+	if err != nil {
+		return m, err
+	}
+	*str = String(data)
+	return m, nil
+}
+
+// MarshalRLP marshals the Bytes to RLP as a byte string.
+func (b Bytes) MarshalRLP(w io.Writer, m int) (int, error) {
+	return rlpWriteString(w, b, m)
+}
+
+// UnmarshalRLP unmarshals the Bytes from an RLP byte string. Unmarshaling will
+// not allocate more than the specified maximum number of bytes.
+func (b *Bytes) UnmarshalRLP(r io.Reader, m int) (int, error) {
+	data, m, err := rlpReadString(r, m, m)
+	if err != nil {
+		return m, err
+	}
+	*b = data
+	return m, nil
+}
+
+// MarshalRLP marshals the Bytes32 to RLP as a 32 byte string.
+func (b32 Bytes32) MarshalRLP(w io.Writer, m int) (int, error) {
+	return rlpWriteString(w, b32[:], m)
+}
+
+// UnmarshalRLP unmarshals the Bytes32 from an RLP byte string. An error is
+// returned if the byte string is not exactly 32 bytes long.
+func (b32 *Bytes32) UnmarshalRLP(r io.Reader, m int) (int, error) {
+	data, m, err := rlpReadString(r, m, m)
+	if err != nil {
+		return m, err
+	}
+	if len(data) != 32 {
+		return m, fmt.Errorf("expected len=32, got len=%v", len(data))
+	}
+	copy((*b32)[:], data)
+	return m, nil
+}
+
+// MarshalRLP marshals the Bytes65 to RLP as a 65 byte string.
+func (b65 Bytes65) MarshalRLP(w io.Writer, m int) (int, error) {
+	return rlpWriteString(w, b65[:], m)
+}
+
+// UnmarshalRLP unmarshals the Bytes65 from an RLP byte string. An error is
+// returned if the byte string is not exactly 65 bytes long.
+func (b65 *Bytes65) UnmarshalRLP(r io.Reader, m int) (int, error) {
+	data, m, err := rlpReadString(r, m, m)
+	if err != nil {
+		return m, err
+	}
+	if len(data) != 65 {
+		return m, fmt.Errorf("expected len=65, got len=%v", len(data))
+	}
+	copy((*b65)[:], data)
+	return m, nil
+}
+
+// MarshalRLP marshals the Bool to RLP. Bools are marshaled as the integers 0
+// and 1, which is consistent with Ethereum.
+func (b Bool) MarshalRLP(w io.Writer, m int) (int, error) {
+	if b.inner {
+		return rlpWriteUint(w, 1, m)
+	}
+	return rlpWriteUint(w, 0, m)
+}
+
+// UnmarshalRLP unmarshals the Bool from RLP. Only the integers 0 and 1 are
+// accepted.
+func (b *Bool) UnmarshalRLP(r io.Reader, m int) (int, error) {
+	x, m, err := rlpReadUint(r, 1, m)
+	if err != nil {
+		return m, err
+	}
+	if x > 1 {
+		return m, fmt.Errorf("non-exhaustive pattern: Bool(%v)", x)
+	}
+	b.inner = x == 1
+	return m, nil
+}
+
+// MarshalRLP marshals the U8 to RLP as a canonical integer.
+func (u8 U8) MarshalRLP(w io.Writer, m int) (int, error) {
+	return rlpWriteUint(w, uint64(u8.inner), m)
+}
+
+// UnmarshalRLP unmarshals the U8 from a canonical RLP integer.
+func (u8 *U8) UnmarshalRLP(r io.Reader, m int) (int, error) {
+	x, m, err := rlpReadUint(r, 1, m)
+	if err != nil {
+		return m, err
+	}
+	u8.inner = uint8(x)
+	return m, nil
+}
+
+// MarshalRLP marshals the U16 to RLP as a canonical integer.
+func (u16 U16) MarshalRLP(w io.Writer, m int) (int, error) {
+	return rlpWriteUint(w, uint64(u16.inner), m)
+}
+
+// UnmarshalRLP unmarshals the U16 from a canonical RLP integer.
+func (u16 *U16) UnmarshalRLP(r io.Reader, m int) (int, error) {
+	x, m, err := rlpReadUint(r, 2, m)
+	if err != nil {
+		return m, err
+	}
+	u16.inner = uint16(x)
+	return m, nil
+}
+
+// MarshalRLP marshals the U32 to RLP as a canonical integer.
+func (u32 U32) MarshalRLP(w io.Writer, m int) (int, error) {
+	return rlpWriteUint(w, uint64(u32.inner), m)
+}
+
+// UnmarshalRLP unmarshals the U32 from a canonical RLP integer.
+func (u32 *U32) UnmarshalRLP(r io.Reader, m int) (int, error) {
+	x, m, err := rlpReadUint(r, 4, m)
+	if err != nil {
+		return m, err
+	}
+	u32.inner = uint32(x)
+	return m, nil
+}
+
+// MarshalRLP marshals the U64 to RLP as a canonical integer.
+func (u64 U64) MarshalRLP(w io.Writer, m int) (int, error) {
+	return rlpWriteUint(w, u64.inner, m)
+}
+
+// UnmarshalRLP unmarshals the U64 from a canonical RLP integer.
+func (u64 *U64) UnmarshalRLP(r io.Reader, m int) (int, error) {
+	x, m, err := rlpReadUint(r, 8, m)
+	if err != nil {
+		return m, err
+	}
+	u64.inner = x
+	return m, nil
+}
+
+// MarshalRLP marshals the U128 to RLP as a canonical integer.
+func (u128 U128) MarshalRLP(w io.Writer, m int) (int, error) {
+	return rlpWriteBigInt(w, u128.inner, m)
+}
+
+// UnmarshalRLP unmarshals the U128 from a canonical RLP integer.
+func (u128 *U128) UnmarshalRLP(r io.Reader, m int) (int, error) {
+	if u128.inner == nil {
+		u128.inner = new(big.Int)
+	}
+	return rlpReadBigInt(r, u128.inner, 16, m)
+}
+
+// MarshalRLP marshals the U256 to RLP as a canonical integer.
+func (u256 U256) MarshalRLP(w io.Writer, m int) (int, error) {
+	return rlpWriteBigInt(w, u256.inner, m)
+}
+
+// UnmarshalRLP unmarshals the U256 from a canonical RLP integer.
+func (u256 *U256) UnmarshalRLP(r io.Reader, m int) (int, error) {
+	if u256.inner == nil {
+		u256.inner = new(big.Int)
+	}
+	return rlpReadBigInt(r, u256.inner, 32, m)
+}
+
+// MarshalRLPList marshals a slice of values to RLP as a list. The elements are
+// marshaled into an intermediate buffer so that the list header can be
+// written; this buffer is accounted for in the maximum number of bytes. Every
+// byte of the payload is counted exactly once, when it is buffered.
+func MarshalRLPList(w io.Writer, vs []RLPMarshaler, m int) (int, error) {
+	if m <= 0 {
+		return m, surge.ErrMaxBytesExceeded
+	}
+
+	buf := new(bytes.Buffer)
+	for _, v := range vs {
+		var err error
+		if m, err = v.MarshalRLP(buf, m); err != nil {
+			return m, err
+		}
+	}
+	m, err := rlpWriteHeader(w, rlpListOffset, buf.Len(), m)
+	if err != nil {
+		return m, err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// UnmarshalRLPList unmarshals an RLP list. The list header is read, and then
+// the function f is called repeatedly to unmarshal the elements until the
+// payload of the list has been fully consumed. The reader given to f is
+// limited to the remaining payload, so f cannot read past the end of the list.
+// The header is counted towards the maximum number of bytes, and the payload
+// is rejected before it is read if it is longer than the remaining budget.
+func UnmarshalRLPList(r io.Reader, m int, f func(r io.Reader, m int) (int, error)) (int, error) {
+	isList, size, _, m, err := rlpReadHeader(r, m)
+	if err != nil {
+		return m, err
+	}
+	if !isList {
+		return m, fmt.Errorf("non-canonical: expected rlp list, got rlp string")
+	}
+	if size >= uint64(m) {
+		return m, surge.ErrMaxBytesExceeded
+	}
+	lr := &io.LimitedReader{R: r, N: int64(size)}
+	for lr.N > 0 {
+		n := lr.N
+		if m, err = f(lr, m); err != nil {
+			return m, err
+		}
+		if lr.N == n {
+			return m, fmt.Errorf("malformed: rlp list element has no bytes")
+		}
+	}
+	return m, nil
+}
+
+// MarshalRLP marshals the List to RLP as a list of its elements.
+func (list List) MarshalRLP(w io.Writer, m int) (int, error) {
+	vs, err := rlpMarshalers(list.Elems)
+	if err != nil {
+		return m, err
+	}
+	return MarshalRLPList(w, vs, m)
+}
+
+// MarshalRLP marshals the Record to RLP as a list of the values of its fields,
+// in the order of the fields. The names of the fields are not marshaled, which
+// is consistent with the way that Ethereum marshals structs.
+func (record Record) MarshalRLP(w io.Writer, m int) (int, error) {
+	if len(record.Values) != len(record.Fields) {
+		return m, fmt.Errorf("expected len=%v, got len=%v", len(record.Fields), len(record.Values))
+	}
+	vs, err := rlpMarshalers(record.Values)
+	if err != nil {
+		return m, err
+	}
+	return MarshalRLPList(w, vs, m)
+}
+
+// MarshalRLP marshals the Maybe to RLP as a list that is empty if the value is
+// absent, and that contains only the value if it is present.
+func (maybe Maybe) MarshalRLP(w io.Writer, m int) (int, error) {
+	if maybe.Value == nil {
+		return MarshalRLPList(w, nil, m)
+	}
+	vs, err := rlpMarshalers([]Value{maybe.Value})
+	if err != nil {
+		return m, err
+	}
+	return MarshalRLPList(w, vs, m)
+}
+
+// UnmarshalRLPValue unmarshals a value described by the TypeDesc from RLP.
+// Lists, records and maybes are unmarshaled recursively, in the form written
+// by their MarshalRLP methods. The bytes that are read are counted towards the
+// maximum number of bytes, and the value is checked against the DefaultLimits
+// before anything is allocated for it.
+func UnmarshalRLPValue(r io.Reader, desc TypeDesc, m int) (Value, int, error) {
+	limits := DefaultLimits()
+	limits.MaxBytes = m
+	return UnmarshalRLPValueWithLimits(r, desc, limits)
+}
+
+// UnmarshalRLPValueWithLimits is the same as UnmarshalRLPValue, but checks the
+// value against the given Limits. The maximum number of bytes is taken from
+// the Limits.
+func UnmarshalRLPValueWithLimits(r io.Reader, desc TypeDesc, limits Limits) (Value, int, error) {
+	m := limits.MaxBytes
+	if err := desc.validate(nil); err != nil {
+		return nil, m, err
+	}
+	return rlpReadValue(r, desc, m, limits, 0)
+}
+
+// rlpMarshalers returns the values as RLPMarshalers. An error is returned if a
+// value cannot be marshaled to RLP.
+func rlpMarshalers(vs []Value) ([]RLPMarshaler, error) {
+	marshalers := make([]RLPMarshaler, len(vs))
+	for i, v := range vs {
+		marshaler, ok := v.(RLPMarshaler)
+		if !ok {
+			return nil, fmt.Errorf("non-exhaustive pattern: %T", v)
+		}
+		marshalers[i] = marshaler
+	}
+	return marshalers, nil
+}
+
+// rlpReadValue reads a value described by a well-formed TypeDesc at the given
+// depth from RLP, and checks it against the Limits.
+func rlpReadValue(r io.Reader, desc TypeDesc, m int, limits Limits, depth int) (Value, int, error) {
+	switch desc.Type {
+	case TypeString:
+		data, m, err := rlpReadString(r, m, limits.MaxStringLen)
+		if err != nil {
+			return nil, m, err
+		}
+		return String(data), m, nil
+
+	case TypeBytes:
+		data, m, err := rlpReadString(r, m, limits.MaxStringLen)
+		if err != nil {
+			return nil, m, err
+		}
+		return Bytes(data), m, nil
+
+	case TypeList:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		// The number of elements is not known until the payload has been
+		// read, so the length of the list is checked as each element is read.
+		elems := []Value{}
+		m, err := UnmarshalRLPList(r, m, func(r io.Reader, m int) (int, error) {
+			if err := limits.checkListLen(len(elems) + 1); err != nil {
+				return m, err
+			}
+			elem, m, err := rlpReadValue(r, *desc.Elem, m, limits, depth+1)
+			if err != nil {
+				return m, err
+			}
+			elems = append(elems, elem)
+			return m, nil
+		})
+		if err != nil {
+			return nil, m, err
+		}
+		return List{Elem: *desc.Elem, Elems: elems}, m, nil
+
+	case TypeRecord:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		if err := limits.checkRecordFields(len(desc.Fields)); err != nil {
+			return nil, m, err
+		}
+		fields := make([]RecordField, len(desc.Fields))
+		for i, field := range desc.Fields {
+			fields[i] = RecordField{Name: field.Name, Type: field.Desc.Type}
+		}
+		values := make([]Value, 0, len(desc.Fields))
+		m, err := UnmarshalRLPList(r, m, func(r io.Reader, m int) (int, error) {
+			if len(values) == len(desc.Fields) {
+				return m, fmt.Errorf("expected len=%v, got len>%v", len(desc.Fields), len(desc.Fields))
+			}
+			v, m, err := rlpReadValue(r, desc.Fields[len(values)].Desc, m, limits, depth+1)
+			if err != nil {
+				return m, err
+			}
+			values = append(values, v)
+			return m, nil
+		})
+		if err != nil {
+			return nil, m, err
+		}
+		if len(values) != len(desc.Fields) {
+			return nil, m, fmt.Errorf("expected len=%v, got len=%v", len(desc.Fields), len(values))
+		}
+		return Record{Fields: fields, Values: values}, m, nil
+
+	case TypeMaybe:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return nil, m, err
+		}
+		var v Value
+		m, err := UnmarshalRLPList(r, m, func(r io.Reader, m int) (int, error) {
+			if v != nil {
+				return m, fmt.Errorf("non-exhaustive pattern: Maybe with more than one value")
+			}
+			elem, m, err := rlpReadValue(r, *desc.Elem, m, limits, depth+1)
+			if err != nil {
+				return m, err
+			}
+			v = elem
+			return m, nil
+		})
+		if err != nil {
+			return nil, m, err
+		}
+		return Maybe{Elem: *desc.Elem, Value: v}, m, nil
+
+	default:
+		ptr, err := newPrimitive(desc.Type)
+		if err != nil {
+			return nil, m, err
+		}
+		if m, err = ptr.(RLPUnmarshaler).UnmarshalRLP(r, m); err != nil {
+			return nil, m, err
+		}
+		return pointee(ptr), m, nil
+	}
+}
+
+// rlpWriteHeader writes the header of an RLP string or list with a payload of
+// the given size. The offset must be rlpStringOffset or rlpListOffset.
+func rlpWriteHeader(w io.Writer, offset byte, size int, m int) (int, error) {
+	if size <= rlpShortMaxLen {
+		bs := [1]byte{offset + byte(size)}
+		return writeWithin(w, bs[:], m)
+	}
+	bs := [9]byte{}
+	binary.BigEndian.PutUint64(bs[1:], uint64(size))
+	lenOfLen := 8
+	for bs[9-lenOfLen] == 0 {
+		lenOfLen--
+	}
+	bs[8-lenOfLen] = offset + rlpShortMaxLen + byte(lenOfLen)
+	return writeWithin(w, bs[8-lenOfLen:], m)
+}
+
+// rlpWriteString writes an RLP byte string.
+func rlpWriteString(w io.Writer, data []byte, m int) (int, error) {
+	if len(data) == 1 && data[0] < rlpStringOffset {
+		return writeWithin(w, data, m)
+	}
+	m, err := rlpWriteHeader(w, rlpStringOffset, len(data), m)
+	if err != nil {
+		return m, err
+	}
+	return writeWithin(w, data, m)
+}
+
+// rlpWriteUint writes an unsigned integer as a canonical RLP byte string (big
+// endian, with no leading zeros).
+func rlpWriteUint(w io.Writer, x uint64, m int) (int, error) {
+	bs := [8]byte{}
+	binary.BigEndian.PutUint64(bs[:], x)
+	i := 0
+	for i < len(bs) && bs[i] == 0 {
+		i++
+	}
+	return rlpWriteString(w, bs[i:], m)
+}
+
+// rlpWriteBigInt writes a big integer as a canonical RLP byte string (big
+// endian, with no leading zeros). A nil integer is treated as zero.
+func rlpWriteBigInt(w io.Writer, x *big.Int, m int) (int, error) {
+	if x == nil {
+		return rlpWriteString(w, nil, m)
+	}
+	return rlpWriteString(w, x.Bytes(), m)
+}
+
+// rlpReadHeader reads the header of an RLP item and returns whether or not it
+// is a list, and the size of its payload. If the item is a single byte string
+// that is encoded as itself, then the size is 1 and the byte is returned. The
+// bytes of the header are counted towards the maximum number of bytes.
+// Non-canonical headers are rejected.
+func rlpReadHeader(r io.Reader, m int) (bool, uint64, []byte, int, error) {
+	bs := [1]byte{}
+	m, err := readWithin(r, bs[:], m)
+	if err != nil {
+		return false, 0, nil, m, err
+	}
+	prefix := bs[0]
+
+	switch {
+	case prefix < rlpStringOffset:
+		return false, 1, []byte{prefix}, m, nil
+	case prefix <= rlpStringOffset+rlpShortMaxLen:
+		return false, uint64(prefix - rlpStringOffset), nil, m, nil
+	case prefix < rlpListOffset:
+		size, m, err := rlpReadLongSize(r, int(prefix-rlpStringOffset-rlpShortMaxLen), m)
+		return false, size, nil, m, err
+	case prefix <= rlpListOffset+rlpShortMaxLen:
+		return true, uint64(prefix - rlpListOffset), nil, m, nil
+	default:
+		size, m, err := rlpReadLongSize(r, int(prefix-rlpListOffset-rlpShortMaxLen), m)
+		return true, size, nil, m, err
+	}
+}
+
+// rlpReadLongSize reads the big endian size of a long form RLP header.
+func rlpReadLongSize(r io.Reader, lenOfLen int, m int) (uint64, int, error) {
+	bs := [8]byte{}
+	m, err := readWithin(r, bs[8-lenOfLen:], m)
+	if err != nil {
+		return 0, m, err
+	}
+	if bs[8-lenOfLen] == 0 {
+		return 0, m, fmt.Errorf("non-canonical: rlp size has leading zeros")
+	}
+	size := binary.BigEndian.Uint64(bs[:])
+	if size <= rlpShortMaxLen {
+		return 0, m, fmt.Errorf("non-canonical: rlp size %v uses long form", size)
+	}
+	return size, m, nil
+}
+
+// rlpReadString reads an RLP byte string that is at most maxLen bytes long.
+// Unmarshaling will not allocate more than the specified maximum number of
+// bytes. Non-canonical encodings are rejected.
+func rlpReadString(r io.Reader, m int, maxLen int) ([]byte, int, error) {
+	isList, size, data, m, err := rlpReadHeader(r, m)
+	if err != nil {
+		return nil, m, err
+	}
+	if isList {
+		return nil, m, fmt.Errorf("non-canonical: expected rlp string, got rlp list")
+	}
+	if data == nil && size >= uint64(m) {
+		return nil, m, surge.ErrMaxBytesExceeded
+	}
+	if err := checkLimit("string len", maxLen, int(size)); err != nil {
+		return nil, m, err
+	}
+	if data != nil {
+		return data, m, nil
+	}
+	data = make([]byte, size)
+	if m, err = readWithin(r, data, m); err != nil {
+		return nil, m, err
+	}
+	if size == 1 && data[0] < rlpStringOffset {
+		return nil, m, fmt.Errorf("non-canonical: rlp byte %v has a header", data[0])
+	}
+	return data, m, nil
+}
+
+// rlpReadUint reads a canonical RLP integer that is at most n bytes long.
+func rlpReadUint(r io.Reader, n int, m int) (uint64, int, error) {
+	data, m, err := rlpReadString(r, m, m)
+	if err != nil {
+		return 0, m, err
+	}
+	if err := rlpCheckUint(data, n); err != nil {
+		return 0, m, err
+	}
+	bs := [8]byte{}
+	copy(bs[8-len(data):], data)
+	return binary.BigEndian.Uint64(bs[:]), m, nil
+}
+
+// rlpReadBigInt reads a canonical RLP integer that is at most n bytes long into
+// a big integer.
+func rlpReadBigInt(r io.Reader, x *big.Int, n int, m int) (int, error) {
+	data, m, err := rlpReadString(r, m, m)
+	if err != nil {
+		return m, err
+	}
+	if err := rlpCheckUint(data, n); err != nil {
+		return m, err
+	}
+	x.SetBytes(data)
+	return m, nil
+}
+
+// rlpCheckUint returns an error if the data is not a canonical integer of at
+// most n bytes.
+func rlpCheckUint(data []byte, n int) error {
+	if len(data) > n {
+		return fmt.Errorf("overflow: expected n<=%v, got n=%v", n, len(data))
+	}
+	if len(data) > 0 && data[0] == 0 {
+		return fmt.Errorf("non-canonical: rlp integer has leading zeros")
+	}
+	return nil
+}
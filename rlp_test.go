@@ -0,0 +1,318 @@
+package abi_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RLP", func() {
+	Context("when marshaling known values", func() {
+		It("should match the ethereum encoding", func() {
+			cases := []struct {
+				v        abi.RLPMarshaler
+				expected []byte
+			}{
+				{abi.NewU64(0), []byte{0x80}},
+				{abi.NewU64(15), []byte{0x0f}},
+				{abi.NewU64(1024), []byte{0x82, 0x04, 0x00}},
+				{abi.NewBool(true), []byte{0x01}},
+				{abi.NewBool(false), []byte{0x80}},
+				{abi.String(""), []byte{0x80}},
+				{abi.String("dog"), []byte{0x83, 'd', 'o', 'g'}},
+				{abi.Bytes{0x7f}, []byte{0x7f}},
+				{abi.Bytes{0x80}, []byte{0x81, 0x80}},
+				{abi.NewU256FromU64(abi.NewU64(0x0400)), []byte{0x82, 0x04, 0x00}},
+			}
+			for _, c := range cases {
+				buf := new(bytes.Buffer)
+				_, err := c.v.MarshalRLP(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Bytes()).To(Equal(c.expected))
+			}
+		})
+
+		It("should use the long form for strings longer than 55 bytes", func() {
+			buf := new(bytes.Buffer)
+			_, err := abi.Bytes(make([]byte, 56)).MarshalRLP(buf, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Bytes()[:2]).To(Equal([]byte{0xb8, 56}))
+			Expect(buf.Len()).To(Equal(58))
+		})
+
+		It("should match the ethereum encoding of lists", func() {
+			buf := new(bytes.Buffer)
+			_, err := abi.MarshalRLPList(buf, []abi.RLPMarshaler{abi.String("cat"), abi.String("dog")}, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Bytes()).To(Equal([]byte{0xc8, 0x83, 'c', 'a', 't', 0x83, 'd', 'o', 'g'}))
+		})
+	})
+
+	Context("when marshaling and unmarshaling", func() {
+		It("should equal itself", func() {
+			f := func(x uint64, y [32]byte, z []byte, b bool) bool {
+				u64 := abi.NewU64(x)
+				u256 := abi.NewU256(y)
+				b32 := abi.Bytes32(y)
+				bs := abi.Bytes(z)
+				bl := abi.NewBool(b)
+
+				buf := new(bytes.Buffer)
+				for _, v := range []abi.RLPMarshaler{u64, u256, b32, bs, bl} {
+					_, err := v.MarshalRLP(buf, abi.MaxBytes)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				u64Out := abi.U64{}
+				u256Out := abi.U256{}
+				b32Out := abi.Bytes32{}
+				bsOut := abi.Bytes{}
+				blOut := abi.Bool{}
+				for _, v := range []abi.RLPUnmarshaler{&u64Out, &u256Out, &b32Out, &bsOut, &blOut} {
+					_, err := v.UnmarshalRLP(buf, abi.MaxBytes)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				Expect(u64Out).To(Equal(u64))
+				Expect(u256Out.Equal(u256)).To(BeTrue())
+				Expect(b32Out).To(Equal(b32))
+				Expect(bytes.Equal(bsOut, bs)).To(BeTrue())
+				Expect(blOut).To(Equal(bl))
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should equal itself when in a list", func() {
+			f := func(xs []uint32) bool {
+				vs := make([]abi.RLPMarshaler, len(xs))
+				for i := range xs {
+					vs[i] = abi.NewU32(xs[i])
+				}
+				buf := new(bytes.Buffer)
+				_, err := abi.MarshalRLPList(buf, vs, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+
+				ys := []abi.U32{}
+				_, err = abi.UnmarshalRLPList(buf, abi.MaxBytes, func(r io.Reader, m int) (int, error) {
+					y := abi.U32{}
+					m, err := y.UnmarshalRLP(r, m)
+					ys = append(ys, y)
+					return m, err
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ys).To(HaveLen(len(xs)))
+				for i := range xs {
+					Expect(ys[i].Uint32()).To(Equal(xs[i]))
+				}
+				return true
+			}
+
+			err := quick.Check(f, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when marshaling composite values", func() {
+		It("should match the ethereum encoding", func() {
+			cases := []struct {
+				text     string
+				expected []byte
+			}{
+				{`list<u8>[u8(1), u8(2)]`, []byte{0xc2, 0x01, 0x02}},
+				{`list<u8>[]`, []byte{0xc0}},
+				{`record{a: u8(1), b: str("dog")}`, []byte{0xc5, 0x01, 0x83, 'd', 'o', 'g'}},
+				{`maybe<u8>(none)`, []byte{0xc0}},
+				{`maybe<u8>(u8(1))`, []byte{0xc1, 0x01}},
+				{`maybe<maybe<u8>>(maybe<u8>(none))`, []byte{0xc1, 0xc0}},
+			}
+			for _, c := range cases {
+				v := abi.MustParseText(c.text)
+				buf := new(bytes.Buffer)
+				_, err := v.(abi.RLPMarshaler).MarshalRLP(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Bytes()).To(Equal(c.expected), c.text)
+
+				w, _, err := abi.UnmarshalRLPValue(bytes.NewReader(c.expected), abi.DescOf(v), abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(abi.Equal(v, w)).To(BeTrue(), c.text)
+			}
+		})
+
+		It("should equal itself", func() {
+			f := func(desc abi.TypeDesc, seed int64) bool {
+				v := abi.RandomValue(rand.New(rand.NewSource(seed)), desc)
+				buf := new(bytes.Buffer)
+				_, err := v.(abi.RLPMarshaler).MarshalRLP(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+
+				w, m, err := abi.UnmarshalRLPValue(buf, desc, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(abi.Equal(v, w)).To(BeTrue())
+				Expect(buf.Len()).To(Equal(0))
+				Expect(m).To(BeNumerically("<", abi.MaxBytes))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should return an error for records and maybes that do not match", func() {
+			record := abi.NewRecordDesc(
+				abi.FieldDesc{Name: "a", Desc: abi.NewTypeDesc(abi.TypeU8)},
+				abi.FieldDesc{Name: "b", Desc: abi.NewTypeDesc(abi.TypeU8)},
+			)
+			maybe := abi.NewMaybeDesc(abi.NewTypeDesc(abi.TypeU8))
+			cases := []struct {
+				desc abi.TypeDesc
+				data []byte
+			}{
+				{record, []byte{0xc1, 0x01}},             // Missing field
+				{record, []byte{0xc3, 0x01, 0x02, 0x03}}, // Extra field
+				{record, []byte{0x82, 0x01, 0x02}},       // String instead of list
+				{maybe, []byte{0xc2, 0x01, 0x02}},        // More than one value
+			}
+			for _, c := range cases {
+				_, _, err := abi.UnmarshalRLPValue(bytes.NewReader(c.data), c.desc, abi.MaxBytes)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+
+		It("should check lists against the limits", func() {
+			// A list with a three byte long form header, and one more element
+			// than is allowed.
+			n := abi.DefaultLimits().MaxListLen + 1
+			data := []byte{0xfa, byte(n >> 16), byte(n >> 8), byte(n)}
+			data = append(data, bytes.Repeat([]byte{0x01}, n)...)
+			_, _, err := abi.UnmarshalRLPValue(bytes.NewReader(data), abi.NewListDesc(abi.NewTypeDesc(abi.TypeU8)), abi.MaxBytes)
+			Expect(err).To(BeAssignableToTypeOf(abi.LimitError{}))
+		})
+	})
+
+	Context("when marshaling and unmarshaling composite values with a limited budget", func() {
+		It("should count every byte towards the budget exactly once", func() {
+			for _, v := range []abi.Value{
+				abi.MustParseText(`list<u8>[u8(1), u8(200)]`),
+				abi.MustParseText(`record{a: bool(true), b: list<u8>[u8(1), u8(200)], c: maybe<str>(str("x"))}`),
+				abi.MustParseText(`list<list<str>>[list<str>[str("cat"), str("dog")], list<str>[]]`),
+			} {
+				buf := new(bytes.Buffer)
+				_, err := v.(abi.RLPMarshaler).MarshalRLP(buf, abi.MaxBytes)
+				Expect(err).ToNot(HaveOccurred())
+				n := buf.Len()
+
+				m, err := v.(abi.RLPMarshaler).MarshalRLP(new(bytes.Buffer), n+1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m).To(Equal(1))
+				_, err = v.(abi.RLPMarshaler).MarshalRLP(new(bytes.Buffer), n)
+				Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+				_, m, err = abi.UnmarshalRLPValue(bytes.NewReader(buf.Bytes()), abi.DescOf(v), n+1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m).To(Equal(1))
+				_, _, err = abi.UnmarshalRLPValue(bytes.NewReader(buf.Bytes()), abi.DescOf(v), n)
+				Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			}
+		})
+	})
+
+	Context("when unmarshaling non-canonical encodings", func() {
+		It("should return an error", func() {
+			cases := [][]byte{
+				{0x82, 0x00, 0x01},       // Integer with leading zeros
+				{0x81, 0x05},             // Single byte with a header
+				{0xb8, 0x02, 0x01, 0x02}, // Long form for a short string
+				{0xb9, 0x00, 0x38},       // Size with leading zeros
+				{0xc0},                   // List instead of string
+			}
+			for _, c := range cases {
+				u64 := abi.U64{}
+				_, err := u64.UnmarshalRLP(bytes.NewReader(c), abi.MaxBytes)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+
+		It("should return an error for integers that overflow", func() {
+			u8 := abi.U8{}
+			_, err := u8.UnmarshalRLP(bytes.NewReader([]byte{0x82, 0x01, 0x00}), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+
+			b := abi.Bool{}
+			_, err = b.UnmarshalRLP(bytes.NewReader([]byte{0x02}), abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error for byte arrays of the wrong length", func() {
+			buf := new(bytes.Buffer)
+			_, err := abi.Bytes(make([]byte, 31)).MarshalRLP(buf, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+
+			b32 := abi.Bytes32{}
+			_, err = b32.UnmarshalRLP(buf, abi.MaxBytes)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when unmarshaling strings that are too long", func() {
+		It("should not allocate and should return an error", func() {
+			data := []byte{0xbb, 0x7f, 0xff, 0xff, 0xff}
+			b := abi.Bytes{}
+			_, err := b.UnmarshalRLP(bytes.NewReader(data), 1024)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+			Expect(b).To(BeEmpty())
+		})
+	})
+
+	Context("when unmarshaling lists that are too long", func() {
+		It("should return an error before reading the payload", func() {
+			for _, data := range [][]byte{
+				{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+				{0xff, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+				{0xfb, 0x7f, 0xff, 0xff, 0xff},
+			} {
+				called := false
+				_, err := abi.UnmarshalRLPList(bytes.NewReader(data), 1024, func(r io.Reader, m int) (int, error) {
+					called = true
+					return m, nil
+				})
+				Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+				Expect(called).To(BeFalse())
+			}
+		})
+	})
+
+	Context("when unmarshaling with a limited budget", func() {
+		It("should count the header towards the budget", func() {
+			u8 := abi.U8{}
+			m, err := u8.UnmarshalRLP(bytes.NewReader([]byte{0x05}), 2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m).To(Equal(1))
+			_, err = u8.UnmarshalRLP(bytes.NewReader([]byte{0x05}), 1)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+			// A two byte header and a 56 byte payload.
+			data := append([]byte{0xb8, 0x38}, make([]byte, 56)...)
+			b := abi.Bytes{}
+			m, err = b.UnmarshalRLP(bytes.NewReader(data), 59)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m).To(Equal(1))
+			_, err = b.UnmarshalRLP(bytes.NewReader(data), 58)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+		})
+
+		It("should return an error for elements that consume no bytes", func() {
+			_, err := abi.UnmarshalRLPList(bytes.NewReader([]byte{0xc1, 0x01}), 1024, func(r io.Reader, m int) (int, error) {
+				return m, nil
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -45,14 +45,14 @@ func (b Bool) SizeHint() int {
 // the specified maximum number of bytes. If it needs to allocate too many
 // bytes, and error may be returned instead.
 func (b Bool) Marshal(w io.Writer, m int) (int, error) {
-	return surge.Marshal(w, b.inner, m)
+	return marshalWithin(w, b.inner, b.SizeHint(), m)
 }
 
 // Unmarshal the Bool from binary. Unmarshaling will not allocate more than the
 // specified maximum number of bytes. If it needs to allocate too many bytes,
 // and error is returned instead.
 func (b *Bool) Unmarshal(r io.Reader, m int) (int, error) {
-	return surge.Unmarshal(r, &b.inner, m)
+	return unmarshalWithin(r, &b.inner, b.SizeHint(), m)
 }
 
 // MarshalJSON implements the JSON marshaler interface. Bools are marshaled as
@@ -145,14 +145,14 @@ func (u8 U8) SizeHint() int {
 // the specified maximum number of bytes. If it needs to allocate too many
 // bytes, and error may be returned instead.
 func (u8 U8) Marshal(w io.Writer, m int) (int, error) {
-	return surge.Marshal(w, u8.inner, m)
+	return marshalWithin(w, u8.inner, u8.SizeHint(), m)
 }
 
 // Unmarshal the U8 from binary. Unmarshaling will not allocate more than the
 // specified maximum number of bytes. If it needs to allocate too many bytes,
 // and error is returned instead.
 func (u8 *U8) Unmarshal(r io.Reader, m int) (int, error) {
-	return surge.Unmarshal(r, &u8.inner, m)
+	return unmarshalWithin(r, &u8.inner, u8.SizeHint(), m)
 }
 
 // MarshalJSON implements the JSON marshaler interface. U8s are marshaled as
@@ -256,14 +256,14 @@ func (u16 U16) SizeHint() int {
 // the specified maximum number of bytes. If it needs to allocate too many
 // bytes, and error may be returned instead.
 func (u16 U16) Marshal(w io.Writer, m int) (int, error) {
-	return surge.Marshal(w, u16.inner, m)
+	return marshalWithin(w, u16.inner, u16.SizeHint(), m)
 }
 
 // Unmarshal the U16 from binary. Unmarshaling will not allocate more than the
 // specified maximum number of bytes. If it needs to allocate too many bytes,
 // and error is returned instead.
 func (u16 *U16) Unmarshal(r io.Reader, m int) (int, error) {
-	return surge.Unmarshal(r, &u16.inner, m)
+	return unmarshalWithin(r, &u16.inner, u16.SizeHint(), m)
 }
 
 // MarshalJSON implements the JSON marshaler interface. U16s are marshaled as
@@ -279,7 +279,7 @@ func (u16 *U16) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &str); err != nil {
 		return err
 	}
-	x, err := strconv.ParseUint(str, 10, 8)
+	x, err := strconv.ParseUint(str, 10, 16)
 	if err != nil {
 		return err
 	}
@@ -372,14 +372,14 @@ func (u32 U32) SizeHint() int {
 // the specified maximum number of bytes. If it needs to allocate too many
 // bytes, and error may be returned instead.
 func (u32 U32) Marshal(w io.Writer, m int) (int, error) {
-	return surge.Marshal(w, u32.inner, m)
+	return marshalWithin(w, u32.inner, u32.SizeHint(), m)
 }
 
 // Unmarshal the U32 from binary. Unmarshaling will not allocate more than the
 // specified maximum number of bytes. If it needs to allocate too many bytes,
 // and error is returned instead.
 func (u32 *U32) Unmarshal(r io.Reader, m int) (int, error) {
-	return surge.Unmarshal(r, &u32.inner, m)
+	return unmarshalWithin(r, &u32.inner, u32.SizeHint(), m)
 }
 
 // MarshalJSON implements the JSON marshaler interface. U32s are marshaled as
@@ -395,7 +395,7 @@ func (u32 *U32) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &str); err != nil {
 		return err
 	}
-	x, err := strconv.ParseUint(str, 10, 8)
+	x, err := strconv.ParseUint(str, 10, 32)
 	if err != nil {
 		return err
 	}
@@ -493,14 +493,14 @@ func (u64 U64) SizeHint() int {
 // the specified maximum number of bytes. If it needs to allocate too many
 // bytes, and error may be returned instead.
 func (u64 U64) Marshal(w io.Writer, m int) (int, error) {
-	return surge.Marshal(w, u64.inner, m)
+	return marshalWithin(w, u64.inner, u64.SizeHint(), m)
 }
 
 // Unmarshal the U64 from binary. Unmarshaling will not allocate more than the
 // specified maximum number of bytes. If it needs to allocate too many bytes,
 // and error is returned instead.
 func (u64 *U64) Unmarshal(r io.Reader, m int) (int, error) {
-	return surge.Unmarshal(r, &u64.inner, m)
+	return unmarshalWithin(r, &u64.inner, u64.SizeHint(), m)
 }
 
 // MarshalJSON implements the JSON marshaler interface. U64s are marshaled as
@@ -516,7 +516,7 @@ func (u64 *U64) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &str); err != nil {
 		return err
 	}
-	x, err := strconv.ParseUint(str, 10, 8)
+	x, err := strconv.ParseUint(str, 10, 64)
 	if err != nil {
 		return err
 	}
@@ -623,34 +623,25 @@ func (u128 U128) SizeHint() int {
 }
 
 func (u128 U128) Marshal(w io.Writer, m int) (int, error) {
-	if m <= 0 {
-		return m, surge.ErrMaxBytesExceeded
-	}
-
 	b16 := paddedTo16(u128.inner)
-	n, err := w.Write(b16[:])
-	return m - n, err
+	return writeWithin(w, b16[:], m)
 }
 
 func (u128 *U128) Unmarshal(r io.Reader, m int) (int, error) {
-	if m <= 0 {
+	// The budget is checked before the buffer is allocated.
+	if m <= u128.SizeHint() {
 		return m, surge.ErrMaxBytesExceeded
 	}
 
 	b16 := [16]byte{}
-	n, err := io.ReadFull(r, b16[:])
-	if err != nil {
+	if _, err := io.ReadFull(r, b16[:]); err != nil {
 		return m, err
 	}
-	m -= n
-	if m <= 0 {
-		return m, surge.ErrMaxBytesExceeded
-	}
 	if u128.inner == nil {
 		u128.inner = new(big.Int)
 	}
 	u128.inner.SetBytes(b16[:])
-	return m, err
+	return m - u128.SizeHint(), nil
 }
 
 func (u128 U128) MarshalJSON() ([]byte, error) {
@@ -781,34 +772,25 @@ func (u256 U256) SizeHint() int {
 }
 
 func (u256 U256) Marshal(w io.Writer, m int) (int, error) {
-	if m <= 0 {
-		return m, surge.ErrMaxBytesExceeded
-	}
-
 	b32 := paddedTo32(u256.inner)
-	n, err := w.Write(b32[:])
-	return m - n, err
+	return writeWithin(w, b32[:], m)
 }
 
 func (u256 *U256) Unmarshal(r io.Reader, m int) (int, error) {
-	if m <= 0 {
+	// The budget is checked before the buffer is allocated.
+	if m <= u256.SizeHint() {
 		return m, surge.ErrMaxBytesExceeded
 	}
 
 	b32 := [32]byte{}
-	n, err := io.ReadFull(r, b32[:])
-	if err != nil {
+	if _, err := io.ReadFull(r, b32[:]); err != nil {
 		return m, err
 	}
-	m -= n
-	if m <= 0 {
-		return m, surge.ErrMaxBytesExceeded
-	}
 	if u256.inner == nil {
 		u256.inner = new(big.Int)
 	}
 	u256.inner.SetBytes(b32[:])
-	return m, err
+	return m - u256.SizeHint(), nil
 }
 
 func (u256 U256) MarshalJSON() ([]byte, error) {
@@ -840,12 +822,25 @@ func (u256 U256) String() string {
 	return u256.inner.Text(10)
 }
 
+// bytes32 returns the U256 as a big endian 32 byte word. A nil integer is
+// treated as zero.
+func (u256 U256) bytes32() Bytes32 {
+	if u256.inner == nil {
+		return Bytes32{}
+	}
+	return Bytes32(paddedTo32(u256.inner))
+}
+
 // paddedTo16 encodes a big integer as a big-endian into a 16-byte array. It
 // will panic if the big integer is more than 16 bytes.
 // Modified from:
 // https://github.com/ethereum/go-ethereum/blob/master/common/math/big.go
 // 17381ecc6695ea9c2d8e5ee0aee5cf70d59a301a
 func paddedTo16(bigint *big.Int) [16]byte {
+	if bigint == nil {
+		// The zero value of a U128 or U256 is zero.
+		return [16]byte{}
+	}
 	if bigint.BitLen()/8 > 16 {
 		panic(fmt.Sprintf("too big: expected n<16, got n=%v", bigint.BitLen()/8))
 	}
@@ -860,6 +855,10 @@ func paddedTo16(bigint *big.Int) [16]byte {
 // https://github.com/ethereum/go-ethereum/blob/master/common/math/big.go
 // 17381ecc6695ea9c2d8e5ee0aee5cf70d59a301a
 func paddedTo32(bigint *big.Int) [32]byte {
+	if bigint == nil {
+		// The zero value of a U128 or U256 is zero.
+		return [32]byte{}
+	}
 	if bigint.BitLen()/8 > 32 {
 		panic(fmt.Sprintf("too big: expected n<32, got n=%v", bigint.BitLen()/8))
 	}
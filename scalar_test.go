@@ -5,6 +5,7 @@ import (
 	"testing/quick"
 
 	"github.com/renproject/abi"
+	"github.com/renproject/surge"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -228,6 +229,20 @@ var _ = Describe("128-bit unsigned integer", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 	})
+
+	Context("when unmarshaling with a maximum number of bytes", func() {
+		It("should return an error when no bytes remain", func() {
+			data := make([]byte, 16)
+
+			z := abi.U128{}
+			_, err := z.Unmarshal(bytes.NewReader(data), 16)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+			m, err := z.Unmarshal(bytes.NewReader(data), 17)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m).To(Equal(1))
+		})
+	})
 })
 
 var _ = Describe("256-bit unsigned integer", func() {
@@ -272,4 +287,18 @@ var _ = Describe("256-bit unsigned integer", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 	})
+
+	Context("when unmarshaling with a maximum number of bytes", func() {
+		It("should return an error when no bytes remain", func() {
+			data := make([]byte, 32)
+
+			z := abi.U256{}
+			_, err := z.Unmarshal(bytes.NewReader(data), 32)
+			Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+			m, err := z.Unmarshal(bytes.NewReader(data), 33)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m).To(Equal(1))
+		})
+	})
 })
@@ -0,0 +1,255 @@
+package abi
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// A Signature is a recoverable secp256k1 ECDSA signature, represented as
+// r‖s‖v where r and s are 32 byte big endian integers and v is the recovery ID.
+// Signatures use the raw convention (v is 0 or 1). Ethereum signatures (v is
+// 27 or 28) can be converted using NewSignatureFromEthereum.
+type Signature struct {
+	Bytes65
+}
+
+// NewSignature returns a Signature from its components. An error is returned
+// if the recovery ID is not 0 or 1.
+func NewSignature(r, s U256, v uint8) (Signature, error) {
+	if v > 1 {
+		return Signature{}, fmt.Errorf("expected v=0 or v=1, got v=%v", v)
+	}
+	sig := Signature{}
+	rBytes, sBytes := r.bytes32(), s.bytes32()
+	copy(sig.Bytes65[:32], rBytes[:])
+	copy(sig.Bytes65[32:64], sBytes[:])
+	sig.Bytes65[64] = v
+	return sig, nil
+}
+
+// NewSignatureFromEthereum returns a Signature from a signature that uses the
+// Ethereum convention (v is 27 or 28). An error is returned if v is not 27 or
+// 28.
+func NewSignatureFromEthereum(b65 Bytes65) (Signature, error) {
+	if b65[64] != 27 && b65[64] != 28 {
+		return Signature{}, fmt.Errorf("expected v=27 or v=28, got v=%v", b65[64])
+	}
+	sig := Signature{Bytes65: b65}
+	sig.Bytes65[64] -= 27
+	return sig, nil
+}
+
+// Ethereum returns the signature using the Ethereum convention (v is 27 or
+// 28).
+func (sig Signature) Ethereum() Bytes65 {
+	b65 := sig.Bytes65
+	b65[64] += 27
+	return b65
+}
+
+// R returns the r component of the signature.
+func (sig Signature) R() U256 {
+	r := [32]byte{}
+	copy(r[:], sig.Bytes65[:32])
+	return NewU256(r)
+}
+
+// S returns the s component of the signature.
+func (sig Signature) S() U256 {
+	s := [32]byte{}
+	copy(s[:], sig.Bytes65[32:64])
+	return NewU256(s)
+}
+
+// V returns the recovery ID of the signature.
+func (sig Signature) V() uint8 {
+	return sig.Bytes65[64]
+}
+
+// IsLowS returns true if s is no greater than half of the curve order. Only
+// low-s signatures are accepted by Validate, which prevents signature
+// malleability.
+func (sig Signature) IsLowS() bool {
+	return sig.S().inner.Cmp(secp256k1HalfN) <= 0
+}
+
+// Normalize returns the equivalent low-s signature. If s is greater than half
+// of the curve order, s is replaced by n-s and the recovery ID is flipped. An
+// error is returned if r or s is not in the range [1, n-1], or if v is not 0
+// or 1, because there is no equivalent low-s signature.
+func (sig Signature) Normalize() (Signature, error) {
+	if err := sig.checkRange(); err != nil {
+		return Signature{}, err
+	}
+	if sig.IsLowS() {
+		return sig, nil
+	}
+	s := NewU256FromInt(new(big.Int).Sub(secp256k1N, sig.S().inner)).bytes32()
+	copy(sig.Bytes65[32:64], s[:])
+	sig.Bytes65[64] ^= 1
+	return sig, nil
+}
+
+// Validate returns an error if the signature is not canonical: r and s must be
+// in the range [1, n-1], s must be low, and v must be 0 or 1.
+func (sig Signature) Validate() error {
+	if err := sig.checkRange(); err != nil {
+		return err
+	}
+	if !sig.IsLowS() {
+		return fmt.Errorf("malformed: s is not low")
+	}
+	return nil
+}
+
+// checkRange returns an error if r or s is not in the range [1, n-1], or if v
+// is not 0 or 1.
+func (sig Signature) checkRange() error {
+	r, s := sig.R().inner, sig.S().inner
+	if r.Sign() == 0 || r.Cmp(secp256k1N) >= 0 {
+		return fmt.Errorf("malformed: r is out of range")
+	}
+	if s.Sign() == 0 || s.Cmp(secp256k1N) >= 0 {
+		return fmt.Errorf("malformed: s is out of range")
+	}
+	if sig.V() > 1 {
+		return fmt.Errorf("expected v=0 or v=1, got v=%v", sig.V())
+	}
+	return nil
+}
+
+// Recover the public key that signed the digest. The public key is returned in
+// its uncompressed form (0x04‖x‖y). An error is returned if the signature is
+// not valid, or if no public key can be recovered.
+func (sig Signature) Recover(digest Bytes32) (Bytes65, error) {
+	if err := sig.Validate(); err != nil {
+		return Bytes65{}, err
+	}
+	r, s := sig.R().inner, sig.S().inner
+
+	// Recover the point R from its x-coordinate and the parity of its
+	// y-coordinate.
+	ry, ok := secp256k1Y(r, sig.V()&1 == 1)
+	if !ok {
+		return Bytes65{}, fmt.Errorf("malformed: r is not on the curve")
+	}
+	point := &secp256k1Point{x: new(big.Int).Set(r), y: ry}
+
+	// Q = r^-1 (sR - eG)
+	e := new(big.Int).SetBytes(digest[:])
+	e.Mod(e, secp256k1N)
+	rInv := new(big.Int).ModInverse(r, secp256k1N)
+	u1 := new(big.Int).Neg(e)
+	u1.Mul(u1, rInv)
+	u1.Mod(u1, secp256k1N)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, secp256k1N)
+	q := secp256k1Add(secp256k1Mul(secp256k1G, u1), secp256k1Mul(point, u2))
+	if q == nil {
+		return Bytes65{}, fmt.Errorf("malformed: public key is the point at infinity")
+	}
+
+	pubKey := Bytes65{}
+	pubKey[0] = 0x04
+	x, y := paddedTo32(q.x), paddedTo32(q.y)
+	copy(pubKey[1:33], x[:])
+	copy(pubKey[33:], y[:])
+	return pubKey, nil
+}
+
+// secp256k1Point is an affine point on the secp256k1 curve. The point at
+// infinity is represented by nil.
+type secp256k1Point struct {
+	x, y *big.Int
+}
+
+var (
+	secp256k1P, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+	secp256k1N, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1)
+	secp256k1G     = func() *secp256k1Point {
+		x, _ := new(big.Int).SetString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", 16)
+		y, _ := new(big.Int).SetString("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8", 16)
+		return &secp256k1Point{x: x, y: y}
+	}()
+)
+
+// secp256k1Y returns the y-coordinate of the point with the given
+// x-coordinate, with the given parity. Returns false if there is no such
+// point.
+func secp256k1Y(x *big.Int, odd bool) (*big.Int, bool) {
+	// y^2 = x^3 + 7
+	y2 := new(big.Int).Exp(x, big.NewInt(3), secp256k1P)
+	y2.Add(y2, big.NewInt(7))
+	y2.Mod(y2, secp256k1P)
+
+	// p = 3 mod 4, so the square root is y^((p+1)/4).
+	exp := new(big.Int).Add(secp256k1P, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y := new(big.Int).Exp(y2, exp, secp256k1P)
+	if new(big.Int).Exp(y, big.NewInt(2), secp256k1P).Cmp(y2) != 0 {
+		return nil, false
+	}
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(secp256k1P, y)
+	}
+	return y, true
+}
+
+// secp256k1Add returns the sum of two points.
+func secp256k1Add(a, b *secp256k1Point) *secp256k1Point {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	lambda := new(big.Int)
+	if a.x.Cmp(b.x) == 0 {
+		if new(big.Int).Add(a.y, b.y).Cmp(secp256k1P) == 0 || a.y.Sign() == 0 {
+			return nil
+		}
+		// lambda = 3x^2 / 2y
+		lambda.Mul(a.x, a.x)
+		lambda.Mul(lambda, big.NewInt(3))
+		denom := new(big.Int).Lsh(a.y, 1)
+		denom.ModInverse(denom, secp256k1P)
+		lambda.Mul(lambda, denom)
+	} else {
+		// lambda = (y2 - y1) / (x2 - x1)
+		lambda.Sub(b.y, a.y)
+		denom := new(big.Int).Sub(b.x, a.x)
+		denom.Mod(denom, secp256k1P)
+		denom.ModInverse(denom, secp256k1P)
+		lambda.Mul(lambda, denom)
+	}
+	lambda.Mod(lambda, secp256k1P)
+
+	// x3 = lambda^2 - x1 - x2
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, a.x)
+	x.Sub(x, b.x)
+	x.Mod(x, secp256k1P)
+
+	// y3 = lambda (x1 - x3) - y1
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, lambda)
+	y.Sub(y, a.y)
+	y.Mod(y, secp256k1P)
+
+	return &secp256k1Point{x: x, y: y}
+}
+
+// secp256k1Mul returns the product of a point and a scalar, using
+// double-and-add.
+func secp256k1Mul(a *secp256k1Point, k *big.Int) *secp256k1Point {
+	var ret *secp256k1Point
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		ret = secp256k1Add(ret, ret)
+		if k.Bit(i) == 1 {
+			ret = secp256k1Add(ret, a)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,118 @@
+package abi_test
+
+import (
+	"encoding/hex"
+	"math/big"
+
+	"github.com/renproject/abi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signature", func() {
+	mustDecode := func(str string) []byte {
+		data, err := hex.DecodeString(str)
+		Expect(err).ToNot(HaveOccurred())
+		return data
+	}
+
+	// Test vector from go-ethereum (crypto/signature_test.go).
+	digest := abi.Bytes32{}
+	ethSig := abi.Bytes65{}
+	pubKey := abi.Bytes65{}
+	BeforeEach(func() {
+		copy(digest[:], mustDecode("ce0677bb30baa8cf067c88db9811f4333d131bf8bcf12fe7065d211dce971008"))
+		copy(ethSig[:], mustDecode("90f27b8b488db00b00606796d2987f6a5f59ae62ea05effe84fef5b8b0e549984a691139ad57a3f0b906637673aa2f63d1f55cb1a69199d4009eea23ceaddc931c"))
+		copy(pubKey[:], mustDecode("04e32df42865e97135acfb65f3bae71bdc86f4d49150ad6a440b6f15878109880a0a2b2667f7e725ceea70c673093bf67663e0312623c8e091b13cf2c0f11ef652"))
+	})
+
+	Context("when recovering a public key", func() {
+		It("should return the public key of the signer", func() {
+			sig, err := abi.NewSignatureFromEthereum(ethSig)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sig.V()).To(Equal(uint8(1)))
+
+			recovered, err := sig.Recover(digest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(recovered).To(Equal(pubKey))
+		})
+
+		It("should not return the public key of the signer for a different digest", func() {
+			sig, err := abi.NewSignatureFromEthereum(ethSig)
+			Expect(err).ToNot(HaveOccurred())
+
+			digest[0]++
+			recovered, err := sig.Recover(digest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(recovered).ToNot(Equal(pubKey))
+		})
+	})
+
+	Context("when converting between conventions", func() {
+		It("should round trip", func() {
+			sig, err := abi.NewSignatureFromEthereum(ethSig)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sig.Ethereum()).To(Equal(ethSig))
+			Expect(abi.NewSignature(sig.R(), sig.S(), sig.V())).To(Equal(sig))
+
+			_, err = abi.NewSignatureFromEthereum(sig.Bytes65)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when the signature has a high s", func() {
+		It("should be rejected until it is normalized", func() {
+			sig, err := abi.NewSignatureFromEthereum(ethSig)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sig.IsLowS()).To(BeTrue())
+
+			n, _ := new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+			highS, err := abi.NewSignature(sig.R(), abi.NewU256FromInt(new(big.Int).Sub(n, sig.S().Int())), sig.V()^1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(highS.IsLowS()).To(BeFalse())
+			Expect(highS.Validate()).ToNot(Succeed())
+			_, err = highS.Recover(digest)
+			Expect(err).To(HaveOccurred())
+
+			Expect(highS.Normalize()).To(Equal(sig))
+			Expect(sig.Normalize()).To(Equal(sig))
+		})
+	})
+
+	Context("when the signature is out of range", func() {
+		It("should be rejected", func() {
+			Expect(abi.Signature{}.Validate()).ToNot(Succeed())
+
+			sig, err := abi.NewSignatureFromEthereum(ethSig)
+			Expect(err).ToNot(HaveOccurred())
+			sig.Bytes65[64] = 2
+			Expect(sig.Validate()).ToNot(Succeed())
+			_, err = sig.Normalize()
+			Expect(err).To(HaveOccurred())
+
+			_, err = abi.NewSignature(sig.R(), sig.S(), 2)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should not be normalized", func() {
+			sig, err := abi.NewSignatureFromEthereum(ethSig)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 32; i < 64; i++ {
+				sig.Bytes65[i] = 0xff
+			}
+			Expect(sig.IsLowS()).To(BeFalse())
+			_, err = sig.Normalize()
+			Expect(err).To(HaveOccurred())
+
+			_, err = abi.Signature{}.Normalize()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when checking the type", func() {
+		It("should be a 65 byte array", func() {
+			Expect(abi.Signature{}.Type()).To(Equal(abi.TypeBytes65))
+		})
+	})
+})
@@ -0,0 +1,345 @@
+package abi
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Value implements the driver.Valuer interface. Strings are stored as text.
+func (str String) Value() (driver.Value, error) {
+	return string(str), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (str *String) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case string:
+		*str = String(src)
+	case []byte:
+		*str = String(src)
+	default:
+		return fmt.Errorf("non-exhaustive pattern: scanning %T into String", src)
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface. Bytes are stored as a blob.
+func (b Bytes) Value() (driver.Value, error) {
+	return []byte(b), nil
+}
+
+// Scan implements the sql.Scanner interface. The bytes are copied, because
+// drivers may reuse the source.
+func (b *Bytes) Scan(src interface{}) error {
+	data, err := scanBytes(src, "Bytes")
+	if err != nil {
+		return err
+	}
+	*b = append(make(Bytes, 0, len(data)), data...)
+	return nil
+}
+
+// Value implements the driver.Valuer interface. Bytes32 are stored as a blob.
+func (b32 Bytes32) Value() (driver.Value, error) {
+	return b32[:], nil
+}
+
+// Scan implements the sql.Scanner interface. The blob must be exactly 32 bytes.
+func (b32 *Bytes32) Scan(src interface{}) error {
+	data, err := scanBytes(src, "Bytes32")
+	if err != nil {
+		return err
+	}
+	if len(data) != 32 {
+		return fmt.Errorf("expected len=32, got len=%v", len(data))
+	}
+	copy(b32[:], data)
+	return nil
+}
+
+// Value implements the driver.Valuer interface. Bytes65 are stored as a blob.
+func (b65 Bytes65) Value() (driver.Value, error) {
+	return b65[:], nil
+}
+
+// Scan implements the sql.Scanner interface. The blob must be exactly 65 bytes.
+func (b65 *Bytes65) Scan(src interface{}) error {
+	data, err := scanBytes(src, "Bytes65")
+	if err != nil {
+		return err
+	}
+	if len(data) != 65 {
+		return fmt.Errorf("expected len=65, got len=%v", len(data))
+	}
+	copy(b65[:], data)
+	return nil
+}
+
+// Value implements the driver.Valuer interface. Bools are stored as booleans.
+func (b Bool) Value() (driver.Value, error) {
+	return b.inner, nil
+}
+
+// Scan implements the sql.Scanner interface. Databases without a boolean type
+// (such as SQLite) store booleans as the integers 0 and 1, so these are also
+// accepted.
+func (b *Bool) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case bool:
+		b.inner = src
+		return nil
+	case int64:
+		if src != 0 && src != 1 {
+			return fmt.Errorf("non-exhaustive pattern: Bool(%v)", src)
+		}
+		b.inner = src == 1
+		return nil
+	case string:
+		return b.scanText(src)
+	case []byte:
+		return b.scanText(string(src))
+	default:
+		return fmt.Errorf("non-exhaustive pattern: scanning %T into Bool", src)
+	}
+}
+
+// scanText scans a Bool from its text representation in a database.
+func (b *Bool) scanText(text string) error {
+	x, err := strconv.ParseBool(text)
+	if err != nil {
+		return err
+	}
+	b.inner = x
+	return nil
+}
+
+// Value implements the driver.Valuer interface. U8s are stored as integers.
+func (u8 U8) Value() (driver.Value, error) {
+	return int64(u8.inner), nil
+}
+
+// Scan implements the sql.Scanner interface. An error is returned if the
+// integer is out of range.
+func (u8 *U8) Scan(src interface{}) error {
+	x, err := scanUint(src, 8, "U8")
+	if err != nil {
+		return err
+	}
+	u8.inner = uint8(x)
+	return nil
+}
+
+// Value implements the driver.Valuer interface. U16s are stored as integers.
+func (u16 U16) Value() (driver.Value, error) {
+	return int64(u16.inner), nil
+}
+
+// Scan implements the sql.Scanner interface. An error is returned if the
+// integer is out of range.
+func (u16 *U16) Scan(src interface{}) error {
+	x, err := scanUint(src, 16, "U16")
+	if err != nil {
+		return err
+	}
+	u16.inner = uint16(x)
+	return nil
+}
+
+// Value implements the driver.Valuer interface. U32s are stored as integers.
+func (u32 U32) Value() (driver.Value, error) {
+	return int64(u32.inner), nil
+}
+
+// Scan implements the sql.Scanner interface. An error is returned if the
+// integer is out of range.
+func (u32 *U32) Scan(src interface{}) error {
+	x, err := scanUint(src, 32, "U32")
+	if err != nil {
+		return err
+	}
+	u32.inner = uint32(x)
+	return nil
+}
+
+// Value implements the driver.Valuer interface. U64s are stored as integers.
+// SQL integers are signed, so an error is returned if the U64 is greater than
+// the maximum int64; use a U128 to store larger values.
+func (u64 U64) Value() (driver.Value, error) {
+	if u64.inner > math.MaxInt64 {
+		return nil, fmt.Errorf("overflow: U64(%v) does not fit in an int64", u64.inner)
+	}
+	return int64(u64.inner), nil
+}
+
+// Scan implements the sql.Scanner interface. An error is returned if the
+// integer is out of range.
+func (u64 *U64) Scan(src interface{}) error {
+	x, err := scanUint(src, 64, "U64")
+	if err != nil {
+		return err
+	}
+	u64.inner = x
+	return nil
+}
+
+// Value implements the driver.Valuer interface. U128s are stored as decimal
+// strings, which can be stored in NUMERIC or DECIMAL columns. SQLite converts
+// text in a NUMERIC column that does not fit in an int64 to a float, so use a
+// TEXT column in SQLite. A nil integer is stored as zero.
+func (u128 U128) Value() (driver.Value, error) {
+	text, err := u128.MarshalText()
+	return string(text), err
+}
+
+// Scan implements the sql.Scanner interface. Text and blobs are parsed as
+// decimal text, which is how drivers return NUMERIC and DECIMAL columns.
+// Integers are accepted, and so are floats that hold an exact integer. An
+// error is returned if the integer is out of range.
+func (u128 *U128) Scan(src interface{}) error {
+	x, err := scanBigInt(src, MaxU128.inner, "U128")
+	if err != nil {
+		return err
+	}
+	u128.inner = x
+	return nil
+}
+
+// Value implements the driver.Valuer interface. U256s are stored as decimal
+// strings, in the same columns as U128s. A nil integer is stored as zero.
+func (u256 U256) Value() (driver.Value, error) {
+	text, err := u256.MarshalText()
+	return string(text), err
+}
+
+// Scan implements the sql.Scanner interface. Sources are scanned in the same
+// way as for U128s. An error is returned if the integer is out of range.
+func (u256 *U256) Scan(src interface{}) error {
+	x, err := scanBigInt(src, MaxU256.inner, "U256")
+	if err != nil {
+		return err
+	}
+	u256.inner = x
+	return nil
+}
+
+// An SQLValue stores any Value in a database as a blob. A nil Inner is stored
+// as NULL. The blob is the TypeDesc of the Value followed by its binary
+// encoding, so values of different types, including lists, records and maybes,
+// can be stored in the same column.
+type SQLValue struct {
+	Inner Value
+}
+
+// Value implements the driver.Valuer interface.
+func (v SQLValue) Value() (driver.Value, error) {
+	if v.Inner == nil {
+		return nil, nil
+	}
+	buf := new(bytes.Buffer)
+	m, err := DescOf(v.Inner).Marshal(buf, MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := v.Inner.Marshal(buf, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Scan implements the sql.Scanner interface. A NULL is scanned as a nil Value.
+// An error is returned if the blob does not contain exactly one Value. The
+// blob is limited to MaxBytes, which also limits the length of lists, Strings
+// and Bytes, and the depth and number of record fields of the Value are
+// checked against the DefaultLimits.
+func (v *SQLValue) Scan(src interface{}) error {
+	if src == nil {
+		v.Inner = nil
+		return nil
+	}
+	data, err := scanBytes(src, "SQLValue")
+	if err != nil {
+		return err
+	}
+	r := bytes.NewReader(data)
+	limits := DefaultLimits()
+	limits.MaxListLen = MaxBytes
+	limits.MaxStringLen = MaxBytes
+	desc, m, err := unmarshalDesc(r, limits.MaxBytes, limits, 0)
+	if err != nil {
+		return err
+	}
+	value, _, err := decodeValue(r, desc, m, limits, 0)
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("malformed: %v unexpected bytes", r.Len())
+	}
+	v.Inner = value
+	return nil
+}
+
+// scanBytes returns the bytes of a blob or text source. The bytes must be
+// copied if they are retained, because drivers may reuse them.
+func scanBytes(src interface{}, name string) ([]byte, error) {
+	switch src := src.(type) {
+	case []byte:
+		return src, nil
+	case string:
+		return []byte(src), nil
+	default:
+		return nil, fmt.Errorf("non-exhaustive pattern: scanning %T into %v", src, name)
+	}
+}
+
+// scanUint returns an unsigned integer with the given number of bits from an
+// integer or decimal text source.
+func scanUint(src interface{}, bitSize int, name string) (uint64, error) {
+	switch src := src.(type) {
+	case int64:
+		if src < 0 {
+			return 0, fmt.Errorf("underflow: %v(%v)", name, src)
+		}
+		if bitSize < 64 && uint64(src) >= uint64(1)<<uint(bitSize) {
+			return 0, fmt.Errorf("overflow: %v(%v)", name, src)
+		}
+		return uint64(src), nil
+	case string:
+		return strconv.ParseUint(src, 10, bitSize)
+	case []byte:
+		return strconv.ParseUint(string(src), 10, bitSize)
+	default:
+		return 0, fmt.Errorf("non-exhaustive pattern: scanning %T into %v", src, name)
+	}
+}
+
+// scanBigInt returns an integer in the range [0, max] from an integer, float or
+// decimal text source. Floats are only accepted if they hold an integer that is
+// exactly representable, because larger floats may have been rounded.
+func scanBigInt(src interface{}, max *big.Int, name string) (*big.Int, error) {
+	switch src := src.(type) {
+	case int64:
+		if src < 0 {
+			return nil, fmt.Errorf("underflow: %v(%v)", name, src)
+		}
+		return new(big.Int).SetInt64(src), nil
+	case float64:
+		if src < 0 {
+			return nil, fmt.Errorf("underflow: %v(%v)", name, src)
+		}
+		if src != math.Trunc(src) || src > 1<<53 {
+			return nil, fmt.Errorf("malformed: %v(%v) is not an exact integer", name, src)
+		}
+		return new(big.Int).SetUint64(uint64(src)), nil
+	case string:
+		return parseBigIntText([]byte(src), max, name)
+	case []byte:
+		return parseBigIntText(src, max, name)
+	default:
+		return nil, fmt.Errorf("non-exhaustive pattern: scanning %T into %v", src, name)
+	}
+}
@@ -0,0 +1,318 @@
+package abi_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SQL", func() {
+	var db *sql.DB
+	tables := 0
+
+	BeforeEach(func() {
+		var err error
+		tables++
+		db, err = sql.Open("abi-memory", fmt.Sprintf("table%v", tables))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(db.Close()).To(Succeed())
+	})
+
+	Context("when inserting and selecting values", func() {
+		It("should return the same values", func() {
+			f := func(x uint64, y [32]byte, z []byte, s string, b bool) bool {
+				x = x >> 1
+				_, err := db.Exec("INSERT",
+					abi.String(s), abi.Bytes(z), abi.Bytes32(y), abi.Bytes65{y[0]}, abi.NewBool(b),
+					abi.NewU8(uint8(x)), abi.NewU16(uint16(x)), abi.NewU32(uint32(x)), abi.NewU64(x),
+					abi.NewU128FromU64(abi.NewU64(x)), abi.NewU256(y),
+					abi.SQLValue{Inner: abi.NewU256(y)},
+				)
+				Expect(err).ToNot(HaveOccurred())
+
+				var (
+					str  abi.String
+					bs   abi.Bytes
+					b32  abi.Bytes32
+					b65  abi.Bytes65
+					bl   abi.Bool
+					u8   abi.U8
+					u16  abi.U16
+					u32  abi.U32
+					u64  abi.U64
+					u128 abi.U128
+					u256 abi.U256
+					v    abi.SQLValue
+				)
+				rows, err := db.Query("SELECT")
+				Expect(err).ToNot(HaveOccurred())
+				for rows.Next() && err == nil {
+					err = rows.Scan(&str, &bs, &b32, &b65, &bl, &u8, &u16, &u32, &u64, &u128, &u256, &v)
+				}
+				Expect(rows.Close()).To(Succeed())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rows.Err()).ToNot(HaveOccurred())
+
+				Expect(str).To(Equal(abi.String(s)))
+				Expect([]byte(bs)).To(Equal(append([]byte{}, z...)))
+				Expect(b32).To(Equal(abi.Bytes32(y)))
+				Expect(b65).To(Equal(abi.Bytes65{y[0]}))
+				Expect(bl).To(Equal(abi.NewBool(b)))
+				Expect(u8).To(Equal(abi.NewU8(uint8(x))))
+				Expect(u16).To(Equal(abi.NewU16(uint16(x))))
+				Expect(u32).To(Equal(abi.NewU32(uint32(x))))
+				Expect(u64).To(Equal(abi.NewU64(x)))
+				Expect(u128.Equal(abi.NewU128FromU64(abi.NewU64(x)))).To(BeTrue())
+				Expect(u256.Equal(abi.NewU256(y))).To(BeTrue())
+				Expect(v.Inner.(abi.U256).Equal(abi.NewU256(y))).To(BeTrue())
+				return true
+			}
+			Expect(quick.Check(f, &quick.Config{MaxCount: 20})).To(Succeed())
+		})
+
+		It("should store lists, records and maybes as generic values", func() {
+			inner, err := abi.NewList(abi.NewTypeDesc(abi.TypeU8), abi.NewU8(1))
+			Expect(err).ToNot(HaveOccurred())
+			list, err := abi.NewList(abi.DescOf(inner), inner, abi.List{Elem: abi.NewTypeDesc(abi.TypeU8)})
+			Expect(err).ToNot(HaveOccurred())
+			record, err := abi.NewRecord(
+				[]abi.RecordField{{Name: "memo", Type: abi.TypeMaybe}, {Name: "outputs", Type: abi.TypeList}},
+				abi.NewSome(abi.String("memo")), list,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			vs := []abi.Value{list, record, abi.NewNone(abi.NewTypeDesc(abi.TypeU256))}
+			for _, v := range vs {
+				_, err := db.Exec("INSERT", abi.SQLValue{Inner: v})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			rows, err := db.Query("SELECT")
+			Expect(err).ToNot(HaveOccurred())
+			for _, v := range vs {
+				Expect(rows.Next()).To(BeTrue())
+				scanned := abi.SQLValue{}
+				Expect(rows.Scan(&scanned)).To(Succeed())
+				Expect(abi.DescOf(scanned.Inner)).To(Equal(abi.DescOf(v)))
+				expected, err := surge.ToBinary(v)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(surge.ToBinary(scanned.Inner)).To(Equal(expected))
+			}
+			Expect(rows.Close()).To(Succeed())
+		})
+
+		It("should store nil generic values as null", func() {
+			_, err := db.Exec("INSERT", abi.SQLValue{})
+			Expect(err).ToNot(HaveOccurred())
+			v := abi.SQLValue{Inner: abi.NewU8(1)}
+			Expect(db.QueryRow("SELECT").Scan(&v)).To(Succeed())
+			Expect(v.Inner).To(BeNil())
+		})
+	})
+
+	Context("when storing large integers", func() {
+		It("should store them as decimal text", func() {
+			one := big.NewInt(1)
+			maxU128 := new(big.Int).Sub(new(big.Int).Lsh(one, 128), one)
+			maxU256 := new(big.Int).Sub(new(big.Int).Lsh(one, 256), one)
+			u128s := []abi.U128{abi.MaxU128, abi.NewU128FromInt(new(big.Int).Sub(maxU128, one))}
+			u256s := []abi.U256{abi.MaxU256, abi.NewU256FromInt(new(big.Int).Sub(maxU256, one))}
+			for i := range u128s {
+				_, err := db.Exec("INSERT", u128s[i], u256s[i])
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			rows, err := db.Query("SELECT")
+			Expect(err).ToNot(HaveOccurred())
+			for i := range u128s {
+				Expect(rows.Next()).To(BeTrue())
+				text128, text256 := "", ""
+				Expect(rows.Scan(&text128, &text256)).To(Succeed())
+				Expect(text128).To(Equal(u128s[i].String()))
+				Expect(text256).To(Equal(u256s[i].String()))
+			}
+			Expect(rows.Close()).To(Succeed())
+		})
+
+		It("should scan decimal text blobs of any length", func() {
+			// Postgres drivers return NUMERIC columns as decimal text in a
+			// byte slice, which can have the same length as the binary
+			// encoding of the integer.
+			u128 := abi.U128{}
+			Expect(u128.Scan([]byte("1234567890123456"))).To(Succeed())
+			Expect(u128.Equal(abi.NewU128FromU64(abi.NewU64(1234567890123456)))).To(BeTrue())
+
+			u256 := abi.U256{}
+			Expect(u256.Scan([]byte("12345678901234567890123456789012"))).To(Succeed())
+			expected, _ := new(big.Int).SetString("12345678901234567890123456789012", 10)
+			Expect(u256.Int()).To(Equal(expected))
+
+			Expect(u128.Scan(make([]byte, 16))).ToNot(Succeed())
+			Expect(u256.Scan(make([]byte, 32))).ToNot(Succeed())
+		})
+
+		It("should reject integers that a numeric column rounded to a float", func() {
+			numeric, err := sql.Open("abi-memory", fmt.Sprintf("numeric%v", tables))
+			Expect(err).ToNot(HaveOccurred())
+			defer numeric.Close()
+
+			_, err = numeric.Exec("INSERT", abi.MaxU128, abi.NewU256FromU64(abi.NewU64(42)))
+			Expect(err).ToNot(HaveOccurred())
+			rows, err := numeric.Query("SELECT")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rows.Next()).To(BeTrue())
+			u128, u256 := abi.U128{}, abi.U256{}
+			Expect(rows.Scan(&u128, &u256)).ToNot(Succeed())
+			Expect(rows.Scan(new(interface{}), &u256)).To(Succeed())
+			Expect(u256.Equal(abi.NewU256FromU64(abi.NewU64(42)))).To(BeTrue())
+			Expect(rows.Close()).To(Succeed())
+		})
+	})
+
+	Context("when values are out of range", func() {
+		It("should return an error", func() {
+			_, err := db.Exec("INSERT", abi.NewU64(1<<63))
+			Expect(err).To(HaveOccurred())
+
+			_, err = db.Exec("INSERT", int64(256), int64(-1), []byte{1, 2, 3}, "340282366920938463463374607431768211456", int64(2))
+			Expect(err).ToNot(HaveOccurred())
+			row := func() *sql.Row { return db.QueryRow("SELECT") }
+			Expect(row().Scan(new(abi.U8), new(interface{}), new(interface{}), new(interface{}), new(interface{}))).ToNot(Succeed())
+			Expect(row().Scan(new(interface{}), new(abi.U64), new(interface{}), new(interface{}), new(interface{}))).ToNot(Succeed())
+			Expect(row().Scan(new(interface{}), new(interface{}), new(abi.Bytes32), new(interface{}), new(interface{}))).ToNot(Succeed())
+			Expect(row().Scan(new(interface{}), new(interface{}), new(interface{}), new(abi.U128), new(interface{}))).ToNot(Succeed())
+			Expect(row().Scan(new(interface{}), new(interface{}), new(interface{}), new(abi.U256), new(interface{}))).To(Succeed())
+			Expect(row().Scan(new(interface{}), new(interface{}), new(interface{}), new(interface{}), new(abi.Bool))).ToNot(Succeed())
+		})
+	})
+})
+
+func init() {
+	sql.Register("abi-memory", &memoryDriver{tables: map[string][][]driver.Value{}})
+}
+
+// memoryDriver is an in-memory stand-in for SQLite. Each data source name is a
+// table. The query "INSERT" appends its arguments as a row, and the query
+// "SELECT" returns every row. Like SQLite, booleans are stored as integers.
+// Tables whose name starts with "numeric" have the NUMERIC affinity of SQLite:
+// decimal text is stored as an integer, or as a float if it does not fit.
+type memoryDriver struct {
+	mu     sync.Mutex
+	tables map[string][][]driver.Value
+}
+
+func (d *memoryDriver) Open(name string) (driver.Conn, error) {
+	return &memoryConn{d: d, table: name}, nil
+}
+
+type memoryConn struct {
+	d     *memoryDriver
+	table string
+}
+
+func (conn *memoryConn) Prepare(query string) (driver.Stmt, error) {
+	if query != "INSERT" && query != "SELECT" {
+		return nil, fmt.Errorf("unsupported query %q", query)
+	}
+	return &memoryStmt{conn: conn, query: query}, nil
+}
+
+func (conn *memoryConn) Close() error {
+	return nil
+}
+
+func (conn *memoryConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+type memoryStmt struct {
+	conn  *memoryConn
+	query string
+}
+
+func (stmt *memoryStmt) Close() error {
+	return nil
+}
+
+func (stmt *memoryStmt) NumInput() int {
+	return -1
+}
+
+func (stmt *memoryStmt) Exec(args []driver.Value) (driver.Result, error) {
+	row := make([]driver.Value, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case bool:
+			if arg {
+				row[i] = int64(1)
+			} else {
+				row[i] = int64(0)
+			}
+		case []byte:
+			row[i] = append([]byte{}, arg...)
+		case string:
+			row[i] = arg
+			if strings.HasPrefix(stmt.conn.table, "numeric") {
+				if x, err := strconv.ParseInt(arg, 10, 64); err == nil {
+					row[i] = x
+				} else if x, err := strconv.ParseFloat(arg, 64); err == nil {
+					row[i] = x
+				}
+			}
+		default:
+			row[i] = arg
+		}
+	}
+	stmt.conn.d.mu.Lock()
+	defer stmt.conn.d.mu.Unlock()
+	stmt.conn.d.tables[stmt.conn.table] = append(stmt.conn.d.tables[stmt.conn.table], row)
+	return driver.RowsAffected(1), nil
+}
+
+func (stmt *memoryStmt) Query(args []driver.Value) (driver.Rows, error) {
+	stmt.conn.d.mu.Lock()
+	defer stmt.conn.d.mu.Unlock()
+	rows := stmt.conn.d.tables[stmt.conn.table]
+	columns := []string{}
+	if len(rows) > 0 {
+		for i := range rows[0] {
+			columns = append(columns, fmt.Sprintf("c%v", i))
+		}
+	}
+	return &memoryRows{columns: columns, rows: rows}, nil
+}
+
+type memoryRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (rows *memoryRows) Columns() []string {
+	return rows.columns
+}
+
+func (rows *memoryRows) Close() error {
+	return nil
+}
+
+func (rows *memoryRows) Next(dest []driver.Value) error {
+	if len(rows.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, rows.rows[0])
+	rows.rows = rows.rows[1:]
+	return nil
+}
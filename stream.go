@@ -0,0 +1,187 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/renproject/surge"
+)
+
+// Frames in a stream of values are prefixed with a uint32 header. The lower 31
+// bits of the header are the length of the payload, and the highest bit is set
+// when the payload is followed by a checksum.
+const (
+	frameChecksumFlag = uint32(1) << 31
+	frameMaxLen       = frameChecksumFlag - 1
+)
+
+// frameTable is the CRC32 table used for frame checksums.
+var frameTable = crc32.MakeTable(crc32.Castagnoli)
+
+// An Encoder writes a stream of values to an I/O writer. Each value is written
+// as a frame:
+//
+//   - a uint32 big endian header, holding the length of the payload and a flag
+//     that is set when the frame has a checksum,
+//   - the payload, which is the TypeDesc of the value followed by its binary
+//     encoding (the TypeDesc of a bytes or scalar value is only its Type), and
+//   - optionally, the CRC32 (Castagnoli) checksum of the payload as a uint32.
+//
+// Frames are self-describing, so a Decoder does not need to be told whether or
+// not checksums are used.
+type Encoder struct {
+	w        io.Writer
+	buf      *bytes.Buffer
+	maxBytes int
+	checksum bool
+}
+
+// NewEncoder returns an Encoder that writes to the I/O writer. By default,
+// frames are limited to MaxBytes and do not have checksums.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:        w,
+		buf:      new(bytes.Buffer),
+		maxBytes: MaxBytes,
+	}
+}
+
+// SetMaxBytes sets the maximum number of bytes in the payload of a frame.
+func (enc *Encoder) SetMaxBytes(m int) {
+	enc.maxBytes = m
+}
+
+// SetChecksum sets whether or not frames are written with a checksum.
+func (enc *Encoder) SetChecksum(checksum bool) {
+	enc.checksum = checksum
+}
+
+// Encode writes a value to the stream as a single frame. An error is returned
+// if the payload exceeds the maximum number of bytes.
+func (enc *Encoder) Encode(v Value) error {
+	enc.buf.Reset()
+	enc.buf.Write(make([]byte, 4))
+	// The remaining budget must be positive, so a payload of exactly the
+	// maximum number of bytes needs one more byte of budget.
+	m, err := DescOf(v).Marshal(enc.buf, enc.maxBytes+1)
+	if err != nil {
+		return err
+	}
+	if _, err = v.Marshal(enc.buf, m); err != nil {
+		return err
+	}
+
+	frame := enc.buf.Bytes()
+	payloadLen := len(frame) - 4
+	if uint64(payloadLen) > uint64(frameMaxLen) {
+		return fmt.Errorf("overflow: frame len=%v", payloadLen)
+	}
+	header := uint32(payloadLen)
+	if enc.checksum {
+		header |= frameChecksumFlag
+		checksum := [4]byte{}
+		binary.BigEndian.PutUint32(checksum[:], crc32.Checksum(frame[4:], frameTable))
+		enc.buf.Write(checksum[:])
+		frame = enc.buf.Bytes()
+	}
+	binary.BigEndian.PutUint32(frame[:4], header)
+
+	_, err = enc.w.Write(frame)
+	return err
+}
+
+// A Decoder reads a stream of values, written by an Encoder, from an I/O
+// reader.
+type Decoder struct {
+	r      io.Reader
+	limits Limits
+}
+
+// NewDecoder returns a Decoder that reads from the I/O reader. By default,
+// frames are limited to MaxBytes, and values are checked against the
+// DefaultLimits.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		r:      r,
+		limits: DefaultLimits(),
+	}
+}
+
+// SetMaxBytes sets the maximum number of bytes in the payload of a frame.
+// Frames with a longer payload are rejected before the payload is read.
+func (dec *Decoder) SetMaxBytes(m int) {
+	dec.limits.MaxBytes = m
+}
+
+// SetLimits sets the Limits that values are checked against. The maximum
+// number of bytes in the payload of a frame is taken from the Limits.
+func (dec *Decoder) SetLimits(limits Limits) {
+	dec.limits = limits
+}
+
+// Decode reads the next value from the stream. It returns io.EOF if the stream
+// ends cleanly between frames, and io.ErrUnexpectedEOF if the stream ends in
+// the middle of a frame. An error is also returned if the payload exceeds the
+// maximum number of bytes, if the checksum does not match, if the value exceeds
+// the Limits, or if the value does not consume the whole payload.
+func (dec *Decoder) Decode() (Value, error) {
+	bs := [4]byte{}
+	if _, err := io.ReadFull(dec.r, bs[:]); err != nil {
+		return nil, err
+	}
+	header := binary.BigEndian.Uint32(bs[:])
+	payloadLen := header & frameMaxLen
+	if uint64(payloadLen) > uint64(dec.limits.MaxBytes) {
+		return nil, surge.ErrMaxBytesExceeded
+	}
+
+	payload := make([]byte, payloadLen)
+	if _, err := io.ReadFull(dec.r, payload); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if header&frameChecksumFlag != 0 {
+		if _, err := io.ReadFull(dec.r, bs[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		expected, got := binary.BigEndian.Uint32(bs[:]), crc32.Checksum(payload, frameTable)
+		if expected != got {
+			return nil, fmt.Errorf("malformed: expected checksum=%08x, got checksum=%08x", expected, got)
+		}
+	}
+
+	r := bytes.NewReader(payload)
+	desc, m, err := unmarshalDesc(r, dec.limits.MaxBytes+1, dec.limits, 0)
+	if err != nil {
+		return nil, malformedFrame(err)
+	}
+	v, _, err := decodeValue(r, desc, m, dec.limits, 0)
+	if err != nil {
+		return nil, malformedFrame(err)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("malformed: %v unexpected bytes in frame", r.Len())
+	}
+	return v, nil
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF, for use when data is
+// expected but there is none.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// malformedFrame converts errors caused by reading past the end of a payload
+// into a malformed frame error, so that they are not confused with the end of
+// the stream.
+func malformedFrame(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("malformed: frame is too short")
+	}
+	return err
+}
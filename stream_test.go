@@ -0,0 +1,181 @@
+package abi_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Streams", func() {
+	encode := func(checksum bool, vs ...abi.Value) []byte {
+		buf := new(bytes.Buffer)
+		enc := abi.NewEncoder(buf)
+		enc.SetChecksum(checksum)
+		for _, v := range vs {
+			Expect(enc.Encode(v)).To(Succeed())
+		}
+		return buf.Bytes()
+	}
+
+	for _, checksum := range []bool{false, true} {
+		checksum := checksum
+
+		Context("when encoding and decoding", func() {
+			It("should return the same values", func() {
+				f := func(x uint64, y [32]byte, z []byte, s string, b bool) bool {
+					vs := []abi.Value{
+						abi.NewU64(x),
+						abi.Bytes32(y),
+						abi.Bytes(z),
+						abi.String(s),
+						abi.NewBool(b),
+						abi.NewU256(y),
+					}
+					dec := abi.NewDecoder(bytes.NewReader(encode(checksum, vs...)))
+					for _, v := range vs {
+						decoded, err := dec.Decode()
+						Expect(err).ToNot(HaveOccurred())
+						Expect(decoded).To(Equal(v))
+					}
+					_, err := dec.Decode()
+					Expect(err).To(Equal(io.EOF))
+					return true
+				}
+				Expect(quick.Check(f, nil)).To(Succeed())
+			})
+
+			It("should return the same lists, records and maybes", func() {
+				inner, err := abi.NewList(abi.NewTypeDesc(abi.TypeU8), abi.NewU8(1))
+				Expect(err).ToNot(HaveOccurred())
+				list, err := abi.NewList(abi.DescOf(inner), inner, abi.List{Elem: abi.NewTypeDesc(abi.TypeU8)})
+				Expect(err).ToNot(HaveOccurred())
+				record, err := abi.NewRecord(
+					[]abi.RecordField{{Name: "memo", Type: abi.TypeMaybe}, {Name: "outputs", Type: abi.TypeList}},
+					abi.NewNone(abi.NewTypeDesc(abi.TypeString)), list,
+				)
+				Expect(err).ToNot(HaveOccurred())
+				vs := []abi.Value{list, record, abi.NewSome(abi.Bytes{1, 2})}
+				dec := abi.NewDecoder(bytes.NewReader(encode(checksum, vs...)))
+				for _, v := range vs {
+					decoded, err := dec.Decode()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(abi.DescOf(decoded)).To(Equal(abi.DescOf(v)))
+					expected, err := surge.ToBinary(v)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(surge.ToBinary(decoded)).To(Equal(expected))
+				}
+				_, err = dec.Decode()
+				Expect(err).To(Equal(io.EOF))
+			})
+
+			It("should return an unexpected EOF when the stream is truncated in a frame", func() {
+				data := encode(checksum, abi.String("hello"), abi.NewU32(42))
+				first := len(encode(checksum, abi.String("hello")))
+				for i := 0; i < len(data); i++ {
+					dec := abi.NewDecoder(bytes.NewReader(data[:i]))
+					_, err := dec.Decode()
+					if i == 0 {
+						Expect(err).To(Equal(io.EOF))
+						continue
+					}
+					if i < first {
+						Expect(err).To(Equal(io.ErrUnexpectedEOF))
+						continue
+					}
+					Expect(err).ToNot(HaveOccurred())
+					_, err = dec.Decode()
+					if i == first {
+						Expect(err).To(Equal(io.EOF))
+					} else {
+						Expect(err).To(Equal(io.ErrUnexpectedEOF))
+					}
+				}
+			})
+
+			It("should return an error when the frame exceeds the maximum number of bytes", func() {
+				dec := abi.NewDecoder(bytes.NewReader(encode(checksum, abi.Bytes(make([]byte, 100)))))
+				dec.SetMaxBytes(100)
+				_, err := dec.Decode()
+				Expect(err).To(Equal(surge.ErrMaxBytesExceeded))
+
+				enc := abi.NewEncoder(new(bytes.Buffer))
+				enc.SetChecksum(checksum)
+				enc.SetMaxBytes(100)
+				Expect(enc.Encode(abi.Bytes(make([]byte, 100)))).To(Equal(surge.ErrMaxBytesExceeded))
+				Expect(enc.Encode(abi.Bytes(make([]byte, 10)))).To(Succeed())
+			})
+
+			It("should accept a frame of exactly the maximum number of bytes", func() {
+				// The payload is the type (2 bytes), the length prefix (4 bytes),
+				// and the bytes (94 bytes).
+				buf := new(bytes.Buffer)
+				enc := abi.NewEncoder(buf)
+				enc.SetChecksum(checksum)
+				enc.SetMaxBytes(100)
+				Expect(enc.Encode(abi.Bytes(make([]byte, 94)))).To(Succeed())
+				Expect(enc.Encode(abi.Bytes(make([]byte, 95)))).To(Equal(surge.ErrMaxBytesExceeded))
+
+				dec := abi.NewDecoder(buf)
+				dec.SetMaxBytes(100)
+				v, err := dec.Decode()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(v).To(Equal(abi.Bytes(make([]byte, 94))))
+			})
+		})
+	}
+
+	Context("when a frame is corrupted", func() {
+		It("should return an error if there is a checksum", func() {
+			data := encode(true, abi.String("hello"))
+			for i := 4; i < len(data); i++ {
+				corrupted := append([]byte{}, data...)
+				corrupted[i] ^= 0x01
+				_, err := abi.NewDecoder(bytes.NewReader(corrupted)).Decode()
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Context("when a frame has unexpected bytes", func() {
+		It("should return an error", func() {
+			payload := []byte{0, byte(abi.TypeU8), 42, 0}
+			frame := make([]byte, 4)
+			binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+			_, err := abi.NewDecoder(bytes.NewReader(append(frame, payload...))).Decode()
+			Expect(err).To(HaveOccurred())
+
+			binary.BigEndian.PutUint32(frame, uint32(len(payload)-1))
+			v, err := abi.NewDecoder(bytes.NewReader(append(frame, payload[:3]...))).Decode()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v).To(Equal(abi.NewU8(42)))
+		})
+
+		It("should return an error if a value exceeds the limits", func() {
+			limits := abi.DefaultLimits()
+			limits.MaxDepth = 1
+			inner := abi.List{Elem: abi.NewTypeDesc(abi.TypeU8)}
+			buf := new(bytes.Buffer)
+			Expect(abi.NewEncoder(buf).Encode(abi.List{Elem: abi.DescOf(inner)})).To(Succeed())
+			dec := abi.NewDecoder(buf)
+			dec.SetLimits(limits)
+			_, err := dec.Decode()
+			Expect(err).To(BeAssignableToTypeOf(abi.LimitError{}))
+		})
+
+		It("should return an error if the payload is too short", func() {
+			payload := []byte{0, byte(abi.TypeU64), 42}
+			frame := make([]byte, 4)
+			binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+			_, err := abi.NewDecoder(bytes.NewReader(append(frame, payload...))).Decode()
+			Expect(err).To(HaveOccurred())
+			Expect(err).ToNot(Equal(io.ErrUnexpectedEOF))
+		})
+	})
+})
@@ -0,0 +1,623 @@
+package abi
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// A BytesFormat is the way that bytes are rendered by FormatText.
+type BytesFormat uint8
+
+const (
+	// BytesHex renders bytes as hex with a 0x prefix, for example 0x0102.
+	BytesHex BytesFormat = iota
+	// BytesBase64 renders bytes as padded standard base64 with a base64:
+	// prefix, for example base64:AQI=.
+	BytesBase64
+	// BytesTruncated renders bytes as hex, but only the first TruncateAfter
+	// bytes are rendered, followed by the total length, for example
+	// 0x0102...(32 bytes). Truncated bytes cannot be parsed.
+	BytesTruncated
+)
+
+// TextOptions configure FormatText.
+type TextOptions struct {
+	// Indent is used to indent the elements of lists and the fields of
+	// records, which are written on their own lines. If it is empty, values
+	// are written on one line.
+	Indent string
+	// Bytes is the way that bytes are rendered.
+	Bytes BytesFormat
+	// TruncateAfter is the number of bytes that are rendered when using
+	// BytesTruncated.
+	TruncateAfter int
+}
+
+// DefaultTextOptions returns the TextOptions used by the String methods of
+// lists and records: one line, and bytes as hex.
+func DefaultTextOptions() TextOptions {
+	return TextOptions{Bytes: BytesHex, TruncateAfter: 8}
+}
+
+// FormatText returns a human-readable text representation of a value. Every
+// value is annotated with its Type:
+//
+//	str("hello")            u256(1000)
+//	b(0x0102)               bool(true)
+//	b32(0x0000...0000)      list<u8>[u8(1), u8(2)]
+//	maybe<u8>(u8(1))        maybe<u8>(none)
+//	record{to: b32(0x...), amount: u256(1000)}
+//
+// Lists and maybes are annotated with the TypeDesc of their elements, in the
+// form returned by its String method, so that empty lists and absent values are
+// fully described. Unless bytes are truncated, the text can be parsed by
+// ParseText. Values that are not bytes, scalar, list, record or maybe values
+// are written using their Go syntax, and cannot be parsed.
+func FormatText(v Value, opts TextOptions) string {
+	b := new(strings.Builder)
+	formatText(b, v, opts, 0)
+	return b.String()
+}
+
+// formatText writes the text representation of a value, at the given depth of
+// indentation.
+func formatText(b *strings.Builder, v Value, opts TextOptions, depth int) {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("nil")
+	case String:
+		b.WriteString("str(")
+		b.WriteString(strconv.Quote(string(v)))
+		b.WriteString(")")
+	case Bytes:
+		formatTextBytes(b, TypeBytes, v, opts)
+	case Bytes32:
+		formatTextBytes(b, TypeBytes32, v[:], opts)
+	case Bytes65:
+		formatTextBytes(b, TypeBytes65, v[:], opts)
+	case Signature:
+		formatTextBytes(b, TypeBytes65, v.Bytes65[:], opts)
+	case Bool:
+		fmt.Fprintf(b, "%v(%v)", TypeBool, v.inner)
+	case U8, U16, U32, U64:
+		fmt.Fprintf(b, "%v(%v)", v.Type(), v)
+	case U128:
+		fmt.Fprintf(b, "%v(%v)", TypeU128, ToNative(v))
+	case U256:
+		fmt.Fprintf(b, "%v(%v)", TypeU256, ToNative(v))
+	case List:
+		fmt.Fprintf(b, "%v<%v>[", TypeList, v.Elem)
+		for i, elem := range v.Elems {
+			formatTextSeparator(b, i, opts, depth+1)
+			formatText(b, elem, opts, depth+1)
+		}
+		formatTextEnd(b, len(v.Elems), opts, depth)
+		b.WriteString("]")
+	case Record:
+		fmt.Fprintf(b, "%v{", TypeRecord)
+		for i, field := range v.Fields {
+			formatTextSeparator(b, i, opts, depth+1)
+			if isTextName(field.Name) {
+				b.WriteString(field.Name)
+			} else {
+				b.WriteString(strconv.Quote(field.Name))
+			}
+			b.WriteString(": ")
+			if i < len(v.Values) {
+				formatText(b, v.Values[i], opts, depth+1)
+			} else {
+				b.WriteString("nil")
+			}
+		}
+		formatTextEnd(b, len(v.Fields), opts, depth)
+		b.WriteString("}")
+	case Maybe:
+		fmt.Fprintf(b, "%v<%v>(", TypeMaybe, v.Elem)
+		if v.Value == nil {
+			b.WriteString("none")
+		} else {
+			formatText(b, v.Value, opts, depth)
+		}
+		b.WriteString(")")
+	default:
+		fmt.Fprintf(b, "%#v", v)
+	}
+}
+
+// formatTextBytes writes bytes of the given Type.
+func formatTextBytes(b *strings.Builder, ty Type, data []byte, opts TextOptions) {
+	b.WriteString(ty.String())
+	b.WriteString("(")
+	switch {
+	case opts.Bytes == BytesBase64:
+		b.WriteString("base64:")
+		b.WriteString(base64.StdEncoding.EncodeToString(data))
+	case opts.Bytes == BytesTruncated && len(data) > opts.TruncateAfter && opts.TruncateAfter >= 0:
+		b.WriteString("0x")
+		b.WriteString(hex.EncodeToString(data[:opts.TruncateAfter]))
+		fmt.Fprintf(b, "...(%v bytes)", len(data))
+	default:
+		b.WriteString("0x")
+		b.WriteString(hex.EncodeToString(data))
+	}
+	b.WriteString(")")
+}
+
+// formatTextSeparator writes the separator before the i-th element of a list
+// or field of a record.
+func formatTextSeparator(b *strings.Builder, i int, opts TextOptions, depth int) {
+	if opts.Indent == "" {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		return
+	}
+	if i > 0 {
+		b.WriteString(",")
+	}
+	b.WriteString("\n")
+	b.WriteString(strings.Repeat(opts.Indent, depth))
+}
+
+// formatTextEnd writes the end of a list or record with n elements or fields.
+func formatTextEnd(b *strings.Builder, n int, opts TextOptions, depth int) {
+	if opts.Indent == "" || n == 0 {
+		return
+	}
+	b.WriteString(",\n")
+	b.WriteString(strings.Repeat(opts.Indent, depth))
+}
+
+// String returns the List in the text format, on one line.
+func (list List) String() string {
+	return FormatText(list, DefaultTextOptions())
+}
+
+// String returns the Record in the text format, on one line.
+func (record Record) String() string {
+	return FormatText(record, DefaultTextOptions())
+}
+
+// String returns the Maybe in the text format, on one line.
+func (maybe Maybe) String() string {
+	return FormatText(maybe, DefaultTextOptions())
+}
+
+// ParseText parses the text representation of a value, as returned by
+// FormatText. Whitespace between tokens, trailing commas, and comments that
+// start with "//" are ignored. Numbers can be decimal, or hex with a 0x
+// prefix, and are range checked. Every element of a list, and the value of a
+// maybe, must be described by the TypeDesc that annotates the list or maybe.
+// Lists, records and maybes, and their TypeDescs, are nested no deeper than the
+// MaxDepth of the DefaultLimits.
+//
+// Errors include the offset in the text at which parsing failed, and errors
+// about values include their Path.
+func ParseText(text string) (Value, error) {
+	p := textParser{text: text, limits: DefaultLimits()}
+	v, err := p.value(nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if p.skip(); p.pos != len(p.text) {
+		return nil, p.errorf("malformed: unexpected %q", p.text[p.pos:p.pos+1])
+	}
+	return v, nil
+}
+
+// MustParseText is like ParseText, but panics if the text cannot be parsed.
+// It is useful for writing fixtures in tests.
+func MustParseText(text string) Value {
+	v, err := ParseText(text)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// A textParser parses the text format.
+type textParser struct {
+	text   string
+	pos    int
+	limits Limits
+}
+
+// errorf returns an error that includes the current offset.
+func (p *textParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(format+" at offset %v", append(args, p.pos)...)
+}
+
+// skip skips whitespace and comments.
+func (p *textParser) skip() {
+	for p.pos < len(p.text) {
+		switch {
+		case strings.ContainsRune(" \t\r\n", rune(p.text[p.pos])):
+			p.pos++
+		case strings.HasPrefix(p.text[p.pos:], "//"):
+			end := strings.IndexByte(p.text[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.text)
+			} else {
+				p.pos += end + 1
+			}
+		default:
+			return
+		}
+	}
+}
+
+// consume skips whitespace and comments, and then consumes the token. Returns
+// false if the next token is different.
+func (p *textParser) consume(token string) bool {
+	p.skip()
+	if strings.HasPrefix(p.text[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// expect consumes the token, or returns an error.
+func (p *textParser) expect(token string) error {
+	if !p.consume(token) {
+		return p.errorf("malformed: expected %q", token)
+	}
+	return nil
+}
+
+// name consumes a field name, or a type name.
+func (p *textParser) name() (string, error) {
+	p.skip()
+	if p.pos < len(p.text) && p.text[p.pos] == '"' {
+		return p.quoted()
+	}
+	n := queryNameLen(p.text[p.pos:])
+	if n == 0 || !isQueryNameStart(p.text[p.pos]) {
+		return "", p.errorf("malformed: expected name")
+	}
+	p.pos += n
+	return p.text[p.pos-n : p.pos], nil
+}
+
+// quoted consumes a quoted string, and returns it unquoted.
+func (p *textParser) quoted() (string, error) {
+	p.skip()
+	if p.pos >= len(p.text) || p.text[p.pos] != '"' {
+		return "", p.errorf("malformed: expected string")
+	}
+	end := p.pos + 1
+	for ; end < len(p.text) && p.text[end] != '"'; end++ {
+		if p.text[end] == '\\' {
+			end++
+		}
+	}
+	if end >= len(p.text) {
+		return "", p.errorf("malformed: unterminated string")
+	}
+	str, err := strconv.Unquote(p.text[p.pos : end+1])
+	if err != nil {
+		return "", p.errorf("malformed: %v", err)
+	}
+	p.pos = end + 1
+	return str, nil
+}
+
+// literal consumes the text up to the closing parenthesis of a bytes or scalar
+// value, and the closing parenthesis.
+func (p *textParser) literal() (string, error) {
+	p.skip()
+	end := strings.IndexByte(p.text[p.pos:], ')')
+	if end < 0 {
+		return "", p.errorf("malformed: expected %q", ")")
+	}
+	literal := strings.TrimSpace(p.text[p.pos : p.pos+end])
+	p.pos += end + 1
+	return literal, nil
+}
+
+// typ consumes a type name.
+func (p *textParser) typ() (Type, error) {
+	start := p.pos
+	name, err := p.name()
+	if err != nil {
+		return TypeNil, err
+	}
+	ty, ok := NewTypeFromString(name)
+	if !ok {
+		p.pos = start
+		return TypeNil, p.errorf("non-exhaustive pattern: Type(%v)", name)
+	}
+	return ty, nil
+}
+
+// value consumes a value at the given Path and depth.
+func (p *textParser) value(path Path, depth int) (Value, error) {
+	p.skip()
+	start := p.pos
+	ty, err := p.typ()
+	if err != nil {
+		return nil, err
+	}
+	switch ty {
+	case TypeList:
+		return p.list(path, depth)
+	case TypeRecord:
+		return p.record(path, depth)
+	case TypeMaybe:
+		return p.maybe(path, depth)
+	}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	switch ty {
+	case TypeString:
+		str, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return String(str), p.expect(")")
+
+	case TypeBytes, TypeBytes32, TypeBytes65:
+		literal, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		data, err := parseTextBytes(literal)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("malformed: %v: %v", path, err)
+		}
+		v, err := fromNative(path, data, NewTypeDesc(ty))
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("%v", err)
+		}
+		return v, nil
+
+	case TypeBool:
+		literal, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		if literal != "true" && literal != "false" {
+			p.pos = start
+			return nil, p.errorf("malformed: expected %v to be true or false, got %q", path, literal)
+		}
+		return NewBool(literal == "true"), nil
+
+	case TypeU8, TypeU16, TypeU32, TypeU64, TypeU128, TypeU256:
+		literal, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		digits, base := literal, 10
+		if strings.HasPrefix(literal, "0x") {
+			digits, base = literal[2:], 16
+		}
+		// Negative decimals are parsed, so that they are reported as an
+		// underflow.
+		i, ok := new(big.Int).SetString(digits, base)
+		if !ok || strings.HasPrefix(digits, "+") || (base == 16 && strings.HasPrefix(digits, "-")) {
+			p.pos = start
+			return nil, p.errorf("malformed: expected %v to be an integer, got %q", path, literal)
+		}
+		v, err := newScalarFromInt(path, ty, i)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("%v", err)
+		}
+		return v, nil
+
+	default:
+		p.pos = start
+		return nil, p.errorf("non-exhaustive pattern: Type(%v)", ty)
+	}
+}
+
+// list consumes a list, after its type name.
+func (p *textParser) list(path Path, depth int) (Value, error) {
+	if err := p.limits.checkDepth(depth + 1); err != nil {
+		return nil, err
+	}
+	if err := p.expect("<"); err != nil {
+		return nil, err
+	}
+	elemDesc, err := p.desc(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(">"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	elems := []Value{}
+	for !p.consume("]") {
+		if len(elems) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if p.consume("]") {
+				break
+			}
+		}
+		elemPath := path.append(IndexSegment(len(elems)))
+		start := p.pos
+		elem, err := p.value(elemPath, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if !DescOf(elem).Equal(elemDesc) {
+			p.pos = start
+			p.skip()
+			return nil, p.errorf("expected %v to have type %v, got %v", elemPath, elemDesc, typeOf(elem))
+		}
+		elems = append(elems, elem)
+	}
+	return List{Elem: elemDesc, Elems: elems}, nil
+}
+
+// record consumes a record, after its type name.
+func (p *textParser) record(path Path, depth int) (Value, error) {
+	if err := p.limits.checkDepth(depth + 1); err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	fields := []RecordField{}
+	values := []Value{}
+	seen := map[string]struct{}{}
+	for !p.consume("}") {
+		if len(fields) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if p.consume("}") {
+				break
+			}
+		}
+		p.skip()
+		start := p.pos
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		fieldPath := path.append(FieldSegment(name))
+		if _, ok := seen[name]; ok {
+			p.pos = start
+			return nil, p.errorf("malformed: duplicate field %v", fieldPath)
+		}
+		seen[name] = struct{}{}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.value(fieldPath, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, RecordField{Name: name, Type: value.Type()})
+		values = append(values, value)
+	}
+	return Record{Fields: fields, Values: values}, nil
+}
+
+// maybe consumes a maybe, after its type name.
+func (p *textParser) maybe(path Path, depth int) (Value, error) {
+	if err := p.limits.checkDepth(depth + 1); err != nil {
+		return nil, err
+	}
+	if err := p.expect("<"); err != nil {
+		return nil, err
+	}
+	elemDesc, err := p.desc(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(">"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if p.consume("none") {
+		return Maybe{Elem: elemDesc}, p.expect(")")
+	}
+	p.skip()
+	start := p.pos
+	value, err := p.value(path, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	if !DescOf(value).Equal(elemDesc) {
+		p.pos = start
+		return nil, p.errorf("expected %v to have type %v, got %v", path, elemDesc, typeOf(value))
+	}
+	return Maybe{Elem: elemDesc, Value: value}, p.expect(")")
+}
+
+// desc consumes a TypeDesc at the given depth.
+func (p *textParser) desc(depth int) (TypeDesc, error) {
+	p.skip()
+	ty, err := p.typ()
+	if err != nil {
+		return TypeDesc{}, err
+	}
+	switch ty {
+	case TypeList, TypeMaybe:
+		if err := p.limits.checkDepth(depth + 1); err != nil {
+			return TypeDesc{}, err
+		}
+		if err := p.expect("<"); err != nil {
+			return TypeDesc{}, err
+		}
+		elem, err := p.desc(depth + 1)
+		if err != nil {
+			return TypeDesc{}, err
+		}
+		return TypeDesc{Type: ty, Elem: &elem}, p.expect(">")
+
+	case TypeRecord:
+		if err := p.limits.checkDepth(depth + 1); err != nil {
+			return TypeDesc{}, err
+		}
+		if err := p.expect("{"); err != nil {
+			return TypeDesc{}, err
+		}
+		fields := []FieldDesc{}
+		seen := map[string]struct{}{}
+		for !p.consume("}") {
+			if len(fields) > 0 {
+				if err := p.expect(","); err != nil {
+					return TypeDesc{}, err
+				}
+				if p.consume("}") {
+					break
+				}
+			}
+			p.skip()
+			start := p.pos
+			name, err := p.name()
+			if err != nil {
+				return TypeDesc{}, err
+			}
+			if _, ok := seen[name]; ok {
+				p.pos = start
+				return TypeDesc{}, p.errorf("malformed: duplicate field %v", name)
+			}
+			seen[name] = struct{}{}
+			if err := p.expect(":"); err != nil {
+				return TypeDesc{}, err
+			}
+			desc, err := p.desc(depth + 1)
+			if err != nil {
+				return TypeDesc{}, err
+			}
+			fields = append(fields, FieldDesc{Name: name, Desc: desc})
+		}
+		return NewRecordDesc(fields...), nil
+
+	default:
+		return NewTypeDesc(ty), nil
+	}
+}
+
+// parseTextBytes parses bytes rendered as hex or base64.
+func parseTextBytes(literal string) ([]byte, error) {
+	switch {
+	case strings.Contains(literal, "..."):
+		return nil, fmt.Errorf("bytes are truncated")
+	case strings.HasPrefix(literal, "0x"):
+		return hex.DecodeString(literal[2:])
+	case strings.HasPrefix(literal, "base64:"):
+		return base64.StdEncoding.DecodeString(literal[len("base64:"):])
+	default:
+		return nil, fmt.Errorf("expected 0x or base64: prefix, got %q", literal)
+	}
+}
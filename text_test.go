@@ -0,0 +1,179 @@
+package abi_test
+
+import (
+	"encoding/base64"
+	"math/big"
+	"math/rand"
+	"strings"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Text format", func() {
+	primitives := []abi.Type{
+		abi.TypeString, abi.TypeBytes, abi.TypeBytes32, abi.TypeBytes65,
+		abi.TypeBool, abi.TypeU8, abi.TypeU16, abi.TypeU32, abi.TypeU64, abi.TypeU128, abi.TypeU256,
+	}
+	randomFields := func(r *rand.Rand) []abi.RecordField {
+		fields := []abi.RecordField{}
+		for i, ty := range primitives {
+			if r.Intn(2) == 0 {
+				continue
+			}
+			fields = append(fields, abi.RecordField{Name: "f" + string(rune('a'+i)), Type: ty})
+		}
+		return fields
+	}
+	randomRecord := func(r *rand.Rand, fields []abi.RecordField) abi.Record {
+		values := []abi.Value{}
+		for _, field := range fields {
+			values = append(values, abi.RandomValue(r, abi.NewTypeDesc(field.Type)))
+		}
+		record, err := abi.NewRecord(fields, values...)
+		Expect(err).ToNot(HaveOccurred())
+		return record
+	}
+
+	Context("when formatting and parsing", func() {
+		It("should return the same value", func() {
+			f := func(seed int64) bool {
+				r := rand.New(rand.NewSource(seed))
+				for _, ty := range primitives {
+					v := abi.RandomValue(r, abi.NewTypeDesc(ty))
+					for _, opts := range []abi.TextOptions{abi.DefaultTextOptions(), {Indent: "\t", Bytes: abi.BytesBase64}} {
+						w, err := abi.ParseText(abi.FormatText(v, opts))
+						Expect(err).ToNot(HaveOccurred())
+						Expect(abi.Equal(v, w)).To(BeTrue())
+					}
+				}
+				fields := randomFields(r)
+				records := []abi.Value{randomRecord(r, fields), randomRecord(r, fields)}
+				list, err := abi.NewList(abi.DescOf(records[0]), records...)
+				Expect(err).ToNot(HaveOccurred())
+				v, err := abi.NewRecord(
+					[]abi.RecordField{{Name: "list", Type: abi.TypeList}, {Name: "empty", Type: abi.TypeList}, {Name: "some", Type: abi.TypeMaybe}, {Name: "none", Type: abi.TypeMaybe}},
+					list, abi.List{Elem: abi.DescOf(list)}, abi.NewSome(records[0]), abi.NewNone(abi.DescOf(list)),
+				)
+				Expect(err).ToNot(HaveOccurred())
+				for _, opts := range []abi.TextOptions{abi.DefaultTextOptions(), {Indent: "  "}} {
+					w, err := abi.ParseText(abi.FormatText(v, opts))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(abi.Equal(v, w)).To(BeTrue())
+				}
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
+
+	Context("when formatting", func() {
+		v := abi.MustParseText(`record{memo: str("hi"), outputs: list<record{to:b,amount:u256}>[record{to: b(0x0102), amount: u256(1000)}], ok: maybe<bool>(bool(true)), none: list<u8>[]}`)
+
+		It("should annotate every value with its type", func() {
+			Expect(abi.FormatText(v, abi.DefaultTextOptions())).To(Equal(`record{memo: str("hi"), outputs: list<record{to:b,amount:u256}>[record{to: b(0x0102), amount: u256(1000)}], ok: maybe<bool>(bool(true)), none: list<u8>[]}`))
+			Expect(v.(abi.Record).String()).To(Equal(abi.FormatText(v, abi.DefaultTextOptions())))
+			Expect(abi.String("hi").String()).To(Equal("hi"))
+		})
+
+		It("should indent", func() {
+			Expect(abi.FormatText(v, abi.TextOptions{Indent: "  "})).To(Equal(strings.Join([]string{
+				`record{`,
+				`  memo: str("hi"),`,
+				`  outputs: list<record{to:b,amount:u256}>[`,
+				`    record{`,
+				`      to: b(0x0102),`,
+				`      amount: u256(1000),`,
+				`    },`,
+				`  ],`,
+				`  ok: maybe<bool>(bool(true)),`,
+				`  none: list<u8>[],`,
+				`}`,
+			}, "\n")))
+		})
+
+		It("should render bytes", func() {
+			b32 := abi.Bytes32{1, 2, 3}
+			Expect(abi.FormatText(b32, abi.TextOptions{Bytes: abi.BytesBase64})).To(Equal("b32(base64:" + base64.StdEncoding.EncodeToString(b32[:]) + ")"))
+			Expect(abi.FormatText(b32, abi.TextOptions{Bytes: abi.BytesTruncated, TruncateAfter: 2})).To(Equal("b32(0x0102...(32 bytes))"))
+			Expect(abi.FormatText(abi.Bytes{1}, abi.TextOptions{Bytes: abi.BytesTruncated, TruncateAfter: 2})).To(Equal("b(0x01)"))
+
+			_, err := abi.ParseText("b32(0x0102...(32 bytes))")
+			Expect(err).To(MatchError(ContainSubstring("truncated")))
+		})
+
+		It("should quote field names that are not identifiers", func() {
+			record, err := abi.NewRecord([]abi.RecordField{{Name: "two words", Type: abi.TypeU8}}, abi.NewU8(1))
+			Expect(err).ToNot(HaveOccurred())
+			text := abi.FormatText(record, abi.DefaultTextOptions())
+			Expect(text).To(Equal(`record{"two words": u8(1)}`))
+			Expect(abi.Equal(abi.MustParseText(text), record)).To(BeTrue())
+		})
+	})
+
+	Context("when parsing hand-written text", func() {
+		It("should accept comments, hex numbers, and trailing commas", func() {
+			v := abi.MustParseText(`
+				// A transfer.
+				record{
+					amount: u256(0xff), // 255
+					nonce:  u64(7),
+					tags:   list<str>[str("a"), str("b"),],
+				}
+			`)
+			amount, err := abi.Query(v, ".amount")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(amount[0].Value).To(Equal(abi.NewU256FromInt(big.NewInt(255))))
+			tags, err := abi.Query(v, ".tags[1]")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tags[0].Value).To(Equal(abi.String("b")))
+		})
+
+		It("should return errors with the offset and path", func() {
+			for text, msg := range map[string]string{
+				``:                                   "offset 0",
+				`u7(1)`:                              "Type(u7)",
+				`u8(256)`:                            "overflow: expected .<=255, got 256 at offset 0",
+				`record{a: list<u8>[u8(1), u9(2)]}`:  "offset 26",
+				`record{a: list<u8>[u8(1), u16(2)]}`: "expected .a[1] to have type u8, got type u16",
+				`record{a: u8(-1)}`:                  "underflow: expected .a>=0",
+				`record{a: u8(1), a: u8(2)}`:         "duplicate field .a",
+				`record{a: u8(1) b: u8(2)}`:          `expected ","`,
+				`b32(0x01)`:                          "expected .",
+				`b(01)`:                              "0x or base64",
+				`bool(yes)`:                          "true or false",
+				`u8(+1)`:                             "integer",
+				`u8(0x-1)`:                           "integer",
+				`str("unterminated)`:                 "unterminated",
+				`u8(1) u8(2)`:                        "unexpected",
+				`maybe()`:                            `expected "<"`,
+				`maybe<u8>(u16(1))`:                  "expected . to have type u8, got type u16",
+				`maybe<u8>(nothing)`:                 "Type(nothing)",
+				`list<u8>`:                           `expected "["`,
+				`list<list>[]`:                       `expected "<"`,
+				`list<record{a:u8,a:u8}>[]`:          "duplicate field a",
+				`list<list<u8>>[list<u8>[], list<str>[]]`:                "expected [1] to have type list<u8>, got type list<str>",
+				`list<record{a:u8}>[record{a: u8(1)}, record{b: u8(1)}]`: "expected [1] to have type record{a:u8}, got type record{b:u8}",
+			} {
+				_, err := abi.ParseText(text)
+				Expect(err).To(MatchError(ContainSubstring(msg)), text)
+			}
+		})
+
+		It("should limit the depth", func() {
+			text := strings.Repeat("list<", 64) + "u8" + strings.Repeat(">", 64) + "[]"
+			_, err := abi.ParseText(text)
+			Expect(err).To(BeAssignableToTypeOf(abi.LimitError{}))
+			text = strings.Repeat("maybe<u8>(", 64) + "u8(1)" + strings.Repeat(")", 64)
+			_, err = abi.ParseText(text)
+			Expect(err).To(BeAssignableToTypeOf(abi.LimitError{}))
+		})
+
+		It("should panic when using MustParseText", func() {
+			Expect(func() { abi.MustParseText("u8(") }).To(Panic())
+		})
+	})
+})
@@ -0,0 +1,445 @@
+package abi_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// update the golden test vectors instead of checking them. Run with:
+//
+//	go test -run TestABI -args -update
+var update = flag.Bool("update", false, "update the golden test vectors in testdata/vectors")
+
+// vectorsVersion is the version of the golden test vectors. It must be
+// incremented, and the change described in testdata/vectors/README.md,
+// whenever a vector changes in a way that breaks implementations that pass the
+// previous version.
+const vectorsVersion = "3"
+
+// A vector is a golden test vector. It describes a value of a type, given as a
+// type description, in its JSON and binary (hex) forms. A vector with an error
+// describes an input that must be rejected; only the form that is given
+// (binary or JSON) is checked. A vector that is decode only describes a
+// non-canonical binary input that decodes to the JSON form, but does not
+// encode back to the same binary.
+type vector struct {
+	Description string          `json:"description"`
+	Type        string          `json:"type"`
+	JSON        json.RawMessage `json:"json,omitempty"`
+	Binary      *string         `json:"binary,omitempty"`
+	MaxBytes    int             `json:"maxBytes,omitempty"`
+	DecodeOnly  bool            `json:"decodeOnly,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// A typeVector is a golden test vector for a type identifier.
+type typeVector struct {
+	Description string          `json:"description"`
+	JSON        json.RawMessage `json:"json,omitempty"`
+	Binary      string          `json:"binary"`
+	Error       string          `json:"error,omitempty"`
+}
+
+var _ = Describe("Golden test vectors", func() {
+	typesPath := filepath.Join("testdata", "vectors", "types.json")
+	valuesPath := filepath.Join("testdata", "vectors", "values.json")
+	versionPath := filepath.Join("testdata", "vectors", "VERSION")
+
+	Context("when generating vectors", func() {
+		It("should match the checked-in vectors", func() {
+			types, err := json.MarshalIndent(generateTypeVectors(), "", "  ")
+			Expect(err).ToNot(HaveOccurred())
+			values, err := json.MarshalIndent(generateValueVectors(), "", "  ")
+			Expect(err).ToNot(HaveOccurred())
+			types, values = append(types, '\n'), append(values, '\n')
+
+			if *update {
+				Expect(ioutil.WriteFile(typesPath, types, 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(valuesPath, values, 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(versionPath, []byte(vectorsVersion+"\n"), 0644)).To(Succeed())
+			}
+
+			version, err := ioutil.ReadFile(versionPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(version)).To(Equal(vectorsVersion + "\n"))
+
+			expectedTypes, err := ioutil.ReadFile(typesPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(types)).To(Equal(string(expectedTypes)))
+			expectedValues, err := ioutil.ReadFile(valuesPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(values)).To(Equal(string(expectedValues)))
+		})
+	})
+
+	Context("when verifying type vectors", func() {
+		It("should decode and encode every vector", func() {
+			data, err := ioutil.ReadFile(typesPath)
+			Expect(err).ToNot(HaveOccurred())
+			vectors := []typeVector{}
+			Expect(json.Unmarshal(data, &vectors)).To(Succeed())
+			Expect(vectors).ToNot(BeEmpty())
+
+			for _, v := range vectors {
+				binary, err := hex.DecodeString(v.Binary)
+				Expect(err).ToNot(HaveOccurred())
+				ty := abi.Type(0)
+				_, err = ty.Unmarshal(bytes.NewReader(binary), abi.MaxBytes)
+				if v.Error != "" {
+					Expect(err).To(HaveOccurred(), v.Description)
+					continue
+				}
+				Expect(err).ToNot(HaveOccurred(), v.Description)
+				Expect(ty.MarshalJSON()).To(MatchJSON(v.JSON), v.Description)
+
+				ty = abi.Type(0)
+				Expect(ty.UnmarshalJSON(v.JSON)).To(Succeed(), v.Description)
+				Expect(surge.ToBinary(ty)).To(Equal(binary), v.Description)
+			}
+		})
+	})
+
+	Context("when verifying value vectors", func() {
+		It("should decode and encode every vector", func() {
+			data, err := ioutil.ReadFile(valuesPath)
+			Expect(err).ToNot(HaveOccurred())
+			vectors := []vector{}
+			Expect(json.Unmarshal(data, &vectors)).To(Succeed())
+			Expect(vectors).ToNot(BeEmpty())
+
+			for _, v := range vectors {
+				desc, err := abi.ParseTypeDesc(v.Type)
+				Expect(err).ToNot(HaveOccurred(), v.Description)
+				maxBytes := abi.MaxBytes
+				if v.MaxBytes != 0 {
+					maxBytes = v.MaxBytes
+				}
+
+				if desc.Type == abi.TypeList || desc.Type == abi.TypeMaybe || desc.Type == abi.TypeRecord {
+					// Lists, maybes and records are only decoded from
+					// binary, and must encode back to the same binary.
+					binary := mustDecodeHex(*v.Binary)
+					value, _, err := abi.UnmarshalValue(bytes.NewReader(binary), desc, maxBytes)
+					if v.Error != "" {
+						Expect(err).To(HaveOccurred(), v.Description)
+						continue
+					}
+					Expect(err).ToNot(HaveOccurred(), v.Description)
+					Expect(value.MarshalJSON()).To(MatchJSON(v.JSON), v.Description)
+					Expect(surge.ToBinary(value)).To(Equal(binary), v.Description)
+					continue
+				}
+				ty := desc.Type
+
+				if v.Binary != nil {
+					binary, err := hex.DecodeString(*v.Binary)
+					Expect(err).ToNot(HaveOccurred())
+					value := newVectorValue(ty)
+					_, err = value.Unmarshal(bytes.NewReader(binary), maxBytes)
+					if v.Error != "" {
+						Expect(err).To(HaveOccurred(), v.Description)
+					} else {
+						Expect(err).ToNot(HaveOccurred(), v.Description)
+						Expect(value.MarshalJSON()).To(MatchJSON(v.JSON), v.Description)
+					}
+				}
+
+				if v.JSON != nil {
+					value := newVectorValue(ty)
+					err := value.UnmarshalJSON(v.JSON)
+					if v.Error != "" {
+						Expect(err).To(HaveOccurred(), v.Description)
+						continue
+					}
+					Expect(err).ToNot(HaveOccurred(), v.Description)
+					if v.DecodeOnly {
+						continue
+					}
+					Expect(surge.ToBinary(value)).To(Equal(mustDecodeHex(*v.Binary)), v.Description)
+				}
+			}
+		})
+	})
+})
+
+// vectorValue is implemented by pointers to every bytes and scalar type.
+type vectorValue interface {
+	surge.Marshaler
+	json.Marshaler
+	json.Unmarshaler
+	Unmarshal(r io.Reader, m int) (int, error)
+}
+
+// newVectorValue returns a pointer to a new value of the given type.
+func newVectorValue(ty abi.Type) vectorValue {
+	switch ty {
+	case abi.TypeString:
+		return new(abi.String)
+	case abi.TypeBytes:
+		return new(abi.Bytes)
+	case abi.TypeBytes32:
+		return new(abi.Bytes32)
+	case abi.TypeBytes65:
+		return new(abi.Bytes65)
+	case abi.TypeBool:
+		return new(abi.Bool)
+	case abi.TypeU8:
+		return new(abi.U8)
+	case abi.TypeU16:
+		return new(abi.U16)
+	case abi.TypeU32:
+		return new(abi.U32)
+	case abi.TypeU64:
+		return new(abi.U64)
+	case abi.TypeU128:
+		return new(abi.U128)
+	case abi.TypeU256:
+		return new(abi.U256)
+	}
+	panic("non-exhaustive pattern")
+}
+
+// mustDecodeHex decodes a hex string, failing the test if it is malformed.
+func mustDecodeHex(str string) []byte {
+	data, err := hex.DecodeString(str)
+	Expect(err).ToNot(HaveOccurred())
+	return data
+}
+
+// generateTypeVectors returns vectors for every Type constant, and for type
+// identifiers that must be rejected.
+func generateTypeVectors() []typeVector {
+	vectors := []typeVector{}
+	for _, ty := range []abi.Type{
+		abi.TypeString, abi.TypeBytes, abi.TypeBytes32, abi.TypeBytes65,
+		abi.TypeBool, abi.TypeU8, abi.TypeU16, abi.TypeU32, abi.TypeU64, abi.TypeU128, abi.TypeU256,
+		abi.TypeMaybe, abi.TypeList, abi.TypeRecord,
+	} {
+		data, err := ty.MarshalJSON()
+		Expect(err).ToNot(HaveOccurred())
+		binary, err := surge.ToBinary(ty)
+		Expect(err).ToNot(HaveOccurred())
+		vectors = append(vectors, typeVector{
+			Description: ty.String(),
+			JSON:        data,
+			Binary:      hex.EncodeToString(binary),
+		})
+	}
+	return append(vectors,
+		typeVector{Description: "nil is not a valid type", Binary: "0000", Error: "non-exhaustive pattern"},
+		typeVector{Description: "unknown type", Binary: "03e7", Error: "non-exhaustive pattern"},
+		typeVector{Description: "truncated", Binary: "00", Error: "unexpected EOF"},
+	)
+}
+
+// generateValueVectors returns vectors for values of every bytes and scalar
+// type, for lists, maybes and records, and for inputs that must be rejected.
+func generateValueVectors() []vector {
+	vectors := []vector{}
+	add := func(description string, v abi.Value, maxBytes int) {
+		data, err := v.MarshalJSON()
+		Expect(err).ToNot(HaveOccurred())
+		binary, err := surge.ToBinary(v)
+		Expect(err).ToNot(HaveOccurred())
+		encoded := hex.EncodeToString(binary)
+		vectors = append(vectors, vector{
+			Description: description,
+			Type:        abi.DescOf(v).String(),
+			JSON:        data,
+			Binary:      &encoded,
+			MaxBytes:    maxBytes,
+		})
+	}
+	addBinaryError := func(description string, ty abi.Type, binary string, maxBytes int, reason string) {
+		vectors = append(vectors, vector{
+			Description: description,
+			Type:        ty.String(),
+			Binary:      &binary,
+			MaxBytes:    maxBytes,
+			Error:       reason,
+		})
+	}
+	addDescBinaryError := func(description string, desc string, binary string, maxBytes int, reason string) {
+		vectors = append(vectors, vector{
+			Description: description,
+			Type:        desc,
+			Binary:      &binary,
+			MaxBytes:    maxBytes,
+			Error:       reason,
+		})
+	}
+	addJSONError := func(description string, ty abi.Type, data string, reason string) {
+		vectors = append(vectors, vector{
+			Description: description,
+			Type:        ty.String(),
+			JSON:        json.RawMessage(data),
+			Error:       reason,
+		})
+	}
+	bigInt := func(str string) *big.Int {
+		x, ok := new(big.Int).SetString(str, 0)
+		Expect(ok).To(BeTrue())
+		return x
+	}
+	sequential := func(n int) []byte {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		return data
+	}
+	ones := func(n int) []byte {
+		return bytes.Repeat([]byte{0xff}, n)
+	}
+
+	// Strings.
+	add("empty string", abi.String(""), 0)
+	add("ascii string", abi.String("hello, world"), 0)
+	add("unicode string", abi.String("héllo 世界 \U0001f600"), 0)
+	add("string with escapes", abi.String("\"\\\n\t\u0000"), 0)
+	add("maximum length string for 64 max bytes", abi.String(strings.Repeat("a", 59)), 64)
+	addBinaryError("string exceeding 64 max bytes", abi.TypeString, hex.EncodeToString(append([]byte{0, 0, 0, 60}, bytes.Repeat([]byte{'a'}, 60)...)), 64, "max bytes exceeded")
+	addBinaryError("string length exceeding max bytes", abi.TypeString, "ffffffff", 0, "max bytes exceeded")
+	addBinaryError("truncated string", abi.TypeString, "0000000568656c6c", 0, "unexpected EOF")
+	addBinaryError("truncated string length", abi.TypeString, "000000", 0, "unexpected EOF")
+
+	// Bytes.
+	add("empty bytes", abi.Bytes{}, 0)
+	add("one zero byte", abi.Bytes{0}, 0)
+	add("32 bytes", abi.Bytes(sequential(32)), 0)
+	add("maximum length bytes for 64 max bytes", abi.Bytes(ones(59)), 64)
+	addBinaryError("bytes exceeding 64 max bytes", abi.TypeBytes, hex.EncodeToString(append([]byte{0, 0, 0, 60}, ones(60)...)), 64, "max bytes exceeded")
+	addBinaryError("bytes length exceeding max bytes", abi.TypeBytes, "ffffffff", 0, "max bytes exceeded")
+	addBinaryError("truncated bytes", abi.TypeBytes, "00000002ff", 0, "unexpected EOF")
+	addJSONError("bytes with invalid base64", abi.TypeBytes, `"!!!!"`, "malformed")
+
+	// Fixed size bytes.
+	b32, b65 := abi.Bytes32{}, abi.Bytes65{}
+	add("zero bytes32", b32, 0)
+	copy(b32[:], sequential(32))
+	add("sequential bytes32", b32, 0)
+	copy(b32[:], ones(32))
+	add("ones bytes32", b32, 0)
+	addBinaryError("truncated bytes32", abi.TypeBytes32, hex.EncodeToString(ones(31)), 0, "unexpected EOF")
+	addJSONError("bytes32 with 31 bytes", abi.TypeBytes32, `"`+abi.Bytes(ones(31)).String()+`"`, "expected len=32")
+	addJSONError("bytes32 with 33 bytes", abi.TypeBytes32, `"`+abi.Bytes(ones(33)).String()+`"`, "expected len=32")
+	add("zero bytes65", b65, 0)
+	copy(b65[:], sequential(65))
+	add("sequential bytes65", b65, 0)
+	copy(b65[:], ones(65))
+	add("ones bytes65", b65, 0)
+	addBinaryError("truncated bytes65", abi.TypeBytes65, hex.EncodeToString(ones(64)), 0, "unexpected EOF")
+	addJSONError("bytes65 with 64 bytes", abi.TypeBytes65, `"`+abi.Bytes(ones(64)).String()+`"`, "expected len=65")
+
+	// Bools.
+	add("false", abi.NewBool(false), 0)
+	add("true", abi.NewBool(true), 0)
+	nonCanonical := "02"
+	vectors = append(vectors, vector{
+		Description: "non-zero bytes other than 01 decode as true",
+		Type:        abi.TypeBool.String(),
+		JSON:        json.RawMessage("true"),
+		Binary:      &nonCanonical,
+		DecodeOnly:  true,
+	})
+	addBinaryError("truncated bool", abi.TypeBool, "", 0, "EOF")
+	addJSONError("bool as a string", abi.TypeBool, `"true"`, "malformed")
+
+	// Integers up to 64 bits.
+	add("u8 zero", abi.NewU8(0), 0)
+	add("u8 one", abi.NewU8(1), 0)
+	add("u8 power of two", abi.NewU8(128), 0)
+	add("u8 max minus one", abi.NewU8(254), 0)
+	add("u8 max", abi.MaxU8(), 0)
+	addBinaryError("truncated u8", abi.TypeU8, "", 0, "EOF")
+	addJSONError("u8 overflow", abi.TypeU8, `"256"`, "overflow")
+	addJSONError("u8 as a number", abi.TypeU8, `1`, "malformed")
+
+	add("u16 zero", abi.NewU16(0), 0)
+	add("u16 one", abi.NewU16(1), 0)
+	add("u16 power of two", abi.NewU16(256), 0)
+	add("u16 max minus one", abi.NewU16(65534), 0)
+	add("u16 max", abi.MaxU16(), 0)
+	addBinaryError("truncated u16", abi.TypeU16, "ff", 0, "unexpected EOF")
+	addJSONError("u16 overflow", abi.TypeU16, `"65536"`, "overflow")
+
+	add("u32 zero", abi.NewU32(0), 0)
+	add("u32 one", abi.NewU32(1), 0)
+	add("u32 power of two", abi.NewU32(1<<16), 0)
+	add("u32 max minus one", abi.NewU32(1<<32-2), 0)
+	add("u32 max", abi.MaxU32(), 0)
+	addBinaryError("truncated u32", abi.TypeU32, "ffffff", 0, "unexpected EOF")
+	addJSONError("u32 overflow", abi.TypeU32, `"4294967296"`, "overflow")
+
+	add("u64 zero", abi.NewU64(0), 0)
+	add("u64 one", abi.NewU64(1), 0)
+	add("u64 power of two", abi.NewU64(1<<32), 0)
+	add("u64 max minus one", abi.NewU64(1<<64-2), 0)
+	add("u64 max", abi.MaxU64(), 0)
+	addBinaryError("truncated u64", abi.TypeU64, "ffffffffffffff", 0, "unexpected EOF")
+	addJSONError("u64 overflow", abi.TypeU64, `"18446744073709551616"`, "overflow")
+	addJSONError("u64 negative", abi.TypeU64, `"-1"`, "malformed")
+
+	// Big integers.
+	add("u128 zero", abi.NewU128FromInt(bigInt("0")), 0)
+	add("u128 one", abi.NewU128FromInt(bigInt("1")), 0)
+	add("u128 power of two", abi.NewU128FromInt(bigInt("0x10000000000000000")), 0)
+	add("u128 max minus one", abi.NewU128FromInt(new(big.Int).Sub(abi.MaxU128.Int(), big.NewInt(1))), 0)
+	add("u128 max", abi.MaxU128, 0)
+	add("u128 with 17 max bytes", abi.NewU128FromInt(bigInt("1")), 17)
+	addBinaryError("u128 with 16 max bytes", abi.TypeU128, hex.EncodeToString(make([]byte, 16)), 16, "max bytes exceeded")
+	addBinaryError("truncated u128", abi.TypeU128, hex.EncodeToString(ones(15)), 0, "unexpected EOF")
+	addJSONError("u128 overflow", abi.TypeU128, `"340282366920938463463374607431768211456"`, "overflow")
+	addJSONError("u128 negative", abi.TypeU128, `"-1"`, "underflow")
+
+	add("u256 zero", abi.NewU256FromInt(bigInt("0")), 0)
+	add("u256 one", abi.NewU256FromInt(bigInt("1")), 0)
+	add("u256 power of two", abi.NewU256FromInt(bigInt("0x100000000000000000000000000000000")), 0)
+	add("u256 max minus one", abi.NewU256FromInt(new(big.Int).Sub(abi.MaxU256.Int(), big.NewInt(1))), 0)
+	add("u256 max", abi.MaxU256, 0)
+	add("u256 with 33 max bytes", abi.NewU256FromInt(bigInt("1")), 33)
+	addBinaryError("u256 with 32 max bytes", abi.TypeU256, hex.EncodeToString(make([]byte, 32)), 32, "max bytes exceeded")
+	addBinaryError("truncated u256", abi.TypeU256, hex.EncodeToString(ones(31)), 0, "unexpected EOF")
+	addJSONError("u256 overflow", abi.TypeU256, `"115792089237316195423570985008687907853269984665640564039457584007913129639936"`, "overflow")
+	addJSONError("u256 negative", abi.TypeU256, `"-1"`, "underflow")
+	addJSONError("u256 hex", abi.TypeU256, `"0x1"`, "malformed")
+
+	// Lists.
+	add("empty list", abi.MustParseText(`list<u8>[]`), 0)
+	add("list of u8", abi.MustParseText(`list<u8>[u8(1), u8(2), u8(3)]`), 0)
+	add("list of strings", abi.MustParseText(`list<str>[str("a"), str(""), str("bc")]`), 0)
+	add("list of lists", abi.MustParseText(`list<list<u16>>[list<u16>[u16(1)], list<u16>[], list<u16>[u16(2), u16(3)]]`), 0)
+	add("list of records", abi.MustParseText(`list<record{to:b32,amount:u256}>[record{to: b32(0x`+strings.Repeat("01", 32)+`), amount: u256(1000)}]`), 0)
+	add("list of u64 for 21 max bytes", abi.MustParseText(`list<u64>[u64(1), u64(2)]`), 21)
+	addDescBinaryError("list of u64 exceeding 20 max bytes", "list<u64>", "0000000200000000000000010000000000000002", 20, "max bytes exceeded")
+	addDescBinaryError("list length exceeding max bytes", "list<u8>", "ffffffff", 0, "max bytes exceeded")
+	addDescBinaryError("truncated list", "list<u16>", "000000020001", 0, "unexpected EOF")
+
+	// Maybes.
+	add("maybe without a value", abi.MustParseText(`maybe<u8>(none)`), 0)
+	add("maybe with a value", abi.MustParseText(`maybe<u8>(u8(42))`), 0)
+	add("maybe of a list", abi.MustParseText(`maybe<list<str>>(list<str>[str("a")])`), 0)
+	addDescBinaryError("maybe with an invalid tag", "maybe<u8>", "022a", 0, "non-exhaustive pattern")
+	addDescBinaryError("truncated maybe", "maybe<u32>", "01000000", 0, "unexpected EOF")
+
+	// Records.
+	add("empty record", abi.MustParseText(`record{}`), 0)
+	add("record of scalars", abi.MustParseText(`record{a: u8(1), b: bool(true), c: u64(2)}`), 0)
+	add("record with nested values", abi.MustParseText(`record{memo: maybe<str>(str("hi")), outputs: list<record{amount:u256}>[record{amount: u256(1)}, record{amount: u256(2)}], ok: maybe<bool>(none)}`), 0)
+	addDescBinaryError("truncated record", "record{a:u8,b:u16}", "0100", 0, "unexpected EOF")
+
+	return vectors
+}
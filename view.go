@@ -0,0 +1,606 @@
+package abi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// A View is a lazy, read-only view over the binary encoding of a value. It
+// does not decode anything until it is accessed, and then it only decodes the
+// part of the encoding that is accessed. Lengths are always checked against the
+// size of the underlying data, so malicious lengths cannot cause allocations or
+// out of bounds reads.
+//
+// Views are built from the TypeDesc of the value, so they can navigate into
+// records, lists and maybes that are nested inside of each other. Navigating
+// into a list, record or maybe returns another View, so calls can be chained.
+// If navigation fails, the error is carried by the returned View and returned
+// by the accessor at the end of the chain:
+//
+//	amount, err := view.Field("outputs").Index(0).Field("amount").U256()
+//
+// Views do not copy the underlying data, and Bytes returns a slice of the
+// underlying data, so it must not be modified while a View is in use.
+//
+// Views check the DefaultLimits when they are accessed. Other Limits can be
+// used by calling WithLimits.
+type View struct {
+	data   []byte
+	desc   TypeDesc
+	depth  int
+	limits Limits
+	err    error
+}
+
+// NewDescView returns a View over the binary encoding of a value described by
+// the TypeDesc. The data may contain more bytes after the value; they are
+// ignored. An error is carried by the View if the TypeDesc is malformed.
+func NewDescView(desc TypeDesc, data []byte) View {
+	if err := desc.validate(nil); err != nil {
+		return View{err: err}
+	}
+	return View{data: data, desc: desc, limits: DefaultLimits()}
+}
+
+// NewView returns a View over the binary encoding of a value of the given
+// bytes or scalar Type. Use NewDescView for lists, records and maybes.
+func NewView(ty Type, data []byte) View {
+	if !isPrimitive(ty) {
+		return View{err: fmt.Errorf("non-exhaustive pattern: Type(%v)", ty)}
+	}
+	return NewDescView(NewTypeDesc(ty), data)
+}
+
+// NewListView returns a View over the binary encoding of a list whose elements
+// are of the given bytes or scalar Type. The binary encoding of a list is a
+// uint32 length prefix followed by the binary encoding of each element.
+func NewListView(elemTy Type, data []byte) View {
+	if !isPrimitive(elemTy) {
+		return View{err: fmt.Errorf("non-exhaustive pattern: Type(%v)", elemTy)}
+	}
+	return NewDescView(NewListDesc(NewTypeDesc(elemTy)), data)
+}
+
+// NewRecordView returns a View over the binary encoding of a record with the
+// given fields of bytes or scalar Types. Use NewDescView for records with
+// fields that are lists, records or maybes.
+func NewRecordView(fields []RecordField, data []byte) View {
+	descs := make([]FieldDesc, len(fields))
+	for i, field := range fields {
+		if !isPrimitive(field.Type) {
+			return View{err: fmt.Errorf("non-exhaustive pattern: field %v has type %v", field.Name, field.Type)}
+		}
+		descs[i] = FieldDesc{Name: field.Name, Desc: NewTypeDesc(field.Type)}
+	}
+	return NewDescView(NewRecordDesc(descs...), data)
+}
+
+// WithLimits returns the View, and every View that is navigated to from it,
+// with the given Limits. Accessors return a LimitError if a limit is exceeded.
+func (view View) WithLimits(limits Limits) View {
+	view.limits = limits
+	return view
+}
+
+// Type returns the type identifier of the viewed value.
+func (view View) Type() Type {
+	return view.desc.Type
+}
+
+// Desc returns the TypeDesc of the viewed value.
+func (view View) Desc() TypeDesc {
+	return view.desc
+}
+
+// Err returns the error that occurred while navigating to the View, if any.
+func (view View) Err() error {
+	return view.err
+}
+
+// Len returns the number of elements in a list.
+func (view View) Len() (int, error) {
+	if err := view.expect(TypeList); err != nil {
+		return 0, err
+	}
+	n, _, _, err := view.listLen(view.budget())
+	return n, err
+}
+
+// Index returns a View of the element at index i of a list. Elements before
+// the element are skipped by reading their lengths, without decoding them.
+func (view View) Index(i int) View {
+	if err := view.expect(TypeList); err != nil {
+		return View{err: err}
+	}
+	n, offset, _, err := view.listLen(view.budget())
+	if err != nil {
+		return View{err: err}
+	}
+	if i < 0 || i >= n {
+		return View{err: fmt.Errorf("expected index<%v, got index=%v", n, i)}
+	}
+	elem := *view.desc.Elem
+	if size, ok := fixedSize(elem.Type); ok {
+		offset += i * size
+	} else if elem.minSize() > 0 {
+		for j := 0; j < i; j++ {
+			size, err := view.limits.encodedSize(elem, view.data[offset:], view.depth+1)
+			if err != nil {
+				return View{err: err}
+			}
+			offset += size
+		}
+	}
+	return view.sub(elem, offset)
+}
+
+// Field returns a View of the field of a record with the given name. Fields
+// before the field are skipped by reading their lengths, without decoding them.
+func (view View) Field(name string) View {
+	if err := view.expect(TypeRecord); err != nil {
+		return View{err: err}
+	}
+	offset := 0
+	for _, field := range view.desc.Fields {
+		if field.Name == name {
+			return view.sub(field.Desc, offset)
+		}
+		size, err := view.limits.encodedSize(field.Desc, view.data[offset:], view.depth+1)
+		if err != nil {
+			return View{err: err}
+		}
+		offset += size
+	}
+	return View{err: fmt.Errorf("non-exhaustive pattern: field %v", name)}
+}
+
+// IsNone returns true if a maybe has no value.
+func (view View) IsNone() (bool, error) {
+	if err := view.expect(TypeMaybe); err != nil {
+		return false, err
+	}
+	some, err := view.some()
+	return !some, err
+}
+
+// Some returns a View of the value of a maybe. An error is carried by the
+// returned View if the maybe has no value.
+func (view View) Some() View {
+	if err := view.expect(TypeMaybe); err != nil {
+		return View{err: err}
+	}
+	some, err := view.some()
+	if err != nil {
+		return View{err: err}
+	}
+	if !some {
+		return View{err: fmt.Errorf("expected some, got none")}
+	}
+	return view.sub(*view.desc.Elem, 1)
+}
+
+// Value decodes the viewed value. Lists are decoded into a List, and records
+// are decoded into a Record.
+func (view View) Value() (Value, error) {
+	v, _, err := view.value(view.budget())
+	return v, err
+}
+
+// value decodes the viewed value. Lists of elements with an empty binary
+// encoding are charged against the budget, which is shared by all of the
+// values nested inside of the viewed value, and the remaining budget is
+// returned.
+func (view View) value(m int) (Value, int, error) {
+	if view.err != nil {
+		return nil, m, view.err
+	}
+	var v Value
+	var err error
+	switch view.desc.Type {
+	case TypeString:
+		v, err = view.String()
+	case TypeBytes:
+		var b Bytes
+		b, err = view.Bytes()
+		v = append(Bytes{}, b...)
+	case TypeBytes32:
+		v, err = view.Bytes32()
+	case TypeBytes65:
+		v, err = view.Bytes65()
+	case TypeBool:
+		v, err = view.Bool()
+	case TypeU8:
+		v, err = view.U8()
+	case TypeU16:
+		v, err = view.U16()
+	case TypeU32:
+		v, err = view.U32()
+	case TypeU64:
+		v, err = view.U64()
+	case TypeU128:
+		v, err = view.U128()
+	case TypeU256:
+		v, err = view.U256()
+	case TypeList:
+		return view.list(m)
+	case TypeRecord:
+		return view.record(m)
+	case TypeMaybe:
+		return view.maybe(m)
+	default:
+		err = fmt.Errorf("non-exhaustive pattern: Type(%v)", view.desc.Type)
+	}
+	return v, m, err
+}
+
+// list decodes the viewed list into a List.
+func (view View) list(m int) (Value, int, error) {
+	if err := view.expect(TypeList); err != nil {
+		return nil, m, err
+	}
+	n, offset, m, err := view.listLen(m)
+	if err != nil {
+		return nil, m, err
+	}
+	elems := make([]Value, n)
+	for i := range elems {
+		elem := view.sub(*view.desc.Elem, offset)
+		if elems[i], m, err = elem.value(m); err != nil {
+			return nil, m, err
+		}
+		offset += len(elem.data)
+	}
+	return List{Elem: *view.desc.Elem, Elems: elems}, m, nil
+}
+
+// record decodes the viewed record into a Record.
+func (view View) record(m int) (Value, int, error) {
+	if err := view.expect(TypeRecord); err != nil {
+		return nil, m, err
+	}
+	offset := 0
+	fields := make([]RecordField, len(view.desc.Fields))
+	values := make([]Value, len(view.desc.Fields))
+	for i, field := range view.desc.Fields {
+		value := view.sub(field.Desc, offset)
+		var err error
+		if values[i], m, err = value.value(m); err != nil {
+			return nil, m, err
+		}
+		offset += len(value.data)
+		fields[i] = RecordField{Name: field.Name, Type: field.Desc.Type}
+	}
+	return Record{Fields: fields, Values: values}, m, nil
+}
+
+// maybe decodes the viewed maybe into a Maybe.
+func (view View) maybe(m int) (Value, int, error) {
+	if err := view.expect(TypeMaybe); err != nil {
+		return nil, m, err
+	}
+	some, err := view.some()
+	if err != nil || !some {
+		return Maybe{Elem: *view.desc.Elem}, m, err
+	}
+	v, m, err := view.sub(*view.desc.Elem, 1).value(m)
+	if err != nil {
+		return nil, m, err
+	}
+	return Maybe{Elem: *view.desc.Elem, Value: v}, m, nil
+}
+
+// String returns the viewed String.
+func (view View) String() (String, error) {
+	data, err := view.variable(TypeString)
+	return String(data), err
+}
+
+// Bytes returns the viewed Bytes. The Bytes are a slice of the underlying data,
+// and are not copied.
+func (view View) Bytes() (Bytes, error) {
+	data, err := view.variable(TypeBytes)
+	return Bytes(data), err
+}
+
+// Bytes32 returns the viewed Bytes32.
+func (view View) Bytes32() (Bytes32, error) {
+	b32 := Bytes32{}
+	data, err := view.fixed(TypeBytes32)
+	copy(b32[:], data)
+	return b32, err
+}
+
+// Bytes65 returns the viewed Bytes65.
+func (view View) Bytes65() (Bytes65, error) {
+	b65 := Bytes65{}
+	data, err := view.fixed(TypeBytes65)
+	copy(b65[:], data)
+	return b65, err
+}
+
+// Bool returns the viewed Bool.
+func (view View) Bool() (Bool, error) {
+	data, err := view.fixed(TypeBool)
+	if err != nil {
+		return Bool{}, err
+	}
+	return NewBool(data[0] != 0), nil
+}
+
+// U8 returns the viewed U8.
+func (view View) U8() (U8, error) {
+	data, err := view.fixed(TypeU8)
+	if err != nil {
+		return U8{}, err
+	}
+	return NewU8(data[0]), nil
+}
+
+// U16 returns the viewed U16.
+func (view View) U16() (U16, error) {
+	data, err := view.fixed(TypeU16)
+	if err != nil {
+		return U16{}, err
+	}
+	return NewU16(binary.BigEndian.Uint16(data)), nil
+}
+
+// U32 returns the viewed U32.
+func (view View) U32() (U32, error) {
+	data, err := view.fixed(TypeU32)
+	if err != nil {
+		return U32{}, err
+	}
+	return NewU32(binary.BigEndian.Uint32(data)), nil
+}
+
+// U64 returns the viewed U64.
+func (view View) U64() (U64, error) {
+	data, err := view.fixed(TypeU64)
+	if err != nil {
+		return U64{}, err
+	}
+	return NewU64(binary.BigEndian.Uint64(data)), nil
+}
+
+// U128 returns the viewed U128.
+func (view View) U128() (U128, error) {
+	data, err := view.fixed(TypeU128)
+	if err != nil {
+		return U128{}, err
+	}
+	return U128{inner: new(big.Int).SetBytes(data)}, nil
+}
+
+// U256 returns the viewed U256.
+func (view View) U256() (U256, error) {
+	data, err := view.fixed(TypeU256)
+	if err != nil {
+		return U256{}, err
+	}
+	return U256{inner: new(big.Int).SetBytes(data)}, nil
+}
+
+// expect returns an error if the View has an error, is not of the given Type,
+// or exceeds its Limits.
+func (view View) expect(ty Type) error {
+	if view.err != nil {
+		return view.err
+	}
+	if view.desc.Type != ty {
+		return fmt.Errorf("expected type=%v, got type=%v", ty, view.desc.Type)
+	}
+	if err := view.limits.checkBytes(len(view.data)); err != nil {
+		return err
+	}
+	switch ty {
+	case TypeList, TypeMaybe:
+		return view.limits.checkDepth(view.depth + 1)
+	case TypeRecord:
+		if err := view.limits.checkDepth(view.depth + 1); err != nil {
+			return err
+		}
+		return view.limits.checkRecordFields(len(view.desc.Fields))
+	}
+	return nil
+}
+
+// sub returns a View of the value described by the TypeDesc at the offset,
+// nested one level deeper than the View.
+func (view View) sub(desc TypeDesc, offset int) View {
+	if offset > len(view.data) {
+		return View{err: fmt.Errorf("expected len>=%v, got len=%v", offset, len(view.data))}
+	}
+	size, err := view.limits.encodedSize(desc, view.data[offset:], view.depth+1)
+	if err != nil {
+		return View{err: err}
+	}
+	return View{data: view.data[offset : offset+size], desc: desc, depth: view.depth + 1, limits: view.limits}
+}
+
+// some returns true if the viewed maybe has a value.
+func (view View) some() (bool, error) {
+	if len(view.data) < 1 {
+		return false, fmt.Errorf("expected len>=1, got len=%v", len(view.data))
+	}
+	switch view.data[0] {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("non-exhaustive pattern: Maybe(%v)", view.data[0])
+	}
+}
+
+// listLen returns the length of the viewed list, the offset of its first
+// element, and the remaining budget after the elements are charged against it.
+func (view View) listLen(m int) (int, int, int, error) {
+	n, m, err := view.limits.listLen(*view.desc.Elem, view.data, m)
+	return n, 4, m, err
+}
+
+// budget returns the number of bytes that remain from the MaxBytes of the
+// Limits after the viewed data is charged against it. Lists of elements with
+// an empty binary encoding are charged against the budget, in the same way as
+// by UnmarshalValueWithLimits, so a View reads the same values as the decoder.
+func (view View) budget() int {
+	return view.limits.MaxBytes - len(view.data)
+}
+
+// fixed returns the data of a fixed size value of the given Type.
+func (view View) fixed(ty Type) ([]byte, error) {
+	if err := view.expect(ty); err != nil {
+		return nil, err
+	}
+	size, _ := fixedSize(ty)
+	if len(view.data) < size {
+		return nil, fmt.Errorf("expected len=%v, got len=%v", size, len(view.data))
+	}
+	return view.data[:size], nil
+}
+
+// variable returns the data of a length prefixed value of the given Type.
+func (view View) variable(ty Type) ([]byte, error) {
+	if err := view.expect(ty); err != nil {
+		return nil, err
+	}
+	size, err := view.limits.encodedSize(view.desc, view.data, view.depth)
+	if err != nil {
+		return nil, err
+	}
+	if err := view.limits.checkStringLen(size - 4); err != nil {
+		return nil, err
+	}
+	return view.data[4:size], nil
+}
+
+// fixedSize returns the size of the binary encoding of values of the given
+// Type. Returns false if the size depends on the value.
+func fixedSize(ty Type) (int, bool) {
+	switch ty {
+	case TypeBool, TypeU8:
+		return 1, true
+	case TypeU16:
+		return 2, true
+	case TypeU32:
+		return 4, true
+	case TypeU64:
+		return 8, true
+	case TypeU128:
+		return 16, true
+	case TypeU256, TypeBytes32:
+		return 32, true
+	case TypeBytes65:
+		return 65, true
+	default:
+		return 0, false
+	}
+}
+
+// encodedSize returns the size of the binary encoding of the value described
+// by the TypeDesc, at the given depth, at the start of the data. Nested values
+// are skipped by reading their lengths, and are checked against the Limits. An
+// error is returned if the data is too short.
+func (limits Limits) encodedSize(desc TypeDesc, data []byte, depth int) (int, error) {
+	if size, ok := fixedSize(desc.Type); ok {
+		if len(data) < size {
+			return 0, fmt.Errorf("expected len=%v, got len=%v", size, len(data))
+		}
+		return size, nil
+	}
+
+	switch desc.Type {
+	case TypeList:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return 0, err
+		}
+		// Lists that are nested inside of the viewed value are only charged
+		// when they are viewed, so they are checked against the whole budget
+		// here.
+		n, _, err := limits.listLen(*desc.Elem, data, limits.MaxBytes)
+		if err != nil {
+			return 0, err
+		}
+		offset := 4
+		if size, ok := fixedSize(desc.Elem.Type); ok {
+			return offset + n*size, nil
+		}
+		if desc.Elem.minSize() == 0 {
+			return offset, nil
+		}
+		for i := 0; i < n; i++ {
+			size, err := limits.encodedSize(*desc.Elem, data[offset:], depth+1)
+			if err != nil {
+				return 0, err
+			}
+			offset += size
+		}
+		return offset, nil
+
+	case TypeRecord:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return 0, err
+		}
+		if err := limits.checkRecordFields(len(desc.Fields)); err != nil {
+			return 0, err
+		}
+		offset := 0
+		for _, field := range desc.Fields {
+			size, err := limits.encodedSize(field.Desc, data[offset:], depth+1)
+			if err != nil {
+				return 0, err
+			}
+			offset += size
+		}
+		return offset, nil
+
+	case TypeMaybe:
+		if err := limits.checkDepth(depth + 1); err != nil {
+			return 0, err
+		}
+		some, err := View{data: data}.some()
+		if err != nil || !some {
+			return 1, err
+		}
+		size, err := limits.encodedSize(*desc.Elem, data[1:], depth+1)
+		return 1 + size, err
+	}
+
+	if len(data) < 4 {
+		return 0, fmt.Errorf("expected len>=4, got len=%v", len(data))
+	}
+	size := uint64(binary.BigEndian.Uint32(data))
+	if size > uint64(len(data)-4) {
+		return 0, fmt.Errorf("expected len>=%v, got len=%v", size+4, len(data))
+	}
+	return int(size) + 4, nil
+}
+
+// listLen returns the length of the list at the start of the data, whose
+// elements are described by the TypeDesc. If the elements have a binary
+// encoding that is not empty, the length is checked against the number of
+// remaining bytes, using the smallest size of an element. Otherwise, the
+// elements take no bytes, so they are charged against the budget instead, and
+// the remaining budget is returned.
+func (limits Limits) listLen(elem TypeDesc, data []byte, m int) (int, int, error) {
+	if len(data) < 4 {
+		return 0, m, fmt.Errorf("expected len>=4, got len=%v", len(data))
+	}
+	n := uint64(binary.BigEndian.Uint32(data))
+	if size := elem.minSize(); size > 0 {
+		if n*uint64(size) > uint64(len(data)-4) {
+			return 0, m, fmt.Errorf("overflow: list len=%v exceeds remaining bytes", n)
+		}
+	} else {
+		var err error
+		if m, err = elem.chargeElems(int(n), m); err != nil {
+			return 0, m, err
+		}
+	}
+	if err := limits.checkListLen(int(n)); err != nil {
+		return 0, m, err
+	}
+	return int(n), m, nil
+}
@@ -0,0 +1,278 @@
+package abi_test
+
+import (
+	"bytes"
+	"strings"
+	"testing/quick"
+
+	"github.com/renproject/abi"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Views", func() {
+	fields := []abi.RecordField{
+		{Name: "memo", Type: abi.TypeString},
+		{Name: "to", Type: abi.TypeBytes32},
+		{Name: "payload", Type: abi.TypeBytes},
+		{Name: "amount", Type: abi.TypeU256},
+		{Name: "nonce", Type: abi.TypeU64},
+	}
+
+	marshalRecord := func(vs ...abi.Value) []byte {
+		buf := new(bytes.Buffer)
+		for _, v := range vs {
+			_, err := v.Marshal(buf, abi.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		return buf.Bytes()
+	}
+
+	Context("when viewing a record", func() {
+		It("should return the fields", func() {
+			f := func(memo string, to [32]byte, payload []byte, amount [32]byte, nonce uint64) bool {
+				data := marshalRecord(abi.String(memo), abi.Bytes32(to), abi.Bytes(payload), abi.NewU256(amount), abi.NewU64(nonce))
+				view := abi.NewRecordView(fields, data)
+
+				actualMemo, err := view.Field("memo").String()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actualMemo).To(Equal(abi.String(memo)))
+				actualTo, err := view.Field("to").Bytes32()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actualTo).To(Equal(abi.Bytes32(to)))
+				actualPayload, err := view.Field("payload").Bytes()
+				Expect(err).ToNot(HaveOccurred())
+				Expect([]byte(actualPayload)).To(Equal(append([]byte{}, payload...)))
+				actualAmount, err := view.Field("amount").U256()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actualAmount.Equal(abi.NewU256(amount))).To(BeTrue())
+				actualNonce, err := view.Field("nonce").Value()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actualNonce).To(Equal(abi.NewU64(nonce)))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should not copy bytes", func() {
+			data := marshalRecord(abi.String("memo"), abi.Bytes32{}, abi.Bytes{1, 2, 3}, abi.NewU256([32]byte{}), abi.NewU64(0))
+			payload, err := abi.NewRecordView(fields, data).Field("payload").Bytes()
+			Expect(err).ToNot(HaveOccurred())
+			payload[0] = 42
+			Expect(bytes.Contains(data, []byte{42, 2, 3})).To(BeTrue())
+		})
+
+		It("should return an error for unknown fields and wrong types", func() {
+			data := marshalRecord(abi.String("memo"), abi.Bytes32{}, abi.Bytes{}, abi.NewU256([32]byte{}), abi.NewU64(0))
+			view := abi.NewRecordView(fields, data)
+			_, err := view.Field("unknown").U64()
+			Expect(err).To(HaveOccurred())
+			_, err = view.Field("nonce").U32()
+			Expect(err).To(HaveOccurred())
+			_, err = view.Index(0).U32()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should decode the record", func() {
+			data := marshalRecord(abi.String("memo"), abi.Bytes32{1}, abi.Bytes{2}, abi.NewU256([32]byte{31: 3}), abi.NewU64(4))
+			v, err := abi.NewRecordView(fields, data).Value()
+			Expect(err).ToNot(HaveOccurred())
+			expected, err := abi.NewRecord(fields, abi.String("memo"), abi.Bytes32{1}, abi.Bytes{2}, abi.NewU256([32]byte{31: 3}), abi.NewU64(4))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.Equal(v, expected)).To(BeTrue())
+
+			_, err = abi.NewRecordView(fields, data[:len(data)-1]).Value()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error when the record is truncated", func() {
+			data := marshalRecord(abi.String("memo"), abi.Bytes32{}, abi.Bytes{}, abi.NewU256([32]byte{}), abi.NewU64(0))
+			for i := 0; i < len(data); i++ {
+				_, err := abi.NewRecordView(fields, data[:i]).Field("nonce").U64()
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Context("when viewing a list", func() {
+		It("should return the elements", func() {
+			f := func(xs []uint16, strs []string) bool {
+				u16s := make([]abi.U16, len(xs))
+				for i, x := range xs {
+					u16s[i] = abi.NewU16(x)
+				}
+				data, err := surge.ToBinary(u16s)
+				Expect(err).ToNot(HaveOccurred())
+				view := abi.NewListView(abi.TypeU16, data)
+				n, err := view.Len()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(len(xs)))
+				for i := range xs {
+					u16, err := view.Index(i).U16()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(u16).To(Equal(u16s[i]))
+				}
+				_, err = view.Index(len(xs)).U16()
+				Expect(err).To(HaveOccurred())
+
+				data, err = surge.ToBinary(strs)
+				Expect(err).ToNot(HaveOccurred())
+				view = abi.NewListView(abi.TypeString, data)
+				for i := range strs {
+					str, err := view.Index(i).String()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str).To(Equal(abi.String(strs[i])))
+				}
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should decode the list", func() {
+			f := func(strs []string) bool {
+				data, err := surge.ToBinary(strs)
+				Expect(err).ToNot(HaveOccurred())
+				v, err := abi.NewListView(abi.TypeString, data).Value()
+				Expect(err).ToNot(HaveOccurred())
+				list := v.(abi.List)
+				Expect(list.Elem).To(Equal(abi.NewTypeDesc(abi.TypeString)))
+				Expect(list.Elems).To(HaveLen(len(strs)))
+				for i := range strs {
+					Expect(list.Elems[i]).To(Equal(abi.String(strs[i])))
+				}
+				encoded, err := surge.ToBinary(list)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(encoded).To(Equal(data))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should return an error for malicious lengths", func() {
+			view := abi.NewListView(abi.TypeBytes32, []byte{0xff, 0xff, 0xff, 0xff, 0x00})
+			_, err := view.Len()
+			Expect(err).To(HaveOccurred())
+			_, err = view.Index(1).Bytes32()
+			Expect(err).To(HaveOccurred())
+
+			view = abi.NewListView(abi.TypeBytes, []byte{0, 0, 0, 2, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+			_, err = view.Index(0).Bytes()
+			Expect(err).To(HaveOccurred())
+			_, err = view.Index(1).Bytes()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when viewing nested values", func() {
+		It("should navigate records, lists and maybes", func() {
+			v := abi.MustParseText(`record{memo: maybe<str>(str("hi")), outputs: list<record{to:b32,amount:u256,refund:maybe<u64>}>[` +
+				`record{to: b32(0x` + strings.Repeat("01", 32) + `), amount: u256(1), refund: maybe<u64>(none)}, ` +
+				`record{to: b32(0x` + strings.Repeat("02", 32) + `), amount: u256(2), refund: maybe<u64>(u64(3))}], nonce: u64(4)}`)
+			data, err := surge.ToBinary(v)
+			Expect(err).ToNot(HaveOccurred())
+			view := abi.NewDescView(abi.DescOf(v), data)
+
+			memo, err := view.Field("memo").Some().String()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(memo).To(Equal(abi.String("hi")))
+			n, err := view.Field("outputs").Len()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(2))
+			amount, err := view.Field("outputs").Index(1).Field("amount").U256()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(amount.Equal(abi.NewU256FromU64(abi.NewU64(2)))).To(BeTrue())
+			none, err := view.Field("outputs").Index(0).Field("refund").IsNone()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(none).To(BeTrue())
+			_, err = view.Field("outputs").Index(0).Field("refund").Some().U64()
+			Expect(err).To(HaveOccurred())
+			refund, err := view.Field("outputs").Index(1).Field("refund").Some().U64()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(refund).To(Equal(abi.NewU64(3)))
+			nonce, err := view.Field("nonce").U64()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(nonce).To(Equal(abi.NewU64(4)))
+
+			decoded, err := view.Value()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.Equal(decoded, v)).To(BeTrue())
+		})
+
+		It("should read lists of empty records in the same way as the decoder", func() {
+			v := abi.MustParseText(`record{empty: list<record{}>[record{}, record{}, record{}], nonce: u64(4)}`)
+			data, err := surge.ToBinary(v)
+			Expect(err).ToNot(HaveOccurred())
+			view := abi.NewDescView(abi.DescOf(v), data)
+
+			list := abi.NewDescView(abi.NewListDesc(abi.NewRecordDesc()), data)
+			Expect(list.Len()).To(Equal(3))
+			Expect(view.Field("empty").Len()).To(Equal(3))
+			_, err = view.Field("empty").Index(2).Value()
+			Expect(err).ToNot(HaveOccurred())
+			nonce, err := view.Field("nonce").U64()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(nonce).To(Equal(abi.NewU64(4)))
+
+			decoded, _, err := abi.UnmarshalValue(bytes.NewReader(data), abi.DescOf(v), len(data)+4)
+			Expect(err).ToNot(HaveOccurred())
+			viewed, err := view.Value()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(abi.Equal(viewed, decoded)).To(BeTrue())
+			Expect(abi.Equal(viewed, v)).To(BeTrue())
+		})
+
+		It("should check the depth of nested values", func() {
+			v := abi.MustParseText(`list<list<list<u8>>>[list<list<u8>>[list<u8>[u8(1)]]]`)
+			data, err := surge.ToBinary(v)
+			Expect(err).ToNot(HaveOccurred())
+
+			limits := abi.DefaultLimits()
+			limits.MaxDepth = 3
+			view := abi.NewDescView(abi.DescOf(v), data).WithLimits(limits)
+			x, err := view.Index(0).Index(0).Index(0).U8()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(x).To(Equal(abi.NewU8(1)))
+
+			limits.MaxDepth = 2
+			view = view.WithLimits(limits)
+			_, err = view.Len()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = view.Index(0).Index(0).Len()
+			Expect(err).To(HaveOccurred())
+			_, err = view.Value()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error for malformed type descs", func() {
+			_, err := abi.NewDescView(abi.NewTypeDesc(abi.TypeList), []byte{0, 0, 0, 0}).Len()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when viewing random data", func() {
+		It("should not panic", func() {
+			f := func(data []byte, i uint8) bool {
+				view := abi.NewRecordView(fields, data)
+				for _, field := range fields {
+					view.Field(field.Name).Value()
+				}
+				view.Value()
+				desc, err := abi.ParseTypeDesc("record{a:maybe<list<str>>,b:list<record{c:u8,d:maybe<b>}>}")
+				Expect(err).ToNot(HaveOccurred())
+				nested := abi.NewDescView(desc, data)
+				nested.Value()
+				nested.Field("a").Some().Index(int(i)).Value()
+				nested.Field("b").Index(int(i)).Field("d").Some().Value()
+				for _, ty := range []abi.Type{abi.TypeString, abi.TypeBytes, abi.TypeU64, abi.TypeBytes65} {
+					abi.NewListView(ty, data).Index(int(i)).Value()
+					abi.NewListView(ty, data).Value()
+					abi.NewView(ty, data).Value()
+				}
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,251 @@
+package abi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SkipChildren can be returned by EnterList and EnterRecord to skip the
+// children of the list or record. The matching LeaveList or LeaveRecord is
+// still called.
+var SkipChildren = errors.New("skip children")
+
+// A Visitor is called for every value visited by Walk. Each callback is given
+// the Path of the value. If a callback returns an error, other than
+// SkipChildren, then Walk stops and returns the error. Embed BaseVisitor to
+// only implement some of the callbacks.
+type Visitor interface {
+	VisitString(path Path, v String) error
+	VisitBytes(path Path, v Bytes) error
+	VisitBytes32(path Path, v Bytes32) error
+	VisitBytes65(path Path, v Bytes65) error
+	VisitBool(path Path, v Bool) error
+	VisitU8(path Path, v U8) error
+	VisitU16(path Path, v U16) error
+	VisitU32(path Path, v U32) error
+	VisitU64(path Path, v U64) error
+	VisitU128(path Path, v U128) error
+	VisitU256(path Path, v U256) error
+
+	// EnterList is called before the elements of a list are visited, and
+	// LeaveList is called after.
+	EnterList(path Path, v List) error
+	LeaveList(path Path, v List) error
+
+	// EnterRecord is called before the fields of a record are visited, and
+	// LeaveRecord is called after.
+	EnterRecord(path Path, v Record) error
+	LeaveRecord(path Path, v Record) error
+
+	// EnterMaybe is called before the value of a maybe is visited, and
+	// LeaveMaybe is called after. The value has the same Path as the maybe.
+	EnterMaybe(path Path, v Maybe) error
+	LeaveMaybe(path Path, v Maybe) error
+}
+
+// BaseVisitor implements every callback of the Visitor interface by doing
+// nothing.
+type BaseVisitor struct{}
+
+// VisitString does nothing.
+func (BaseVisitor) VisitString(Path, String) error { return nil }
+
+// VisitBytes does nothing.
+func (BaseVisitor) VisitBytes(Path, Bytes) error { return nil }
+
+// VisitBytes32 does nothing.
+func (BaseVisitor) VisitBytes32(Path, Bytes32) error { return nil }
+
+// VisitBytes65 does nothing.
+func (BaseVisitor) VisitBytes65(Path, Bytes65) error { return nil }
+
+// VisitBool does nothing.
+func (BaseVisitor) VisitBool(Path, Bool) error { return nil }
+
+// VisitU8 does nothing.
+func (BaseVisitor) VisitU8(Path, U8) error { return nil }
+
+// VisitU16 does nothing.
+func (BaseVisitor) VisitU16(Path, U16) error { return nil }
+
+// VisitU32 does nothing.
+func (BaseVisitor) VisitU32(Path, U32) error { return nil }
+
+// VisitU64 does nothing.
+func (BaseVisitor) VisitU64(Path, U64) error { return nil }
+
+// VisitU128 does nothing.
+func (BaseVisitor) VisitU128(Path, U128) error { return nil }
+
+// VisitU256 does nothing.
+func (BaseVisitor) VisitU256(Path, U256) error { return nil }
+
+// EnterList does nothing.
+func (BaseVisitor) EnterList(Path, List) error { return nil }
+
+// LeaveList does nothing.
+func (BaseVisitor) LeaveList(Path, List) error { return nil }
+
+// EnterRecord does nothing.
+func (BaseVisitor) EnterRecord(Path, Record) error { return nil }
+
+// LeaveRecord does nothing.
+func (BaseVisitor) LeaveRecord(Path, Record) error { return nil }
+
+// EnterMaybe does nothing.
+func (BaseVisitor) EnterMaybe(Path, Maybe) error { return nil }
+
+// LeaveMaybe does nothing.
+func (BaseVisitor) LeaveMaybe(Path, Maybe) error { return nil }
+
+// Walk visits a value, and every value nested inside of it, in depth-first
+// order. Elements of lists and fields of records are visited in order, and the
+// value of a maybe is visited if it is present. Signatures are visited as
+// Bytes65. An error is returned if a value is not a bytes, scalar, list, record
+// or maybe value.
+func Walk(v Value, visitor Visitor) error {
+	return walk(nil, v, visitor)
+}
+
+// walk visits a value at the given Path.
+func walk(path Path, v Value, visitor Visitor) error {
+	switch v := v.(type) {
+	case String:
+		return visitor.VisitString(path, v)
+	case Bytes:
+		return visitor.VisitBytes(path, v)
+	case Bytes32:
+		return visitor.VisitBytes32(path, v)
+	case Bytes65:
+		return visitor.VisitBytes65(path, v)
+	case Signature:
+		return visitor.VisitBytes65(path, v.Bytes65)
+	case Bool:
+		return visitor.VisitBool(path, v)
+	case U8:
+		return visitor.VisitU8(path, v)
+	case U16:
+		return visitor.VisitU16(path, v)
+	case U32:
+		return visitor.VisitU32(path, v)
+	case U64:
+		return visitor.VisitU64(path, v)
+	case U128:
+		return visitor.VisitU128(path, v)
+	case U256:
+		return visitor.VisitU256(path, v)
+	case List:
+		if err := visitor.EnterList(path, v); err != nil {
+			if err != SkipChildren {
+				return err
+			}
+			return visitor.LeaveList(path, v)
+		}
+		for i, elem := range v.Elems {
+			if err := walk(path.append(IndexSegment(i)), elem, visitor); err != nil {
+				return err
+			}
+		}
+		return visitor.LeaveList(path, v)
+	case Record:
+		if len(v.Values) != len(v.Fields) {
+			return fmt.Errorf("expected %v to have len=%v, got len=%v", path, len(v.Fields), len(v.Values))
+		}
+		if err := visitor.EnterRecord(path, v); err != nil {
+			if err != SkipChildren {
+				return err
+			}
+			return visitor.LeaveRecord(path, v)
+		}
+		for i, field := range v.Fields {
+			if err := walk(path.append(FieldSegment(field.Name)), v.Values[i], visitor); err != nil {
+				return err
+			}
+		}
+		return visitor.LeaveRecord(path, v)
+	case Maybe:
+		if err := visitor.EnterMaybe(path, v); err != nil {
+			if err != SkipChildren {
+				return err
+			}
+			return visitor.LeaveMaybe(path, v)
+		}
+		if v.Value != nil {
+			if err := walk(path, v.Value, visitor); err != nil {
+				return err
+			}
+		}
+		return visitor.LeaveMaybe(path, v)
+	default:
+		return fmt.Errorf("non-exhaustive pattern: %v has type %T", path, v)
+	}
+}
+
+// A Transformer rewrites a value at a Path. It returns the value that replaces
+// it, which can be the same value.
+type Transformer func(path Path, v Value) (Value, error)
+
+// Transform rewrites a value, and every value nested inside of it, and returns
+// the new value. Values are rewritten bottom-up: the elements of a list, or the
+// fields of a record, are rewritten before the list or record itself, which is
+// given to the Transformer with its rewritten children. Transform never
+// modifies the original value.
+//
+// A Transformer must not change the TypeDesc of an element of a list or the
+// value of a maybe, and must not change the Type of a field of a record. An
+// error is returned if it does, or if it returns an error.
+func Transform(v Value, f Transformer) (Value, error) {
+	return transform(nil, v, f)
+}
+
+// transform rewrites a value at the given Path.
+func transform(path Path, v Value, f Transformer) (Value, error) {
+	switch v := v.(type) {
+	case List:
+		elems := make([]Value, len(v.Elems))
+		for i, elem := range v.Elems {
+			elemPath := path.append(IndexSegment(i))
+			rewritten, err := transform(elemPath, elem, f)
+			if err != nil {
+				return nil, err
+			}
+			if rewritten == nil || !DescOf(rewritten).Equal(v.Elem) {
+				return nil, fmt.Errorf("expected %v to have type %v, got %v", elemPath, v.Elem, typeOf(rewritten))
+			}
+			elems[i] = rewritten
+		}
+		return f(path, List{Elem: v.Elem, Elems: elems})
+	case Record:
+		if len(v.Values) != len(v.Fields) {
+			return nil, fmt.Errorf("expected %v to have len=%v, got len=%v", path, len(v.Fields), len(v.Values))
+		}
+		values := make([]Value, len(v.Values))
+		for i, field := range v.Fields {
+			fieldPath := path.append(FieldSegment(field.Name))
+			rewritten, err := transform(fieldPath, v.Values[i], f)
+			if err != nil {
+				return nil, err
+			}
+			if rewritten == nil || rewritten.Type() != field.Type {
+				return nil, fmt.Errorf("expected %v to have type %v, got %v", fieldPath, field.Type, typeOf(rewritten))
+			}
+			values[i] = rewritten
+		}
+		fields := append(make([]RecordField, 0, len(v.Fields)), v.Fields...)
+		return f(path, Record{Fields: fields, Values: values})
+	case Maybe:
+		if v.Value == nil {
+			return f(path, v)
+		}
+		rewritten, err := transform(path, v.Value, f)
+		if err != nil {
+			return nil, err
+		}
+		if rewritten == nil || !DescOf(rewritten).Equal(v.Elem) {
+			return nil, fmt.Errorf("expected %v to have type %v, got %v", path, v.Elem, typeOf(rewritten))
+		}
+		return f(path, Maybe{Elem: v.Elem, Value: rewritten})
+	default:
+		return f(path, v)
+	}
+}
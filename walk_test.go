@@ -0,0 +1,276 @@
+package abi_test
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/renproject/abi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// A recordingVisitor records the Path and kind of every callback.
+type recordingVisitor struct {
+	abi.BaseVisitor
+	calls []string
+}
+
+func (visitor *recordingVisitor) record(kind string, path abi.Path) error {
+	visitor.calls = append(visitor.calls, kind+" "+path.String())
+	return nil
+}
+
+func (visitor *recordingVisitor) VisitString(path abi.Path, v abi.String) error {
+	return visitor.record("str", path)
+}
+
+func (visitor *recordingVisitor) VisitBytes32(path abi.Path, v abi.Bytes32) error {
+	return visitor.record("b32", path)
+}
+
+func (visitor *recordingVisitor) VisitU256(path abi.Path, v abi.U256) error {
+	return visitor.record("u256", path)
+}
+
+func (visitor *recordingVisitor) EnterList(path abi.Path, v abi.List) error {
+	return visitor.record("enter list", path)
+}
+
+func (visitor *recordingVisitor) LeaveList(path abi.Path, v abi.List) error {
+	return visitor.record("leave list", path)
+}
+
+func (visitor *recordingVisitor) EnterRecord(path abi.Path, v abi.Record) error {
+	return visitor.record("enter record", path)
+}
+
+func (visitor *recordingVisitor) LeaveRecord(path abi.Path, v abi.Record) error {
+	return visitor.record("leave record", path)
+}
+
+func (visitor *recordingVisitor) EnterMaybe(path abi.Path, v abi.Maybe) error {
+	return visitor.record("enter maybe", path)
+}
+
+func (visitor *recordingVisitor) LeaveMaybe(path abi.Path, v abi.Maybe) error {
+	return visitor.record("leave maybe", path)
+}
+
+// A sumVisitor sums every U256, and collects every Bytes32.
+type sumVisitor struct {
+	abi.BaseVisitor
+	sum    *big.Int
+	hashes []abi.Bytes32
+}
+
+func (visitor *sumVisitor) VisitU256(path abi.Path, v abi.U256) error {
+	visitor.sum.Add(visitor.sum, v.Int())
+	return nil
+}
+
+func (visitor *sumVisitor) VisitBytes32(path abi.Path, v abi.Bytes32) error {
+	visitor.hashes = append(visitor.hashes, v)
+	return nil
+}
+
+// A skipVisitor skips the children of every list.
+type skipVisitor struct {
+	recordingVisitor
+}
+
+func (visitor *skipVisitor) EnterList(path abi.Path, v abi.List) error {
+	visitor.record("enter list", path)
+	return abi.SkipChildren
+}
+
+var _ = Describe("Walking values", func() {
+	outputFields := []abi.RecordField{
+		{Name: "hash", Type: abi.TypeBytes32},
+		{Name: "amount", Type: abi.TypeU256},
+	}
+	output := func(hash byte, amount int64) abi.Value {
+		record, err := abi.NewRecord(outputFields, abi.Bytes32{hash}, abi.NewU256FromInt(big.NewInt(amount)))
+		Expect(err).ToNot(HaveOccurred())
+		return record
+	}
+	message := func() abi.Record {
+		outputs, err := abi.NewList(abi.DescOf(output(0, 0)), output(1, 10), output(2, 20), output(3, 30))
+		Expect(err).ToNot(HaveOccurred())
+		record, err := abi.NewRecord(
+			[]abi.RecordField{{Name: "memo", Type: abi.TypeString}, {Name: "outputs", Type: abi.TypeList}},
+			abi.String("secret"), outputs,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		return record
+	}
+
+	Context("when formatting paths", func() {
+		It("should use jq-style syntax", func() {
+			path := abi.Path{abi.FieldSegment("outputs"), abi.IndexSegment(2), abi.FieldSegment("amount")}
+			Expect(path.String()).To(Equal(".outputs[2].amount"))
+			Expect(abi.Path{}.String()).To(Equal("."))
+			Expect(abi.Path{abi.IndexSegment(0)}.String()).To(Equal("[0]"))
+		})
+	})
+
+	Context("when walking a value", func() {
+		It("should visit every value in depth-first order with its path", func() {
+			visitor := new(recordingVisitor)
+			Expect(abi.Walk(message(), visitor)).To(Succeed())
+			Expect(visitor.calls).To(Equal([]string{
+				"enter record .",
+				"str .memo",
+				"enter list .outputs",
+				"enter record .outputs[0]",
+				"b32 .outputs[0].hash",
+				"u256 .outputs[0].amount",
+				"leave record .outputs[0]",
+				"enter record .outputs[1]",
+				"b32 .outputs[1].hash",
+				"u256 .outputs[1].amount",
+				"leave record .outputs[1]",
+				"enter record .outputs[2]",
+				"b32 .outputs[2].hash",
+				"u256 .outputs[2].amount",
+				"leave record .outputs[2]",
+				"leave list .outputs",
+				"leave record .",
+			}))
+		})
+
+		It("should visit the values of maybes with the path of the maybe", func() {
+			v, err := abi.NewRecord(
+				[]abi.RecordField{{Name: "memo", Type: abi.TypeMaybe}, {Name: "refund", Type: abi.TypeMaybe}},
+				abi.NewSome(abi.String("memo")), abi.NewNone(abi.NewTypeDesc(abi.TypeBytes32)),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			visitor := &recordingVisitor{}
+			Expect(abi.Walk(v, visitor)).To(Succeed())
+			Expect(visitor.calls).To(Equal([]string{
+				"enter record .",
+				"enter maybe .memo",
+				"str .memo",
+				"leave maybe .memo",
+				"enter maybe .refund",
+				"leave maybe .refund",
+				"leave record .",
+			}))
+		})
+
+		It("should sum amounts and collect hashes", func() {
+			visitor := &sumVisitor{sum: new(big.Int)}
+			Expect(abi.Walk(message(), visitor)).To(Succeed())
+			Expect(visitor.sum).To(Equal(big.NewInt(60)))
+			Expect(visitor.hashes).To(Equal([]abi.Bytes32{{1}, {2}, {3}}))
+		})
+
+		It("should skip children", func() {
+			visitor := new(skipVisitor)
+			Expect(abi.Walk(message(), visitor)).To(Succeed())
+			Expect(visitor.calls).To(Equal([]string{
+				"enter record .",
+				"str .memo",
+				"enter list .outputs",
+				"leave list .outputs",
+				"leave record .",
+			}))
+		})
+
+		It("should stop at the first error", func() {
+			err := fmt.Errorf("stop")
+			visitor := &errorVisitor{err: err}
+			Expect(abi.Walk(message(), visitor)).To(Equal(err))
+			Expect(visitor.n).To(Equal(1))
+		})
+
+		It("should visit scalars at the root", func() {
+			visitor := new(recordingVisitor)
+			Expect(abi.Walk(abi.String("root"), visitor)).To(Succeed())
+			Expect(visitor.calls).To(Equal([]string{"str ."}))
+		})
+	})
+
+	Context("when transforming a value", func() {
+		It("should rewrite values bottom-up without modifying the original", func() {
+			original := message()
+			paths := []string{}
+			redacted, err := abi.Transform(original, func(path abi.Path, v abi.Value) (abi.Value, error) {
+				paths = append(paths, path.String())
+				if _, ok := v.(abi.String); ok {
+					return abi.String("REDACTED"), nil
+				}
+				return v, nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths[len(paths)-1]).To(Equal("."))
+			Expect(paths).To(ContainElement(".outputs[1].amount"))
+
+			memo, _ := redacted.(abi.Record).Get("memo")
+			Expect(memo).To(Equal(abi.String("REDACTED")))
+			memo, _ = original.Get("memo")
+			Expect(memo).To(Equal(abi.String("secret")))
+		})
+
+		It("should give lists and records their rewritten children", func() {
+			doubled, err := abi.Transform(message(), func(path abi.Path, v abi.Value) (abi.Value, error) {
+				if u256, ok := v.(abi.U256); ok {
+					return abi.NewU256FromInt(new(big.Int).Mul(u256.Int(), big.NewInt(2))), nil
+				}
+				return v, nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			visitor := &sumVisitor{sum: new(big.Int)}
+			Expect(abi.Walk(doubled, visitor)).To(Succeed())
+			Expect(visitor.sum).To(Equal(big.NewInt(120)))
+		})
+
+		It("should return an error if a type is changed", func() {
+			_, err := abi.Transform(message(), func(path abi.Path, v abi.Value) (abi.Value, error) {
+				if _, ok := v.(abi.U256); ok {
+					return abi.NewU64(0), nil
+				}
+				return v, nil
+			})
+			Expect(err).To(MatchError(ContainSubstring(".outputs[0].amount")))
+		})
+
+		It("should return an error if the shape of an element is changed", func() {
+			inner, err := abi.NewList(abi.NewTypeDesc(abi.TypeU8), abi.NewU8(1))
+			Expect(err).ToNot(HaveOccurred())
+			v, err := abi.NewList(abi.NewMaybeDesc(abi.DescOf(inner)), abi.NewSome(inner), abi.NewNone(abi.DescOf(inner)))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = abi.Transform(v, func(path abi.Path, v abi.Value) (abi.Value, error) {
+				if _, ok := v.(abi.List); ok && path.String() == "[0]" {
+					return abi.List{Elem: abi.NewTypeDesc(abi.TypeU16)}, nil
+				}
+				return v, nil
+			})
+			Expect(err).To(MatchError("expected [0] to have type list<u8>, got type list<u16>"))
+		})
+
+		It("should return errors from the transformer", func() {
+			_, err := abi.Transform(message(), func(path abi.Path, v abi.Value) (abi.Value, error) {
+				return nil, fmt.Errorf("failed at %v", path)
+			})
+			Expect(err).To(MatchError("failed at .memo"))
+		})
+	})
+})
+
+// An errorVisitor returns an error from the first callback.
+type errorVisitor struct {
+	abi.BaseVisitor
+	err error
+	n   int
+}
+
+func (visitor *errorVisitor) EnterRecord(path abi.Path, v abi.Record) error {
+	visitor.n++
+	return visitor.err
+}
+
+func (visitor *errorVisitor) VisitString(path abi.Path, v abi.String) error {
+	visitor.n++
+	return visitor.err
+}